@@ -1 +1,3 @@
 # Storj Cloud Client Python Modules
+
+__version__ = "0.1.0"
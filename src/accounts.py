@@ -0,0 +1,94 @@
+"""
+Dashboard accounts
+
+Maps groups of nodes to dashboard accounts, so one client can monitor nodes
+on behalf of several customers. A node belongs to the first account whose
+servers or tags match it; nodes matching none fall back to the default
+account of api.token.
+"""
+
+import fnmatch
+import ipaddress
+from dataclasses import dataclass, field
+from typing import Dict, List, Optional
+
+from .signing import PayloadSigner
+
+DEFAULT_ACCOUNT = 'default'
+
+# Docker label listing a node's tags, comma-separated
+TAGS_LABEL = 'storjcloud.tags'
+
+
+@dataclass
+class Account:
+    """One dashboard account and the nodes it owns"""
+    name: str
+    token: str
+    endpoint: str
+    servers: List[str] = field(default_factory=list)
+    tags: List[str] = field(default_factory=list)
+    signing_secret: Optional[str] = None
+
+    def signer(self) -> Optional[PayloadSigner]:
+        return PayloadSigner(self.signing_secret) if self.signing_secret else None
+
+    def _matches_server(self, address: str) -> bool:
+        for server in self.servers:
+            try:
+                if ipaddress.ip_address(address) in ipaddress.ip_network(server, strict=False):
+                    return True
+            except ValueError:
+                if fnmatch.fnmatch(address, server):
+                    return True
+        return False
+
+    def matches(self, node: Dict) -> bool:
+        # Nodes found by host name also match on the address it resolved to
+        if any(self._matches_server(address)
+               for address in {node.get('address', ''), node.get('resolved_address') or ''} if address):
+            return True
+        return bool(set(self.tags) & set(node.get('tags') or []))
+
+
+def load_accounts(config) -> List[Account]:
+    """Configured accounts, followed by the default account if api.token is set"""
+    accounts = [
+        Account(
+            name=entry['name'],
+            token=entry['token'],
+            endpoint=entry.get('endpoint') or config.api.endpoint,
+            servers=entry.get('servers') or [],
+            tags=entry.get('tags') or [],
+            signing_secret=entry.get('signing_secret'),
+        )
+        for entry in config.api.accounts
+    ]
+    if config.api.token:
+        accounts.append(Account(DEFAULT_ACCOUNT, config.api.token, config.api.endpoint,
+                                signing_secret=config.api.signing_secret))
+    return accounts
+
+
+def fallback_account(accounts: List[Account]) -> Optional[Account]:
+    """Account receiving nodes that match no other: the default, or one without matchers"""
+    for account in accounts:
+        if account.name == DEFAULT_ACCOUNT or not (account.servers or account.tags):
+            return account
+    return None
+
+
+def assign_nodes(nodes: List[Dict], accounts: List[Account]) -> Dict[str, List[Dict]]:
+    """Group discovered nodes by account name; unassignable nodes are under None"""
+    fallback = fallback_account(accounts)
+    groups: Dict[Optional[str], List[Dict]] = {}
+    for node in nodes:
+        account = next((a for a in accounts if (a.servers or a.tags) and a.matches(node)), fallback)
+        groups.setdefault(account.name if account else None, []).append(node)
+    return groups
+
+
+def parse_tags(labels: Optional[Dict]) -> List[str]:
+    """Tags from a container's labels"""
+    value = (labels or {}).get(TAGS_LABEL, '')
+    return [tag.strip() for tag in value.split(',') if tag.strip()]
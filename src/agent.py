@@ -0,0 +1,114 @@
+"""
+Dashboard agent connection
+
+Keeps a lightweight outbound WebSocket open to the dashboard and answers its
+on-demand collection requests, so the web UI's refresh button syncs a node
+immediately instead of waiting for the next interval. Only outbound
+connections are made, so nothing needs to be exposed on the node host.
+"""
+
+import asyncio
+import logging
+import random
+from typing import Dict
+
+import aiohttp
+
+from . import __version__
+from .dashboard import dashboard_session
+
+# Reconnect delays after a dropped connection, in seconds
+RECONNECT_MIN_DELAY = 5
+RECONNECT_MAX_DELAY = 300
+
+# Seconds between keepalive pings on an idle connection
+HEARTBEAT = 30
+
+
+def agent_url(dashboard_url: str) -> str:
+    """WebSocket URL of the dashboard's agent endpoint"""
+    url = dashboard_url.rstrip('/') + '/agent'
+    if url.startswith('https://'):
+        return 'wss://' + url[len('https://'):]
+    if url.startswith('http://'):
+        return 'ws://' + url[len('http://'):]
+    return url
+
+
+class AgentConnection:
+    """Serves dashboard collection requests for one sync service
+
+    Messages are JSON objects. The dashboard sends {"type": "collect",
+    "id": ..., "nodeId": ...} to sync one node, or without nodeId to start
+    a full cycle now; the agent answers with {"type": "result", "id": ...,
+    "success": ...} once the data has been uploaded.
+    """
+
+    def __init__(self, sync, logger=None):
+        self.sync = sync
+        self.logger = logger or logging.getLogger(__name__)
+        self.url = agent_url(sync.dashboard_url)
+        self.connected = False
+        self.requests = 0
+        self.tasks = set()
+
+    async def run(self):
+        """Stay connected until cancelled, reconnecting with backoff"""
+        delay = RECONNECT_MIN_DELAY
+        while True:
+            try:
+                await self._session()
+                delay = RECONNECT_MIN_DELAY
+            except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+                self.logger.warning("Agent connection to %s failed: %s", self.url, e)
+            self.connected = False
+            await asyncio.sleep(delay * random.uniform(0.5, 1.0))
+            delay = min(delay * 2, RECONNECT_MAX_DELAY)
+
+    async def _session(self):
+        headers = {'Authorization': f'Bearer {self.sync.api_token}'}
+        async with dashboard_session(headers=headers) as session:
+            async with session.ws_connect(self.url, heartbeat=HEARTBEAT) as ws:
+                self.connected = True
+                self.logger.info("Agent connected to %s", self.url)
+                await ws.send_json({'type': 'hello', 'version': __version__,
+                                    'account': self.sync.account, 'nodes': len(self.sync.known_nodes)})
+                async for message in ws:
+                    if message.type == aiohttp.WSMsgType.TEXT:
+                        try:
+                            request = message.json()
+                        except ValueError:
+                            self.logger.debug("Ignoring malformed agent message: %.200s", message.data)
+                            continue
+                        # Requests are served concurrently so a slow node does not block others
+                        task = asyncio.create_task(self._handle(ws, request))
+                        self.tasks.add(task)
+                        task.add_done_callback(self.tasks.discard)
+                    elif message.type in (aiohttp.WSMsgType.CLOSED, aiohttp.WSMsgType.ERROR):
+                        break
+                self.logger.info("Agent disconnected from %s", self.url)
+
+    async def _handle(self, ws, request: Dict):
+        kind = request.get('type')
+        if kind == 'ping':
+            await ws.send_json({'type': 'pong', 'id': request.get('id')})
+            return
+        if kind != 'collect':
+            self.logger.debug("Ignoring unknown agent request type %r", kind)
+            return
+
+        self.requests += 1
+        node_id = request.get('nodeId')
+        response = {'type': 'result', 'id': request.get('id'), 'nodeId': node_id}
+        if not node_id:
+            self.logger.info("Dashboard requested a sync cycle")
+            self.sync.sync_now()
+            response['success'] = True
+        else:
+            self.logger.info("Dashboard requested a refresh of node %s", node_id[:8])
+            success = await self.sync.collect_now(node_id)
+            response['success'] = bool(success)
+            if success is None:
+                response['error'] = 'unknown node'
+        if not ws.closed:
+            await ws.send_json(response)
@@ -0,0 +1,163 @@
+"""
+Upload aggregator
+
+Receives the uploads of agents (sync daemons next to the nodes, with
+api.endpoint pointing here) over mutual TLS and forwards them to the
+dashboard, so a site with strict egress rules needs only one machine that
+talks to the internet. Uploads are acknowledged once they are in the
+aggregator's outbox, and retried from there until the dashboard accepts them.
+Retried uploads (same idempotency key) and the same node reported by two
+agents within the dedupe window are forwarded once. All other API requests,
+such as node listing and registration, are relayed as they are, with the
+aggregator's own token and, for writes, its own request signature.
+"""
+
+import asyncio
+import json
+import logging
+import time
+from collections import OrderedDict
+from typing import Dict, Optional, Tuple
+
+from aiohttp import web
+
+from .compat import CLIENT_VERSION_HEADER, MIN_VERSION_HEADER, min_version
+from .dashboard import MUTATING_METHODS, dashboard_session, read_only
+from .mtls import peer_name
+from .outbox import IDEMPOTENCY_HEADER
+from .sinks import DashboardSink
+
+# Idempotency keys remembered to drop retried uploads
+SEEN_KEYS_SIZE = 100000
+
+# Seconds between attempts to deliver the outbox while no uploads arrive
+FLUSH_INTERVAL = 30
+
+# Request headers relayed to the dashboard; the agent's token is replaced
+RELAYED_HEADERS = ('Content-Type', 'Accept', IDEMPOTENCY_HEADER, CLIENT_VERSION_HEADER)
+
+
+class Aggregator:
+    """mTLS endpoint for agents in front of the dashboard API"""
+
+    def __init__(self, upstream: DashboardSink, dedupe_window: float = 60, logger=None):
+        self.upstream = upstream
+        self.dedupe_window = dedupe_window
+        self.logger = logger or logging.getLogger(__name__)
+        self.seen: OrderedDict = OrderedDict()
+        # Node ID -> (agent, time) of the last forwarded upload
+        self.reports: Dict[str, Tuple[Optional[str], float]] = {}
+        self.agents: Dict[str, float] = {}
+        self.stats = {'received': 0, 'duplicates': 0, 'relayed': 0}
+        self.runner = None
+        self.flusher = None
+
+    def application(self) -> web.Application:
+        app = web.Application()
+        app.router.add_get('/aggregator/state', self.state)
+        app.router.add_patch('/storj/nodes/{node_id}', self.receive)
+        app.router.add_route('*', '/{path:.*}', self.relay)
+        return app
+
+    async def start(self, host: str, port: int, ssl_context):
+        await self.upstream.open()
+        self.runner = web.AppRunner(self.application())
+        await self.runner.setup()
+        await web.TCPSite(self.runner, host, port, ssl_context=ssl_context).start()
+        self.flusher = asyncio.create_task(self._flush_loop())
+        self.logger.info("Aggregator listening on https://%s:%d, forwarding to %s",
+                         host, port, self.upstream.dashboard_url)
+
+    async def stop(self):
+        if self.flusher:
+            self.flusher.cancel()
+        if self.runner:
+            await self.runner.cleanup()
+        await self.upstream.close()
+
+    async def _flush_loop(self):
+        while True:
+            await asyncio.sleep(FLUSH_INTERVAL)
+            try:
+                await self.upstream.flush()
+            except Exception as e:
+                self.logger.error("Failed to deliver buffered uploads: %s", e)
+
+    def _agent(self, request) -> str:
+        agent = peer_name(request) or request.remote or 'unknown'
+        if agent not in self.agents:
+            self.logger.info("Agent %s connected", agent)
+        self.agents[agent] = time.time()
+        return agent
+
+    def _duplicate(self, key: Optional[str], node_id: str, agent: str) -> bool:
+        if key and key in self.seen:
+            return True
+        last = self.reports.get(node_id)
+        # A node polled by two agents, e.g. overlapping inventories
+        return bool(last and last[0] != agent and time.time() - last[1] < self.dedupe_window)
+
+    async def receive(self, request):
+        agent = self._agent(request)
+        node_id = request.match_info['node_id']
+        key = request.headers.get(IDEMPOTENCY_HEADER)
+        self.stats['received'] += 1
+        if self._duplicate(key, node_id, agent):
+            self.stats['duplicates'] += 1
+            return web.Response(status=204)
+        try:
+            payload = await request.json()
+        except ValueError:
+            return web.json_response({'error': 'invalid JSON'}, status=400)
+
+        if key:
+            self.seen[key] = True
+            while len(self.seen) > SEEN_KEYS_SIZE:
+                self.seen.popitem(last=False)
+        self.reports[node_id] = (agent, time.time())
+        # Queued in the outbox first, so the agent can drop it either way
+        delivered = await self.upstream.write({'id': node_id}, payload)
+        if not delivered:
+            self.logger.debug("Upload of node %s from %s buffered", node_id[:8], agent)
+        # Agents learn the client version the dashboard requires, as from the dashboard itself
+        return web.Response(status=204, headers={MIN_VERSION_HEADER: min_version()} if min_version() else None)
+
+    async def relay(self, request):
+        agent = self._agent(request)
+        if request.path == '/agent':
+            # On-demand collection needs a WebSocket to the dashboard per agent
+            return web.json_response({'error': 'not available through the aggregator'}, status=404)
+        if read_only() and request.method in MUTATING_METHODS:
+            return web.json_response({'error': 'the aggregator is in read-only mode'}, status=403)
+        url = f"{self.upstream.dashboard_url}/{request.match_info['path']}"
+        if request.query_string:
+            url += f"?{request.query_string}"
+        headers = {name: request.headers[name] for name in RELAYED_HEADERS if name in request.headers}
+        headers['Authorization'] = f'Bearer {self.upstream.api_token}'
+        body = await request.read()
+        if self.upstream.signer and request.method in MUTATING_METHODS:
+            # Agents sign for the aggregator, if at all; the dashboard checks the upstream's signature
+            headers.update(self.upstream.signer.sign(request.method, url, body))
+        self.stats['relayed'] += 1
+        try:
+            async with dashboard_session() as session:
+                async with session.request(request.method, url, data=body or None,
+                                           headers=headers) as response:
+                    content = await response.read()
+                    self.logger.debug("Relayed %s %s for %s: HTTP %d", request.method, request.path,
+                                      agent, response.status)
+                    relayed = {MIN_VERSION_HEADER: response.headers[MIN_VERSION_HEADER]} \
+                        if MIN_VERSION_HEADER in response.headers else None
+                    return web.Response(status=response.status, body=content,
+                                        content_type=response.content_type, headers=relayed)
+        except Exception as e:
+            self.logger.error("Failed to relay %s %s: %s", request.method, request.path, e)
+            return web.json_response({'error': 'dashboard unreachable'}, status=502)
+
+    async def state(self, request):
+        now = time.time()
+        return web.json_response({
+            **self.stats,
+            'agents': {agent: round(now - seen) for agent, seen in self.agents.items()},
+            'outbox': self.upstream.stats(),
+        }, dumps=lambda data: json.dumps(data, default=str))
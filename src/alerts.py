@@ -0,0 +1,123 @@
+"""
+Alert notifications
+
+Detects critical node conditions and delivers alerts to the configured
+notification channels as soon as they are observed, noting network events
+that may explain them.
+"""
+
+import logging
+import time
+from dataclasses import dataclass, field
+from datetime import datetime
+from typing import Dict, List, Optional
+
+import aiohttp
+
+
+@dataclass
+class Alert:
+    """A single alert about a node"""
+    node_id: str
+    kind: str
+    title: str
+    message: str
+    severity: str = 'critical'
+    node_name: Optional[str] = None
+    details: Dict = field(default_factory=dict)
+    timestamp: str = field(default_factory=lambda: datetime.utcnow().isoformat())
+
+    def to_dict(self) -> Dict:
+        return {
+            'nodeId': self.node_id,
+            'nodeName': self.node_name,
+            'kind': self.kind,
+            'severity': self.severity,
+            'title': self.title,
+            'message': self.message,
+            'details': self.details,
+            'timestamp': self.timestamp,
+        }
+
+
+def find_critical_satellites(node_data: Dict) -> List[Dict]:
+    """Return satellites on which the node is suspended or disqualified"""
+    critical = []
+    for satellite in node_data.get('satellites', []) or []:
+        for state in ('disqualified', 'suspended'):
+            if satellite.get(state):
+                critical.append({
+                    'id': satellite.get('id'),
+                    'url': satellite.get('url'),
+                    'state': state,
+                    'since': satellite.get(state),
+                })
+                break
+    return critical
+
+
+class AlertManager:
+    """Delivers alerts to log and webhook channels"""
+
+    def __init__(self, webhook_url: Optional[str] = None, enabled: bool = True,
+                 timeout: int = 10, logger=None, network_status=None):
+        self.webhook_url = webhook_url
+        # NetworkStatus annotating alerts with satellite incidents and maintenance
+        self.network_status = network_status
+        self.enabled = enabled
+        self.timeout = timeout
+        self.logger = logger or logging.getLogger(__name__)
+
+        # Keys of conditions already alerted on, so a persisting condition
+        # only notifies once until it clears
+        self.active = set()
+
+        # Node ID -> end of its maintenance window, during which it does not alert
+        self.silenced: Dict[str, float] = {}
+
+    def silence(self, node_id: str, until: float):
+        self.silenced[node_id] = until
+
+    def unsilence(self, node_id: str):
+        self.silenced.pop(node_id, None)
+
+    async def raise_alert(self, key: str, alert: Alert) -> bool:
+        """Notify about a condition unless it was already reported or the node is in maintenance"""
+        if key in self.active:
+            return False
+        if self.silenced.get(alert.node_id, 0) > time.time():
+            # Not marked active, so a condition outlasting the maintenance still alerts
+            self.logger.info("Suppressed alert for node in maintenance: [%s] %s", alert.kind, alert.title)
+            return False
+        self.active.add(key)
+        if self.network_status:
+            await self.network_status.annotate(alert)
+        await self.notify(alert)
+        return True
+
+    def clear(self, key_prefix: str, keep=()):
+        """Forget resolved conditions so they alert again if they recur"""
+        self.active = {key for key in self.active
+                       if not key.startswith(key_prefix) or key in keep}
+
+    async def notify(self, alert: Alert):
+        """Deliver an alert immediately to all channels"""
+        if not self.enabled:
+            return
+
+        log = self.logger.critical if alert.severity == 'critical' else self.logger.warning
+        log("ALERT [%s] %s: %s", alert.kind, alert.title, alert.message)
+
+        if self.webhook_url:
+            await self._send_webhook(alert)
+
+    async def _send_webhook(self, alert: Alert):
+        """POST the alert as JSON to the configured webhook"""
+        try:
+            timeout = aiohttp.ClientTimeout(total=self.timeout)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.post(self.webhook_url, json=alert.to_dict()) as response:
+                    if response.status >= 300:
+                        self.logger.error("Alert webhook returned HTTP %d", response.status)
+        except Exception as e:
+            self.logger.error("Failed to deliver alert webhook: %s", e)
@@ -0,0 +1,139 @@
+"""
+Local node annotations
+
+Nicknames, notes, custom metadata and maintenance windows attached to nodes
+on this client, kept in a local file rather than the dashboard. A nickname
+replaces the node's dashboard name in all CLI output, alerts and sink records,
+and annotations travel with every sync payload. A running daemon picks up
+changes made by other commands.
+"""
+
+import json
+import logging
+import os
+import time
+from pathlib import Path
+from typing import Dict, List, Optional
+
+# Longest nickname accepted, so it fits table columns
+MAX_NICKNAME_LENGTH = 64
+
+
+def parse_metadata(pairs: List[str]) -> Dict[str, str]:
+    """KEY=VALUE arguments as a dict; raises ValueError for malformed ones"""
+    metadata = {}
+    for pair in pairs:
+        key, sep, value = pair.partition('=')
+        if not sep or not key.strip():
+            raise ValueError(f"invalid metadata {pair!r} (use KEY=VALUE)")
+        metadata[key.strip()] = value
+    return metadata
+
+
+class NodeAnnotations:
+    """Nickname, notes, metadata and maintenance window per node ID, saved as JSON"""
+
+    def __init__(self, path: Path, logger=None):
+        self.path = Path(path)
+        self.logger = logger or logging.getLogger(__name__)
+        # node_id -> {'nickname', 'notes', 'metadata', 'maintenance'}
+        self.nodes: Dict[str, Dict] = {}
+        self.mtime: Optional[float] = None
+        self._load()
+
+    def _load(self):
+        try:
+            self.mtime = self.path.stat().st_mtime
+            self.nodes = json.loads(self.path.read_text()).get('nodes', {})
+        except FileNotFoundError:
+            self.mtime, self.nodes = None, {}
+        except (OSError, ValueError, AttributeError) as e:
+            self.logger.warning("Ignoring unreadable node annotations %s: %s", self.path, e)
+
+    def refresh(self):
+        """Reload the file if another process changed it"""
+        try:
+            mtime = self.path.stat().st_mtime
+        except OSError:
+            mtime = None
+        if mtime != self.mtime:
+            self._load()
+
+    def save(self):
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(json.dumps({'nodes': self.nodes}, indent=2))
+            os.chmod(tmp, 0o600)
+            os.replace(tmp, self.path)
+            self.mtime = self.path.stat().st_mtime
+        except OSError as e:
+            raise ValueError(f"cannot write {self.path}: {e}")
+
+    def get(self, node_id: str) -> Dict:
+        entry = self.nodes.get(node_id) or {}
+        return {
+            'nickname': entry.get('nickname'),
+            'notes': entry.get('notes'),
+            'metadata': dict(entry.get('metadata') or {}),
+            'maintenance': entry.get('maintenance'),
+        }
+
+    def maintenance(self, node_id: str) -> Optional[Dict]:
+        """The node's maintenance window if it is under maintenance now"""
+        window = (self.nodes.get(node_id) or {}).get('maintenance')
+        return window if window and window['until'] > time.time() else None
+
+    def start_maintenance(self, node_id: str, duration: float, reason: Optional[str] = None) -> Dict:
+        now = time.time()
+        window = {'since': now, 'until': now + duration, 'reason': reason}
+        self._update(node_id, maintenance=window)
+        return window
+
+    def end_maintenance(self, node_id: str) -> bool:
+        """End a node's maintenance early; False if it was not under maintenance"""
+        active = self.maintenance(node_id) is not None
+        self._update(node_id, maintenance=None)
+        return active
+
+    def rename(self, node_id: str, nickname: Optional[str]):
+        """Set a node's nickname; None or an empty name removes it"""
+        nickname = (nickname or '').strip() or None
+        if nickname and len(nickname) > MAX_NICKNAME_LENGTH:
+            raise ValueError(f"nickname longer than {MAX_NICKNAME_LENGTH} characters")
+        if nickname and any(other != node_id and entry.get('nickname') == nickname
+                            for other, entry in self.nodes.items()):
+            raise ValueError(f"nickname {nickname!r} is already in use")
+        self._update(node_id, nickname=nickname)
+
+    def annotate(self, node_id: str, notes: Optional[str] = None, metadata: Optional[Dict[str, str]] = None,
+                 remove: Optional[List[str]] = None):
+        """Replace a node's notes if given, and set or remove metadata keys"""
+        entry = self.get(node_id)
+        merged = {**entry['metadata'], **(metadata or {})}
+        for key in remove or []:
+            merged.pop(key, None)
+        self._update(node_id, notes=entry['notes'] if notes is None else (notes or None), metadata=merged)
+
+    def _update(self, node_id: str, **changes):
+        entry = {**self.get(node_id), **changes}
+        if entry['maintenance'] and entry['maintenance']['until'] <= time.time():
+            entry['maintenance'] = None
+        if entry['nickname'] or entry['notes'] or entry['metadata'] or entry['maintenance']:
+            self.nodes[node_id] = entry
+        else:
+            self.nodes.pop(node_id, None)
+        self.save()
+
+    def apply(self, node: Dict) -> Dict:
+        """A registered node with its annotations, named by its nickname if it has one"""
+        entry = self.nodes.get(node.get('nodeId'))
+        if not entry:
+            return node
+        annotated = {**node, 'notes': entry.get('notes'), 'metadata': entry.get('metadata') or {}}
+        maintenance = self.maintenance(node.get('nodeId'))
+        if maintenance:
+            annotated['maintenance'] = maintenance
+        if entry.get('nickname'):
+            annotated.update(name=entry['nickname'], nickname=entry['nickname'], dashboardName=node.get('name'))
+        return annotated
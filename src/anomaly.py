@@ -0,0 +1,80 @@
+"""
+Traffic anomaly detection
+
+Keeps a baseline of each node's daily ingress and egress and flags days on
+which traffic deviates sharply from it, such as egress dropping to near zero
+while the node is online.
+"""
+
+from datetime import datetime, timezone
+from statistics import median
+from typing import Dict, List, Optional, Tuple
+
+# Days of history the baseline is computed from
+BASELINE_DAYS = 7
+
+# Minimum days of history before anomalies are reported
+MIN_BASELINE_DAYS = 3
+
+# Traffic below this fraction, or above this multiple, of the baseline is anomalous
+LOW_RATIO = 0.2
+HIGH_RATIO = 5.0
+
+# Baselines below this many bytes per day are too small to judge
+MIN_BASELINE_BYTES = 1e9
+
+# The current day is judged only after this many hours of data
+MIN_DAY_HOURS = 4
+
+
+def daily_traffic(bandwidth_daily: Optional[List[Dict]]) -> Dict[str, Tuple[int, int]]:
+    """Per-day (ingress, egress) bytes from the node's daily bandwidth entries"""
+    days = {}
+    for entry in bandwidth_daily or []:
+        start = entry.get('intervalStart', '')[:10]
+        if not start:
+            continue
+        ingress = sum((entry.get('ingress') or {}).values())
+        egress = sum((entry.get('egress') or {}).values())
+        days[start] = (ingress, egress)
+    return days
+
+
+def detect_traffic_anomalies(history: Dict[str, Tuple[int, int]],
+                             now: Optional[datetime] = None) -> List[Dict]:
+    """Compare the latest day against the baseline of the days before it
+
+    The current, incomplete day is extrapolated to a full day once enough
+    of it has passed; before that the previous day is judged instead.
+    """
+    now = now or datetime.now(timezone.utc)
+    today = now.strftime('%Y-%m-%d')
+    hours = now.hour + now.minute / 60
+
+    days = sorted(day for day in history if day <= today)
+    if days and days[-1] == today and hours < MIN_DAY_HOURS:
+        days = days[:-1]
+    if len(days) < MIN_BASELINE_DAYS + 1:
+        return []
+
+    current_day = days[-1]
+    scale = 24 / hours if current_day == today else 1
+    baseline_days = days[-1 - BASELINE_DAYS:-1]
+
+    anomalies = []
+    for index, direction in ((0, 'ingress'), (1, 'egress')):
+        baseline = median(history[day][index] for day in baseline_days)
+        if baseline < MIN_BASELINE_BYTES:
+            continue
+        current = history[current_day][index] * scale
+        ratio = current / baseline
+        if ratio < LOW_RATIO or ratio > HIGH_RATIO:
+            anomalies.append({
+                'direction': direction,
+                'day': current_day,
+                'current': current,
+                'baseline': baseline,
+                'ratio': ratio,
+                'kind': 'drop' if ratio < LOW_RATIO else 'spike',
+            })
+    return anomalies
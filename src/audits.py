@@ -0,0 +1,87 @@
+"""
+Unknown audit trends
+
+Audits that end neither in success nor in a missing piece, such as a piece
+that cannot be read or an error while sending it, count as unknown and lower
+the satellite's suspension score; below 60% the satellite suspends the node.
+The node API reports the score per satellite but neither the unknown audits
+behind it nor containment (an audit the node timed out on, which the
+satellite keeps asking for and eventually fails, lowering the audit score).
+Unknown audits are therefore followed through the stored history of the
+suspension score, and a score falling towards 60% is reported days before it
+gets there. Containment is not tracked: the audit score's trend is computed
+and synced, but not alerted on.
+"""
+
+import time
+from collections import defaultdict
+from typing import Dict, List, Optional
+
+from .store import HistoryStore
+
+# Suspension score below which a satellite suspends the node
+SUSPENSION_THRESHOLD = 0.6
+
+# History used for the trend
+TREND_WINDOW = 7 * 86400
+
+# Minimum time span of history before a trend is computed
+MIN_TREND_SPAN = 6 * 3600
+
+# Drop of the suspension score within the window that counts as falling, below it is noise
+MIN_DROP = 0.005
+
+
+def _slope(points: List[tuple]) -> Optional[float]:
+    """Least-squares change per second of (ts, value) points"""
+    points = [(t, v) for t, v in points if v is not None]
+    if len(points) < 2 or points[-1][0] - points[0][0] < MIN_TREND_SPAN:
+        return None
+    n = len(points)
+    mean_t = sum(t for t, _ in points) / n
+    mean_v = sum(v for _, v in points) / n
+    variance = sum((t - mean_t) ** 2 for t, _ in points)
+    if not variance:
+        return None
+    return sum((t - mean_t) * (v - mean_v) for t, v in points) / variance
+
+
+def audit_trends(rows: List[Dict]) -> List[Dict]:
+    """Score trends per satellite from stored satellite scores, oldest first
+
+    Changes are per day and None while there is too little history;
+    days_to_suspension is set only while the suspension score is falling.
+    """
+    by_satellite = defaultdict(list)
+    for row in rows:
+        by_satellite[row['satellite_id']].append(row)
+
+    trends = []
+    for satellite_id, history in by_satellite.items():
+        latest = history[-1]
+        suspension_slope = _slope([(row['ts'], row['suspension_score']) for row in history])
+        audit_slope = _slope([(row['ts'], row['audit_score']) for row in history])
+        suspension = latest['suspension_score']
+        scores = [row['suspension_score'] for row in history if row['suspension_score'] is not None]
+        falling = (suspension_slope is not None and suspension_slope < 0 and
+                   max(scores) - scores[-1] >= MIN_DROP)
+        days_left = None
+        if falling and suspension is not None and suspension > SUSPENSION_THRESHOLD:
+            days_left = (suspension - SUSPENSION_THRESHOLD) / -suspension_slope / 86400
+        trends.append({
+            'satellite_id': satellite_id,
+            'satellite': latest['satellite'],
+            'audit_score': latest['audit_score'],
+            'suspension_score': suspension,
+            'suspension_per_day': suspension_slope * 86400 if suspension_slope is not None else None,
+            'audit_per_day': audit_slope * 86400 if audit_slope is not None else None,
+            'falling': falling,
+            'days_to_suspension': days_left,
+        })
+    return sorted(trends, key=lambda trend: trend['satellite'] or trend['satellite_id'])
+
+
+def node_audit_trends(store: HistoryStore, node_id: str, now: Optional[float] = None) -> List[Dict]:
+    """Score trends per satellite for a node from the local history store"""
+    now = now or time.time()
+    return audit_trends(store.satellite_scores(node_id, now - TREND_WINDOW, now + 1))
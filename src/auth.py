@@ -4,17 +4,34 @@ Authentication manager
 Handles API token validation and node registration with the dashboard.
 """
 
+import asyncio
 import logging
-from typing import Dict, List, Optional
+from typing import Callable, Dict, List, Optional
 
 import aiohttp
 
+from .annotations import NodeAnnotations
+from .dashboard import dashboard_session
+from .errors import AuthError, NetworkError, classified, http_error
+from .fields import FieldFilter
+from .pseudonym import Pseudonymizer
+from .registration import FAILED, REGISTERED, REGISTRATION_CHUNK_SIZE, UPDATED, registration_result
+from .signing import PayloadSigner, encode_body
+
 
 class AuthManager:
     """Manages authentication with Storj Cloud dashboard"""
     
-    def __init__(self, api_token: str, dashboard_url: str, logger=None):
+    def __init__(self, api_token: str, dashboard_url: str, logger=None,
+                 signer: Optional[PayloadSigner] = None, fields: Optional[FieldFilter] = None,
+                 pseudonyms: Optional[Pseudonymizer] = None, server_address: Optional[str] = None,
+                 annotations: Optional[NodeAnnotations] = None):
         self.api_token = api_token
+        self.server_address = server_address
+        self.signer = signer
+        self.fields = fields
+        self.pseudonyms = pseudonyms
+        self.annotations = annotations
         self.dashboard_url = dashboard_url.rstrip('/')
         self.logger = logger or logging.getLogger(__name__)
     
@@ -24,47 +41,171 @@ class AuthManager:
         headers = {'Authorization': f'Bearer {self.api_token}'}
         
         try:
-            async with aiohttp.ClientSession() as session:
+            async with dashboard_session() as session:
                 async with session.get(url, headers=headers) as response:
                     if response.status == 200:
                         user_data = await response.json()
                         self.logger.info("Token valid for user: %s", user_data.get('email', 'Unknown'))
                         return user_data
-                    elif response.status == 401:
+                    elif response.status in (401, 403):
                         self.logger.error("Invalid API token")
                     else:
-                        self.logger.error("Token validation failed: HTTP %d", response.status)
-        except Exception as e:
-            self.logger.error("Token validation error: %s", e)
+                        # Not an answer about the token, such as a rate limit or an outage
+                        raise http_error(response.status, "Failed to validate token", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
         
         return None
     
-    async def register_nodes(self, nodes: List[Dict]) -> int:
-        """Register discovered nodes with the dashboard"""
-        if not nodes:
-            return 0
+    async def get_quota(self) -> Optional[Dict]:
+        """Account limits and usage; None if the dashboard does not report them"""
+        url = f"{self.dashboard_url}/account/quota"
+        headers = {'Authorization': f'Bearer {self.api_token}'}
         
-        registered_count = 0
+        try:
+            async with dashboard_session() as session:
+                async with session.get(url, headers=headers) as response:
+                    if response.status == 200:
+                        return await response.json()
+                    if response.status == 404:
+                        return None
+                    raise http_error(response.status, "Failed to get account quota", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
+    
+    async def create_token(self, name: str) -> Dict:
+        """Issue a new API token for the same account"""
+        url = f"{self.dashboard_url}/auth/tokens"
+        headers = {'Authorization': f'Bearer {self.api_token}'}
         
-        async with aiohttp.ClientSession() as session:
-            for node in nodes:
-                if await self._register_single_node(session, node):
-                    registered_count += 1
+        try:
+            async with dashboard_session() as session:
+                async with session.post(url, json={'name': name}, headers=headers) as response:
+                    if response.status in [200, 201]:
+                        data = await response.json()
+                        if not data.get('token'):
+                            raise NetworkError("Dashboard did not return a token")
+                        return data
+                    raise http_error(response.status, "Failed to create token", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
+    
+    async def revoke_token(self) -> bool:
+        """Revoke the token this manager authenticates with; False if it was already invalid"""
+        url = f"{self.dashboard_url}/auth/tokens/current"
+        headers = {'Authorization': f'Bearer {self.api_token}'}
         
-        return registered_count
+        try:
+            async with dashboard_session() as session:
+                async with session.delete(url, headers=headers) as response:
+                    if response.status in [200, 204]:
+                        return True
+                    if response.status == 401:
+                        return False
+                    raise http_error(response.status, "Failed to revoke token", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
     
-    async def _register_single_node(self, session: aiohttp.ClientSession, node: Dict) -> bool:
+    async def list_nodes(self) -> List[Dict]:
+        """Get nodes registered with the dashboard"""
+        url = f"{self.dashboard_url}/storj/nodes"
+        headers = {'Authorization': f'Bearer {self.api_token}'}
+        
+        try:
+            async with dashboard_session() as session:
+                async with session.get(url, headers=headers) as response:
+                    if response.status == 200:
+                        data = await response.json()
+                        nodes = data.get('nodes', [])
+                        if self.pseudonyms:
+                            nodes = [self.pseudonyms.reveal(node) for node in nodes]
+                        if self.annotations:
+                            nodes = [self.annotations.apply(node) for node in nodes]
+                        return nodes
+                    raise http_error(response.status, "Failed to get registered nodes", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
+    
+    async def remove_node(self, node_id: str) -> bool:
+        """Remove a node from the dashboard; False if it was not registered"""
+        url = f"{self.dashboard_url}/storj/nodes/{self._public_id(node_id)}"
+        headers = {'Authorization': f'Bearer {self.api_token}'}
+        
+        try:
+            async with dashboard_session() as session:
+                async with session.delete(url, headers=headers) as response:
+                    if response.status in [200, 204]:
+                        self.logger.info("Removed node %s", node_id[:8])
+                        return True
+                    if response.status == 404:
+                        return False
+                    raise http_error(response.status, f"Failed to remove node {node_id[:8]}", response.headers)
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            raise NetworkError(f"Failed to reach dashboard: {e}")
+    
+    def _public_id(self, node_id: str) -> str:
+        """Node ID as the dashboard knows it"""
+        return self.pseudonyms.alias(node_id) if self.pseudonyms else node_id
+    
+    def _signed(self, method: str, url: str, payload: Dict, headers: Dict):
+        """Filtered JSON body and headers, with a signature if a signing secret is configured"""
+        body = encode_body(self.fields.apply(payload) if self.fields else payload)
+        headers = {**headers, 'Content-Type': 'application/json'}
+        if self.signer:
+            headers.update(self.signer.sign(method, url, body))
+        return body, headers
+    
+    async def register_nodes(self, nodes: List[Dict], on_chunk: Optional[Callable[[List[Dict]], None]] = None,
+                             chunk_size: int = REGISTRATION_CHUNK_SIZE) -> List[Dict]:
+        """Register discovered nodes with the dashboard, returning each node's result
+        
+        Nodes are registered in chunks, with on_chunk called after each one.
+        Raises the error of the first node once a whole chunk fails with a
+        NetworkError (unreachable, rate limited or failing with 5xx); the
+        nodes after it are not attempted.
+        """
+        results = []
+        
+        async with dashboard_session() as session:
+            for start in range(0, len(nodes), chunk_size):
+                chunk = nodes[start:start + chunk_size]
+                outcomes = await asyncio.gather(*(self._register_single_node(session, node) for node in chunk),
+                                                return_exceptions=True)
+                chunk_results = []
+                for node, outcome in zip(chunk, outcomes):
+                    if isinstance(outcome, AuthError):
+                        raise outcome
+                    if isinstance(outcome, NetworkError):
+                        outcome = registration_result(node, FAILED, str(outcome), outcome.kind)
+                    elif isinstance(outcome, BaseException):
+                        raise outcome
+                    chunk_results.append(outcome)
+                results.extend(chunk_results)
+                if on_chunk:
+                    on_chunk(chunk_results)
+                if all(isinstance(outcome, NetworkError) for outcome in outcomes):
+                    # Keeps the error's class, so callers can tell a rate limit from an outage
+                    error = outcomes[0]
+                    error.args = (f"Dashboard unavailable after {start} of {len(nodes)} nodes: {error}",)
+                    raise error
+        
+        return results
+    
+    async def _register_single_node(self, session: aiohttp.ClientSession, node: Dict) -> Dict:
         """Register a single node with the dashboard"""
         url = f"{self.dashboard_url}/storj/nodes"
         headers = {'Authorization': f'Bearer {self.api_token}'}
         
         # Prepare node data for registration
         node_data = {
-            'nodeId': node['node_id'],
+            'nodeId': self._public_id(node['node_id']),
             'name': node.get('name', f"Node-{node['dashboard_port']}"),
             'address': node['address'],
             'port': node.get('storage_port', 28967),
             'dashboardPort': node['dashboard_port'],
+            'externalAddress': node.get('external_address'),
+            'serverAddress': self.server_address,
+            'tags': node.get('tags', []),
             'version': node.get('version'),
             'status': node.get('status', 'UNKNOWN'),
             'allocatedSpace': node.get('disk_space', {}).get('total', 0),
@@ -73,51 +214,70 @@ class AuthManager:
             'bandwidthUsed': node.get('bandwidth', {}).get('used', 0),
             'uptime': node.get('uptime', 0),
             'lastSeen': node.get('last_contact'),
+            'critical': bool(node.get('critical_satellites')),
+            'criticalSatellites': node.get('critical_satellites', []),
             'config': {
                 'detectedFrom': node.get('detected_from'),
                 'containerId': node.get('container_id'),
                 'containerName': node.get('container_name'),
-                'image': node.get('image')
+                'image': node.get('image'),
+                'identityDir': node.get('identity_dir'),
+                'storageDir': node.get('storage_dir')
             }
         }
         
         try:
-            async with session.post(url, json=node_data, headers=headers) as response:
+            body, headers = self._signed('POST', url, node_data, headers)
+            async with session.post(url, data=body, headers=headers) as response:
                 if response.status in [200, 201]:
                     self.logger.info("Registered node %s (%s)", 
                                    node['node_id'][:8], node.get('name'))
-                    return True
+                    return registration_result(node, REGISTERED)
                 elif response.status == 409:
                     # Node already exists, try to update it
                     self.logger.info("Node %s already exists, updating...", node['node_id'][:8])
                     return await self._update_existing_node(session, node, node_data)
-                elif response.status == 401:
-                    self.logger.error("Authentication failed - check API token")
-                    return False
+                elif classified(response.status):
+                    raise http_error(response.status, f"Failed to register node {node['node_id'][:8]}",
+                                     response.headers)
                 else:
                     error_text = await response.text()
                     self.logger.error("Failed to register node %s: HTTP %d - %s", 
                                     node['node_id'][:8], response.status, error_text)
-                    return False
+                    return registration_result(node, FAILED, f"HTTP {response.status}: {error_text[:200]}", 'http')
+        except (AuthError, NetworkError):
+            raise
+        except (aiohttp.ClientConnectionError, asyncio.TimeoutError) as e:
+            self.logger.error("Failed to register node %s: %s", node['node_id'][:8], e)
+            raise NetworkError(str(e) or type(e).__name__)
         except Exception as e:
             self.logger.error("Failed to register node %s: %s", node['node_id'][:8], e)
-            return False
+            return registration_result(node, FAILED, str(e))
     
     async def _update_existing_node(self, session: aiohttp.ClientSession, 
-                                   node: Dict, node_data: Dict) -> bool:
+                                   node: Dict, node_data: Dict) -> Dict:
         """Update an existing node's information"""
-        url = f"{self.dashboard_url}/storj/nodes/{node['node_id']}"
+        url = f"{self.dashboard_url}/storj/nodes/{node_data['nodeId']}"
         headers = {'Authorization': f'Bearer {self.api_token}'}
         
         try:
-            async with session.patch(url, json=node_data, headers=headers) as response:
+            body, headers = self._signed('PATCH', url, node_data, headers)
+            async with session.patch(url, data=body, headers=headers) as response:
                 if response.status in [200, 204]:
                     self.logger.info("Updated node %s", node['node_id'][:8])
-                    return True
+                    return registration_result(node, UPDATED)
+                elif classified(response.status):
+                    raise http_error(response.status, f"Failed to update node {node['node_id'][:8]}",
+                                     response.headers)
                 else:
                     self.logger.error("Failed to update node %s: HTTP %d", 
                                     node['node_id'][:8], response.status)
-                    return False
+                    return registration_result(node, FAILED, f"update failed: HTTP {response.status}", 'http')
+        except (AuthError, NetworkError):
+            raise
+        except (aiohttp.ClientConnectionError, asyncio.TimeoutError) as e:
+            self.logger.error("Failed to update node %s: %s", node['node_id'][:8], e)
+            raise NetworkError(str(e) or type(e).__name__)
         except Exception as e:
             self.logger.error("Failed to update node %s: %s", node['node_id'][:8], e)
-            return False
+            return registration_result(node, FAILED, str(e))
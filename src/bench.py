@@ -0,0 +1,93 @@
+"""
+API benchmarking
+
+Measures round-trip latency and throughput to the dashboard API and to node
+dashboards, to help choose sync interval and batch settings.
+"""
+
+import asyncio
+import math
+import time
+from typing import Dict, List, Optional, Tuple
+
+import aiohttp
+
+# Node API requests made per node in a sync cycle
+REQUESTS_PER_NODE_SYNC = 5
+
+
+def percentile(values: List[float], pct: float) -> Optional[float]:
+    """Nearest-rank percentile"""
+    if not values:
+        return None
+    ordered = sorted(values)
+    rank = max(1, math.ceil(pct / 100 * len(ordered)))
+    return ordered[rank - 1]
+
+
+async def bench_url(session: aiohttp.ClientSession, url: str, iterations: int,
+                    concurrency: int = 1, headers: Optional[Dict] = None) -> Dict:
+    """Request a URL repeatedly, returning latency percentiles and throughput"""
+    semaphore = asyncio.Semaphore(concurrency)
+    latencies: List[float] = []
+    errors: Dict[str, int] = {}
+    received = 0
+
+    async def one():
+        nonlocal received
+        async with semaphore:
+            started = time.perf_counter()
+            try:
+                async with session.get(url, headers=headers) as response:
+                    body = await response.read()
+                    if response.status != 200:
+                        errors[f"HTTP {response.status}"] = errors.get(f"HTTP {response.status}", 0) + 1
+                        return
+            except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+                name = type(e).__name__
+                errors[name] = errors.get(name, 0) + 1
+                return
+            latencies.append(time.perf_counter() - started)
+            received += len(body)
+
+    started = time.perf_counter()
+    await asyncio.gather(*(one() for _ in range(iterations)))
+    elapsed = time.perf_counter() - started
+
+    return {
+        'url': url,
+        'iterations': iterations,
+        'ok': len(latencies),
+        'errors': errors,
+        'p50': percentile(latencies, 50),
+        'p90': percentile(latencies, 90),
+        'p99': percentile(latencies, 99),
+        'max': max(latencies) if latencies else None,
+        'requests_per_second': len(latencies) / elapsed if elapsed else None,
+        'bytes_per_second': received / elapsed if elapsed else None,
+    }
+
+
+async def run_bench(api_url: str, token: str, node_urls: List[Tuple[str, str]], iterations: int,
+                    concurrency: int = 1, timeout: float = 30) -> Tuple[Dict, List[Dict]]:
+    """Benchmark the dashboard API and each (name, url) node target in turn"""
+    async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=timeout)) as session:
+        api = await bench_url(session, api_url, iterations, concurrency,
+                              headers={'Authorization': f'Bearer {token}'})
+        api['target'] = 'dashboard API'
+
+        nodes = []
+        for name, url in node_urls:
+            result = await bench_url(session, url, iterations, concurrency)
+            result['target'] = name
+            nodes.append(result)
+    return api, nodes
+
+
+def estimate_cycle(api: Dict, nodes: List[Dict], batch_size: int) -> Optional[float]:
+    """Rough sync cycle duration from median latencies"""
+    node_latencies = [result['p50'] for result in nodes if result['p50'] is not None]
+    if not node_latencies or api['p50'] is None:
+        return None
+    per_node = REQUESTS_PER_NODE_SYNC * sum(node_latencies) / len(node_latencies) + api['p50']
+    return math.ceil(len(nodes) / batch_size) * per_node
@@ -0,0 +1,131 @@
+"""
+Cancellation
+
+Ctrl-C cancels the running command's task, and with it every port probe and
+HTTP request still waiting for an answer, instead of letting each run into its
+timeout. Blocking calls handed to threads (name resolution, Docker API calls,
+storage probes) run on daemon threads, so an interrupted command exits without
+waiting for them to return either.
+
+--deadline bounds the whole command the same way. Commands that can report
+partial results (discover, status, sync) stop their work a little earlier,
+DEADLINE_GRACE of the deadline but at most MAX_DEADLINE_GRACE seconds, to
+print what they have before failing with DeadlineExceeded; anything still
+running at the deadline itself is cancelled.
+"""
+
+import asyncio
+import queue
+import threading
+import time
+from concurrent.futures import Future, ThreadPoolExecutor
+from typing import Any, Awaitable, Coroutine, Optional
+
+from .errors import DeadlineExceeded
+
+# Blocking calls running at once, as for asyncio's default executor
+MAX_THREADS = 32
+
+# Share of the deadline kept for reporting partial results
+DEADLINE_GRACE = 0.1
+MAX_DEADLINE_GRACE = 10
+
+# Set from --deadline: the time.monotonic() the command must be done by, and the flag's value
+_deadline: Optional[float] = None
+_grace = 0.0
+_deadline_text = ''
+
+
+class DaemonThreadExecutor(ThreadPoolExecutor):
+    """Runs calls on up to max_workers daemon threads, which nothing waits for at exit"""
+
+    def __init__(self, max_workers: int = MAX_THREADS):
+        super().__init__(max_workers)
+        self.calls: queue.SimpleQueue = queue.SimpleQueue()
+        self.threads = 0
+        self.idle = 0
+        self.lock = threading.Lock()
+
+    def submit(self, fn, /, *args, **kwargs) -> Future:
+        future: Future = Future()
+        with self.lock:
+            # Threads are started as calls arrive, until max_workers exist
+            if self.idle:
+                self.idle -= 1
+            elif self.threads < self._max_workers:
+                self.threads += 1
+                threading.Thread(target=self._work, daemon=True).start()
+        self.calls.put((future, fn, args, kwargs))
+        return future
+
+    def _work(self):
+        while True:
+            future, fn, args, kwargs = self.calls.get()
+            if future.set_running_or_notify_cancel():
+                try:
+                    future.set_result(fn(*args, **kwargs))
+                except BaseException as e:
+                    future.set_exception(e)
+            del future, fn, args, kwargs
+            with self.lock:
+                self.idle += 1
+
+    def shutdown(self, wait: bool = True, *, cancel_futures: bool = False):
+        # Calls still running are abandoned rather than waited for
+        pass
+
+
+def set_deadline(seconds: float, text: str):
+    """Bound commands run from now on to seconds (--deadline text)"""
+    global _deadline, _grace, _deadline_text
+    _deadline = time.monotonic() + seconds
+    _grace = min(seconds * DEADLINE_GRACE, MAX_DEADLINE_GRACE)
+    _deadline_text = text
+
+
+def time_left(grace: bool = True) -> Optional[float]:
+    """Seconds until the work of the command must stop, None without a deadline
+
+    With grace, the time kept for reporting partial results is not included.
+    """
+    if _deadline is None:
+        return None
+    return max(0.0, _deadline - time.monotonic() - (_grace if grace else 0))
+
+
+def deadline_error(detail: str = '') -> DeadlineExceeded:
+    return DeadlineExceeded(f"Deadline of {_deadline_text} reached" + (f"; {detail}" if detail else ''))
+
+
+async def within_deadline(awaitable: Awaitable) -> Any:
+    """Await until the command has to stop its work, raising DeadlineExceeded then"""
+    left = time_left()
+    if left is None:
+        return await awaitable
+    try:
+        return await asyncio.wait_for(awaitable, left)
+    except asyncio.TimeoutError:
+        if time_left() > 0:
+            # A timeout of the awaited work itself
+            raise
+        raise deadline_error()
+
+
+def run(main: Coroutine, deadline: bool = True) -> Any:
+    """Run a command's coroutine like asyncio.run, returning promptly once interrupted
+
+    With deadline, the coroutine is cancelled when the --deadline passes.
+    """
+    async def command():
+        asyncio.get_running_loop().set_default_executor(DaemonThreadExecutor())
+        left = time_left(grace=False) if deadline else None
+        if left is None:
+            return await main
+        try:
+            return await asyncio.wait_for(main, left)
+        except asyncio.TimeoutError:
+            if time_left(grace=False) > 0:
+                raise
+            raise deadline_error("the command was cancelled")
+
+    return asyncio.run(command())
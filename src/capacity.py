@@ -0,0 +1,79 @@
+"""
+Allocation sanity check
+
+Compares a node's allocated space with the capacity and free space of the
+filesystem it stores data on. An allocation the disk cannot hold makes the
+node crash when the disk fills up instead of stopping at its allocation.
+"""
+
+import os
+import shutil
+from pathlib import Path
+from typing import Dict, Optional
+
+# Share of the filesystem a node should allocate at most, leaving room for
+# databases, trash and filesystem overhead
+MAX_ALLOCATION_SHARE = 0.9
+
+# Mount point of the storage directory in storagenode containers
+CONTAINER_STORAGE_DIR = '/app/config'
+
+
+def storage_dir(node: Dict) -> Optional[Path]:
+    """Storage directory of a registered node, if recorded at discovery"""
+    directory = (node.get('config') or {}).get('storageDir') or node.get('storageDir')
+    if directory:
+        return Path(os.path.expanduser(directory))
+    return None
+
+
+def filesystem_usage(directory: Optional[Path]) -> Optional[Dict]:
+    """Total and free bytes of the filesystem holding a directory on this host"""
+    if not directory:
+        return None
+    try:
+        usage = shutil.disk_usage(directory)
+    except OSError:
+        return None
+    return {'total': usage.total, 'free': usage.free}
+
+
+def check_allocation(disk_space: Dict, filesystem: Optional[Dict] = None) -> Optional[Dict]:
+    """Evaluate a node's allocation against its filesystem
+
+    disk_space is the node API's diskSpace. When the filesystem cannot be
+    inspected locally, the node's own report of free disk space is used and
+    the share of the disk allocated cannot be checked. Returns None when
+    neither is known.
+    """
+    used = disk_space.get('used', 0) or 0
+    trash = disk_space.get('trash', 0) or 0
+    allocated = disk_space.get('allocated') or used + (disk_space.get('available', 0) or 0)
+    remaining = max(allocated - used - trash, 0)
+
+    if filesystem:
+        free, total = filesystem['free'], filesystem['total']
+    elif disk_space.get('free') is not None:
+        free, total = disk_space['free'], None
+    else:
+        return None
+
+    problems = []
+    shortfall = remaining - free
+    if shortfall > 0:
+        problems.append(f"The allocation needs {remaining / 1e9:.0f} GB more but the disk has only "
+                        f"{free / 1e9:.0f} GB free")
+    if total and allocated > total * MAX_ALLOCATION_SHARE:
+        problems.append(f"{allocated / 1e12:.2f} TB allocated is over {MAX_ALLOCATION_SHARE:.0%} "
+                        f"of the {total / 1e12:.2f} TB disk")
+
+    return {
+        'allocated': allocated,
+        'used': used,
+        'trash': trash,
+        'remaining': remaining,
+        'filesystem_total': total,
+        'filesystem_free': free,
+        'shortfall': max(shortfall, 0),
+        'problems': problems,
+    }
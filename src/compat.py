@@ -0,0 +1,114 @@
+"""
+Dashboard version compatibility
+
+Every dashboard request reports the client's version (X-Client-Version and
+the User-Agent). A dashboard that needs a newer client to get payloads in the
+shape it expects announces the oldest version it supports with
+X-Min-Client-Version on its responses, or refuses requests with HTTP 426
+Upgrade Required. The client warns once per announced version, since an
+older client's uploads can silently lose fields after a dashboard upgrade.
+With --strict-compat the response that says so fails instead, and nothing
+more is sent to the dashboard.
+"""
+
+from typing import Mapping, Optional
+
+import aiohttp
+
+from . import __version__
+from .errors import VersionSkewError
+from .logger import get_logger
+from .selfupdate import parse_version
+
+CLIENT_VERSION_HEADER = 'X-Client-Version'
+MIN_VERSION_HEADER = 'X-Min-Client-Version'
+USER_AGENT = f'storjcloud-client/{__version__}'
+
+UPGRADE_REQUIRED = 426
+
+# Set from --strict-compat
+_strict = False
+
+# Oldest client version the dashboard last announced
+_min_version: Optional[str] = None
+
+# Whether this client is older than the dashboard supports, once it said so
+_too_old = False
+
+_warned = set()
+
+logger = get_logger()
+
+
+def set_strict_compat(strict: bool):
+    """Refuse dashboard requests once the dashboard requires a newer client"""
+    global _strict
+    _strict = strict
+
+
+def client_headers() -> dict:
+    return {'User-Agent': USER_AGENT, CLIENT_VERSION_HEADER: __version__}
+
+
+def min_version() -> Optional[str]:
+    """The oldest client version the dashboard supports, if it announced one"""
+    return _min_version
+
+
+def too_old() -> bool:
+    return _too_old
+
+
+def _message() -> str:
+    announced = _min_version and parse_version(__version__) < parse_version(_min_version)
+    required = f"storjcloud-client {_min_version} or newer" if announced else "a newer storjcloud-client"
+    return (f"The dashboard requires {required} (this is {__version__}); "
+            "payloads from this version may lose fields. Update with self-update")
+
+
+def observe(status: int, headers: Mapping[str, str]):
+    """Note the dashboard's compatibility announcement in a response
+
+    Raises VersionSkewError in strict mode when this client is too old.
+    """
+    global _min_version, _too_old
+    announced = headers.get(MIN_VERSION_HEADER)
+    if announced:
+        try:
+            outdated = parse_version(__version__) < parse_version(announced)
+        except ValueError:
+            logger.debug("Ignoring invalid %s: %r", MIN_VERSION_HEADER, announced)
+            announced, outdated = None, False
+        if announced:
+            _min_version = announced.strip().lstrip('v')
+            _too_old = outdated
+    if status == UPGRADE_REQUIRED:
+        _too_old = True
+    if not _too_old:
+        return
+    check()
+    if (_min_version, status == UPGRADE_REQUIRED) not in _warned:
+        _warned.add((_min_version, status == UPGRADE_REQUIRED))
+        logger.warning("%s", _message())
+
+
+def check():
+    """Raise VersionSkewError in strict mode if the dashboard requires a newer client"""
+    if _strict and _too_old:
+        raise VersionSkewError(_message() + " (--strict-compat)")
+
+
+async def _on_request_start(session, context, params):
+    check()
+
+
+async def _on_request_end(session, context, params):
+    observe(params.response.status, params.response.headers)
+
+
+def trace_config() -> aiohttp.TraceConfig:
+    """Session hooks checking every dashboard request and response"""
+    trace = aiohttp.TraceConfig()
+    trace.on_request_start.append(_on_request_start)
+    trace.on_request_end.append(_on_request_end)
+    return trace
@@ -0,0 +1,142 @@
+"""
+Shell completion
+
+Generates completion scripts for bash, zsh, fish and PowerShell from the
+command line parser, so they always match the installed version's commands,
+subcommands, options and option values. Each script carries a table of the
+words valid after every command path (such as `nodes dormant`) and completes
+the command name both as storjcloud-client and storjcloud-client.py.
+"""
+
+import argparse
+from typing import Dict, List, Tuple
+
+SHELLS = ('bash', 'zsh', 'fish', 'powershell')
+
+PROGRAMS = ('storjcloud-client', 'storjcloud-client.py')
+
+
+def command_tree(parser: argparse.ArgumentParser, path: Tuple[str, ...] = ()) -> Dict[Tuple[str, ...], Dict]:
+    """Per command path (() for the top level): its subcommands, options and option values"""
+    entry = {'commands': [], 'options': [], 'values': {}}
+    tree = {path: entry}
+    for action in parser._actions:
+        if isinstance(action, argparse._SubParsersAction):
+            subtrees = {}
+            for name, subparser in action.choices.items():
+                entry['commands'].append(name)
+                if id(subparser) not in subtrees:
+                    subtrees[id(subparser)] = command_tree(subparser, path + (name,))
+                    tree.update(subtrees[id(subparser)])
+                    continue
+                # An alias shares its command's parser and completions
+                for key, value in subtrees[id(subparser)].items():
+                    tree[path + (name,) + key[len(path) + 1:]] = value
+        elif action.option_strings and action.help != argparse.SUPPRESS:
+            entry['options'] += [option for option in action.option_strings if option.startswith('--')]
+            if action.choices:
+                for option in action.option_strings:
+                    entry['values'][option] = [str(choice) for choice in action.choices]
+        elif action.choices and not action.option_strings:
+            # A positional argument with fixed values, such as the shell of `completion`
+            entry['commands'] += [str(choice) for choice in action.choices]
+    return tree
+
+
+def _words(entry: Dict) -> str:
+    return ' '.join(entry['commands'] + entry['options'])
+
+
+def bash_script(tree: Dict) -> str:
+    paths = '\n'.join(f'        "{" ".join(path)}") words="{_words(entry)}" ;;' for path, entry in tree.items())
+    values = '\n'.join(f'        "{" ".join(path)}|{option}") words="{" ".join(choices)}" ;;'
+                       for path, entry in tree.items() for option, choices in entry['values'].items())
+    commands = ' '.join(sorted({name for path in tree for name in path}))
+    return f"""# storjcloud-client completion for bash
+_storjcloud_client() {{
+    local cur="${{COMP_WORDS[COMP_CWORD]}}" prev="${{COMP_WORDS[COMP_CWORD-1]}}" path="" word words
+    local known=" {commands} "
+    for word in "${{COMP_WORDS[@]:1:COMP_CWORD-1}}"; do
+        [[ "$word" != -* && "$known" == *" $word "* ]] && path="${{path:+$path }}$word"
+    done
+    words=""
+    case "$path|$prev" in
+{values}
+    esac
+    if [[ -z "$words" ]]; then
+        case "$path" in
+{paths}
+        esac
+    fi
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}}
+complete -o default -F _storjcloud_client {' '.join(PROGRAMS)}
+"""
+
+
+def zsh_script(tree: Dict) -> str:
+    # zsh runs the bash completion through its compatibility layer
+    return ("# storjcloud-client completion for zsh\n"
+            "autoload -U +X bashcompinit && bashcompinit\n" + bash_script(tree).split('\n', 1)[1])
+
+
+def fish_script(tree: Dict) -> str:
+    lines = ['# storjcloud-client completion for fish']
+    for program in PROGRAMS:
+        for path, entry in tree.items():
+            if path:
+                condition = f"__fish_seen_subcommand_from {path[-1]}"
+                if len(path) == 1:
+                    subcommands = ' '.join(tree[path]['commands'])
+                    if subcommands:
+                        condition += f"; and not __fish_seen_subcommand_from {subcommands}"
+            else:
+                condition = "__fish_use_subcommand"
+            for command in entry['commands']:
+                lines.append(f"complete -c {program} -f -n '{condition}' -a {command}")
+            for option in entry['options']:
+                choices = entry['values'].get(option)
+                values = f" -x -a '{' '.join(choices)}'" if choices else ''
+                lines.append(f"complete -c {program} -n '{condition}' -l {option[2:]}{values}")
+    return '\n'.join(lines) + '\n'
+
+
+def powershell_script(tree: Dict) -> str:
+    def quoted(words: List[str]) -> str:
+        return ', '.join(f"'{word}'" for word in words) or ''
+
+    paths = '\n'.join(f"    '{' '.join(path)}' = @({quoted(entry['commands'] + entry['options'])})"
+                      for path, entry in tree.items())
+    values = '\n'.join(f"    '{' '.join(path)}|{option}' = @({quoted(choices)})"
+                       for path, entry in tree.items() for option, choices in entry['values'].items())
+    return f"""# storjcloud-client completion for PowerShell
+$StorjcloudClientWords = @{{
+{paths}
+}}
+$StorjcloudClientValues = @{{
+{values}
+}}
+Register-ArgumentCompleter -Native -CommandName {', '.join(PROGRAMS)} -ScriptBlock {{
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $elements = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object {{ $_.ToString() }})
+    if ($wordToComplete) {{ $elements = @($elements | Select-Object -SkipLast 1) }}
+    $path = @()
+    foreach ($element in $elements) {{
+        $candidate = (@($path) + $element) -join ' '
+        if (-not $element.StartsWith('-') -and $StorjcloudClientWords.ContainsKey($candidate)) {{ $path += $element }}
+    }}
+    $key = $path -join ' '
+    $previous = if ($elements.Count) {{ $elements[-1] }} else {{ '' }}
+    $words = $StorjcloudClientValues["$key|$previous"]
+    if (-not $words) {{ $words = $StorjcloudClientWords[$key] }}
+    $words | Where-Object {{ $_ -like "$wordToComplete*" }} | ForEach-Object {{
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }}
+}}
+"""
+
+
+def completion_script(parser: argparse.ArgumentParser, shell: str) -> str:
+    tree = command_tree(parser)
+    return {'bash': bash_script, 'zsh': zsh_script, 'fish': fish_script,
+            'powershell': powershell_script}[shell](tree)
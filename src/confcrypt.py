@@ -0,0 +1,157 @@
+"""
+Encrypted config values
+
+Secret values in the config file (the API token, signing secret and webhook
+URLs, which usually embed a secret) can be stored encrypted instead of in
+plaintext, as `enc:v1:` strings written by `config encrypt`. Values are
+encrypted with AES-256-GCM, either under a machine key kept in the data
+directory, readable only by its owner, or under a key derived with scrypt
+from a passphrase given in STORJCLOUD_CONFIG_PASSPHRASE. Encrypted values are
+decrypted when the config file is loaded, anywhere in the file.
+"""
+
+import base64
+import hashlib
+import os
+from pathlib import Path
+from typing import Any, Dict, Optional, Tuple
+
+PREFIX = 'enc:v1:'
+
+# Key sources, as marked in encrypted values
+MACHINE = 'm'
+PASSPHRASE = 'p'
+MODE_NAMES = {MACHINE: 'machine key', PASSPHRASE: 'passphrase'}
+
+PASSPHRASE_ENV = 'STORJCLOUD_CONFIG_PASSPHRASE'
+
+# Machine key file in the data directory
+MACHINE_KEY_FILE = 'config.key'
+
+# Config keys holding secrets: encrypted by `config encrypt` and masked when displayed
+SECRET_KEYS = ('api.token', 'api.signing_secret', 'alerts.webhook_url', 'errors.sentry_dsn',
+               'errors.webhook_url')
+
+# Secret fields of the entries of list keys, encrypted one value at a time with `config encrypt-value`
+SECRET_ENTRY_KEYS = {'api.accounts': ('token',), 'hub.servers': ('password', 'token')}
+
+# scrypt cost of passphrase keys: about 0.1s and 32 MiB
+SCRYPT_N = 2 ** 15
+SCRYPT_R = 8
+SALT_SIZE = 16
+NONCE_SIZE = 12
+
+
+def is_encrypted(value: Any) -> bool:
+    return isinstance(value, str) and value.startswith(PREFIX)
+
+
+def _aesgcm(key: bytes):
+    try:
+        from cryptography.hazmat.primitives.ciphers.aead import AESGCM
+    except ImportError:
+        raise ValueError("encrypted config values need the cryptography package (pip install cryptography)")
+    return AESGCM(key)
+
+
+class ConfigKeys:
+    """Keys of encrypted config values: the machine key file or a passphrase"""
+
+    def __init__(self, machine_key: Path, passphrase: Optional[str] = None):
+        self.machine_key = Path(machine_key)
+        self.passphrase = passphrase
+        # salt -> derived key, so a file encrypted in one go costs one derivation
+        self.derived: Dict[bytes, bytes] = {}
+        self.salt: Optional[bytes] = None
+
+    def _machine(self, create: bool = False) -> bytes:
+        try:
+            return base64.b64decode(self.machine_key.read_text().strip(), validate=True)
+        except FileNotFoundError:
+            if not create:
+                raise ValueError(f"machine key {self.machine_key} not found; was the config encrypted "
+                                 "on another machine?")
+        except (OSError, ValueError) as e:
+            raise ValueError(f"cannot read machine key {self.machine_key}: {e}")
+        key = os.urandom(32)
+        self.machine_key.parent.mkdir(parents=True, exist_ok=True)
+        fd = os.open(self.machine_key, os.O_WRONLY | os.O_CREAT | os.O_EXCL, 0o600)
+        with os.fdopen(fd, 'w') as f:
+            f.write(base64.b64encode(key).decode() + '\n')
+        return key
+
+    def _derive(self, salt: bytes) -> bytes:
+        passphrase = self.passphrase or os.getenv(PASSPHRASE_ENV)
+        if not passphrase:
+            raise ValueError(f"the config file has values encrypted with a passphrase; set {PASSPHRASE_ENV}")
+        if salt not in self.derived:
+            self.derived[salt] = hashlib.scrypt(passphrase.encode(), salt=salt, n=SCRYPT_N, r=SCRYPT_R, p=1,
+                                                maxmem=64 * 1024 * 1024, dklen=32)
+        return self.derived[salt]
+
+    def encrypt(self, value: str, mode: str = MACHINE) -> str:
+        nonce = os.urandom(NONCE_SIZE)
+        if mode == PASSPHRASE:
+            self.salt = self.salt or os.urandom(SALT_SIZE)
+            header, key = self.salt, self._derive(self.salt)
+        else:
+            header, key = b'', self._machine(create=True)
+        sealed = _aesgcm(key).encrypt(nonce, value.encode(), None)
+        return f"{PREFIX}{mode}:" + base64.b64encode(header + nonce + sealed).decode()
+
+    def decrypt(self, value: str) -> Tuple[str, str]:
+        """The plaintext of an encrypted value and the mode it was encrypted with
+
+        Raises ValueError if it cannot be decrypted.
+        """
+        mode, _, encoded = value[len(PREFIX):].partition(':')
+        try:
+            blob = base64.b64decode(encoded, validate=True)
+        except ValueError:
+            raise ValueError("malformed encrypted value")
+        if mode == PASSPHRASE:
+            salt, blob = blob[:SALT_SIZE], blob[SALT_SIZE:]
+            key = self._derive(salt)
+        elif mode == MACHINE:
+            key = self._machine()
+        else:
+            raise ValueError(f"unknown encryption mode {mode!r}")
+        if len(blob) <= NONCE_SIZE:
+            raise ValueError("malformed encrypted value")
+        cipher = _aesgcm(key)
+        try:
+            plaintext = cipher.decrypt(blob[:NONCE_SIZE], blob[NONCE_SIZE:], None)
+        except Exception:
+            # InvalidTag: another key, or a changed value
+            raise ValueError(f"cannot decrypt with this {MODE_NAMES[mode]}")
+        return plaintext.decode(), mode
+
+
+def decrypt_tree(data: Any, keys: ConfigKeys, path: str = '') -> Tuple[Any, Dict[str, str]]:
+    """Config data with every encrypted value decrypted, and the mode of each by key path
+
+    Paths are dotted keys, with list indexes such as api.accounts[0].token.
+    Raises ValueError naming the first value that cannot be decrypted.
+    """
+    found: Dict[str, str] = {}
+    if isinstance(data, dict):
+        result = {}
+        for key, value in data.items():
+            result[key], nested = decrypt_tree(value, keys, f"{path}.{key}" if path else str(key))
+            found.update(nested)
+        return result, found
+    if isinstance(data, list):
+        result = []
+        for index, value in enumerate(data):
+            item, nested = decrypt_tree(value, keys, f"{path}[{index}]")
+            result.append(item)
+            found.update(nested)
+        return result, found
+    if not is_encrypted(data):
+        return data, found
+    try:
+        plaintext, mode = keys.decrypt(data)
+    except ValueError as e:
+        raise ValueError(f"{path}: {e}")
+    found[path] = mode
+    return plaintext, found
@@ -4,20 +4,167 @@ Configuration management
 Handles loading and managing configuration from files, environment variables, and CLI arguments.
 """
 
+import json
 import os
-from dataclasses import dataclass, field
+import re
+from dataclasses import asdict, dataclass, field
 from pathlib import Path
-from typing import List, Optional
+from typing import Dict, List, Optional, Union
 
 import yaml
 
+from .confcrypt import MACHINE_KEY_FILE, SECRET_KEYS, ConfigKeys, decrypt_tree
+from .errors import EXIT_CONFIG, ClientError
+from .schema import DURATION_FIELDS, validate_config_data
+
+
+DURATION_UNITS = {'s': 1, 'm': 60, 'h': 3600, 'd': 86400}
+
+
+# Recognized environment variables and the config keys they set
+ENV_VARS = [
+    ('STORJCLOUD_API_TOKEN', 'api.token'),
+    ('STORJCLOUD_DASHBOARD_URL', 'api.endpoint'),
+    ('STORJCLOUD_API_TIMEOUT', 'api.timeout'),
+    ('STORJCLOUD_SIGNING_SECRET', 'api.signing_secret'),
+    ('STORJCLOUD_READ_ONLY', 'api.read_only'),
+    ('DOCKER_HOST', 'discovery.docker_host'),
+    ('STORJCLOUD_FROM_DOCKER', 'discovery.from_docker'),
+    ('STORJCLOUD_SYNC_INTERVAL', 'sync.interval'),
+    ('STORJCLOUD_NETWORK_INTERFACE', 'network.interface'),
+    ('STORJCLOUD_LOG_LEVEL', 'logging.level'),
+    ('STORJCLOUD_LOG_FILE', 'logging.file'),
+    ('STORJCLOUD_ALERT_WEBHOOK', 'alerts.webhook_url'),
+    ('STORJCLOUD_FIAT_CURRENCY', 'currency.fiat'),
+    ('STORJCLOUD_SENTRY_DSN', 'errors.sentry_dsn'),
+]
+
+# Recognized environment variables that are not config file keys,
+# with a function returning their resolved value
+EXTRA_ENV_VARS = {
+    'STORJCLOUD_DATA_DIR': lambda: str(data_dir()),
+    'STORJCLOUD_NON_INTERACTIVE': lambda: str(env_flag('STORJCLOUD_NON_INTERACTIVE')),
+    'STORJCLOUD_TELEMETRY': lambda: os.getenv('STORJCLOUD_TELEMETRY', ''),
+    # Never displayed
+    'STORJCLOUD_CONFIG_PASSPHRASE': lambda: '(set)' if os.getenv('STORJCLOUD_CONFIG_PASSPHRASE') else '',
+}
+
+
+class ConfigError(ClientError):
+    """Invalid configuration, carrying one message per problem"""
+    exit_code = EXIT_CONFIG
+    kind = 'config'
+    
+    def __init__(self, errors: List[str], source: Optional[str] = None):
+        self.errors = errors
+        self.source = source
+        prefix = f"{source}: " if source else ""
+        super().__init__(prefix + '; '.join(errors))
+
+
+def parse_duration(value: Union[str, int, float]) -> float:
+    """Parse a duration such as 300, "10s", "5m" or "1h30m" into seconds"""
+    if isinstance(value, (int, float)):
+        return float(value)
+    
+    text = value.strip().lower()
+    if re.fullmatch(r'\d+(\.\d+)?', text):
+        return float(text)
+    
+    parts = re.findall(r'(\d+(?:\.\d+)?)([smhd])', text)
+    if not parts or ''.join(n + u for n, u in parts) != text:
+        raise ValueError(f"Invalid duration: {value!r} (use e.g. 30s, 5m, 1h)")
+    return sum(float(n) * DURATION_UNITS[u] for n, u in parts)
+
+
+def _duration_errors(values: dict) -> List[str]:
+    """Check duration values (keyed by dotted config key) against their minimums"""
+    errors = []
+    for dotted_key, value in values.items():
+        if value is None:
+            continue
+        try:
+            seconds = parse_duration(value)
+        except (ValueError, AttributeError):
+            errors.append(f"{dotted_key} must be a duration such as 30s, 5m or 1h")
+            continue
+        minimum = DURATION_FIELDS[dotted_key]
+        if seconds < minimum:
+            errors.append(f"{dotted_key} must be ≥ {minimum:g}s")
+    return errors
+
+
+def env_flag(name: str) -> bool:
+    """Whether a boolean environment variable is set to a true value"""
+    return os.getenv(name, '').lower() in ('true', '1', 'yes')
+
+
+def data_dir() -> Path:
+    """Directory for local caches and state"""
+    return Path(os.getenv('STORJCLOUD_DATA_DIR', str(Path.home() / '.storjcloud')))
+
+
+def write_config_value(config_path: str, dotted_key: str, value: Optional[str]):
+    """Set, or with None remove, a section.key value in a YAML config file
+    
+    Only the key's own line changes, so comments and layout survive. The file
+    is replaced atomically and keeps its permissions.
+    """
+    section, key = dotted_key.split('.', 1)
+    path = Path(config_path)
+    lines = path.read_text().splitlines(keepends=True)
+    if lines and not lines[-1].endswith('\n'):
+        lines[-1] += '\n'
+    
+    def entry(indent: str) -> str:
+        # A JSON string is a valid quoted YAML scalar
+        return f"{indent}{key}: {json.dumps(value)}\n"
+    
+    start = next((i for i, line in enumerate(lines) if re.match(rf'{section}:', line)), None)
+    if start is not None and not re.match(rf'{section}:\s*(#.*)?$', lines[start]):
+        raise ConfigError([f"cannot update {dotted_key}: '{section}' is not a block mapping, edit it by hand"],
+                          config_path)
+    if start is None:
+        if value is not None:
+            lines += [f"{section}:\n", entry('  ')]
+    else:
+        end = start + 1
+        while end < len(lines) and (lines[end][:1] in (' ', '\t') or not lines[end].strip()):
+            end += 1
+        children = [line for line in lines[start + 1:end] if line.strip() and not line.strip().startswith('#')]
+        indent = re.match(r'\s*', children[0]).group() if children else '  '
+        at = next((i for i in range(start + 1, end) if lines[i].startswith(f"{indent}{key}:")), None)
+        if at is not None and value is None:
+            del lines[at]
+        elif at is not None:
+            lines[at] = entry(indent)
+        elif value is not None:
+            lines.insert(start + 1, entry(indent))
+    
+    text = ''.join(lines)
+    if ((yaml.safe_load(text) or {}).get(section) or {}).get(key) != value:
+        raise ConfigError([f"cannot update {dotted_key} safely, edit it by hand"], config_path)
+    
+    tmp = path.with_name(path.name + '.tmp')
+    tmp.write_text(text)
+    os.chmod(tmp, path.stat().st_mode & 0o777)
+    os.replace(tmp, path)
+
 
 @dataclass
 class ApiConfig:
     """API configuration"""
     token: str = ""
     endpoint: str = "https://storj.cloud/api/v1"
-    timeout: int = 30
+    timeout: float = 30
+    accounts: List[Dict] = field(default_factory=list)
+    signing_secret: Optional[str] = None
+    # Client certificate for an aggregator endpoint (agent mode)
+    client_cert: Optional[str] = None
+    client_key: Optional[str] = None
+    ca_file: Optional[str] = None
+    # Collect and display only, never change dashboard data
+    read_only: bool = False
 
 
 @dataclass
@@ -27,16 +174,58 @@ class DiscoveryConfig:
     docker_host: str = "unix:///var/run/docker.sock"
     common_ports: List[int] = field(default_factory=lambda: [14000, 14001, 14002, 14003, 14004, 14005])
     port_range: List[int] = field(default_factory=lambda: [14000, 14010])
-    timeout: int = 5
+    timeout: float = 5
     retry_attempts: int = 3
 
 
 @dataclass
 class SyncConfig:
     """Sync configuration"""
-    interval: int = 300
+    interval: float = 300
     batch_size: int = 10
+    # Uploads sent to the dashboard at once, sharing a pool of kept-alive connections
+    max_inflight_uploads: int = 16
     retry_failed: bool = True
+    outbox_limit: int = 10000
+    backpressure_threshold: int = 1000
+    backpressure: str = "coalesce"
+    startup_jitter: float = 0
+    phase_offset: bool = False
+    jitter_seed: Optional[str] = None
+    storage_probe: bool = False
+    # How long exit progress and held amount history are reused (0 = fetch every cycle)
+    static_ttl: float = 3600
+    # How long a node stays unreachable before it is dormant and no longer polled (0 = never)
+    dormant_after: float = 604800
+    # How long a shutdown waits for the nodes in flight to be uploaded
+    drain_timeout: float = 30
+    fields: Dict[str, List[str]] = field(default_factory=dict)
+    pseudonymize_node_ids: bool = False
+    sinks: List[Dict] = field(default_factory=lambda: [{'type': 'dashboard'}])
+
+
+@dataclass
+class AggregatorConfig:
+    """mTLS endpoint receiving agent uploads (aggregator command)"""
+    listen: str = "0.0.0.0:9650"
+    cert: Optional[str] = None
+    key: Optional[str] = None
+    client_ca: Optional[str] = None
+    dedupe_window: float = 60
+
+
+@dataclass
+class HubConfig:
+    """Remote servers polled by this client, with per-server connection settings"""
+    servers: List[Dict] = field(default_factory=list)
+    failure_threshold: int = 2
+
+
+@dataclass
+class NetworkConfig:
+    """Host network configuration"""
+    interface: Optional[str] = None
+    prefer_overlay: bool = False
 
 
 @dataclass
@@ -44,6 +233,112 @@ class LoggingConfig:
     """Logging configuration"""
     level: str = "info"
     file: Optional[str] = None
+    levels: Dict[str, str] = field(default_factory=dict)
+
+
+@dataclass
+class AlertsConfig:
+    """Alert notification configuration"""
+    enabled: bool = True
+    webhook_url: Optional[str] = None
+    timeout: float = 10
+    disk_full_days: int = 14
+    # Days before a falling suspension score reaches suspension that alert (0 = never)
+    unknown_audit_days: int = 14
+    # Storj network status page (Statuspage summary) that annotates alerts, None to not poll it
+    status_feed: Optional[str] = "https://status.storj.io/api/v2/summary.json"
+    status_interval: float = 300
+    # Storage probe latency, as a multiple of the node's recent probes, that alerts (0 = never)
+    storage_latency_factor: float = 5
+
+
+@dataclass
+class ErrorsConfig:
+    """Error reporting configuration (off unless a destination is set)"""
+    sentry_dsn: Optional[str] = None
+    webhook_url: Optional[str] = None
+    environment: Optional[str] = None
+    timeout: float = 10
+
+
+@dataclass
+class TracingConfig:
+    """OpenTelemetry tracing configuration"""
+    enabled: bool = False
+    endpoint: Optional[str] = None
+    service_name: str = "storjcloud-client"
+
+
+@dataclass
+class CurrencyConfig:
+    """Fiat currency conversion configuration"""
+    fiat: Optional[str] = None
+    source: str = "https://api.coingecko.com/api/v3/simple/price"
+    cache_ttl: float = 3600
+
+
+@dataclass
+class PricingConfig:
+    """Satellite pricing model for independent payout estimates (USD)"""
+    storage_tb_month: float = 1.50
+    egress_tb: float = 2.00
+    repair_audit_tb: float = 2.00
+    tolerance: float = 0.05
+
+
+@dataclass
+class HealthConfig:
+    """Node health score weights and alert threshold (0 = no alert)"""
+    weights: Dict[str, float] = field(default_factory=dict)
+    alert_below: float = 50
+
+
+@dataclass
+class SatellitesConfig:
+    """Satellite trust list configuration"""
+    trust_source: str = "https://www.storj.io/dcs-satellites"
+    extra_trusted: List[str] = field(default_factory=list)
+    cache_ttl: float = 86400
+    # Satellite IDs or addresses to collect and alert on (empty = all) or to ignore
+    include: List[str] = field(default_factory=list)
+    exclude: List[str] = field(default_factory=list)
+
+
+@dataclass
+class HistoryConfig:
+    """Local history configuration"""
+    enabled: bool = True
+    path: Optional[str] = None
+    retention_days: int = 400
+
+
+@dataclass
+class TelemetryConfig:
+    """Anonymous usage telemetry configuration (opt-in)"""
+    enabled: bool = False
+    endpoint: Optional[str] = None
+    interval: float = 86400
+
+
+@dataclass
+class UpdateConfig:
+    """Self-update configuration"""
+    endpoint: str = "https://api.github.com/repos/ElektryonUK/storjcloud-client/releases/latest"
+    # Base64 Ed25519 public key that releases' SHA256SUMS must be signed with
+    public_key: Optional[str] = None
+    timeout: float = 60
+
+
+@dataclass
+class LowPowerConfig:
+    """Low-power profile for small devices (--low-power)"""
+    enabled: bool = False
+    # Shortest sync interval of the profile
+    interval: float = 900
+    # Collectors not run (see COLLECTORS in lowpower.py)
+    skip: List[str] = field(default_factory=lambda: ['identity', 'storage_probe'])
+    # Resident memory in MiB above which caches are dropped
+    memory_target: int = 64
 
 
 @dataclass
@@ -52,15 +347,42 @@ class Config:
     api: ApiConfig = field(default_factory=ApiConfig)
     discovery: DiscoveryConfig = field(default_factory=DiscoveryConfig)
     sync: SyncConfig = field(default_factory=SyncConfig)
+    network: NetworkConfig = field(default_factory=NetworkConfig)
+    hub: HubConfig = field(default_factory=HubConfig)
+    aggregator: AggregatorConfig = field(default_factory=AggregatorConfig)
     logging: LoggingConfig = field(default_factory=LoggingConfig)
+    alerts: AlertsConfig = field(default_factory=AlertsConfig)
+    errors: ErrorsConfig = field(default_factory=ErrorsConfig)
+    tracing: TracingConfig = field(default_factory=TracingConfig)
+    currency: CurrencyConfig = field(default_factory=CurrencyConfig)
+    pricing: PricingConfig = field(default_factory=PricingConfig)
+    health: HealthConfig = field(default_factory=HealthConfig)
+    satellites: SatellitesConfig = field(default_factory=SatellitesConfig)
+    history: HistoryConfig = field(default_factory=HistoryConfig)
+    telemetry: TelemetryConfig = field(default_factory=TelemetryConfig)
+    update: UpdateConfig = field(default_factory=UpdateConfig)
+    low_power: LowPowerConfig = field(default_factory=LowPowerConfig)
+    
+    def __post_init__(self):
+        # Origin of each explicitly set value, and the config file read
+        self._sources = {}
+        self.config_file: Optional[str] = None
+        # Key paths of values decrypted from the file, with their encryption mode
+        self.encrypted: Dict[str, str] = {}
+        self.keys = ConfigKeys(data_dir() / MACHINE_KEY_FILE)
     
     @classmethod
     def load(cls, config_path: Optional[str] = None) -> 'Config':
-        """Load configuration from file and environment"""
+        """Load configuration from file and environment
+        
+        Raises ConfigError listing every problem found.
+        """
         config = cls()
         
         # Load from file
-        if config_path and Path(config_path).exists():
+        if config_path:
+            if not Path(config_path).exists():
+                raise ConfigError([f"config file not found: {config_path}"])
             config._load_from_file(config_path)
         else:
             # Try default locations
@@ -77,6 +399,7 @@ class Config:
         
         # Override with environment variables
         config._load_from_env()
+        config.validate()
         
         return config
     
@@ -85,62 +408,91 @@ class Config:
         try:
             with open(config_path, 'r') as f:
                 data = yaml.safe_load(f)
-            
-            if 'api' in data:
-                api_data = data['api']
-                self.api.token = api_data.get('token', self.api.token)
-                self.api.endpoint = api_data.get('endpoint', self.api.endpoint)
-                self.api.timeout = api_data.get('timeout', self.api.timeout)
-            
-            if 'discovery' in data:
-                disc_data = data['discovery']
-                self.discovery.from_docker = disc_data.get('from_docker', self.discovery.from_docker)
-                self.discovery.docker_host = disc_data.get('docker_host', self.discovery.docker_host)
-                self.discovery.common_ports = disc_data.get('common_ports', self.discovery.common_ports)
-                self.discovery.port_range = disc_data.get('port_range', self.discovery.port_range)
-                self.discovery.timeout = disc_data.get('timeout', self.discovery.timeout)
-                self.discovery.retry_attempts = disc_data.get('retry_attempts', self.discovery.retry_attempts)
-            
-            if 'sync' in data:
-                sync_data = data['sync']
-                self.sync.interval = sync_data.get('interval', self.sync.interval)
-                self.sync.batch_size = sync_data.get('batch_size', self.sync.batch_size)
-                self.sync.retry_failed = sync_data.get('retry_failed', self.sync.retry_failed)
-            
-            if 'logging' in data:
-                log_data = data['logging']
-                self.logging.level = log_data.get('level', self.logging.level)
-                self.logging.file = log_data.get('file', self.logging.file)
-                
-        except Exception as e:
-            # If config file is invalid, use defaults
-            pass
-    
-    def _load_from_env(self):
-        """Load configuration from environment variables"""
-        # API config
-        self.api.token = os.getenv('STORJCLOUD_API_TOKEN', self.api.token)
-        self.api.endpoint = os.getenv('STORJCLOUD_DASHBOARD_URL', self.api.endpoint)
-        
-        if timeout := os.getenv('STORJCLOUD_API_TIMEOUT'):
-            try:
-                self.api.timeout = int(timeout)
-            except ValueError:
-                pass
+        except (OSError, yaml.YAMLError) as e:
+            raise ConfigError([f"cannot read {config_path}: {e}"])
         
-        # Discovery config
-        self.discovery.docker_host = os.getenv('DOCKER_HOST', self.discovery.docker_host)
+        if data is None:
+            return
+        if not isinstance(data, dict):
+            raise ConfigError([f"{config_path}: config file must contain a mapping"])
+        try:
+            data, self.encrypted = decrypt_tree(data, self.keys)
+        except ValueError as e:
+            raise ConfigError([str(e)], config_path)
         
-        if from_docker := os.getenv('STORJCLOUD_FROM_DOCKER'):
-            self.discovery.from_docker = from_docker.lower() in ('true', '1', 'yes')
+        errors = validate_config_data(data)
+        errors += _duration_errors({
+            key: (data.get(key.split('.')[0]) or {}).get(key.split('.')[1])
+            for key in DURATION_FIELDS if isinstance(data.get(key.split('.')[0]), dict)
+        })
+        if errors:
+            raise ConfigError(errors, config_path)
         
-        # Sync config
-        if interval := os.getenv('STORJCLOUD_SYNC_INTERVAL'):
+        self.config_file = config_path
+        for section_name, values in data.items():
+            section = getattr(self, section_name)
+            for key, value in (values or {}).items():
+                self._set(section, f"{section_name}.{key}", value)
+    
+    def _set(self, section, dotted_key: str, value, source: str = 'file'):
+        """Assign one configuration value, parsing durations"""
+        if dotted_key in DURATION_FIELDS and value is not None:
             try:
-                self.sync.interval = int(interval)
-            except ValueError:
-                pass
+                value = parse_duration(value)
+            except ValueError as e:
+                raise ConfigError([f"{dotted_key}: {e}"])
+        setattr(section, dotted_key.split('.', 1)[1], value)
+        self._sources[dotted_key] = source
+    
+    def validate(self):
+        """Check the effective configuration, including environment overrides"""
+        errors = validate_config_data(asdict(self))
+        errors += _duration_errors({
+            key: getattr(getattr(self, key.split('.')[0]), key.split('.')[1])
+            for key in DURATION_FIELDS
+        })
         
-        # Logging config
-        self.logging.level = os.getenv('STORJCLOUD_LOG_LEVEL', self.logging.level)
-        self.logging.file = os.getenv('STORJCLOUD_LOG_FILE', self.logging.file)
+        names = [account.get('name') for account in self.api.accounts]
+        errors += [f"api.accounts: duplicate account name '{name}'"
+                   for name in sorted(set(names)) if names.count(name) > 1]
+        
+        if errors:
+            raise ConfigError(errors)
+    
+    @property
+    def telemetry_endpoint(self) -> str:
+        return self.telemetry.endpoint or f"{self.api.endpoint.rstrip('/')}/telemetry"
+    
+    @property
+    def history_path(self) -> Path:
+        """Location of the local history database"""
+        return Path(self.history.path).expanduser() if self.history.path else data_dir() / 'history.db'
+    
+    def _load_from_env(self):
+        """Load configuration from environment variables"""
+        for env_var, dotted_key in ENV_VARS:
+            value = os.getenv(env_var)
+            if not value:
+                continue
+            
+            section_name, key = dotted_key.split('.', 1)
+            if isinstance(getattr(getattr(self, section_name), key), bool):
+                value = env_flag(env_var)
+            self._set(getattr(self, section_name), dotted_key, value, source='env')
+    
+    def set_flag(self, dotted_key: str, value):
+        """Override a value from a command line flag"""
+        self._set(getattr(self, dotted_key.split('.', 1)[0]), dotted_key, value, source='flag')
+    
+    def sealed(self, dotted_key: str, value: str) -> str:
+        """A new value as written to the config file, encrypted if the value it replaces was"""
+        mode = self.encrypted.get(dotted_key)
+        return self.keys.encrypt(value, mode) if mode else value
+    
+    def get(self, dotted_key: str):
+        section_name, key = dotted_key.split('.', 1)
+        return getattr(getattr(self, section_name), key)
+    
+    def source_of(self, dotted_key: str) -> str:
+        """Where a value came from: flag, env, file or default"""
+        return self._sources.get(dotted_key, 'default')
@@ -0,0 +1,63 @@
+"""
+Daemon control
+
+The sync daemon records its process ID in a PID file while it runs, so the
+ctl command can find it and send it signals: SIGUSR2 starts a sync cycle
+immediately, SIGUSR1 dumps its state.
+"""
+
+import logging
+import os
+import signal
+from pathlib import Path
+from typing import Optional
+
+# Signal that makes a running daemon start a sync cycle now
+SYNC_NOW_SIGNAL = getattr(signal, 'SIGUSR2', None)
+
+
+class PidFile:
+    """PID file of a running daemon, removed when it stops"""
+
+    def __init__(self, path: Path, logger=None):
+        self.path = Path(path)
+        self.logger = logger or logging.getLogger(__name__)
+
+    def write(self):
+        other = running_pid(self.path)
+        if other and other != os.getpid():
+            self.logger.warning("Another sync daemon (PID %d) is running; ctl commands reach this one", other)
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(f"{os.getpid()}\n")
+            os.replace(tmp, self.path)
+        except OSError as e:
+            self.logger.warning("Failed to write PID file %s: %s", self.path, e)
+
+    def remove(self):
+        # Only the daemon that wrote the file removes it
+        if running_pid(self.path) == os.getpid():
+            try:
+                self.path.unlink()
+            except OSError:
+                pass
+
+
+def running_pid(path: Path) -> Optional[int]:
+    """PID of the daemon that wrote the file, if it is still running"""
+    try:
+        pid = int(Path(path).read_text().strip())
+        os.kill(pid, 0)
+    except (OSError, ValueError):
+        return None
+    return pid
+
+
+def signal_daemon(path: Path, signum: int) -> int:
+    """Send a signal to the running daemon, returning its PID; raises ValueError if none runs"""
+    pid = running_pid(path)
+    if pid is None:
+        raise ValueError(f"no sync daemon is running (no live PID in {path})")
+    os.kill(pid, signum)
+    return pid
@@ -0,0 +1,67 @@
+"""
+Crash reports
+
+Writes a report file for unexpected errors with the stack trace, the node
+being processed and an excerpt of the payload involved, to attach to bug
+reports.
+"""
+
+import json
+import logging
+import platform
+import sys
+import time
+import traceback
+from pathlib import Path
+from typing import Any, Dict, Optional
+
+from . import __version__
+
+# Crash reports kept; older ones are deleted
+MAX_CRASH_REPORTS = 20
+
+# Characters of the payload included in a report
+PAYLOAD_EXCERPT = 4000
+
+
+def crash_details(error: BaseException, context: Optional[Dict] = None, payload: Any = None) -> Dict:
+    """Stack trace, environment and payload excerpt of an exception"""
+    excerpt = None
+    if payload is not None:
+        try:
+            excerpt = json.dumps(payload, default=str)
+        except (TypeError, ValueError):
+            excerpt = repr(payload)
+        if len(excerpt) > PAYLOAD_EXCERPT:
+            excerpt = excerpt[:PAYLOAD_EXCERPT] + f"... ({len(excerpt)} characters)"
+
+    return {
+        'time': time.strftime('%Y-%m-%dT%H:%M:%SZ', time.gmtime()),
+        'client_version': __version__,
+        'python': sys.version.split()[0],
+        'platform': platform.platform(),
+        'error': f"{type(error).__name__}: {error}",
+        'traceback': traceback.format_exception(type(error), error, error.__traceback__),
+        'context': context or {},
+        'payload_excerpt': excerpt,
+    }
+
+
+def write_crash_report(directory: Path, error: BaseException, context: Optional[Dict] = None,
+                       payload: Any = None, logger=None) -> Optional[Path]:
+    """Write a crash report for an exception, returning its path"""
+    logger = logger or logging.getLogger(__name__)
+    directory = Path(directory)
+    report = crash_details(error, context, payload)
+
+    path = directory / f"crash-{time.strftime('%Y%m%d-%H%M%S')}-{id(error) & 0xffff:04x}.json"
+    try:
+        directory.mkdir(parents=True, exist_ok=True)
+        path.write_text(json.dumps(report, indent=2, default=str))
+        for old in sorted(directory.glob('crash-*.json'))[:-MAX_CRASH_REPORTS]:
+            old.unlink()
+    except OSError as e:
+        logger.debug("Failed to write crash report: %s", e)
+        return None
+
+    return path
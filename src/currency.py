@@ -0,0 +1,126 @@
+"""
+Currency conversion
+
+Converts USD-denominated payout amounts to STORJ and to the operator's local
+fiat currency using a cached exchange rate source.
+"""
+
+import json
+import logging
+import time
+from pathlib import Path
+from typing import Dict, Optional
+
+import aiohttp
+
+DEFAULT_RATE_SOURCE = "https://api.coingecko.com/api/v3/simple/price"
+
+
+class ExchangeRates:
+    """STORJ and fiat exchange rates with an on-disk cache"""
+
+    def __init__(self, fiat: Optional[str] = None, source: str = DEFAULT_RATE_SOURCE,
+                 cache_path: Optional[Path] = None, cache_ttl: int = 3600, logger=None):
+        self.fiat = fiat.lower() if fiat else None
+        self.source = source
+        self.cache_path = cache_path
+        self.cache_ttl = cache_ttl
+        self.logger = logger or logging.getLogger(__name__)
+
+        self.storj_usd: Optional[float] = None
+        self.usd_fiat: Optional[float] = None
+
+    async def load(self) -> bool:
+        """Load rates from cache, refreshing from the source when stale"""
+        cached = self._read_cache()
+        if cached and time.time() - cached.get('fetched_at', 0) < self.cache_ttl:
+            self._apply(cached)
+            return True
+
+        fetched = await self._fetch()
+        if fetched:
+            self._apply(fetched)
+            self._write_cache(fetched)
+            return True
+
+        if cached:
+            self.logger.warning("Using stale exchange rates from %s", cached.get('fetched_at'))
+            self._apply(cached)
+            return True
+
+        return False
+
+    def to_storj(self, usd: float) -> Optional[float]:
+        if not self.storj_usd:
+            return None
+        return usd / self.storj_usd
+
+    def to_fiat(self, usd: float) -> Optional[float]:
+        if self.usd_fiat is None:
+            return None
+        return usd * self.usd_fiat
+
+    def convert(self, usd: float) -> Dict:
+        """Express a USD amount in USD, STORJ and the configured fiat currency"""
+        amounts = {'usd': usd, 'storj': self.to_storj(usd)}
+        if self.fiat:
+            amounts[self.fiat] = self.to_fiat(usd)
+        return amounts
+
+    def _apply(self, rates: Dict):
+        self.storj_usd = rates.get('storj_usd')
+        self.usd_fiat = rates.get('usd_fiat')
+
+    async def _fetch(self) -> Optional[Dict]:
+        currencies = ['usd'] + ([self.fiat] if self.fiat and self.fiat != 'usd' else [])
+        params = {'ids': 'storj', 'vs_currencies': ','.join(currencies)}
+
+        try:
+            timeout = aiohttp.ClientTimeout(total=10)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.get(self.source, params=params) as response:
+                    if response.status != 200:
+                        self.logger.warning("Exchange rate source returned HTTP %d", response.status)
+                        return None
+                    data = await response.json()
+        except Exception as e:
+            self.logger.warning("Failed to fetch exchange rates: %s", e)
+            return None
+
+        prices = data.get('storj', {})
+        storj_usd = prices.get('usd')
+        if not storj_usd:
+            return None
+
+        usd_fiat = 1.0
+        if self.fiat and self.fiat != 'usd':
+            storj_fiat = prices.get(self.fiat)
+            usd_fiat = storj_fiat / storj_usd if storj_fiat else None
+
+        return {
+            'storj_usd': storj_usd,
+            'usd_fiat': usd_fiat,
+            'fiat': self.fiat,
+            'fetched_at': time.time(),
+        }
+
+    def _read_cache(self) -> Optional[Dict]:
+        if not self.cache_path or not self.cache_path.exists():
+            return None
+        try:
+            cached = json.loads(self.cache_path.read_text())
+        except (OSError, ValueError):
+            return None
+        # Rates cached for another fiat currency are of no use
+        if cached.get('fiat') != self.fiat:
+            return None
+        return cached
+
+    def _write_cache(self, rates: Dict):
+        if not self.cache_path:
+            return
+        try:
+            self.cache_path.parent.mkdir(parents=True, exist_ok=True)
+            self.cache_path.write_text(json.dumps(rates))
+        except OSError as e:
+            self.logger.debug("Failed to write exchange rate cache: %s", e)
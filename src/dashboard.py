@@ -0,0 +1,88 @@
+"""
+Dashboard sessions
+
+HTTP sessions for the dashboard API. They present the client certificate
+(see mtls.py), report the client's version (see compat.py), can share a pool
+of kept-alive connections between concurrent requests, and in read-only mode
+refuse every request that would change dashboard data.
+"""
+
+from typing import Optional
+
+import aiohttp
+
+from . import compat
+from .errors import ReadOnlyError
+from .mtls import client_tls
+
+# Set from --read-only or api.read_only
+_read_only = False
+
+# Seconds an idle pooled connection to the dashboard is kept open
+KEEPALIVE_TIMEOUT = 60
+
+# Request methods refused in read-only mode
+MUTATING_METHODS = ('POST', 'PUT', 'PATCH', 'DELETE')
+
+
+def set_read_only(read_only: bool):
+    """Refuse dashboard requests that change anything, in every session"""
+    global _read_only
+    _read_only = read_only
+
+
+def read_only() -> bool:
+    return _read_only
+
+
+class ReadOnlySession:
+    """A dashboard session raising ReadOnlyError instead of sending mutating requests"""
+
+    def __init__(self, session: aiohttp.ClientSession):
+        self.session = session
+
+    def __getattr__(self, name):
+        return getattr(self.session, name)
+
+    async def __aenter__(self):
+        await self.session.__aenter__()
+        return self
+
+    async def __aexit__(self, *exc):
+        return await self.session.__aexit__(*exc)
+
+    def request(self, method: str, url, **kwargs):
+        if method.upper() in MUTATING_METHODS:
+            raise ReadOnlyError(f"Read-only mode: refusing {method.upper()} {url}")
+        return self.session.request(method, url, **kwargs)
+
+    def post(self, url, **kwargs):
+        return self.request('POST', url, **kwargs)
+
+    def put(self, url, **kwargs):
+        return self.request('PUT', url, **kwargs)
+
+    def patch(self, url, **kwargs):
+        return self.request('PATCH', url, **kwargs)
+
+    def delete(self, url, **kwargs):
+        return self.request('DELETE', url, **kwargs)
+
+
+def dashboard_session(connections: Optional[int] = None, **kwargs) -> aiohttp.ClientSession:
+    """HTTP session for the dashboard API, with the client certificate if one is set
+
+    With connections, requests share a pool of at most that many kept-alive
+    connections instead of aiohttp's default limits.
+    """
+    kwargs['headers'] = {**compat.client_headers(), **(kwargs.get('headers') or {})}
+    kwargs.setdefault('trace_configs', []).append(compat.trace_config())
+    context = client_tls()
+    if connections:
+        kwargs.setdefault('connector', aiohttp.TCPConnector(
+            limit=connections, limit_per_host=connections, keepalive_timeout=KEEPALIVE_TIMEOUT,
+            ssl=context if context else True))
+    elif context:
+        kwargs.setdefault('connector', aiohttp.TCPConnector(ssl=context))
+    session = aiohttp.ClientSession(**kwargs)
+    return ReadOnlySession(session) if _read_only else session
@@ -0,0 +1,152 @@
+"""
+Debug HTTP server
+
+Optional local HTTP endpoints for profiling a running daemon in the field:
+task and thread stacks, a CPU profile over a time window, memory allocation
+statistics and internal counters. /healthz also reports the upload queue
+depth, and a degraded status while uploads are held back.
+"""
+
+import asyncio
+import cProfile
+import functools
+import gc
+import io
+import json
+import logging
+import pstats
+import resource
+import sys
+import time
+import traceback
+import tracemalloc
+from typing import Callable, Dict, Optional, Tuple
+
+from aiohttp import web
+
+# Longest CPU profile that can be requested, in seconds
+MAX_PROFILE_SECONDS = 300
+
+
+def _redacted_argv():
+    """Command line with the API token masked"""
+    argv = list(sys.argv)
+    for i, arg in enumerate(argv):
+        if arg in ('--token', '-t') and i + 1 < len(argv):
+            argv[i + 1] = '***'
+        elif arg.startswith('--token='):
+            argv[i] = '--token=***'
+    return argv
+
+
+def parse_listen(value: str) -> Tuple[str, int]:
+    """Split HOST:PORT, defaulting the host to 127.0.0.1"""
+    host, _, port = value.rpartition(':')
+    if not port.isdigit() or not 0 < int(port) < 65536:
+        raise ValueError(f"Invalid listen address {value!r} (use e.g. 127.0.0.1:6060)")
+    return host.strip('[]') or '127.0.0.1', int(port)
+
+
+class DebugServer:
+    """Serves /debug/* diagnostics on a local address"""
+
+    def __init__(self, listen: str, counters: Optional[Callable[[], Dict]] = None, logger=None,
+                 health: Optional[Callable[[], Dict]] = None):
+        self.host, self.port = parse_listen(listen)
+        self.counters = counters or dict
+        self.health = health or dict
+        self.logger = logger or logging.getLogger(__name__)
+        self.started = time.time()
+        self.runner = None
+        self.profiling = False
+
+    async def start(self):
+        if self.host not in ('127.0.0.1', 'localhost', '::1'):
+            self.logger.warning("Debug server listens on %s, which is reachable from other hosts", self.host)
+
+        # Allocation tracking costs some memory and CPU, so only while debugging
+        if not tracemalloc.is_tracing():
+            tracemalloc.start()
+
+        app = web.Application()
+        app.router.add_get('/healthz', self.healthz)
+        app.router.add_get('/debug/vars', self.vars)
+        app.router.add_get('/debug/stacks', self.stacks)
+        app.router.add_get('/debug/profile', self.profile)
+        app.router.add_get('/debug/heap', self.heap)
+
+        self.runner = web.AppRunner(app)
+        await self.runner.setup()
+        await web.TCPSite(self.runner, self.host, self.port).start()
+        self.logger.info("Debug server listening on http://%s:%d/debug/vars", self.host, self.port)
+
+    async def stop(self):
+        if self.runner:
+            await self.runner.cleanup()
+            self.runner = None
+
+    async def healthz(self, request):
+        health = self.health()
+        return web.json_response({
+            'status': 'degraded' if health.get('backpressured') else 'ok',
+            'uptime': time.time() - self.started,
+            **health,
+        })
+
+    async def vars(self, request):
+        """Internal counters and memory statistics, like Go's expvar"""
+        current, peak = tracemalloc.get_traced_memory()
+        return web.json_response({
+            'cmdline': _redacted_argv(),
+            'uptime': time.time() - self.started,
+            'memory': {
+                'max_rss_kb': resource.getrusage(resource.RUSAGE_SELF).ru_maxrss,
+                'traced_current': current,
+                'traced_peak': peak,
+                'gc_counts': gc.get_count(),
+                'gc_objects': len(gc.get_objects()),
+            },
+            'tasks': len(asyncio.all_tasks()),
+            'counters': self.counters(),
+        }, dumps=functools.partial(json.dumps, default=str))
+
+    async def stacks(self, request):
+        """Stacks of every asyncio task and thread"""
+        out = io.StringIO()
+        for task in asyncio.all_tasks():
+            out.write(f"--- task {task.get_name()} ({task.get_coro()!r})\n")
+            task.print_stack(file=out)
+        for thread_id, frame in sys._current_frames().items():
+            out.write(f"--- thread {thread_id}\n")
+            out.write(''.join(traceback.format_stack(frame)))
+        return web.Response(text=out.getvalue())
+
+    async def profile(self, request):
+        """CPU profile of the event loop over ?seconds=N (default 30)"""
+        try:
+            seconds = min(float(request.query.get('seconds', 30)), MAX_PROFILE_SECONDS)
+        except ValueError:
+            raise web.HTTPBadRequest(text="seconds must be a number")
+        if self.profiling:
+            raise web.HTTPConflict(text="A profile is already running")
+
+        self.profiling = True
+        profiler = cProfile.Profile()
+        try:
+            profiler.enable()
+            await asyncio.sleep(seconds)
+        finally:
+            profiler.disable()
+            self.profiling = False
+
+        out = io.StringIO()
+        pstats.Stats(profiler, stream=out).sort_stats('cumulative').print_stats(50)
+        return web.Response(text=out.getvalue())
+
+    async def heap(self, request):
+        """Source lines holding the most allocated memory"""
+        limit = request.query.get('limit', '30')
+        limit = int(limit) if limit.isdigit() else 30
+        snapshot = tracemalloc.take_snapshot()
+        lines = [str(stat) for stat in snapshot.statistics('lineno')[:limit]]
+        return web.Response(text='\n'.join(lines) + '\n')
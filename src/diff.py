@@ -0,0 +1,109 @@
+"""
+Fleet history diff
+
+Compares the fleet at two points in local history: nodes added and removed,
+and per node the changes of status, version, reputation scores and used
+space, along with the events recorded in between. A node counts as present
+at a point if it was sampled shortly before it, so the sync daemon must have
+been running at both points.
+"""
+
+import re
+import time
+from datetime import datetime
+from typing import Dict, List, Optional
+
+from .config import parse_duration
+
+# Time before a point within which a node must have been sampled to count as present
+DEFAULT_WINDOW = 3600
+
+# Smallest score change reported, the precision scores are shown with
+SCORE_CHANGE = 0.0005
+
+SCORE_KEYS = {'audit_score': 'audit', 'suspension_score': 'suspension', 'online_score': 'online'}
+
+
+def parse_point(value: str, now: Optional[float] = None) -> float:
+    """A point in time: now, today, yesterday, a duration ago (12h) or a date (2024-01-31[T08:00])
+
+    Raises ValueError for anything else.
+    """
+    now = time.time() if now is None else now
+    text = value.strip().lower()
+    if text == 'now':
+        return now
+    if text == 'yesterday':
+        return now - 86400
+    if text == 'today':
+        return datetime.fromtimestamp(now).replace(hour=0, minute=0, second=0, microsecond=0).timestamp()
+    if re.fullmatch(r'\d{4}-\d{2}-\d{2}([t ]\d{2}:\d{2}(:\d{2})?)?', text):
+        return datetime.fromisoformat(text.upper()).timestamp()
+    try:
+        return now - parse_duration(text.removesuffix(' ago'))
+    except ValueError:
+        raise ValueError(f"invalid point in time {value!r} (use now, today, yesterday, 12h or 2024-01-31)")
+
+
+def _sample_row(sample: Dict) -> Dict:
+    return {
+        'node_id': sample['node_id'],
+        'name': sample['name'],
+        'status': sample['status'],
+        'version': sample['version'],
+        'disk_used': sample['disk_used'],
+        **{key: sample[key] for key in SCORE_KEYS},
+    }
+
+
+def fleet_diff(before: Dict[str, Dict], after: Dict[str, Dict], events: Optional[List[Dict]] = None,
+               include_unchanged: bool = False) -> Dict:
+    """What changed between two sets of latest samples by node ID
+
+    Nodes whose only change is used space are left out of changed unless
+    include_unchanged is set; their space still counts in the totals.
+    """
+    events = events or []
+    by_node: Dict[str, List[Dict]] = {}
+    for event in events:
+        by_node.setdefault(event['node_id'], []).append(event)
+
+    changed = []
+    for node_id in sorted(set(before) & set(after), key=lambda node_id: after[node_id]['name'] or node_id):
+        old, new = before[node_id], after[node_id]
+        changes = {}
+        for key in ('status', 'version'):
+            if old[key] and new[key] and old[key] != new[key]:
+                changes[key] = {'from': old[key], 'to': new[key]}
+        for key, label in SCORE_KEYS.items():
+            if old[key] is not None and new[key] is not None and abs(new[key] - old[key]) >= SCORE_CHANGE:
+                changes[label] = {'from': old[key], 'to': new[key]}
+        node_events = by_node.get(node_id, [])
+        if not changes and not node_events and not include_unchanged:
+            continue
+        changed.append({
+            'node_id': node_id,
+            'name': new['name'] or old['name'],
+            'status': new['status'],
+            'disk_used_delta': (new['disk_used'] or 0) - (old['disk_used'] or 0),
+            'changes': changes,
+            'events': [{'ts': event['ts'], 'kind': event['kind'], 'message': event['message']}
+                       for event in node_events],
+        })
+
+    used_before = sum(sample['disk_used'] or 0 for sample in before.values())
+    used_after = sum(sample['disk_used'] or 0 for sample in after.values())
+    return {
+        'nodes_before': len(before),
+        'nodes_after': len(after),
+        'added': [_sample_row(after[node_id]) for node_id in sorted(set(after) - set(before))],
+        'removed': [_sample_row(before[node_id]) for node_id in sorted(set(before) - set(after))],
+        'changed': changed,
+        'disk_used_before': used_before,
+        'disk_used_after': used_after,
+        'events': len(events),
+    }
+
+
+def format_point(ts: float) -> str:
+    return datetime.fromtimestamp(ts).strftime('%Y-%m-%d %H:%M')
@@ -6,15 +6,47 @@ by inspecting container metadata, port mappings, and environment variables.
 """
 
 import asyncio
+import ipaddress
 import json
 import logging
 import re
-from typing import Dict, List, Optional
+import time
+from pathlib import Path
+from typing import Callable, Dict, List, Optional
 
 import aiohttp
 import docker
 from docker.errors import DockerException
 
+from .accounts import parse_tags
+from .alerts import find_critical_satellites
+from .capacity import CONTAINER_STORAGE_DIR
+from .identity import CONTAINER_IDENTITY_DIR, valid_node_id
+from .network import overlay_peers, resolve_host, url_host
+from .nodes import determine_status
+from .nodeschema import adapt_sno, parse_version
+from .satfilter import satellite_filter
+
+
+def storagenode_mismatches(data) -> List[str]:
+    """Why a /api/sno response is not from a storagenode; empty if it is
+    
+    Anything answering HTTP on a dashboard port could otherwise be taken for
+    a node, so the response must have the overview's shape and a valid NodeID.
+    """
+    if not isinstance(data, dict):
+        return [f"response is a JSON {type(data).__name__}, not an object"]
+    mismatches = []
+    if not valid_node_id(data.get('nodeID')):
+        mismatches.append(f"no valid nodeID ({str(data.get('nodeID'))[:20]!r})")
+    if parse_version(data.get('version') if isinstance(data.get('version'), str) else None) is None:
+        mismatches.append("no storagenode version")
+    if not isinstance(data.get('diskSpace'), dict):
+        mismatches.append("no diskSpace")
+    if not isinstance(data.get('satellites'), list):
+        mismatches.append("no satellites list")
+    return mismatches
+
 
 class DockerDiscovery:
     """Discovers Storj nodes from Docker containers"""
@@ -27,10 +59,11 @@ class DockerDiscovery:
     async def discover_nodes(self) -> List[Dict]:
         """Discover all Storj nodes from Docker containers"""
         try:
-            self.client = docker.DockerClient(base_url=self.docker_host)
-            self.client.ping()  # Test connection
+            # Docker API calls block, so they run on threads an interrupt need not wait for
+            self.client = await asyncio.to_thread(docker.DockerClient, base_url=self.docker_host)
+            await asyncio.to_thread(self.client.ping)  # Test connection
             
-            containers = self._get_storj_containers()
+            containers = await asyncio.to_thread(self._get_storj_containers)
             self.logger.info("Found %d Storj containers", len(containers))
             
             nodes = []
@@ -48,6 +81,18 @@ class DockerDiscovery:
             if self.client:
                 self.client.close()
     
+    def inspect_container(self, name: str) -> Optional[Dict]:
+        """Docker inspect data of a container, or None if it cannot be read"""
+        try:
+            client = docker.DockerClient(base_url=self.docker_host)
+            try:
+                return client.containers.get(name).attrs
+            finally:
+                client.close()
+        except DockerException as e:
+            self.logger.debug("Failed to inspect container %s: %s", name, e)
+            return None
+    
     def _get_storj_containers(self) -> List:
         """Get all running Storj storage node containers"""
         try:
@@ -77,7 +122,7 @@ class DockerDiscovery:
         """Extract node information from container"""
         try:
             # Get container details
-            container.reload()
+            await asyncio.to_thread(container.reload)
             attrs = container.attrs
             
             # Extract basic info
@@ -105,8 +150,12 @@ class DockerDiscovery:
                 'address': host_ip,
                 'dashboard_port': dashboard_port,
                 'storage_port': self._get_storage_port(attrs),
+                'external_address': self._get_external_address(attrs),
+                'identity_dir': self._get_identity_dir(attrs),
+                'storage_dir': self._get_storage_dir(attrs),
+                'tags': parse_tags(attrs.get('Config', {}).get('Labels')),
                 'version': node_data.get('version', ''),
-                'status': self._determine_status(node_data),
+                'status': determine_status(node_data),
                 'disk_space': {
                     'used': node_data.get('diskSpace', {}).get('used', 0),
                     'available': node_data.get('diskSpace', {}).get('available', 0),
@@ -116,6 +165,7 @@ class DockerDiscovery:
                 'bandwidth': node_data.get('bandwidth', {}),
                 'uptime': node_data.get('uptime', 0),
                 'last_contact': node_data.get('lastContactSuccess'),
+                'critical_satellites': find_critical_satellites(node_data),
                 'container_id': container.id,
                 'container_name': name,
                 'image': image,
@@ -174,6 +224,28 @@ class DockerDiscovery:
         
         return 28967  # Default
     
+    def _get_identity_dir(self, attrs: Dict) -> Optional[str]:
+        """Host directory mounted as the container's identity directory"""
+        for mount in attrs.get('Mounts', []):
+            if mount.get('Destination') == CONTAINER_IDENTITY_DIR:
+                return mount.get('Source')
+        return None
+    
+    def _get_storage_dir(self, attrs: Dict) -> Optional[str]:
+        """Host directory mounted as the container's storage directory"""
+        for mount in attrs.get('Mounts', []):
+            if mount.get('Destination') == CONTAINER_STORAGE_DIR:
+                return mount.get('Source')
+        return None
+    
+    def _get_external_address(self, attrs: Dict) -> Optional[str]:
+        """External HOST:PORT the node advertises to satellites (ADDRESS variable)"""
+        env_vars = attrs.get('Config', {}).get('Env', [])
+        for env_var in env_vars:
+            if env_var.startswith('ADDRESS='):
+                return env_var.split('=', 1)[1] or None
+        return None
+    
     async def _fetch_node_data(self, host: str, port: int) -> Optional[Dict]:
         """Fetch node data from dashboard API"""
         url = f"http://{host}:{port}/api/sno"
@@ -182,45 +254,246 @@ class DockerDiscovery:
             async with aiohttp.ClientSession() as session:
                 async with session.get(url, timeout=5) as response:
                     if response.status == 200:
-                        return await response.json()
+                        data = await response.json()
+                        mismatches = storagenode_mismatches(data)
+                        if mismatches:
+                            self.logger.warning("%s answers on the dashboard port but is not a storagenode: %s",
+                                                url, '; '.join(mismatches))
+                            return None
+                        return adapt_sno(satellite_filter().sno(data))[0]
                     else:
                         self.logger.debug("API request failed: %s %d", url, response.status)
         except Exception as e:
             self.logger.debug("Failed to fetch node data from %s: %s", url, e)
         
         return None
+
+
+# Maximum number of ports probed at the same time
+DEFAULT_SCAN_CONCURRENCY = 256
+
+# Most ports probed per host, so a typo such as 1400-65535 is caught
+MAX_SCAN_PORTS = 4096
+
+# Largest CIDR block expanded for scanning
+MAX_SCAN_HOSTS = 65536
+
+# --server entry standing for the hosts of the overlay networks
+OVERLAY_HOSTS = 'overlay'
+
+
+def parse_ports(spec) -> List[int]:
+    """Expand a port list such as 14000-14100,15002,28967, or a list of ports and ranges
     
-    def _determine_status(self, node_data: Dict) -> str:
-        """Determine node status from API data"""
-        if not node_data.get('lastContactSuccess'):
-            return 'OFFLINE'
-        
-        # Check reputation scores
-        if 'reputation' in node_data:
-            reputation = node_data['reputation']
-            audit_score = reputation.get('auditScore', 1.0)
-            suspension_score = reputation.get('suspensionScore', 0.0)
-            
-            if suspension_score > 0:
-                return 'SUSPENDED'
-            elif audit_score < 0.95:
-                return 'WARNING'
+    Raises ValueError for malformed entries, ports outside 1-65535 and lists
+    longer than MAX_SCAN_PORTS.
+    """
+    entries = spec.split(',') if isinstance(spec, str) else [str(entry) for entry in spec]
+    ports = []
+    for entry in (part.strip() for part in entries):
+        if not entry:
+            continue
+        match = re.fullmatch(r'(\d+)(?:\s*-\s*(\d+))?', entry)
+        if not match:
+            raise ValueError(f"invalid port or range {entry!r} (use e.g. 14000-14100,15002)")
+        start, end = int(match.group(1)), int(match.group(2) or match.group(1))
+        if not 0 < start <= end < 65536:
+            raise ValueError(f"invalid port range {entry!r}")
+        ports.extend(range(start, end + 1))
+    ports = list(dict.fromkeys(ports))
+    if not ports:
+        raise ValueError("no ports given")
+    if len(ports) > MAX_SCAN_PORTS:
+        raise ValueError(f"{len(ports)} ports is more than the {MAX_SCAN_PORTS} scanned per host")
+    return ports
+
+
+def expand_hosts(spec: str) -> List[str]:
+    """Expand a comma-separated list of addresses, hostnames and CIDR blocks
+    
+    The entry `overlay` stands for the peers of this host's Tailscale and
+    WireGuard networks.
+    """
+    hosts = []
+    for entry in (part.strip() for part in spec.split(',')):
+        if not entry:
+            continue
+        if entry == OVERLAY_HOSTS:
+            peers = overlay_peers()
+            if not peers:
+                raise ValueError("No Tailscale or WireGuard peers found")
+            hosts.extend(peers)
+            continue
+        if '/' not in entry:
+            hosts.append(entry)
+            continue
         
-        return 'ONLINE'
+        network = ipaddress.ip_network(entry, strict=False)
+        if network.num_addresses > MAX_SCAN_HOSTS:
+            raise ValueError(f"Network {entry} is too large to scan (max {MAX_SCAN_HOSTS} addresses)")
+        addresses = list(network.hosts()) or [network.network_address]
+        hosts.extend(str(address) for address in addresses)
+    
+    return list(dict.fromkeys(hosts))
+
+
+async def scan_host(host: str, ports: List[int], timeout: int = 5, logger=None,
+                    semaphore: Optional[asyncio.Semaphore] = None, progress=None) -> List[Dict]:
+    """Scan ports on every address a host name resolves to
+    
+    Nodes are reported under the host name, so they stay identifiable when
+    DHCP renumbers the host. A node answering on several addresses (IPv4 and
+    IPv6) is reported once; if the addresses lead to different nodes on the
+    same port, those are reported under their address instead.
+    """
+    logger = logger or logging.getLogger(__name__)
+    try:
+        addresses = await resolve_host(host)
+    except OSError as e:
+        logger.warning("Cannot resolve %s: %s", host, e)
+        return []
+    if len(addresses) > 1:
+        logger.debug("%s resolves to %s", host, ', '.join(addresses))
+        if progress:
+            progress.total_probes += (len(addresses) - 1) * len(ports)
+    
+    semaphore = semaphore or asyncio.Semaphore(DEFAULT_SCAN_CONCURRENCY)
+    results = await asyncio.gather(*(
+        PortScanner(host, timeout, logger, semaphore=semaphore, progress=progress, address=address).scan_ports(ports)
+        for address in addresses
+    ))
+    
+    by_port: Dict[int, Dict[str, Dict]] = {}
+    for found in results:
+        for node in found:
+            by_port.setdefault(node['dashboard_port'], {}).setdefault(node['node_id'], node)
+    nodes = []
+    for port, found in by_port.items():
+        if len(found) > 1:
+            logger.warning("%s:%d leads to different nodes depending on the address, "
+                           "reporting them by address", host, port)
+            for node in found.values():
+                node['address'] = node['resolved_address']
+        nodes.extend(found.values())
+    return nodes
+
+
+async def scan_hosts(hosts: List[str], ports: List[int], timeout: int = 5, logger=None,
+                     progress=None, concurrency: int = DEFAULT_SCAN_CONCURRENCY,
+                     host_ports: Optional[Dict[str, List[int]]] = None,
+                     on_nodes: Optional[Callable[[List[Dict]], None]] = None) -> List[Dict]:
+    """Scan ports on many hosts, sharing one concurrency limit
+    
+    Hosts in host_ports are scanned on their own ports instead. on_nodes is
+    called with the nodes of each host as soon as that host is done.
+    """
+    semaphore = asyncio.Semaphore(concurrency)
+    host_ports = host_ports or {}
+    
+    async def scan(host: str) -> List[Dict]:
+        nodes = await scan_host(host, host_ports.get(host, ports), timeout, logger, semaphore, progress)
+        if on_nodes and nodes:
+            on_nodes(nodes)
+        if progress:
+            progress.host_done()
+        return nodes
+    
+    results = await asyncio.gather(*(scan(host) for host in hosts))
+    return [node for nodes in results for node in nodes]
+
+
+class DiscoveryCache:
+    """Port-scan results from earlier runs, used to speed up rescans"""
+    
+    def __init__(self, path: Path, logger=None):
+        self.path = Path(path)
+        self.logger = logger or logging.getLogger(__name__)
+    
+    def load(self) -> List[Dict]:
+        try:
+            return json.loads(self.path.read_text()).get('nodes', [])
+        except (OSError, ValueError, AttributeError):
+            return []
+    
+    def save(self, nodes: List[Dict], scanned_hosts: List[str]):
+        """Replace cached entries for the scanned hosts with their new results"""
+        scanned = set(scanned_hosts)
+        kept = [node for node in self.load() if node.get('address') not in scanned]
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            self.path.write_text(json.dumps({
+                'updated_at': time.time(),
+                'nodes': kept + nodes,
+            }, default=str))
+        except OSError as e:
+            self.logger.debug("Failed to write discovery cache: %s", e)
+
+
+async def incremental_scan(hosts: List[str], ports: List[int], cached: List[Dict],
+                           timeout: int = 5, logger=None, progress=None,
+                           concurrency: int = DEFAULT_SCAN_CONCURRENCY,
+                           host_ports: Optional[Dict[str, List[int]]] = None,
+                           on_nodes: Optional[Callable[[List[Dict]], None]] = None) -> List[Dict]:
+    """Re-check cached node endpoints, full-scanning hosts that lost a node or have none cached"""
+    logger = logger or logging.getLogger(__name__)
+    known: Dict[str, Dict[int, str]] = {}
+    for node in cached:
+        if node.get('address') in hosts:
+            known.setdefault(node['address'], {})[node['dashboard_port']] = node.get('node_id')
+    # Hosts new to the scan, or without nodes last time, may have gained one
+    uncached = [host for host in hosts if host not in known]
+    semaphore = asyncio.Semaphore(concurrency)
+    
+    async def recheck(host: str) -> List[Dict]:
+        return await scan_host(host, list(known[host]), timeout, logger, semaphore, progress)
+    
+    results = await asyncio.gather(*(recheck(host) for host in known))
+    
+    nodes, missing = [], []
+    for host, found in zip(known, results):
+        found_ids = {(node['dashboard_port'], node['node_id']) for node in found}
+        if all(entry in found_ids for entry in known[host].items()):
+            nodes.extend(found)
+            if on_nodes and found:
+                on_nodes(found)
+            if progress:
+                progress.host_done()
+        else:
+            missing.append(host)
+    
+    if missing:
+        logger.info("Known nodes missing on %d host(s), rescanning: %s",
+                    len(missing), ', '.join(missing))
+        if progress:
+            progress.total_probes += sum(len((host_ports or {}).get(host, ports)) for host in missing)
+    if uncached:
+        logger.info("Full-scanning %d host(s) without cached nodes", len(uncached))
+    if missing or uncached:
+        nodes.extend(await scan_hosts(missing + uncached, ports, timeout, logger, progress, concurrency,
+                                      host_ports, on_nodes))
+    
+    return nodes
 
 
 class PortScanner:
     """Scans specific ports for Storj nodes"""
     
-    def __init__(self, host: str, timeout: int = 5, logger=None):
+    def __init__(self, host: str, timeout: int = 5, logger=None,
+                 semaphore: Optional[asyncio.Semaphore] = None, progress=None,
+                 address: Optional[str] = None):
         self.host = host
+        # Address probed, by default the host itself
+        self.address = address or host
         self.timeout = timeout
         self.logger = logger or logging.getLogger(__name__)
+        self.semaphore = semaphore or asyncio.Semaphore(DEFAULT_SCAN_CONCURRENCY)
+        self.progress = progress
     
     async def scan_ports(self, ports: List[int]) -> List[Dict]:
         """Scan list of ports for Storj nodes"""
-        tasks = [self._check_port(port) for port in ports]
-        results = await asyncio.gather(*tasks, return_exceptions=True)
+        async with aiohttp.ClientSession() as session:
+            tasks = [self._probe(session, port) for port in ports]
+            results = await asyncio.gather(*tasks, return_exceptions=True)
         
         nodes = []
         for result in results:
@@ -229,54 +502,51 @@ class PortScanner:
         
         return nodes
     
-    async def _check_port(self, port: int) -> Optional[Dict]:
+    async def _probe(self, session: aiohttp.ClientSession, port: int) -> Optional[Dict]:
+        """Check one port within the concurrency limit and report progress"""
+        async with self.semaphore:
+            node = await self._check_port(session, port)
+        if self.progress:
+            self.progress.probe_done(found=node is not None)
+        return node
+    
+    async def _check_port(self, session: aiohttp.ClientSession, port: int) -> Optional[Dict]:
         """Check if a specific port has a Storj node"""
-        url = f"http://{self.host}:{port}/api/sno"
+        url = f"http://{url_host(self.address)}:{port}/api/sno"
         
         try:
-            async with aiohttp.ClientSession() as session:
-                async with session.get(url, timeout=self.timeout) as response:
-                    if response.status == 200:
-                        node_data = await response.json()
-                        
-                        return {
-                            'node_id': node_data.get('nodeID', ''),
-                            'name': f"Node-{port}",
-                            'address': self.host,
-                            'dashboard_port': port,
-                            'storage_port': 28967,  # Default
-                            'version': node_data.get('version', ''),
-                            'status': self._determine_status(node_data),
-                            'disk_space': {
-                                'used': node_data.get('diskSpace', {}).get('used', 0),
-                                'available': node_data.get('diskSpace', {}).get('available', 0),
-                                'total': node_data.get('diskSpace', {}).get('used', 0) + 
-                                       node_data.get('diskSpace', {}).get('available', 0)
-                            },
-                            'bandwidth': node_data.get('bandwidth', {}),
-                            'uptime': node_data.get('uptime', 0),
-                            'last_contact': node_data.get('lastContactSuccess'),
-                            'detected_from': 'port_scan'
-                        }
+            async with session.get(url, timeout=self.timeout) as response:
+                if response.status == 200:
+                    data = await response.json()
+                    mismatches = storagenode_mismatches(data)
+                    if mismatches:
+                        self.logger.info("Ignoring %s:%d, it answers HTTP but is not a storagenode (%s)",
+                                         self.host, port, '; '.join(mismatches))
+                        return None
+                    node_data = adapt_sno(satellite_filter().sno(data))[0]
+                    
+                    return {
+                        'node_id': node_data.get('nodeID', ''),
+                        'name': f"Node-{port}",
+                        'address': self.host,
+                        'resolved_address': self.address,
+                        'dashboard_port': port,
+                        'storage_port': 28967,  # Default
+                        'version': node_data.get('version', ''),
+                        'status': determine_status(node_data),
+                        'disk_space': {
+                            'used': node_data.get('diskSpace', {}).get('used', 0),
+                            'available': node_data.get('diskSpace', {}).get('available', 0),
+                            'total': node_data.get('diskSpace', {}).get('used', 0) + 
+                                   node_data.get('diskSpace', {}).get('available', 0)
+                        },
+                        'bandwidth': node_data.get('bandwidth', {}),
+                        'uptime': node_data.get('uptime', 0),
+                        'last_contact': node_data.get('lastContactSuccess'),
+                        'critical_satellites': find_critical_satellites(node_data),
+                        'detected_from': 'port_scan'
+                    }
         except Exception as e:
             self.logger.debug("Port %d check failed: %s", port, e)
         
         return None
-    
-    def _determine_status(self, node_data: Dict) -> str:
-        """Determine node status from API data"""
-        if not node_data.get('lastContactSuccess'):
-            return 'OFFLINE'
-        
-        # Check reputation scores
-        if 'reputation' in node_data:
-            reputation = node_data['reputation']
-            audit_score = reputation.get('auditScore', 1.0)
-            suspension_score = reputation.get('suspensionScore', 0.0)
-            
-            if suspension_score > 0:
-                return 'SUSPENDED'
-            elif audit_score < 0.95:
-                return 'WARNING'
-        
-        return 'ONLINE'
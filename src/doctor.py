@@ -0,0 +1,282 @@
+"""
+Node setup diagnostics
+
+Checks behind the doctor command. Each check inspects one aspect of a
+node's setup and returns results with a severity and a human-readable
+explanation of what is wrong and how to fix it.
+"""
+
+import asyncio
+import ipaddress
+import logging
+import socket
+from dataclasses import asdict, dataclass, field
+from typing import Dict, List, Optional
+
+import aiohttp
+
+from .capacity import check_allocation, filesystem_usage, storage_dir
+from .extaddr import PublicIpLookup, check_external_address
+from .identity import identity_dir, inspect_identity
+from .nat import UpnpGateway, default_gateway, local_address, natpmp_external_address
+from .nodeapi import NodeApiClient, node_endpoint
+from .nodes import node_label, parse_exit_progress
+from .output import GREEN, RED, YELLOW
+from .trust import TrustList, compare_satellites
+
+OK = 'ok'
+WARN = 'warn'
+FAIL = 'fail'
+SKIP = 'skip'
+
+SEVERITY_COLORS = {OK: GREEN, WARN: YELLOW, FAIL: RED}
+
+# Storage port used when the dashboard has none recorded
+DEFAULT_STORAGE_PORT = 28967
+
+
+@dataclass
+class CheckResult:
+    """Outcome of one check for one node (or for the host if node is None)"""
+    check: str
+    status: str
+    message: str
+    node: Optional[str] = None
+    details: Dict = field(default_factory=dict)
+
+    def to_dict(self) -> Dict:
+        return asdict(self)
+
+
+def storage_port(node: Dict) -> int:
+    return int(node.get('port') or DEFAULT_STORAGE_PORT)
+
+
+def _resolve(address: str) -> Optional[str]:
+    try:
+        return socket.gethostbyname(address)
+    except OSError:
+        return None
+
+
+def expected_internal_client(node: Dict, lan_address: Optional[str]) -> Optional[str]:
+    """LAN address the gateway should forward a node's storage port to
+
+    Nodes discovered through Docker are registered with a loopback address,
+    in which case the forward has to point at this host.
+    """
+    address = _resolve(node.get('address') or '127.0.0.1')
+    if not address or ipaddress.ip_address(address).is_loopback:
+        return lan_address
+    return address
+
+
+async def check_port_mappings(nodes: List[Dict], timeout: float = 3, logger=None,
+                              lan_address: Optional[str] = None) -> List[CheckResult]:
+    """Verify the gateway forwards each node's storage port to the node's host
+
+    The LAN address defaults to the one used to reach the gateway.
+    """
+    logger = logger or logging.getLogger(__name__)
+    gateway_address = default_gateway()
+    lan_address = lan_address or local_address(gateway_address or '192.0.2.1')
+
+    try:
+        gateway = await UpnpGateway.discover(timeout, logger)
+    except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+        logger.debug("UPnP discovery failed: %s", e)
+        gateway = None
+
+    if not gateway:
+        external = None
+        if gateway_address:
+            try:
+                external = await natpmp_external_address(gateway_address, timeout)
+            except OSError as e:
+                logger.debug("NAT-PMP query failed: %s", e)
+        if external:
+            return [CheckResult('port_mapping', SKIP,
+                                f"Gateway {gateway_address} speaks NAT-PMP only (external address {external}), "
+                                "which cannot list port forwards; verify them in the router's settings",
+                                details={'gateway': gateway_address, 'external_address': external})]
+        return [CheckResult('port_mapping', SKIP,
+                            "No UPnP or NAT-PMP gateway answered; port forwards cannot be verified "
+                            "(UPnP may be disabled on the router)",
+                            details={'gateway': gateway_address})]
+
+    results = []
+    for node in nodes:
+        port = storage_port(node)
+        expected = expected_internal_client(node, lan_address)
+        label = node_label(node)
+        details = {'external_port': port, 'expected_client': expected}
+
+        try:
+            tcp = await gateway.port_mapping(port, 'TCP')
+            udp = await gateway.port_mapping(port, 'UDP')
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+            results.append(CheckResult('port_mapping', SKIP, f"Gateway query failed: {e}", label, details))
+            continue
+        details.update(tcp=tcp, udp=udp)
+
+        if not tcp:
+            results.append(CheckResult(
+                'port_mapping', WARN,
+                f"Gateway reports no TCP forward for port {port}; if the router was rebooted it may have "
+                "dropped it (forwards set up manually are not always visible over UPnP)",
+                label, details))
+            continue
+
+        wrong = [f"{proto} {port} forwards to {m['internal_client']}:{m['internal_port']}"
+                 for proto, m in (('TCP', tcp), ('UDP', udp))
+                 if m and (m['internal_client'] != expected or m['internal_port'] != port)]
+        disabled = [proto for proto, m in (('TCP', tcp), ('UDP', udp)) if m and not m['enabled']]
+        if wrong:
+            results.append(CheckResult('port_mapping', FAIL,
+                                       f"{'; '.join(wrong)}, expected {expected}:{port}", label, details))
+        elif disabled:
+            results.append(CheckResult('port_mapping', FAIL,
+                                       f"{' and '.join(disabled)} forward for port {port} is disabled",
+                                       label, details))
+        elif not udp:
+            results.append(CheckResult('port_mapping', WARN,
+                                       f"No UDP forward for port {port}; QUIC will be misconfigured",
+                                       label, details))
+        else:
+            results.append(CheckResult('port_mapping', OK,
+                                       f"TCP and UDP {port} forward to {expected}", label, details))
+    return results
+
+
+async def check_external_addresses(nodes: List[Dict], logger=None) -> List[CheckResult]:
+    """Verify each node's external address resolves to this host's public IP"""
+    with_address = [node for node in nodes if node.get('externalAddress')]
+    if not with_address:
+        return [CheckResult('external_address', SKIP,
+                            "No node has a known external address (only nodes discovered from Docker do)")]
+
+    public_ip = await PublicIpLookup(logger=logger).get()
+    if not public_ip:
+        return [CheckResult('external_address', SKIP, "Could not determine this host's public IP")]
+
+    results = []
+    for node in with_address:
+        result = await check_external_address(node['externalAddress'], public_ip)
+        if result['matches']:
+            status, message = OK, f"{result['host']} resolves to public IP {public_ip}"
+        elif not result['resolved']:
+            status, message = FAIL, f"{result['host']} does not resolve"
+        else:
+            status, message = FAIL, (f"{result['host']} resolves to {', '.join(result['resolved'])}, "
+                                     f"not this host's public IP {public_ip}; the dynamic DNS record is stale")
+        results.append(CheckResult('external_address', status, message, node_label(node), result))
+    return results
+
+
+def check_identities(nodes: List[Dict], logger=None) -> List[CheckResult]:
+    """Inspect the identity directory of every node running on this host"""
+    results = []
+    for node in nodes:
+        directory = identity_dir(node)
+        if not directory:
+            continue
+        identity = inspect_identity(directory, node.get('nodeId'), logger)
+        if identity['healthy'] is None:
+            status, message = SKIP, '; '.join(identity['warnings'])
+        elif identity['problems']:
+            status, message = FAIL, '; '.join(identity['problems'])
+        elif identity['warnings']:
+            status, message = WARN, '; '.join(identity['warnings'])
+        else:
+            status, message = OK, f"Valid identity, difficulty {identity['difficulty']}"
+        results.append(CheckResult('identity', status, message, node_label(node), identity))
+
+    if not results:
+        return [CheckResult('identity', SKIP,
+                            "No identity directory known (only nodes discovered from Docker have one)")]
+    return results
+
+
+async def check_allocations(nodes: List[Dict], node_api: NodeApiClient) -> List[CheckResult]:
+    """Verify each node's allocation fits on the disk backing it"""
+    results = []
+    for node in nodes:
+        sno = await node_api.get_sno(*node_endpoint(node))
+        if sno is None:
+            results.append(CheckResult('allocation', SKIP, "Node dashboard unreachable", node_label(node)))
+            continue
+        result = check_allocation(sno.get('diskSpace', {}), filesystem_usage(storage_dir(node)))
+        if not result:
+            status, message = SKIP, "Node does not report free disk space and its storage is not on this host"
+        elif result['problems']:
+            status, message = WARN, '; '.join(result['problems'])
+        else:
+            status, message = OK, (f"{result['allocated'] / 1e12:.2f} TB allocated, "
+                                   f"{result['filesystem_free'] / 1e12:.2f} TB free on disk")
+        results.append(CheckResult('allocation', status, message, node_label(node), result or {}))
+    return results
+
+
+async def check_api_schemas(nodes: List[Dict], node_api: NodeApiClient) -> List[CheckResult]:
+    """Verify the client understands each node's dashboard API"""
+    results = []
+    for node in nodes:
+        sno = await node_api.get_sno(*node_endpoint(node))
+        rejected = node_api.rejections.get(node_endpoint(node))
+        if rejected:
+            results.append(CheckResult('node_api', FAIL, f"Rejected by strict parsing: {'; '.join(rejected)}",
+                                       node_label(node), {'problems': rejected}))
+            continue
+        if sno is None:
+            results.append(CheckResult('node_api', SKIP, "Node dashboard unreachable", node_label(node)))
+            continue
+        problems = sno['apiProblems'] + sno['parseWarnings']
+        details = {'schema': sno['apiSchema'], 'version': sno.get('version'), 'problems': problems}
+        if problems:
+            results.append(CheckResult('node_api', WARN, f"{'; '.join(problems)} "
+                                       "(check for a client update)", node_label(node), details))
+        else:
+            results.append(CheckResult('node_api', OK, f"{sno.get('version')}, {sno['apiSchema']} schema",
+                                       node_label(node), details))
+    return results
+
+
+async def check_satellites(nodes: List[Dict], node_api: NodeApiClient, trust: TrustList) -> List[CheckResult]:
+    """Compare the satellites of each node with the trusted satellite list"""
+    trusted = node_api.satellites.trusted(await trust.load())
+    results = []
+    for node in nodes:
+        sno = await node_api.get_sno(*node_endpoint(node))
+        if sno is None:
+            results.append(CheckResult('satellites', SKIP, "Node dashboard unreachable", node_label(node)))
+            continue
+        progress = parse_exit_progress(await node_api.get_exit_progress(*node_endpoint(node)))
+        exited = [entry['satellite_id'] for entry in progress if entry['completed']]
+        result = compare_satellites(sno, trusted, exited, trust.extra)
+
+        problems = []
+        if result['untrusted']:
+            problems.append("Untrusted satellites: " +
+                            ', '.join(sat['url'] or sat['id'] for sat in result['untrusted']))
+        if result['missing']:
+            problems.append("Missing trusted satellites: " +
+                            ', '.join(sat['url'] or sat['id'] for sat in result['missing']))
+        if problems:
+            results.append(CheckResult('satellites', WARN, '; '.join(problems), node_label(node), result))
+        else:
+            results.append(CheckResult('satellites', OK, f"All {len(trusted)} trusted satellites, no others",
+                                       node_label(node), result))
+    return results
+
+
+async def run_checks(nodes: List[Dict], node_api: NodeApiClient, trust: TrustList, timeout: float = 3,
+                     logger=None, lan_address: Optional[str] = None) -> List[CheckResult]:
+    """Run every diagnostic check against the registered nodes"""
+    results = []
+    results.extend(await check_port_mappings(nodes, timeout, logger, lan_address))
+    results.extend(await check_external_addresses(nodes, logger))
+    results.extend(check_identities(nodes, logger))
+    results.extend(await check_allocations(nodes, node_api))
+    results.extend(await check_api_schemas(nodes, node_api))
+    results.extend(await check_satellites(nodes, node_api, trust))
+    return results
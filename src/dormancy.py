@@ -0,0 +1,137 @@
+"""
+Per-node error budget
+
+Counts the polls in a row in which a node's dashboard API was unreachable.
+After a few such failures the node is polled progressively less often, and
+once it has been failing for longer than sync.dormant_after it is marked
+dormant and no longer polled at all, until `nodes reactivate` wakes it up.
+The first successful poll resets a node's budget. Kept in a local file, so
+nodes reactivated from the command line are picked up by a running daemon.
+"""
+
+import json
+import logging
+import os
+import time
+from pathlib import Path
+from typing import Dict, List, Optional
+
+# Consecutive failures after which a node is no longer polled every cycle
+BACKOFF_AFTER = 3
+
+# Most cycles between two polls of a failing node
+MAX_BACKOFF_CYCLES = 16
+
+
+def backoff_cycles(failures: int) -> int:
+    """Cycles between polls of a node after this many failures in a row"""
+    if failures < BACKOFF_AFTER:
+        return 1
+    return min(2 ** (failures - BACKOFF_AFTER + 1), MAX_BACKOFF_CYCLES)
+
+
+class ErrorBudget:
+    """Consecutive failures and dormancy per node ID, saved as JSON"""
+
+    def __init__(self, path: Path, dormant_after: float = 0, logger=None):
+        self.path = Path(path)
+        # Seconds of failing before a node turns dormant, 0 never
+        self.dormant_after = dormant_after
+        self.logger = logger or logging.getLogger(__name__)
+        # node_id -> {'name', 'account', 'failures', 'since', 'last', 'dormant'}
+        self.nodes: Dict[str, Dict] = {}
+        self.mtime: Optional[float] = None
+        self._load()
+
+    def _load(self):
+        try:
+            self.mtime = self.path.stat().st_mtime
+            self.nodes = json.loads(self.path.read_text()).get('nodes', {})
+        except FileNotFoundError:
+            self.mtime, self.nodes = None, {}
+        except (OSError, ValueError, AttributeError) as e:
+            self.logger.warning("Ignoring unreadable node error budget %s: %s", self.path, e)
+
+    def refresh(self):
+        """Reload the file if another process changed it"""
+        try:
+            mtime = self.path.stat().st_mtime
+        except OSError:
+            mtime = None
+        if mtime != self.mtime:
+            self._load()
+
+    def save(self):
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(json.dumps({'nodes': self.nodes}, indent=2))
+            os.replace(tmp, self.path)
+            self.mtime = self.path.stat().st_mtime
+        except OSError as e:
+            self.logger.error("Failed to save node error budget: %s", e)
+
+    def dormant(self, node_id: str) -> Optional[Dict]:
+        entry = self.nodes.get(node_id)
+        return entry if entry and entry.get('dormant') else None
+
+    def backing_off(self, node_id: str) -> bool:
+        """Whether the node is no longer polled every cycle"""
+        entry = self.nodes.get(node_id)
+        return bool(entry) and (bool(entry.get('dormant')) or entry['failures'] >= BACKOFF_AFTER)
+
+    def due(self, node_id: str, interval: float, now: Optional[float] = None) -> bool:
+        """Whether the node is polled this cycle"""
+        entry = self.nodes.get(node_id)
+        if not entry:
+            return True
+        if entry.get('dormant'):
+            return False
+        # Half a cycle of slack, so a cycle starting slightly early still counts
+        return (now or time.time()) - entry['last'] >= (backoff_cycles(entry['failures']) - 0.5) * interval
+
+    def failed(self, node: Dict, account: Optional[str] = None, now: Optional[float] = None) -> Dict:
+        """Count a failed poll of a registered node; the entry's 'dormant' is set once it turns dormant"""
+        now = now or time.time()
+        # Keeps nodes reactivated by another process meanwhile
+        self.refresh()
+        entry = self.nodes.setdefault(node.get('nodeId', 'unknown'), {
+            'name': node.get('name'), 'account': account, 'failures': 0, 'since': now, 'last': now, 'dormant': None,
+        })
+        entry['failures'] += 1
+        entry['last'] = now
+        if self.dormant_after and not entry['dormant'] and now - entry['since'] >= self.dormant_after:
+            entry['dormant'] = now
+        self.save()
+        return entry
+
+    def succeeded(self, node_id: str) -> Optional[Dict]:
+        """Reset the node's budget, returning the entry it had if it was failing"""
+        self.refresh()
+        entry = self.nodes.pop(node_id, None)
+        if entry:
+            self.save()
+        return entry
+
+    def reactivate(self, node_id: str) -> bool:
+        """Poll a node every cycle again; False if it was not dormant or backing off"""
+        if not self.backing_off(node_id):
+            return False
+        self.nodes.pop(node_id)
+        self.save()
+        return True
+
+    def failing(self) -> List[Dict]:
+        """Nodes with failed polls, longest failing first, with their nodeId"""
+        return sorted(({'nodeId': node_id, **entry} for node_id, entry in self.nodes.items()),
+                      key=lambda entry: entry['since'])
+
+    def forget(self, registered, account: Optional[str] = None):
+        """Drop the budget of an account's nodes no longer registered"""
+        self.refresh()
+        gone = {node_id for node_id, entry in self.nodes.items()
+                if entry.get('account') == account and node_id not in registered}
+        for node_id in gone:
+            del self.nodes[node_id]
+        if gone:
+            self.save()
@@ -0,0 +1,90 @@
+"""
+Error reporting
+
+Forwards unexpected errors to Sentry or a generic error webhook together with
+the daemon context (client version, node count, cycle), so crashes on
+unattended servers are noticed. Disabled unless a destination is configured;
+node payloads are never included.
+"""
+
+import asyncio
+import logging
+from typing import Dict, Optional
+
+import aiohttp
+
+from . import __version__
+from .crash import crash_details
+
+
+class ErrorReporter:
+    """Delivers error reports to Sentry and/or a webhook"""
+
+    def __init__(self, sentry_dsn: Optional[str] = None, webhook_url: Optional[str] = None,
+                 environment: Optional[str] = None, timeout: float = 10, logger=None):
+        self.sentry_dsn = sentry_dsn
+        self.webhook_url = webhook_url
+        self.environment = environment
+        self.timeout = timeout
+        self.logger = logger or logging.getLogger(__name__)
+        self.sentry = None
+        self.pending = set()
+        self.reported = 0
+        if sentry_dsn:
+            self.sentry = self._init_sentry()
+
+    @property
+    def enabled(self) -> bool:
+        return bool(self.sentry or self.webhook_url)
+
+    def _init_sentry(self):
+        try:
+            import sentry_sdk
+        except ImportError:
+            self.logger.warning("errors.sentry_dsn is set but sentry-sdk is not installed (pip install sentry-sdk)")
+            return None
+        sentry_sdk.init(dsn=self.sentry_dsn, release=f"storjcloud-client@{__version__}",
+                        environment=self.environment, default_integrations=False)
+        return sentry_sdk
+
+    def report(self, error: BaseException, context: Optional[Dict] = None):
+        """Schedule delivery of a report from a running event loop"""
+        if not self.enabled:
+            return
+        task = asyncio.get_running_loop().create_task(self.send(error, context))
+        self.pending.add(task)
+        task.add_done_callback(self.pending.discard)
+
+    async def send(self, error: BaseException, context: Optional[Dict] = None):
+        """Deliver a report to every configured destination"""
+        if not self.enabled:
+            return
+        self.reported += 1
+        context = {**(context or {}), 'environment': self.environment}
+        if self.sentry:
+            new_scope = getattr(self.sentry, 'new_scope', None) or self.sentry.push_scope
+            with new_scope() as scope:
+                scope.set_context('daemon', context)
+                for key in ('command', 'account', 'cycle'):
+                    if context.get(key) is not None:
+                        scope.set_tag(key, context[key])
+                self.sentry.capture_exception(error)
+            # The SDK sends from a background thread; wait for it without blocking the loop
+            await asyncio.to_thread(self.sentry.flush, self.timeout)
+        if self.webhook_url:
+            await self._send_webhook(crash_details(error, context))
+
+    async def _send_webhook(self, report: Dict):
+        try:
+            timeout = aiohttp.ClientTimeout(total=self.timeout)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.post(self.webhook_url, json=report) as response:
+                    if response.status >= 300:
+                        self.logger.debug("Error webhook returned HTTP %d", response.status)
+        except Exception as e:
+            self.logger.debug("Failed to deliver error report: %s", e)
+
+    async def flush(self):
+        """Wait for scheduled reports, e.g. before exiting"""
+        if self.pending:
+            await asyncio.wait(self.pending, timeout=self.timeout)
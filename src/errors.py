@@ -0,0 +1,149 @@
+"""
+Error classes and exit codes
+
+Every failure class maps to a documented process exit code so scripts and
+service managers can branch on the kind of failure. Classes also name their
+kind, as reported in JSON output and telemetry, and whether trying again
+later can succeed; failed dashboard and node requests are classified by
+http_error() from their HTTP status rather than by their message.
+"""
+
+from typing import Dict, Mapping, Optional
+
+EXIT_OK = 0
+EXIT_ERROR = 1          # Unexpected or unclassified failure
+EXIT_USAGE = 2          # Invalid command line arguments
+EXIT_CONFIG = 3         # Invalid or incomplete configuration
+EXIT_AUTH = 4           # Token rejected by the dashboard
+EXIT_NETWORK = 5        # Dashboard or nodes unreachable
+EXIT_PARTIAL = 6        # Command completed for only some nodes
+EXIT_NO_NODES = 7       # No nodes discovered or registered
+EXIT_INCOMPATIBLE = 8   # The dashboard requires a newer client (--strict-compat)
+EXIT_DEADLINE = 9       # The --deadline passed; results may be partial
+EXIT_RATE_LIMITED = 10  # The dashboard's rate limit was reached
+EXIT_INTERRUPTED = 130  # Interrupted by the user (SIGINT)
+
+
+class ClientError(Exception):
+    """Base class for failures that map to an exit code"""
+    exit_code = EXIT_ERROR
+    kind = 'error'
+    # Whether the same request can succeed when tried again later
+    retryable = False
+    
+    def to_dict(self) -> Dict:
+        """The error as reported in JSON output"""
+        return {'kind': self.kind, 'message': str(self), 'exitCode': self.exit_code, 'retryable': self.retryable}
+
+
+class UsageError(ClientError):
+    """Invalid command line arguments"""
+    exit_code = EXIT_USAGE
+    kind = 'usage'
+
+
+class AuthError(ClientError):
+    """The dashboard rejected the API token"""
+    exit_code = EXIT_AUTH
+    kind = 'auth'
+
+
+class NetworkError(ClientError):
+    """The dashboard or a node could not be reached"""
+    exit_code = EXIT_NETWORK
+    kind = 'network'
+    retryable = True
+
+
+class HttpError(NetworkError):
+    """The dashboard answered with an unexpected HTTP status"""
+    kind = 'http'
+    # Asking again gets the same answer, unlike for the subclasses
+    retryable = False
+    
+    def __init__(self, message: str, status: Optional[int] = None):
+        super().__init__(message)
+        self.status = status
+    
+    def to_dict(self) -> Dict:
+        return {**super().to_dict(), 'status': self.status}
+
+
+class ServerError(HttpError):
+    """The dashboard failed with a 5xx status"""
+    kind = 'server_error'
+    retryable = True
+
+
+class RateLimitedError(HttpError):
+    """The dashboard's rate limit was reached (HTTP 429)"""
+    exit_code = EXIT_RATE_LIMITED
+    kind = 'rate_limited'
+    retryable = True
+    
+    def __init__(self, message: str, status: Optional[int] = 429, retry_after: Optional[float] = None):
+        super().__init__(message, status)
+        self.retry_after = retry_after
+    
+    def to_dict(self) -> Dict:
+        return {**super().to_dict(), 'retryAfter': self.retry_after}
+
+
+class NodeUnreachableError(NetworkError):
+    """A node's dashboard API did not answer"""
+    kind = 'node_unreachable'
+
+
+class PartialSuccess(ClientError):
+    """The command completed for only some of the nodes"""
+    exit_code = EXIT_PARTIAL
+    kind = 'partial'
+
+
+class ReadOnlyError(UsageError):
+    """A command would change dashboard data in read-only mode"""
+    kind = 'read_only'
+
+
+class NoNodesFound(ClientError):
+    """There were no nodes to operate on"""
+    exit_code = EXIT_NO_NODES
+    kind = 'no_nodes'
+
+
+class VersionSkewError(ClientError):
+    """The dashboard requires a newer client than this one"""
+    exit_code = EXIT_INCOMPATIBLE
+    kind = 'incompatible'
+
+
+class DeadlineExceeded(ClientError):
+    """The command ran out of time (--deadline)"""
+    exit_code = EXIT_DEADLINE
+    kind = 'deadline'
+
+
+def retry_after(headers: Optional[Mapping[str, str]]) -> Optional[float]:
+    """Seconds of a Retry-After header, if it has any"""
+    try:
+        return float(headers['Retry-After']) if headers else None
+    except (KeyError, ValueError):
+        return None
+
+
+def classified(status: int) -> bool:
+    """Whether http_error gives a status a class of its own rather than HttpError"""
+    return status in (401, 403, 429) or status >= 500
+
+
+def http_error(status: int, action: str, headers: Optional[Mapping[str, str]] = None) -> ClientError:
+    """The error class of a failed dashboard request, e.g. http_error(503, 'Failed to get nodes')"""
+    if status in (401, 403):
+        return AuthError("Authentication failed - check API token")
+    if status == 429:
+        delay = retry_after(headers)
+        return RateLimitedError(f"{action}: rate limited" + (f", retry in {delay:.0f}s" if delay else ''),
+                                retry_after=delay)
+    if status >= 500:
+        return ServerError(f"{action}: HTTP {status}", status)
+    return HttpError(f"{action}: HTTP {status}", status)
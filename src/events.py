@@ -0,0 +1,90 @@
+"""
+Node event timeline
+
+Derives significant changes of a node from consecutive observations: going
+offline and coming back, version changes, status changes, reputation scores
+dropping below the degraded threshold and disk usage crossing thresholds.
+Events are kept in the local history store, giving a change history next to
+the current state.
+"""
+
+from typing import Dict, List, Optional, Tuple
+
+from .output import DEGRADED_SCORE, format_age
+
+OFFLINE = 'offline'
+ONLINE = 'online'
+VERSION_CHANGED = 'version_changed'
+STATUS_CHANGED = 'status_changed'
+SCORE_DROPPED = 'score_dropped'
+SCORE_RECOVERED = 'score_recovered'
+DISK_THRESHOLD = 'disk_threshold'
+
+EVENT_KINDS = [OFFLINE, ONLINE, VERSION_CHANGED, STATUS_CHANGED, SCORE_DROPPED, SCORE_RECOVERED, DISK_THRESHOLD]
+
+# Events telling whether a node is up, the last of which is its availability
+AVAILABILITY_EVENTS = (OFFLINE, ONLINE)
+
+# Shares of the allocation whose crossing is an event
+DISK_THRESHOLDS = (0.8, 0.9, 0.95)
+
+SCORES = {'audit_score': 'audit', 'suspension_score': 'suspension', 'online_score': 'online'}
+
+# (kind, message, data)
+Event = Tuple[str, str, Dict]
+
+
+def availability_event(last: Optional[Dict], up: bool, reason: str, ts: float) -> Optional[Event]:
+    """An offline or online event if the node's availability changed since the last one"""
+    was_down = bool(last and last['kind'] == OFFLINE)
+    if not up and not was_down:
+        return OFFLINE, f"Went offline: {reason}", {'reason': reason}
+    if up and was_down:
+        downtime = ts - last['ts']
+        return ONLINE, f"Came back after {format_age(downtime)}", {'downtime': round(downtime)}
+    return None
+
+
+def _disk_ratio(sample: Dict) -> Optional[float]:
+    used, available = sample.get('disk_used'), sample.get('disk_available')
+    if used is None or available is None or not used + available:
+        return None
+    return used / (used + available)
+
+
+def sample_events(previous: Optional[Dict], current: Dict) -> List[Event]:
+    """Events between two history samples of a node, none for its first sample"""
+    if not previous:
+        return []
+    events = []
+    if previous.get('version') and current.get('version') and previous['version'] != current['version']:
+        events.append((VERSION_CHANGED, f"Version changed from {previous['version']} to {current['version']}",
+                       {'from': previous['version'], 'to': current['version']}))
+
+    # Going offline and back is covered by availability events
+    if previous.get('status') and previous['status'] != current['status'] and 'OFFLINE' not in (
+            previous['status'], current['status']):
+        events.append((STATUS_CHANGED, f"Status changed from {previous['status']} to {current['status']}",
+                       {'from': previous['status'], 'to': current['status']}))
+
+    for key, label in SCORES.items():
+        before, after = previous.get(key), current.get(key)
+        if before is None or after is None:
+            continue
+        if before >= DEGRADED_SCORE > after:
+            events.append((SCORE_DROPPED, f"{label.capitalize()} score dropped to {after:.3f} (from {before:.3f})",
+                           {'score': label, 'from': before, 'to': after}))
+        elif before < DEGRADED_SCORE <= after:
+            events.append((SCORE_RECOVERED, f"{label.capitalize()} score recovered to {after:.3f}",
+                           {'score': label, 'from': before, 'to': after}))
+
+    before, after = _disk_ratio(previous), _disk_ratio(current)
+    if before is not None and after is not None:
+        for threshold in DISK_THRESHOLDS:
+            if before < threshold <= after:
+                events.append((DISK_THRESHOLD, f"Disk usage crossed {threshold:.0%} ({after:.1%} used)",
+                               {'threshold': threshold, 'ratio': after, 'direction': 'up'}))
+            elif after < threshold <= before:
+                events.append((DISK_THRESHOLD, f"Disk usage fell below {threshold:.0%} ({after:.1%} used)",
+                               {'threshold': threshold, 'ratio': after, 'direction': 'down'}))
+    return events
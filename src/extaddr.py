@@ -0,0 +1,97 @@
+"""
+External address monitoring
+
+Resolves the external address a node advertises to satellites and compares
+it with the host's current public IP, catching dynamic DNS records that
+stopped updating and silently cut off ingress.
+"""
+
+import asyncio
+import ipaddress
+import logging
+import socket
+import time
+from typing import Dict, List, Optional, Tuple
+
+import aiohttp
+
+# Services returning the caller's public IP as plain text, tried in order
+PUBLIC_IP_URLS = (
+    'https://api.ipify.org',
+    'https://ifconfig.me/ip',
+    'https://icanhazip.com',
+)
+
+# Seconds a looked-up public IP is reused
+PUBLIC_IP_TTL = 300
+
+
+def split_address(address: str) -> Tuple[str, Optional[int]]:
+    """Split a node's HOST:PORT external address"""
+    host, sep, port = address.strip().rpartition(':')
+    if not sep or not port.isdigit() or (host.count(':') and not host.startswith('[')):
+        return address.strip().strip('[]'), None
+    return host.strip('[]'), int(port)
+
+
+async def resolve_host(host: str) -> List[str]:
+    """All addresses a host name resolves to (an IP literal resolves to itself)"""
+    try:
+        return [str(ipaddress.ip_address(host))]
+    except ValueError:
+        pass
+    loop = asyncio.get_running_loop()
+    try:
+        infos = await loop.getaddrinfo(host, None, type=socket.SOCK_STREAM)
+    except socket.gaierror:
+        return []
+    return sorted({info[4][0] for info in infos})
+
+
+class PublicIpLookup:
+    """Looks up the host's public IP, caching it for PUBLIC_IP_TTL seconds"""
+
+    def __init__(self, timeout: float = 10, logger=None):
+        self.timeout = timeout
+        self.logger = logger or logging.getLogger(__name__)
+        self.address: Optional[str] = None
+        self.looked_up = 0.0
+
+    async def get(self) -> Optional[str]:
+        if self.address and time.time() - self.looked_up < PUBLIC_IP_TTL:
+            return self.address
+
+        # A separate session, so the dashboard token is never sent to these services
+        async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=self.timeout)) as session:
+            for url in PUBLIC_IP_URLS:
+                try:
+                    async with session.get(url) as response:
+                        if response.status != 200:
+                            continue
+                        address = str(ipaddress.ip_address((await response.text()).strip()))
+                except (aiohttp.ClientError, asyncio.TimeoutError, OSError, ValueError) as e:
+                    self.logger.debug("Public IP lookup via %s failed: %s", url, e)
+                    continue
+                self.address, self.looked_up = address, time.time()
+                return address
+
+        self.logger.warning("Could not determine the public IP address")
+        return None
+
+
+async def check_external_address(external_address: str, public_ip: str) -> Dict:
+    """Compare a node's external address with the public IP
+
+    The result's matches is False when the name does not resolve or none of
+    its addresses is the public IP.
+    """
+    host, port = split_address(external_address)
+    resolved = await resolve_host(host)
+    return {
+        'external_address': external_address,
+        'host': host,
+        'port': port,
+        'resolved': resolved,
+        'public_ip': public_ip,
+        'matches': public_ip in resolved,
+    }
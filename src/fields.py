@@ -0,0 +1,63 @@
+"""
+Upload field filtering
+
+Removes fields operators do not want to share from the payloads uploaded to
+the dashboard, such as external addresses or host details. Fields are named by
+dotted paths (`client.host`, `satellites.url`) with shell-style wildcards;
+list items are filtered like the object containing them. Local history keeps
+the unfiltered data.
+"""
+
+import fnmatch
+from typing import Any, Iterable, List
+
+# Fields the dashboard cannot do without
+REQUIRED_FIELDS = {'nodeId'}
+
+
+class FieldFilter:
+    """Allow and deny lists of payload fields
+
+    With an allow list, only the listed fields (and everything below them) are
+    uploaded; the deny list is applied afterwards and always wins.
+    """
+
+    def __init__(self, allow: Iterable[str] = (), deny: Iterable[str] = ()):
+        self.allow: List[str] = list(allow or [])
+        self.deny: List[str] = list(deny or [])
+
+    def __bool__(self) -> bool:
+        return bool(self.allow or self.deny)
+
+    def _matches(self, path: str, patterns: List[str]) -> bool:
+        return any(fnmatch.fnmatchcase(path, pattern) for pattern in patterns)
+
+    def _leads_to_allowed(self, path: str) -> bool:
+        """Whether an allowed field lies below this path"""
+        depth = path.count('.') + 1
+        return any(fnmatch.fnmatchcase(path, '.'.join(pattern.split('.')[:depth]))
+                   for pattern in self.allow if pattern.count('.') >= depth)
+
+    def apply(self, payload: Any) -> Any:
+        """A filtered copy of a payload"""
+        return self._filter(payload, '', allowed=not self.allow)
+
+    def _filter(self, value: Any, prefix: str, allowed: bool) -> Any:
+        if isinstance(value, list):
+            return [self._filter(item, prefix, allowed) for item in value]
+        if not isinstance(value, dict):
+            return value
+
+        result = {}
+        for key, item in value.items():
+            path = f"{prefix}{key}"
+            if prefix == '' and key in REQUIRED_FIELDS:
+                result[key] = item
+                continue
+            if self._matches(path, self.deny):
+                continue
+            if allowed or self._matches(path, self.allow):
+                result[key] = self._filter(item, path + '.', allowed=True)
+            elif isinstance(item, (dict, list)) and self._leads_to_allowed(path):
+                result[key] = self._filter(item, path + '.', allowed=False)
+        return result
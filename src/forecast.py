@@ -0,0 +1,65 @@
+"""
+Disk usage forecasting
+
+Fits a linear trend to a node's stored disk usage history and projects when
+the allocated space will be exhausted.
+"""
+
+import time
+from typing import Dict, List, Optional
+
+from .store import HistoryStore
+
+# History used for the trend
+FORECAST_WINDOW = 14 * 86400
+
+# Minimum time span of history before a forecast is made
+MIN_FORECAST_SPAN = 6 * 3600
+
+
+def forecast_disk_full(samples: List[Dict]) -> Optional[Dict]:
+    """Project when a node runs out of allocated space from its samples
+
+    Returns None while there is too little history or usage is not growing.
+    """
+    points = [(s['ts'], s['disk_used']) for s in samples if s.get('disk_used') is not None]
+    if len(points) < 2 or points[-1][0] - points[0][0] < MIN_FORECAST_SPAN:
+        return None
+
+    # Least-squares slope of used bytes over time
+    n = len(points)
+    mean_t = sum(t for t, _ in points) / n
+    mean_u = sum(u for _, u in points) / n
+    variance = sum((t - mean_t) ** 2 for t, _ in points)
+    if not variance:
+        return None
+    slope = sum((t - mean_t) * (u - mean_u) for t, u in points) / variance
+    if slope <= 0:
+        return None
+
+    latest = samples[-1]
+    free = latest.get('disk_available') or 0
+    seconds_left = free / slope
+    return {
+        'growth_per_day': slope * 86400,
+        'free': free,
+        'days_left': seconds_left / 86400,
+        'full_at': latest['ts'] + seconds_left,
+    }
+
+
+def node_forecast(store: HistoryStore, node_id: str, now: Optional[float] = None) -> Optional[Dict]:
+    """Disk-full forecast for a node from the local history store"""
+    now = now or time.time()
+    return forecast_disk_full(store.samples(now - FORECAST_WINDOW, now + 1, node_id))
+
+
+def format_days_left(forecast: Optional[Dict]) -> str:
+    if not forecast:
+        return '-'
+    days = forecast['days_left']
+    if days < 1:
+        return '<1 day'
+    if days > 999:
+        return '>999 days'
+    return f"~{days:.0f} days"
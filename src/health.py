@@ -0,0 +1,76 @@
+"""
+Node health score
+
+Folds a node's availability, reputation scores, audit success rate and
+version status into a single score from 0 to 100, for triage across a fleet.
+Each component is a value between 0 and 1; components a node does not report
+are left out and the remaining weights scaled up.
+"""
+
+from typing import Dict, List, Optional
+
+# Default weight of each component
+HEALTH_WEIGHTS = {
+    'uptime': 2.0,
+    'audit': 3.0,
+    'suspension': 2.0,
+    'online': 2.0,
+    'success': 1.0,
+    'version': 0.5,
+}
+
+# Score bands shown in status output
+GOOD_HEALTH = 90
+FAIR_HEALTH = 70
+
+
+def health_components(metrics: Dict) -> Dict[str, float]:
+    """Component values of a node from its status metrics"""
+    if not metrics.get('reachable'):
+        # An unreachable node is down; its last known scores are not at hand
+        return {'uptime': 0.0}
+    components = {'uptime': 0.0 if metrics.get('status') == 'OFFLINE' else 1.0}
+    for component in ('audit', 'suspension', 'online'):
+        score = metrics.get(f'{component}_score')
+        if score is not None:
+            components[component] = max(0.0, min(1.0, float(score)))
+    if metrics.get('audit_success_rate') is not None:
+        components['success'] = metrics['audit_success_rate']
+    if metrics.get('up_to_date') is not None:
+        components['version'] = 1.0 if metrics['up_to_date'] else 0.0
+    return components
+
+
+def audit_success_rate(sno: Dict) -> Optional[float]:
+    """Share of successful audits, where the node API reports the counts"""
+    audit = sno.get('audit') or {}
+    total = audit.get('totalCount') or 0
+    return audit.get('successCount', 0) / total if total else None
+
+
+def health_score(metrics: Dict, weights: Optional[Dict[str, float]] = None) -> Dict:
+    """Weighted health score of a node, with the components it is made of
+
+    Disqualified nodes always score 0.
+    """
+    weights = {**HEALTH_WEIGHTS, **(weights or {})}
+    components = health_components(metrics)
+    total = sum(weights[name] for name in components)
+    score = sum(weights[name] * value for name, value in components.items()) / total * 100 if total else 0.0
+    if metrics.get('status') == 'DISQUALIFIED':
+        score = 0.0
+    return {'score': round(score, 1), 'components': components}
+
+
+def health_band(score: Optional[float]) -> Optional[str]:
+    if score is None:
+        return None
+    if score >= GOOD_HEALTH:
+        return 'good'
+    return 'fair' if score >= FAIR_HEALTH else 'poor'
+
+
+def health_problems(components: Dict[str, float]) -> List[str]:
+    """Components dragging a score down, worst first"""
+    weak = sorted((value, name) for name, value in components.items() if value < 0.95)
+    return [f"{name} {value:.2f}" for value, name in weak]
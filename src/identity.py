@@ -0,0 +1,178 @@
+"""
+Node identity inspection
+
+Reads a storage node's identity directory on the local host and checks the
+certificate chain, that the NodeID derived from the CA key matches the
+registered one, and that the private keys are not readable by others.
+"""
+
+import hashlib
+import logging
+import os
+import stat
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Dict, List, Optional
+
+IDENTITY_FILES = ('identity.cert', 'identity.key', 'ca.cert')
+PRIVATE_KEY_FILES = ('identity.key', 'ca.key')
+
+# Proof-of-work difficulty satellites require of node identities
+MIN_DIFFICULTY = 36
+
+# Mount point of the identity directory in storagenode containers
+CONTAINER_IDENTITY_DIR = '/app/identity'
+
+BASE58_ALPHABET = '123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz'
+
+
+def _base58check(payload: bytes, version: int = 0) -> str:
+    data = bytes([version]) + payload
+    data += hashlib.sha256(hashlib.sha256(data).digest()).digest()[:4]
+    number = int.from_bytes(data, 'big')
+    encoded = ''
+    while number:
+        number, remainder = divmod(number, 58)
+        encoded = BASE58_ALPHABET[remainder] + encoded
+    leading = len(data) - len(data.lstrip(b'\0'))
+    return '1' * leading + encoded
+
+
+def valid_node_id(value: str) -> bool:
+    """Whether a string is a well-formed NodeID: base58check of version 0 and a 32-byte ID"""
+    if not isinstance(value, str) or not value or any(char not in BASE58_ALPHABET for char in value):
+        return False
+    number = 0
+    for char in value:
+        number = number * 58 + BASE58_ALPHABET.index(char)
+    leading = len(value) - len(value.lstrip('1'))
+    data = b'\0' * leading + (number.to_bytes((number.bit_length() + 7) // 8, 'big') if number else b'')
+    if len(data) != 37 or data[0] != 0:
+        return False
+    return hashlib.sha256(hashlib.sha256(data[:-4]).digest()).digest()[:4] == data[-4:]
+
+
+def _difficulty(node_id: bytes) -> int:
+    """Trailing zero bits of the ID hash"""
+    bits = 0
+    for byte in reversed(node_id):
+        if byte:
+            return bits + ((byte & -byte).bit_length() - 1)
+        bits += 8
+    return bits
+
+
+def derive_node_id(ca_certificate) -> Dict:
+    """NodeID and difficulty derived from a CA certificate's public key"""
+    from cryptography.hazmat.primitives import serialization
+
+    public_key = ca_certificate.public_key().public_bytes(
+        serialization.Encoding.DER, serialization.PublicFormat.SubjectPublicKeyInfo)
+    digest = hashlib.sha256(public_key).digest()
+    return {'node_id': _base58check(digest), 'difficulty': _difficulty(digest)}
+
+
+def _verify_signed_by(certificate, issuer) -> bool:
+    from cryptography.exceptions import InvalidSignature
+    from cryptography.hazmat.primitives.asymmetric import ec
+
+    try:
+        issuer.public_key().verify(certificate.signature, certificate.tbs_certificate_bytes,
+                                   ec.ECDSA(certificate.signature_hash_algorithm))
+    except (InvalidSignature, TypeError, ValueError):
+        return False
+    return True
+
+
+def _check_permissions(directory: Path, problems: List[str], warnings: List[str]):
+    for name in PRIVATE_KEY_FILES:
+        path = directory / name
+        if not path.exists():
+            continue
+        mode = path.stat().st_mode
+        if mode & (stat.S_IRWXG | stat.S_IRWXO):
+            problems.append(f"{name} is accessible by other users (mode {stat.S_IMODE(mode):o}, use 600)")
+    if (directory / 'ca.key').exists():
+        warnings.append("ca.key is kept next to the node; it is only needed to create identities "
+                        "and is safer backed up offline")
+
+
+def inspect_identity(directory: Path, expected_node_id: Optional[str] = None, logger=None) -> Dict:
+    """Check the health of an identity directory
+
+    Returns the derived node ID and difficulty with lists of problems (the
+    identity is broken or exposed) and warnings. healthy is None when the
+    directory could not be inspected at all.
+    """
+    logger = logger or logging.getLogger(__name__)
+    directory = Path(directory)
+    result = {'directory': str(directory), 'node_id': None, 'difficulty': None,
+              'problems': [], 'warnings': [], 'healthy': None}
+    problems, warnings = result['problems'], result['warnings']
+
+    try:
+        from cryptography import x509
+        from cryptography.hazmat.primitives import serialization
+    except ImportError:
+        warnings.append("Install the cryptography package to inspect identities")
+        return result
+
+    if not directory.is_dir():
+        warnings.append(f"Identity directory {directory} not found on this host")
+        return result
+
+    missing = [name for name in IDENTITY_FILES if not (directory / name).exists()]
+    if missing:
+        problems.append(f"Missing {', '.join(missing)}")
+        result['healthy'] = False
+        return result
+
+    try:
+        chain = x509.load_pem_x509_certificates((directory / 'identity.cert').read_bytes())
+        ca = x509.load_pem_x509_certificate((directory / 'ca.cert').read_bytes())
+        key = serialization.load_pem_private_key((directory / 'identity.key').read_bytes(), password=None)
+    except PermissionError as e:
+        warnings.append(f"Cannot read identity files: {e}")
+        return result
+    except (OSError, ValueError) as e:
+        problems.append(f"Unreadable identity file: {e}")
+        result['healthy'] = False
+        return result
+
+    leaf = chain[0]
+    if len(chain) < 2 or chain[-1] != ca:
+        problems.append("identity.cert does not end with the certificate from ca.cert")
+    if not _verify_signed_by(leaf, ca):
+        problems.append("identity.cert is not signed by the CA in ca.cert")
+    public_format = (serialization.Encoding.DER, serialization.PublicFormat.SubjectPublicKeyInfo)
+    if key.public_key().public_bytes(*public_format) != leaf.public_key().public_bytes(*public_format):
+        problems.append("identity.key does not belong to identity.cert")
+
+    now = datetime.now(timezone.utc)
+    for name, certificate in (('identity.cert', leaf), ('ca.cert', ca)):
+        if certificate.not_valid_after_utc < now:
+            problems.append(f"{name} expired on {certificate.not_valid_after_utc:%Y-%m-%d}")
+
+    derived = derive_node_id(ca)
+    result.update(derived)
+    if expected_node_id and derived['node_id'] != expected_node_id:
+        problems.append(f"Identity is for node {derived['node_id'][:12]}…, "
+                        f"not the registered node {expected_node_id[:12]}…")
+    if derived['difficulty'] < MIN_DIFFICULTY:
+        problems.append(f"Identity difficulty {derived['difficulty']} is below the required {MIN_DIFFICULTY}")
+
+    try:
+        _check_permissions(directory, problems, warnings)
+    except OSError as e:
+        logger.debug("Failed to check identity permissions: %s", e)
+
+    result['healthy'] = not problems
+    return result
+
+
+def identity_dir(node: Dict) -> Optional[Path]:
+    """Identity directory of a registered node, if recorded at discovery"""
+    directory = (node.get('config') or {}).get('identityDir') or node.get('identityDir')
+    if directory:
+        return Path(os.path.expanduser(directory))
+    return None
@@ -0,0 +1,158 @@
+"""
+Host inventories
+
+Reads the hosts to scan from an Ansible inventory (INI or YAML) or a plain
+file with one host per line, so fleets already described for Ansible can be
+discovered in one run. Inventory groups become node tags, which can map nodes
+to dashboard accounts.
+"""
+
+import re
+from pathlib import Path
+from typing import Dict, List, Optional
+
+import yaml
+
+# Groups every Ansible host implicitly belongs to
+IMPLICIT_GROUPS = {'all', 'ungrouped'}
+
+# Ansible host ranges such as node[01:20].lan or rack-[a:c]
+RANGE_PATTERN = re.compile(r'\[([0-9]+|[a-z]):([0-9]+|[a-z])(?::([0-9]+))?\]')
+
+
+class Inventory:
+    """Hosts with the groups they belong to"""
+
+    def __init__(self):
+        # Host name -> address to scan (ansible_host, or the name itself)
+        self.addresses: Dict[str, str] = {}
+        self.groups: Dict[str, List[str]] = {}
+        self.children: Dict[str, List[str]] = {}
+
+    def add_host(self, name: str, group: str = 'ungrouped', address: Optional[str] = None):
+        for host in expand_range(name):
+            if address or host not in self.addresses:
+                self.addresses[host] = address or host
+            members = self.groups.setdefault(group, [])
+            if host not in members:
+                members.append(host)
+
+    def add_child(self, parent: str, child: str):
+        self.children.setdefault(parent, []).append(child)
+        self.groups.setdefault(child, [])
+
+    def hosts(self, group: Optional[str] = None) -> List[str]:
+        """Names of the hosts in a group and its child groups, by default all hosts"""
+        if not group or group == 'all':
+            return list(self.addresses)
+        if group not in self.groups and group not in self.children:
+            raise ValueError(f"no group {group!r} in inventory")
+        hosts, pending, seen = [], [group], set()
+        while pending:
+            current = pending.pop(0)
+            if current in seen:
+                continue
+            seen.add(current)
+            hosts.extend(host for host in self.groups.get(current, []) if host not in hosts)
+            pending.extend(self.children.get(current, []))
+        return hosts
+
+    def tags(self, host: str) -> List[str]:
+        """Explicit groups of a host, including the parents of its groups"""
+        direct = [group for group, members in self.groups.items() if host in members]
+        tags = []
+        while direct:
+            group = direct.pop(0)
+            if group in tags or group in IMPLICIT_GROUPS:
+                continue
+            tags.append(group)
+            direct.extend(parent for parent, children in self.children.items() if group in children)
+        return tags
+
+
+def expand_range(pattern: str) -> List[str]:
+    """Expand the first Ansible host range in a name, recursively"""
+    match = RANGE_PATTERN.search(pattern)
+    if not match:
+        return [pattern]
+    start, end, step = match.group(1), match.group(2), int(match.group(3) or 1)
+    if start.isdigit() != end.isdigit():
+        raise ValueError(f"invalid host range in {pattern!r}")
+    if start.isdigit():
+        width = len(start) if start.startswith('0') else 0
+        values = [str(value).zfill(width) for value in range(int(start), int(end) + 1, step)]
+    else:
+        values = [chr(value) for value in range(ord(start), ord(end) + 1, step)]
+    if not values:
+        raise ValueError(f"empty host range in {pattern!r}")
+    prefix, suffix = pattern[:match.start()], pattern[match.end():]
+    return [host for value in values for host in expand_range(prefix + value + suffix)]
+
+
+def _host_vars(fields: List[str]) -> Dict[str, str]:
+    return dict(field.split('=', 1) for field in fields if '=' in field)
+
+
+def parse_ini(text: str) -> Inventory:
+    """Ansible INI inventory; a plain list of hosts is one too"""
+    inventory = Inventory()
+    group, kind = 'ungrouped', 'hosts'
+    for number, raw in enumerate(text.splitlines(), 1):
+        line = re.split(r'\s[#;]', raw.strip(), maxsplit=1)[0].strip()
+        if not line or line.startswith(('#', ';')):
+            continue
+        if line.startswith('['):
+            if not line.endswith(']'):
+                raise ValueError(f"line {number}: unterminated group header")
+            group, _, kind = line[1:-1].partition(':')
+            kind = kind or 'hosts'
+            if kind == 'hosts':
+                inventory.groups.setdefault(group, [])
+            continue
+        fields = line.split()
+        if kind == 'hosts':
+            inventory.add_host(fields[0], group, _host_vars(fields[1:]).get('ansible_host'))
+        elif kind == 'children':
+            inventory.add_child(group, fields[0])
+    return inventory
+
+
+def parse_yaml(text: str) -> Inventory:
+    """Ansible YAML inventory"""
+    inventory = Inventory()
+
+    def walk(name: str, group: Dict):
+        group = group or {}
+        if not isinstance(group, dict):
+            raise ValueError(f"group {name!r} is not a mapping")
+        inventory.groups.setdefault(name, [])
+        for host, host_vars in (group.get('hosts') or {}).items():
+            inventory.add_host(str(host), name, (host_vars or {}).get('ansible_host'))
+        for child, child_group in (group.get('children') or {}).items():
+            inventory.add_child(name, child)
+            walk(child, child_group)
+
+    data = yaml.safe_load(text) or {}
+    if not isinstance(data, dict):
+        raise ValueError("not an Ansible YAML inventory")
+    for name, group in data.items():
+        walk(name, group)
+    return inventory
+
+
+def load_inventory(path: str) -> Inventory:
+    """Read an inventory file, YAML if it ends in .yml or .yaml
+
+    Raises ValueError if the file cannot be read or parsed.
+    """
+    path = Path(path).expanduser()
+    try:
+        text = path.read_text()
+    except OSError as e:
+        raise ValueError(f"cannot read {path}: {e}")
+    try:
+        if path.suffix in ('.yml', '.yaml'):
+            return parse_yaml(text)
+        return parse_ini(text)
+    except (yaml.YAMLError, ValueError) as e:
+        raise ValueError(f"{path}: {e}")
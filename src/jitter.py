@@ -0,0 +1,51 @@
+"""
+Fleet load spreading
+
+Daemons on many servers started with the same interval would otherwise all
+hit the dashboard at the same moment. Each machine derives a stable fraction
+from its machine ID, used to delay its first cycle by part of the startup
+jitter and to run its cycles at its own offset within every interval. The
+offsets are deterministic, so a restarted daemon keeps its place in the fleet.
+"""
+
+import hashlib
+import socket
+from pathlib import Path
+from typing import Optional
+
+MACHINE_ID_FILES = ('/etc/machine-id', '/var/lib/dbus/machine-id')
+
+
+def machine_id() -> str:
+    """The systemd machine ID, or the hostname where there is none"""
+    for path in MACHINE_ID_FILES:
+        try:
+            value = Path(path).read_text().strip()
+        except OSError:
+            continue
+        if value:
+            return value
+    return socket.gethostname()
+
+
+def fleet_fraction(seed: str, purpose: str) -> float:
+    """A stable number in [0, 1) for this seed, different per purpose"""
+    digest = hashlib.sha256(f"{purpose}:{seed}".encode()).digest()
+    return int.from_bytes(digest[:8], 'big') / 2 ** 64
+
+
+def startup_delay(seed: str, jitter: float) -> float:
+    """Seconds to wait before the first cycle, up to jitter"""
+    return fleet_fraction(seed, 'startup') * jitter if jitter > 0 else 0.0
+
+
+def phase_offset(seed: str, interval: float) -> float:
+    """This machine's offset of cycle starts within the interval"""
+    return fleet_fraction(seed, 'phase') * interval
+
+
+def next_phase(now: float, interval: float, offset: Optional[float]) -> float:
+    """Start of the next cycle: a full interval from now, or the next time at the offset"""
+    if offset is None:
+        return now + interval
+    return now + interval - (now - offset) % interval
@@ -0,0 +1,62 @@
+"""
+JSON Lines output
+
+With --output jsonl, long-running commands (discover, sync, status --watch)
+write one JSON object per line to stdout as things happen, such as a node
+found, a node synced or an error, so other tools can follow a run without
+parsing log lines. Every event has an `event` name and a `ts` timestamp;
+warnings and errors logged while streaming are emitted as events as well;
+the error that ends a command carries its kind, exit code and whether it is
+retryable (see errors.py). Logs still go to stderr.
+"""
+
+import json
+import logging
+import sys
+from datetime import datetime, timezone
+from typing import Optional, TextIO
+
+OUTPUT_FORMATS = ('text', 'jsonl')
+
+# Where events go once streaming is enabled
+_stream: Optional[TextIO] = None
+
+
+def set_output(output: str, stream: Optional[TextIO] = None):
+    """Stream events to stream (stdout by default) if output is jsonl"""
+    global _stream
+    _stream = (stream or sys.stdout) if output == 'jsonl' else None
+    if _stream:
+        root = logging.getLogger('storjcloud-client')
+        if not any(isinstance(handler, EventHandler) for handler in root.handlers):
+            root.addHandler(EventHandler())
+
+
+def streaming() -> bool:
+    return _stream is not None
+
+
+def emit(event: str, **fields):
+    """Write an event line, if streaming; fields that are None are left out"""
+    if _stream is None:
+        return
+    record = {'event': event, 'ts': datetime.now(timezone.utc).isoformat(timespec='milliseconds')}
+    record.update((key, value) for key, value in fields.items() if value is not None)
+    _stream.write(json.dumps(record, default=str) + '\n')
+    _stream.flush()
+
+
+class EventHandler(logging.Handler):
+    """Emits logged warnings and errors as warning and error events"""
+
+    def __init__(self):
+        super().__init__(logging.WARNING)
+
+    def emit(self, record: logging.LogRecord):
+        try:
+            message = record.getMessage()
+        except Exception:
+            message = str(record.msg)
+        emit('error' if record.levelno >= logging.ERROR else 'warning',
+             message=message, component=record.name.partition('.')[2] or None,
+             error=getattr(record, 'error', None))
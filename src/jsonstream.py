@@ -0,0 +1,141 @@
+"""
+Streaming JSON array decoding
+
+Decodes the items of a large JSON array incrementally as response chunks
+arrive, keeping only selected fields of each item, so a node's full response
+body is never held in memory at once.
+"""
+
+import json
+from typing import Dict, Iterable, List, Optional
+
+_WHITESPACE = ' \t\r\n'
+
+
+class JsonArrayStream:
+    """Incremental decoder for a top-level JSON array, or an array under a top-level key"""
+
+    def __init__(self, key: Optional[str] = None, fields: Optional[Iterable[str]] = None):
+        self.key = key
+        self.fields = set(fields) if fields else None
+        self.decoder = json.JSONDecoder()
+        self.buffer = ''
+        self.pos = 0
+        self.done = False
+
+        # Scanner state while looking for the array start
+        self.in_array = False
+        self.depth = 0
+        self.in_string = False
+        self.escape = False
+        self.string_start = 0
+        self.last_key = None
+        self.expect_key = False
+
+    def feed(self, chunk: str) -> List[Dict]:
+        """Add response text and return the items completed by it"""
+        if self.done:
+            return []
+        self.buffer += chunk
+        if not self.in_array and not self._seek():
+            return []
+        return self._items()
+
+    def close(self):
+        """Signal the end of the response"""
+        if not self.done and self.in_array:
+            raise ValueError("Truncated JSON array")
+
+    def _select(self, item):
+        if self.fields is None or not isinstance(item, dict):
+            return item
+        return {k: v for k, v in item.items() if k in self.fields}
+
+    def _seek(self) -> bool:
+        """Scan forward to the opening bracket of the wanted array"""
+        buf = self.buffer
+        while self.pos < len(buf):
+            char = buf[self.pos]
+            self.pos += 1
+
+            if self.in_string:
+                if self.escape:
+                    self.escape = False
+                elif char == '\\':
+                    self.escape = True
+                elif char == '"':
+                    self.in_string = False
+                    if self.depth == 1 and self.expect_key:
+                        self.last_key = json.loads(buf[self.string_start:self.pos])
+                        self.expect_key = False
+                continue
+
+            if char in _WHITESPACE:
+                continue
+            if self.key is None:
+                if char != '[':
+                    raise ValueError("Expected a JSON array")
+                return self._enter_array()
+
+            if char == '"':
+                self.in_string = True
+                self.string_start = self.pos - 1
+            elif char in '{[':
+                if self.depth == 1 and char == '[' and self.last_key == self.key:
+                    return self._enter_array()
+                self.depth += 1
+                self.expect_key = char == '{' and self.depth == 1
+            elif char in '}]':
+                self.depth -= 1
+                if self.depth == 0:
+                    # End of the document without the key
+                    self.done = True
+                    return False
+            elif char == ',' and self.depth == 1:
+                self.last_key = None
+                self.expect_key = True
+            elif char != ':' and self.depth == 1:
+                # A scalar value at the top level ends any pending key match
+                if self.last_key == self.key:
+                    self.done = True
+                    return False
+
+        # Keep a key string that is split across chunks
+        keep = self.string_start if self.in_string else self.pos
+        self.buffer = buf[keep:]
+        self.pos -= keep
+        self.string_start -= keep
+        return False
+
+    def _enter_array(self) -> bool:
+        self.in_array = True
+        self._compact()
+        return True
+
+    def _items(self) -> List[Dict]:
+        items = []
+        buf = self.buffer
+        while True:
+            while self.pos < len(buf) and buf[self.pos] in _WHITESPACE + ',':
+                self.pos += 1
+            if self.pos >= len(buf):
+                break
+            if buf[self.pos] == ']':
+                self.done = True
+                break
+            try:
+                item, end = self.decoder.raw_decode(buf, self.pos)
+            except ValueError:
+                # Incomplete item, wait for more data
+                break
+            if end == len(buf) and not isinstance(item, (dict, list)):
+                # A number may continue in the next chunk
+                break
+            items.append(self._select(item))
+            self.pos = end
+        self._compact()
+        return items
+
+    def _compact(self):
+        self.buffer = self.buffer[self.pos:]
+        self.pos = 0
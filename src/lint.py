@@ -0,0 +1,160 @@
+"""
+Storagenode configuration linting
+
+Parses a storage node's config.yaml and the parameters of its docker run
+command, and flags settings that are known to cause trouble: disabled or
+reduced logging, unsafe storage settings and deprecated flags.
+"""
+
+from dataclasses import asdict, dataclass
+from pathlib import Path
+from typing import Dict, Iterable, List, Optional
+
+import yaml
+
+from .wallet import KNOWN_FEATURES
+
+ERROR = 'error'
+WARNING = 'warning'
+INFO = 'info'
+
+# Storagenode settings supplied through container environment variables
+ENV_SETTINGS = {
+    'STORAGE': 'storage.allocated-disk-space',
+    'ADDRESS': 'contact.external-address',
+    'EMAIL': 'operator.email',
+    'WALLET': 'operator.wallet',
+}
+
+# Flags that no longer have any effect, and why
+DEPRECATED = {
+    'storage.allocated-bandwidth': "bandwidth is no longer limited by the node",
+    'storage2.monitor.minimum-bandwidth': "bandwidth is no longer limited by the node",
+    'kademlia.': "Kademlia was replaced by satellite contact",
+}
+
+QUIET_LOG_LEVELS = ('error', 'fatal', 'panic', 'dpanic')
+
+
+@dataclass
+class Finding:
+    """One linted setting"""
+    key: str
+    severity: str
+    message: str
+    source: Optional[str] = None
+
+    def to_dict(self) -> Dict:
+        return asdict(self)
+
+
+def _flatten(data: Dict, prefix: str = '') -> Dict:
+    flat = {}
+    for key, value in (data or {}).items():
+        name = f"{prefix}{key}"
+        if isinstance(value, dict):
+            flat.update(_flatten(value, f"{name}."))
+        else:
+            flat[name] = value
+    return flat
+
+
+def load_config_file(path: Path) -> Dict:
+    """Settings of a storagenode config.yaml as flat dotted keys"""
+    data = yaml.safe_load(Path(path).read_text()) or {}
+    if not isinstance(data, dict):
+        raise ValueError(f"{path} is not a YAML mapping")
+    return {key: (value, str(path)) for key, value in _flatten(data).items()}
+
+
+def parse_flags(args: Iterable[str], source: str = 'docker run') -> Dict:
+    """Settings from --key=value and --key value command line arguments"""
+    settings = {}
+    args = list(args)
+    i = 0
+    while i < len(args):
+        arg = args[i]
+        i += 1
+        if not arg.startswith('--'):
+            continue
+        key, sep, value = arg[2:].partition('=')
+        if not sep:
+            if i < len(args) and not args[i].startswith('--'):
+                value = args[i]
+                i += 1
+            else:
+                value = 'true'
+        try:
+            settings[key] = (yaml.safe_load(value) if value else value, source)
+        except yaml.YAMLError:
+            settings[key] = (value, source)
+    return settings
+
+
+def parse_env(env: Iterable[str], source: str = 'docker run') -> Dict:
+    """Settings from the container's environment variables"""
+    settings = {}
+    for entry in env:
+        name, _, value = entry.partition('=')
+        if name in ENV_SETTINGS:
+            settings[ENV_SETTINGS[name]] = (value, source)
+    return settings
+
+
+def container_settings(attrs: Dict) -> Dict:
+    """Settings passed to a storagenode container, from docker inspect data"""
+    source = f"container {attrs.get('Name', '').lstrip('/')}"
+    settings = parse_env(attrs.get('Config', {}).get('Env') or [], source)
+    settings.update(parse_flags(attrs.get('Args') or [], source))
+    return settings
+
+
+def _false(value) -> bool:
+    return value is False or str(value).lower() in ('false', '0', 'no')
+
+
+def lint_settings(settings: Dict) -> List[Finding]:
+    """Check settings given as {key: (value, source)}"""
+    findings = []
+
+    def add(key, severity, message):
+        findings.append(Finding(key, severity, message, settings.get(key, (None, None))[1]))
+
+    level = str(settings.get('log.level', ('info',))[0]).lower()
+    if level in QUIET_LOG_LEVELS:
+        add('log.level', WARNING, f"Log level {level} hides warnings such as failed audits and uploads")
+    output = str(settings.get('log.output', ('',))[0])
+    if output in ('/dev/null', 'none'):
+        add('log.output', ERROR, "Logging is disabled; failures cannot be diagnosed")
+
+    if 'filestore.force-sync' in settings and _false(settings['filestore.force-sync'][0]):
+        add('filestore.force-sync', WARNING,
+            "Disk sync is disabled; pieces written just before a power loss can be lost and fail audits")
+    if 'storage2.piece-scan-on-startup' in settings and _false(settings['storage2.piece-scan-on-startup'][0]):
+        add('storage2.piece-scan-on-startup', WARNING,
+            "Used space is not recalculated on startup and drifts from what is really on disk")
+    if 'server.use-peer-ca-whitelist' in settings and _false(settings['server.use-peer-ca-whitelist'][0]):
+        add('server.use-peer-ca-whitelist', ERROR, "Peers are not checked against the trusted CA list")
+    if 'operator.wallet-features' in settings:
+        features = settings['operator.wallet-features'][0]
+        features = features if isinstance(features, list) else str(features or '').split(',')
+        features = [str(feature).strip() for feature in features if str(feature).strip()]
+        unknown = [feature for feature in features if feature.lower() not in KNOWN_FEATURES]
+        if unknown:
+            add('operator.wallet-features', WARNING,
+                f"Unknown wallet feature {', '.join(unknown)} (known: {', '.join(KNOWN_FEATURES)})")
+    if 'storage.allocated-disk-space' not in settings:
+        add('storage.allocated-disk-space', INFO, "No allocation set; the node uses its built-in default")
+
+    for key in sorted(settings):
+        for prefix, reason in DEPRECATED.items():
+            if key == prefix or (prefix.endswith('.') and key.startswith(prefix)):
+                add(key, WARNING, f"Deprecated flag: {reason}")
+    return findings
+
+
+def lint_summary(findings: List[Finding]) -> str:
+    counts = {severity: sum(1 for f in findings if f.severity == severity) for severity in (ERROR, WARNING, INFO)}
+    if not findings:
+        return "no issues"
+    return ', '.join(f"{count} {severity}{'s' if count != 1 else ''}" for severity, count in counts.items() if count)
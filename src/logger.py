@@ -2,31 +2,81 @@
 Logging configuration
 
 Sets up structured logging with appropriate formatting and levels.
+Components log through child loggers (storjcloud-client.sync, ...) so
+their levels can be set individually with logging.levels.
 """
 
 import logging
 import sys
 from pathlib import Path
-from typing import Optional
+from typing import Dict, Optional
 
 import coloredlogs
 
+# Components with their own logger and configurable level
+LOG_COMPONENTS = ['discovery', 'sync', 'api', 'alerts', 'agent', 'aggregator', 'history']
 
-def setup_logger(level: str = 'info', log_file: Optional[str] = None) -> logging.Logger:
-    """Setup structured logging with colors and file output"""
+
+def _numeric_level(level: str) -> int:
+    return getattr(logging, level.upper(), logging.INFO)
+
+
+def setup_logger(level: str = 'info', log_file: Optional[str] = None,
+                 color: bool = True, levels: Optional[Dict[str, str]] = None) -> logging.Logger:
+    """Setup structured logging with colors and file output
+    
+    levels overrides the level of individual components; components not
+    listed use the global level.
+    """
     
     # Get logger
     logger = logging.getLogger('storjcloud-client')
     
     # Set level
-    numeric_level = getattr(logging, level.upper(), logging.INFO)
-    logger.setLevel(numeric_level)
+    logger.setLevel(_numeric_level(level))
+    for component in LOG_COMPONENTS:
+        component_level = (levels or {}).get(component)
+        get_logger(component).setLevel(_numeric_level(component_level) if component_level else logging.NOTSET)
+    
+    # Handlers pass everything a component may log; the loggers do the filtering
+    numeric_level = min([logger.level] + [get_logger(c).level for c in LOG_COMPONENTS if get_logger(c).level])
     
     # Clear existing handlers
     logger.handlers.clear()
     
-    # Console handler with colors
     console_format = '%(asctime)s %(name)s[%(process)d] %(levelname)s %(message)s'
+    
+    if not color:
+        # Plain, stable console output for scripts and CI
+        console_handler = logging.StreamHandler(sys.stderr)
+        console_handler.setLevel(numeric_level)
+        console_handler.setFormatter(logging.Formatter(console_format, datefmt='%Y-%m-%d %H:%M:%S'))
+        logger.addHandler(console_handler)
+        logger.propagate = False
+    else:
+        _install_colored(logger, numeric_level, console_format)
+    
+    # File handler if specified
+    if log_file:
+        log_path = Path(log_file)
+        log_path.parent.mkdir(parents=True, exist_ok=True)
+        
+        file_handler = logging.FileHandler(log_file)
+        file_handler.setLevel(numeric_level)
+        
+        file_format = logging.Formatter(
+            '%(asctime)s [%(process)d] %(name)s %(levelname)s: %(message)s',
+            datefmt='%Y-%m-%d %H:%M:%S'
+        )
+        file_handler.setFormatter(file_format)
+        
+        logger.addHandler(file_handler)
+    
+    return logger
+
+
+def _install_colored(logger: logging.Logger, numeric_level: int, console_format: str):
+    """Console handler with colors"""
     coloredlogs.install(
         level=numeric_level,
         logger=logger,
@@ -46,24 +96,6 @@ def setup_logger(level: str = 'info', log_file: Optional[str] = None) -> logging
             'critical': {'color': 'red', 'bold': True}
         }
     )
-    
-    # File handler if specified
-    if log_file:
-        log_path = Path(log_file)
-        log_path.parent.mkdir(parents=True, exist_ok=True)
-        
-        file_handler = logging.FileHandler(log_file)
-        file_handler.setLevel(numeric_level)
-        
-        file_format = logging.Formatter(
-            '%(asctime)s [%(process)d] %(name)s %(levelname)s: %(message)s',
-            datefmt='%Y-%m-%d %H:%M:%S'
-        )
-        file_handler.setFormatter(file_format)
-        
-        logger.addHandler(file_handler)
-    
-    return logger
 
 
 def get_logger(name: str = None) -> logging.Logger:
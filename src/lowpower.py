@@ -0,0 +1,79 @@
+"""
+Low-power profile
+
+With --low-power (or low_power.enabled) the sync daemon is tuned for
+Raspberry Pi Zero-class hosts: nodes are collected one at a time with a
+single upload in flight, cycles run at most every low_power.interval, the
+collectors listed in low_power.skip are not run, and the in-memory buffers
+(node API response cache, score history, pages of registered nodes, the
+upload queue) are capped to small fixed sizes. After each cycle the daemon's
+resident memory is compared with low_power.memory_target; above it the
+response cache is dropped and a warning is logged.
+"""
+
+import gc
+import logging
+import os
+from typing import Optional
+
+# Collectors low_power.skip can turn off
+COLLECTORS = ('identity', 'storage_probe', 'external_address', 'traffic_anomalies', 'audit_trends')
+
+# Buffer limits of the profile
+RESPONSE_CACHE_SIZE = 64
+SCORE_HISTORY_SIZE = 4
+NODE_PAGE_SIZE = 50
+OUTBOX_LIMIT = 1000
+BACKPRESSURE_THRESHOLD = 100
+
+
+def apply_profile(config):
+    """Override the sync settings with the profile's, as flags"""
+    profile = config.low_power
+    config.set_flag('sync.batch_size', 1)
+    config.set_flag('sync.max_inflight_uploads', 1)
+    config.set_flag('sync.interval', max(config.sync.interval, profile.interval))
+    config.set_flag('sync.outbox_limit', min(config.sync.outbox_limit, OUTBOX_LIMIT))
+    # 0 turns backpressure off, which the profile leaves alone
+    if config.sync.backpressure_threshold:
+        config.set_flag('sync.backpressure_threshold', min(config.sync.backpressure_threshold,
+                                                           BACKPRESSURE_THRESHOLD))
+    if 'storage_probe' in profile.skip:
+        config.set_flag('sync.storage_probe', False)
+
+
+def resident_memory() -> Optional[int]:
+    """Current resident set size in bytes, where /proc has it"""
+    try:
+        with open('/proc/self/statm') as f:
+            return int(f.read().split()[1]) * os.sysconf('SC_PAGE_SIZE')
+    except (OSError, ValueError, IndexError, AttributeError):
+        return None
+
+
+class MemoryGuard:
+    """Drops caches when the daemon's resident memory exceeds its target"""
+
+    def __init__(self, target_mib: int, logger=None):
+        self.target = target_mib * 2 ** 20
+        self.logger = logger or logging.getLogger(__name__)
+        self.over = False
+
+    def check(self, node_api) -> Optional[int]:
+        """Resident memory after the check, releasing the response cache above the target"""
+        rss = resident_memory()
+        if rss is None or rss <= self.target:
+            if self.over and rss is not None:
+                self.logger.info("Memory back to %.0f MiB, within the %d MiB target", rss / 2 ** 20,
+                                 self.target // 2 ** 20)
+            self.over = False
+            return rss
+        if node_api:
+            node_api.cache.clear()
+        gc.collect()
+        if not self.over:
+            self.logger.warning("Memory at %.0f MiB exceeds the %d MiB low-power target; dropped the "
+                                "response cache (skip more collectors with low_power.skip)",
+                                rss / 2 ** 20, self.target // 2 ** 20)
+        self.over = True
+        return resident_memory()
@@ -0,0 +1,217 @@
+"""
+Mock dashboard server
+
+An in-memory implementation of the dashboard API the client talks to
+(token check, node registration, node updates, fleet rollups, telemetry and
+the agent connection), for validating discover and sync flows without touching the
+production service.
+"""
+
+import json
+import logging
+import time
+from typing import Dict, Iterable, Optional
+
+from aiohttp import WSMsgType, web
+
+from .signing import PayloadSigner
+
+# Requests kept in the request log returned by /mock/state
+REQUEST_LOG_SIZE = 200
+
+
+class MockDashboard:
+    """Dashboard API backed by dictionaries"""
+
+    def __init__(self, tokens: Optional[Iterable[str]] = None, logger=None,
+                 signing_secret: Optional[str] = None):
+        self.tokens = set(tokens or ())
+        self.signer = PayloadSigner(signing_secret) if signing_secret else None
+        self.logger = logger or logging.getLogger(__name__)
+        self.nodes: Dict[str, Dict] = {}
+        self.updates: Dict[str, int] = {}
+        self.max_nodes = 100
+        self.revoked = set()
+        self.issued = 0
+        self.idempotency_keys = set()
+        self.duplicates = 0
+        self.telemetry = []
+        self.alerts = []
+        # Latest fleet rollup per (account, host)
+        self.fleet: Dict[str, Dict] = {}
+        self.requests = []
+        self.agents = set()
+        self.runner = None
+
+    def application(self) -> web.Application:
+        app = web.Application(middlewares=[self._authenticate])
+        app.router.add_get('/auth/me', self.me)
+        app.router.add_get('/account/quota', self.quota)
+        app.router.add_post('/auth/tokens', self.create_token)
+        app.router.add_delete('/auth/tokens/current', self.revoke_token)
+        app.router.add_get('/storj/nodes', self.list_nodes)
+        app.router.add_post('/storj/nodes', self.register_node)
+        app.router.add_patch('/storj/nodes/{node_id}', self.update_node)
+        app.router.add_delete('/storj/nodes/{node_id}', self.remove_node)
+        app.router.add_put('/storj/fleet', self.update_fleet)
+        app.router.add_post('/telemetry', self.receive_telemetry)
+        app.router.add_post('/alerts', self.receive_alert)
+        app.router.add_get('/agent', self.agent)
+        app.router.add_get('/mock/state', self.state)
+        app.router.add_post('/mock/refresh', self.refresh)
+        return app
+
+    async def start(self, host: str, port: int):
+        self.runner = web.AppRunner(self.application())
+        await self.runner.setup()
+        await web.TCPSite(self.runner, host, port).start()
+        self.logger.info("Mock dashboard listening on http://%s:%d (use --url http://%s:%d)",
+                         host, port, host, port)
+
+    async def stop(self):
+        if self.runner:
+            await self.runner.cleanup()
+            self.runner = None
+
+    @web.middleware
+    async def _authenticate(self, request, handler):
+        self.requests.append({'time': time.time(), 'method': request.method, 'path': request.path_qs})
+        del self.requests[:-REQUEST_LOG_SIZE]
+
+        # The webhook, mock controls and state need no token
+        if request.path == '/alerts' or request.path.startswith('/mock/'):
+            return await handler(request)
+        token = request.headers.get('Authorization', '').removeprefix('Bearer ').strip()
+        if not token or token in self.revoked or (self.tokens and token not in self.tokens):
+            raise web.HTTPUnauthorized(text='invalid token')
+        request['token'] = token
+        if self.signer and request.method in ('POST', 'PATCH', 'PUT') and request.path.startswith('/storj/'):
+            if not self.signer.verify(request.method, request.path_qs, await request.read(), request.headers):
+                raise web.HTTPUnauthorized(text='invalid signature')
+        return await handler(request)
+
+    async def _json(self, request) -> Dict:
+        try:
+            data = await request.json()
+        except ValueError:
+            raise web.HTTPBadRequest(text='invalid JSON')
+        if not isinstance(data, dict):
+            raise web.HTTPBadRequest(text='expected a JSON object')
+        return data
+
+    async def me(self, request):
+        return web.json_response({'email': 'mock@localhost', 'name': 'Mock dashboard'})
+
+    async def quota(self, request):
+        return web.json_response({
+            'limits': {'maxNodes': self.max_nodes, 'requestsPerMinute': 600, 'retentionDays': 365},
+            'usage': {'nodes': len(self.nodes)},
+        })
+
+    async def create_token(self, request):
+        data = await self._json(request)
+        self.issued += 1
+        token = f"mock-token-{self.issued}"
+        if self.tokens:
+            self.tokens.add(token)
+        return web.json_response({'token': token, 'name': data.get('name')}, status=201)
+
+    async def revoke_token(self, request):
+        self.revoked.add(request['token'])
+        return web.Response(status=204)
+
+    async def list_nodes(self, request):
+        nodes = list(self.nodes.values())
+        try:
+            offset = int(request.query.get('offset', 0))
+            limit = int(request.query.get('limit', len(nodes) or 1))
+        except ValueError:
+            raise web.HTTPBadRequest(text='offset and limit must be integers')
+        return web.json_response({'nodes': nodes[offset:offset + limit], 'total': len(nodes)})
+
+    async def register_node(self, request):
+        data = await self._json(request)
+        node_id = data.get('nodeId')
+        if not node_id:
+            raise web.HTTPBadRequest(text='nodeId is required')
+        if node_id in self.nodes:
+            raise web.HTTPConflict(text='node already registered')
+        self.nodes[node_id] = {**data, 'id': node_id, 'registeredAt': time.time()}
+        self.logger.info("Registered node %s (%s)", node_id[:8], data.get('name'))
+        return web.json_response(self.nodes[node_id], status=201)
+
+    async def update_node(self, request):
+        node_id = request.match_info['node_id']
+        if node_id not in self.nodes:
+            raise web.HTTPNotFound(text='node not registered')
+        data = await self._json(request)
+        # A repeated upload whose acknowledgement was lost is acknowledged again, not applied
+        key = request.headers.get('Idempotency-Key')
+        if key in self.idempotency_keys:
+            self.duplicates += 1
+            return web.json_response(self.nodes[node_id])
+        if key:
+            self.idempotency_keys.add(key)
+        self.nodes[node_id].update(data, updatedAt=time.time())
+        self.updates[node_id] = self.updates.get(node_id, 0) + 1
+        self.logger.debug("Updated node %s (%d fields)", node_id[:8], len(data))
+        return web.json_response(self.nodes[node_id])
+
+    async def remove_node(self, request):
+        node_id = request.match_info['node_id']
+        if self.nodes.pop(node_id, None) is None:
+            raise web.HTTPNotFound(text='node not registered')
+        self.updates.pop(node_id, None)
+        self.logger.info("Removed node %s", node_id[:8])
+        return web.Response(status=204)
+
+    async def receive_telemetry(self, request):
+        self.telemetry.append(await self._json(request))
+        return web.Response(status=204)
+
+    async def receive_alert(self, request):
+        alert = await self._json(request)
+        self.alerts.append(alert)
+        self.logger.info("Alert [%s] %s", alert.get('kind'), alert.get('title'))
+        return web.Response(status=204)
+
+    async def agent(self, request):
+        ws = web.WebSocketResponse()
+        await ws.prepare(request)
+        self.agents.add(ws)
+        self.logger.info("Agent connected")
+        try:
+            async for message in ws:
+                if message.type == WSMsgType.TEXT:
+                    self.logger.info("Agent message: %s", message.data)
+        finally:
+            self.agents.discard(ws)
+            self.logger.info("Agent disconnected")
+        return ws
+
+    async def refresh(self, request):
+        """Ask connected agents to collect ?nodeId=..., or run a cycle without it"""
+        message = {'type': 'collect', 'id': f"mock-{time.time():.0f}"}
+        if request.query.get('nodeId'):
+            message['nodeId'] = request.query['nodeId']
+        for ws in list(self.agents):
+            await ws.send_json(message)
+        return web.json_response({'sent': len(self.agents), 'request': message})
+
+    async def update_fleet(self, request):
+        data = await self._json(request)
+        self.fleet[f"{data.get('account') or ''}@{data.get('host') or ''}"] = data
+        return web.Response(status=204)
+
+    async def state(self, request):
+        """Everything the mock has received, for assertions in tests"""
+        return web.json_response({
+            'nodes': self.nodes,
+            'updates': self.updates,
+            'duplicates': self.duplicates,
+            'telemetry': self.telemetry,
+            'alerts': self.alerts,
+            'fleet': self.fleet,
+            'agents': len(self.agents),
+            'requests': self.requests,
+        }, dumps=lambda data: json.dumps(data, default=str))
@@ -0,0 +1,62 @@
+"""
+Mutual TLS
+
+Client certificates for connections to the dashboard API, needed when the
+API endpoint is an aggregator that only accepts known agents, and the server
+side of the aggregator, which requires them.
+"""
+
+import ssl
+from typing import Optional
+
+# Client TLS context of dashboard connections, set from api.client_cert
+_client_context: Optional[ssl.SSLContext] = None
+
+
+def client_context(cert: str, key: Optional[str] = None, ca_file: Optional[str] = None) -> ssl.SSLContext:
+    """TLS context presenting a client certificate, trusting ca_file if given
+
+    Raises ValueError if the files cannot be loaded.
+    """
+    try:
+        context = ssl.create_default_context(cafile=ca_file)
+        context.load_cert_chain(cert, key)
+    except (OSError, ssl.SSLError) as e:
+        raise ValueError(f"cannot load client certificate: {e}")
+    return context
+
+
+def server_context(cert: str, key: str, client_ca: str) -> ssl.SSLContext:
+    """TLS context of a server that only accepts clients with a certificate signed by client_ca
+
+    Raises ValueError if the files cannot be loaded.
+    """
+    try:
+        context = ssl.create_default_context(ssl.Purpose.CLIENT_AUTH, cafile=client_ca)
+        context.load_cert_chain(cert, key)
+    except (OSError, ssl.SSLError) as e:
+        raise ValueError(f"cannot load server certificate: {e}")
+    context.verify_mode = ssl.CERT_REQUIRED
+    return context
+
+
+def set_client_tls(context: Optional[ssl.SSLContext]):
+    """Use a client certificate for every dashboard connection"""
+    global _client_context
+    _client_context = context
+
+
+def client_tls() -> Optional[ssl.SSLContext]:
+    """The client TLS context of dashboard connections, if a client certificate is set"""
+    return _client_context
+
+
+def peer_name(request) -> Optional[str]:
+    """Common name of the client certificate of an aiohttp request"""
+    ssl_object = request.transport.get_extra_info('ssl_object') if request.transport else None
+    certificate = ssl_object.getpeercert() if ssl_object else None
+    for field in (certificate or {}).get('subject', ()):
+        for key, value in field:
+            if key == 'commonName':
+                return value
+    return None
@@ -0,0 +1,181 @@
+"""
+Gateway port mapping inspection
+
+Queries the local internet gateway over UPnP IGD and NAT-PMP to check that
+a node's external port is forwarded to the right host, diagnosing the
+classic "router rebooted and forgot the forward" failure.
+"""
+
+import asyncio
+import logging
+import socket
+import struct
+from typing import Dict, List, Optional
+from urllib.parse import urljoin
+from xml.etree import ElementTree
+
+import aiohttp
+
+SSDP_ADDRESS = ('239.255.255.250', 1900)
+NATPMP_PORT = 5351
+
+WAN_SERVICES = (
+    'urn:schemas-upnp-org:service:WANIPConnection:2',
+    'urn:schemas-upnp-org:service:WANIPConnection:1',
+    'urn:schemas-upnp-org:service:WANPPPConnection:1',
+)
+
+SOAP_ENVELOPE = (
+    '<?xml version="1.0"?>'
+    '<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" '
+    's:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">'
+    '<s:Body><u:{action} xmlns:u="{service}">{arguments}</u:{action}></s:Body></s:Envelope>'
+)
+
+
+def default_gateway() -> Optional[str]:
+    """IPv4 default gateway from the kernel routing table (Linux)"""
+    try:
+        with open('/proc/net/route') as f:
+            for line in f.readlines()[1:]:
+                fields = line.split()
+                if fields[1] == '00000000' and int(fields[3], 16) & 2:
+                    return socket.inet_ntoa(struct.pack('<L', int(fields[2], 16)))
+    except (OSError, ValueError, IndexError):
+        pass
+    return None
+
+
+def local_address(towards: str = '192.0.2.1') -> Optional[str]:
+    """This host's LAN address used to reach the given address"""
+    try:
+        with socket.socket(socket.AF_INET, socket.SOCK_DGRAM) as sock:
+            sock.connect((towards, 9))
+            return sock.getsockname()[0]
+    except OSError:
+        return None
+
+
+class _Collector(asyncio.DatagramProtocol):
+    def __init__(self):
+        self.responses: List[bytes] = []
+
+    def datagram_received(self, data, addr):
+        self.responses.append(data)
+
+
+async def _udp_exchange(message: bytes, address, timeout: float) -> List[bytes]:
+    loop = asyncio.get_running_loop()
+    transport, protocol = await loop.create_datagram_endpoint(_Collector, local_addr=('0.0.0.0', 0))
+    try:
+        transport.sendto(message, address)
+        await asyncio.sleep(timeout)
+    finally:
+        transport.close()
+    return protocol.responses
+
+
+class UpnpGateway:
+    """WAN connection service of a UPnP internet gateway device"""
+
+    def __init__(self, control_url: str, service: str, timeout: float = 5):
+        self.control_url = control_url
+        self.service = service
+        self.timeout = timeout
+
+    @classmethod
+    async def discover(cls, timeout: float = 3, logger=None) -> Optional['UpnpGateway']:
+        """Find the gateway's WAN connection service via SSDP"""
+        logger = logger or logging.getLogger(__name__)
+        search = (
+            'M-SEARCH * HTTP/1.1\r\n'
+            f'HOST: {SSDP_ADDRESS[0]}:{SSDP_ADDRESS[1]}\r\n'
+            'MAN: "ssdp:discover"\r\nMX: 2\r\n'
+            'ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n'
+        ).encode()
+        responses = await _udp_exchange(search, SSDP_ADDRESS, timeout)
+
+        locations = []
+        for response in responses:
+            for line in response.decode(errors='replace').split('\r\n'):
+                if line.lower().startswith('location:'):
+                    locations.append(line.split(':', 1)[1].strip())
+
+        client_timeout = aiohttp.ClientTimeout(total=timeout)
+        async with aiohttp.ClientSession(timeout=client_timeout) as session:
+            for location in dict.fromkeys(locations):
+                try:
+                    async with session.get(location) as response:
+                        description = await response.text()
+                except (aiohttp.ClientError, asyncio.TimeoutError, OSError) as e:
+                    logger.debug("Failed to read gateway description %s: %s", location, e)
+                    continue
+                gateway = cls._from_description(location, description)
+                if gateway:
+                    return gateway
+        return None
+
+    @classmethod
+    def _from_description(cls, location: str, description: str) -> Optional['UpnpGateway']:
+        try:
+            root = ElementTree.fromstring(description)
+        except ElementTree.ParseError:
+            return None
+        for element in root.iter():
+            if not element.tag.endswith('service'):
+                continue
+            fields = {child.tag.split('}')[-1]: (child.text or '').strip() for child in element}
+            if fields.get('serviceType') in WAN_SERVICES and fields.get('controlURL'):
+                return cls(urljoin(location, fields['controlURL']), fields['serviceType'])
+        return None
+
+    async def _call(self, action: str, **arguments) -> Optional[Dict[str, str]]:
+        """Invoke a SOAP action, returning its output arguments or None on a fault"""
+        body = SOAP_ENVELOPE.format(
+            action=action, service=self.service,
+            arguments=''.join(f'<{k}>{v}</{k}>' for k, v in arguments.items()),
+        )
+        headers = {
+            'Content-Type': 'text/xml; charset="utf-8"',
+            'SOAPAction': f'"{self.service}#{action}"',
+        }
+        async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=self.timeout)) as session:
+            async with session.post(self.control_url, data=body, headers=headers) as response:
+                text = await response.text()
+                if response.status != 200:
+                    return None
+        root = ElementTree.fromstring(text)
+        for element in root.iter():
+            if element.tag.endswith(f'{action}Response'):
+                return {child.tag.split('}')[-1]: (child.text or '') for child in element}
+        return None
+
+    async def external_address(self) -> Optional[str]:
+        result = await self._call('GetExternalIPAddress')
+        return result.get('NewExternalIPAddress') if result else None
+
+    async def port_mapping(self, external_port: int, protocol: str = 'TCP') -> Optional[Dict]:
+        """The forward for an external port, or None if there is none"""
+        result = await self._call('GetSpecificPortMappingEntry', NewRemoteHost='',
+                                  NewExternalPort=external_port, NewProtocol=protocol)
+        if not result:
+            return None
+        return {
+            'internal_client': result.get('NewInternalClient'),
+            'internal_port': int(result.get('NewInternalPort') or 0),
+            'enabled': result.get('NewEnabled') in ('1', 'true'),
+            'description': result.get('NewPortMappingDescription'),
+        }
+
+
+async def natpmp_external_address(gateway: str, timeout: float = 2) -> Optional[str]:
+    """External address reported by a NAT-PMP gateway (RFC 6886)
+
+    NAT-PMP cannot list existing mappings without creating one, so only the
+    gateway's presence and external address are checked this way.
+    """
+    responses = await _udp_exchange(b'\x00\x00', (gateway, NATPMP_PORT), timeout)
+    for response in responses:
+        if len(response) >= 12 and response[1] == 128 and struct.unpack('!H', response[2:4])[0] == 0:
+            return socket.inet_ntoa(response[8:12])
+    return None
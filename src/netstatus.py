@@ -0,0 +1,161 @@
+"""
+Storj network status
+
+Polls the public status page of the Storj network (a Statuspage summary) for
+incidents, maintenance in progress and degraded components. Alerts about
+node-side symptoms that a satellite-side event can cause, such as a traffic
+drop or a falling suspension score, are annotated with the events affecting
+the node's satellite, so operators do not chase a problem on their own nodes
+while the network itself is having one.
+"""
+
+import asyncio
+import logging
+import time
+from typing import Dict, List, Optional
+
+import aiohttp
+
+# Storj's public status page
+DEFAULT_STATUS_FEED = 'https://status.storj.io/api/v2/summary.json'
+
+# Seconds a fetched status is used before the feed is polled again
+DEFAULT_STATUS_INTERVAL = 300
+
+# Alert kinds whose cause can be on the satellite's side
+CORRELATED_KINDS = ('traffic_drop', 'traffic_spike', 'unknown_audits', 'suspended', 'disqualified', 'health')
+
+# Component states reported as events
+DEGRADED_STATES = ('degraded_performance', 'partial_outage', 'major_outage', 'under_maintenance')
+
+
+def parse_summary(summary: Dict) -> List[Dict]:
+    """Events in progress in a Statuspage summary response"""
+    events = []
+    for incident in summary.get('incidents') or []:
+        if incident.get('status') in ('resolved', 'postmortem'):
+            continue
+        events.append({
+            'kind': 'incident',
+            'name': incident.get('name'),
+            'status': incident.get('status'),
+            'impact': incident.get('impact'),
+            'components': [c.get('name') for c in incident.get('components') or [] if c.get('name')],
+            'started': incident.get('started_at') or incident.get('created_at'),
+            'url': incident.get('shortlink'),
+        })
+    for maintenance in summary.get('scheduled_maintenances') or []:
+        if maintenance.get('status') not in ('in_progress', 'verifying'):
+            continue
+        events.append({
+            'kind': 'maintenance',
+            'name': maintenance.get('name'),
+            'status': maintenance.get('status'),
+            'impact': maintenance.get('impact'),
+            'components': [c.get('name') for c in maintenance.get('components') or [] if c.get('name')],
+            'started': maintenance.get('started_at') or maintenance.get('scheduled_for'),
+            'url': maintenance.get('shortlink'),
+        })
+    # A degraded component without an incident is still worth mentioning
+    mentioned = {name for event in events for name in event['components']}
+    for component in summary.get('components') or []:
+        if component.get('status') in DEGRADED_STATES and component.get('name') not in mentioned:
+            events.append({
+                'kind': 'maintenance' if component['status'] == 'under_maintenance' else 'incident',
+                'name': f"{component.get('name')} {component['status'].replace('_', ' ')}",
+                'status': component['status'],
+                'impact': None,
+                'components': [component.get('name')],
+                'started': component.get('updated_at'),
+                'url': None,
+            })
+    return events
+
+
+def satellite_label(satellite: Optional[str]) -> Optional[str]:
+    """The short name of a satellite address as the status page uses it, e.g. us1"""
+    if not satellite:
+        return None
+    host = satellite.split('@')[-1].split(':')[0]
+    return host.split('.')[0].lower() or None
+
+
+def affecting(events: List[Dict], satellite: Optional[str] = None) -> List[Dict]:
+    """Events that can affect a node on the given satellite
+
+    Events naming no component are network-wide and affect every node; without
+    a satellite, every event is returned.
+    """
+    label = satellite_label(satellite)
+    if not label:
+        return list(events)
+    return [event for event in events
+            if not event['components'] or
+            any(label in name.lower().split() or name.lower().startswith(label)
+                for name in event['components'])]
+
+
+def describe(event: Dict) -> str:
+    kind = 'satellite maintenance in progress' if event['kind'] == 'maintenance' else 'network incident'
+    return f"{kind}: {event['name']}" + (f" ({event['url']})" if event.get('url') else '')
+
+
+class NetworkStatus:
+    """The network's current events, fetched from the status feed at most every interval seconds"""
+
+    def __init__(self, url: str = DEFAULT_STATUS_FEED, interval: float = DEFAULT_STATUS_INTERVAL,
+                 timeout: float = 10, logger=None):
+        self.url = url
+        self.interval = interval
+        self.timeout = timeout
+        self.logger = logger or logging.getLogger(__name__)
+        self.events: List[Dict] = []
+        self.fetched = 0.0
+        self.failing = False
+
+    async def current(self) -> List[Dict]:
+        """Events in progress; the last known ones while the feed is unreachable"""
+        if time.time() - self.fetched < self.interval:
+            return self.events
+        self.fetched = time.time()
+
+        # A separate session, so the dashboard token is never sent to the status page
+        try:
+            async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=self.timeout)) as session:
+                async with session.get(self.url) as response:
+                    if response.status != 200:
+                        raise ValueError(f"HTTP {response.status}")
+                    summary = await response.json(content_type=None)
+            events = parse_summary(summary if isinstance(summary, dict) else {})
+        except (aiohttp.ClientError, asyncio.TimeoutError, OSError, ValueError, AttributeError) as e:
+            if not self.failing:
+                self.logger.warning("Network status feed %s unavailable: %s", self.url, e)
+            self.failing = True
+            return self.events
+
+        if self.failing:
+            self.logger.info("Network status feed %s available again", self.url)
+        self.failing = False
+        started = [event for event in events if event['name'] not in {e['name'] for e in self.events}]
+        for event in started:
+            self.logger.info("Storj network: %s", describe(event))
+        self.events = events
+        return events
+
+    async def annotate(self, alert) -> List[Dict]:
+        """Add the network events that may explain an alert to its message and details"""
+        if alert.kind not in CORRELATED_KINDS:
+            return []
+        events = affecting(await self.current(), _alert_satellite(alert.details))
+        if events:
+            alert.message += '; ' + '; '.join(describe(event) for event in events)
+            alert.details = {**alert.details, 'networkEvents': events}
+        return events
+
+
+def _alert_satellite(details: Dict) -> Optional[str]:
+    """The satellite address an alert is about, if any"""
+    satellite = details.get('satellite') or (details.get('trend') or {}).get('satellite')
+    if isinstance(satellite, dict):
+        return satellite.get('url') or None
+    return satellite
@@ -0,0 +1,188 @@
+"""
+Host network addresses
+
+Works out which of this host's addresses identifies the server: the address
+of a configured interface, or otherwise the one the kernel would route
+outbound traffic from. The latter guesses wrong on multi-homed servers (VPN,
+LAN and public addresses), hence the network.interface setting.
+
+Tailscale and WireGuard overlays are recognized too, since many operators
+reach remote nodes only over them: their addresses can be preferred as the
+server address, and their peers scanned by discovery.
+"""
+
+import asyncio
+import fcntl
+import ipaddress
+import json
+import logging
+import socket
+import struct
+import subprocess
+from pathlib import Path
+from typing import Dict, List, Optional
+
+from .nat import local_address
+
+SIOCGIFADDR = 0x8915
+
+# Addresses Tailscale assigns to nodes of a tailnet
+TAILSCALE_NETWORK = ipaddress.ip_network('100.64.0.0/10')
+
+TAILSCALE = 'tailscale'
+WIREGUARD = 'wireguard'
+
+# Largest WireGuard allowed-ips block whose addresses are scanned as peers
+MAX_PEER_PREFIX = 30
+
+
+def url_host(address: str) -> str:
+    """Host part of a URL for an address, bracketing IPv6 literals"""
+    return f"[{address}]" if ':' in address else address
+
+
+async def resolve_host(host: str) -> List[str]:
+    """Every IPv4 and IPv6 address of a host name, or an address itself
+
+    Raises OSError if the name does not resolve.
+    """
+    try:
+        return [str(ipaddress.ip_address(host))]
+    except ValueError:
+        pass
+    infos = await asyncio.get_running_loop().getaddrinfo(host, None, type=socket.SOCK_STREAM)
+    return list(dict.fromkeys(info[4][0] for info in infos))
+
+
+def interface_names() -> List[str]:
+    """Names of this host's network interfaces"""
+    try:
+        return [name for _, name in socket.if_nameindex()]
+    except OSError:
+        return []
+
+
+def interface_address(name: str) -> Optional[str]:
+    """IPv4 address of a network interface, None if it has none
+
+    Raises ValueError for unknown interfaces.
+    """
+    if name not in interface_names():
+        raise ValueError(f"no network interface {name!r} (available: {', '.join(interface_names()) or 'none'})")
+    with socket.socket(socket.AF_INET, socket.SOCK_DGRAM) as sock:
+        try:
+            request = struct.pack('256s', name.encode()[:15])
+            return socket.inet_ntoa(fcntl.ioctl(sock.fileno(), SIOCGIFADDR, request)[20:24])
+        except OSError:
+            return None
+
+
+def interface_addresses() -> Dict[str, str]:
+    """IPv4 address of every interface that has one"""
+    addresses = {}
+    for name in interface_names():
+        address = interface_address(name)
+        if address:
+            addresses[name] = address
+    return addresses
+
+
+def overlay_kind(name: str, address: Optional[str] = None) -> Optional[str]:
+    """Overlay network an interface belongs to, if any"""
+    try:
+        uevent = (Path('/sys/class/net') / name / 'uevent').read_text()
+    except OSError:
+        uevent = ''
+    if 'DEVTYPE=wireguard' in uevent or name.startswith('wg'):
+        return WIREGUARD
+    if name.startswith('tailscale') or (
+            name.startswith(('tun', 'utun')) and address and ipaddress.ip_address(address) in TAILSCALE_NETWORK):
+        return TAILSCALE
+    return None
+
+
+def overlay_interfaces() -> Dict[str, Dict]:
+    """Tailscale and WireGuard interfaces with their kind and IPv4 address"""
+    overlays = {}
+    for name, address in interface_addresses().items():
+        kind = overlay_kind(name, address)
+        if kind:
+            overlays[name] = {'kind': kind, 'address': address}
+    return overlays
+
+
+def _run(command: List[str], logger) -> Optional[str]:
+    try:
+        result = subprocess.run(command, capture_output=True, text=True, timeout=10)
+    except (OSError, subprocess.TimeoutExpired) as e:
+        logger.debug("%s failed: %s", command[0], e)
+        return None
+    if result.returncode != 0:
+        logger.debug("%s failed: %s", ' '.join(command), result.stderr.strip())
+        return None
+    return result.stdout
+
+
+def tailscale_peers(logger=None) -> List[str]:
+    """IPv4 addresses of the other online devices in the tailnet"""
+    logger = logger or logging.getLogger(__name__)
+    output = _run(['tailscale', 'status', '--json'], logger)
+    try:
+        peers = (json.loads(output) if output else {}).get('Peer') or {}
+    except ValueError:
+        return []
+    addresses = []
+    for peer in peers.values():
+        if peer.get('Online') is False:
+            continue
+        addresses.extend(ip for ip in peer.get('TailscaleIPs') or [] if ipaddress.ip_address(ip).version == 4)
+    return addresses
+
+
+def wireguard_peers(logger=None) -> List[str]:
+    """IPv4 addresses WireGuard routes to peers (needs root)"""
+    logger = logger or logging.getLogger(__name__)
+    output = _run(['wg', 'show', 'all', 'allowed-ips'], logger) or ''
+    addresses = []
+    for line in output.splitlines():
+        for block in line.split()[2:]:
+            try:
+                network = ipaddress.ip_network(block, strict=False)
+            except ValueError:
+                continue
+            if network.version == 4 and network.prefixlen >= MAX_PEER_PREFIX:
+                addresses.extend(str(address) for address in (list(network.hosts()) or [network.network_address]))
+    return addresses
+
+
+def overlay_peers(logger=None) -> List[str]:
+    """Addresses of the hosts reachable over this host's overlay networks"""
+    overlays = overlay_interfaces().values()
+    kinds = {overlay['kind'] for overlay in overlays}
+    own = {overlay['address'] for overlay in overlays}
+    peers = []
+    if TAILSCALE in kinds:
+        peers.extend(tailscale_peers(logger))
+    if WIREGUARD in kinds:
+        peers.extend(wireguard_peers(logger))
+    return [peer for peer in dict.fromkeys(peers) if peer not in own]
+
+
+def server_address(interface: Optional[str] = None, towards: str = '192.0.2.1',
+                   prefer_overlay: bool = False) -> Optional[str]:
+    """Address identifying this server, from the given interface if any
+
+    With prefer_overlay, the address of a Tailscale or WireGuard interface is
+    used when there is one, Tailscale first. Raises ValueError if the
+    interface does not exist or has no IPv4 address.
+    """
+    if not interface and prefer_overlay:
+        overlays = sorted(overlay_interfaces().values(), key=lambda overlay: overlay['kind'] != TAILSCALE)
+        if overlays:
+            return overlays[0]['address']
+    if not interface:
+        return local_address(towards)
+    address = interface_address(interface)
+    if not address:
+        raise ValueError(f"network interface {interface!r} has no IPv4 address")
+    return address
@@ -0,0 +1,361 @@
+"""
+Storage node dashboard API client
+
+Fetches data from a storage node's local dashboard API (`/api/sno/...`).
+Large array responses are decoded as they stream in, and responses carrying
+validators are revalidated with conditional requests instead of re-downloaded.
+Responses can be recorded to a directory and replayed from it offline.
+Node overviews are translated from the node's API schema to the client's,
+and satellites left out by the satellite filter are dropped from responses.
+Endpoints whose data rarely changes are reused for a while without asking the
+node again.
+"""
+
+import codecs
+import json
+import logging
+import re
+import time
+from collections import OrderedDict
+from typing import Dict, Iterable, List, Optional, Tuple
+
+import aiohttp
+
+from .jsonstream import JsonArrayStream
+from .network import url_host
+from .nodeschema import StrictParseError, parse_sno
+from .recording import TrafficLog
+from .satfilter import SatelliteFilter, satellite_filter
+
+# Bytes read at a time from streamed responses
+STREAM_CHUNK_SIZE = 16 * 1024
+
+# Fields kept from streamed array items
+DAILY_BANDWIDTH_FIELDS = ('intervalStart', 'ingress', 'egress')
+HELD_HISTORY_FIELDS = ('satelliteID', 'satelliteName', 'joinedAt', 'totalHeld', 'totalDisposed')
+PAYSTUB_FIELDS = ('satelliteId', 'period', 'held', 'paid', 'distributed', 'disposed')
+AUDIT_FIELDS = ('satelliteID', 'satelliteName', 'auditScore', 'suspensionScore', 'onlineScore')
+
+# Responses kept for conditional requests; least recently used are evicted first
+RESPONSE_CACHE_SIZE = 4096
+
+# Seconds the responses of static endpoints are reused by default: graceful
+# exit progress and held amount history change at most a few times a month
+STATIC_TTL = 3600
+
+
+# Traffic log of clients created without one, set from --record or --replay
+_default_traffic: Optional[TrafficLog] = None
+
+
+def set_traffic(traffic: Optional[TrafficLog]):
+    """Record or replay the node API traffic of every client"""
+    global _default_traffic
+    _default_traffic = traffic
+
+
+# Parsing mode of clients created without one, set from --strict-parsing
+_default_strict = False
+
+
+def set_strict_parsing(strict: bool):
+    """Reject node overviews that do not parse cleanly in every client"""
+    global _default_strict
+    _default_strict = strict
+
+
+def _freshness(headers) -> Optional[float]:
+    """Seconds a response may be reused without revalidation, or None if it may not be stored"""
+    cache_control = headers.get('Cache-Control', '').lower()
+    if 'no-store' in cache_control:
+        return None
+    match = re.search(r'max-age=(\d+)', cache_control)
+    return float(match.group(1)) if match and 'no-cache' not in cache_control else 0.0
+
+
+class NodeApiClient:
+    """Client for the storagenode dashboard API shared across many nodes"""
+
+    def __init__(self, timeout: int = 10, logger=None, traffic: Optional[TrafficLog] = None,
+                 endpoints: Optional[Dict[str, Dict]] = None, strict: Optional[bool] = None,
+                 satellites: Optional[SatelliteFilter] = None, static_ttl: float = STATIC_TTL,
+                 cache_size: int = RESPONSE_CACHE_SIZE):
+        self.timeout = timeout
+        self.cache_size = cache_size
+        # 0 fetches static endpoints every time, like the others
+        self.static_ttl = static_ttl
+        self.strict = _default_strict if strict is None else strict
+        self.satellites = satellites if satellites is not None else satellite_filter()
+        # Address -> scheme, headers, timeout and verify_tls of nodes behind a proxy
+        self.endpoints = endpoints or {}
+        self.logger = logger or logging.getLogger(__name__)
+        self.traffic = traffic or _default_traffic
+        self.session = None
+        self.cache: OrderedDict = OrderedDict()
+        self.stats = {'requests': 0, 'not_modified': 0, 'fresh': 0}
+        # (address, port, version) of nodes already warned about
+        self.schema_warned = set()
+        # (address, port) -> why its last overview was rejected in strict mode
+        self.rejections: Dict[Tuple[str, int], List[str]] = {}
+
+    def open(self) -> 'NodeApiClient':
+        """Create the shared HTTP session (must be called inside the event loop)"""
+        self.session = aiohttp.ClientSession(
+            timeout=aiohttp.ClientTimeout(total=self.timeout)
+        )
+        return self
+
+    async def __aenter__(self):
+        return self.open()
+
+    async def __aexit__(self, *exc):
+        await self.close()
+
+    async def close(self):
+        if self.session:
+            await self.session.close()
+            self.session = None
+
+    def _cached(self, cache_key: Tuple) -> Tuple[Optional[Dict], Dict]:
+        """Cache entry for a request and the conditional headers to send"""
+        # Recordings need full responses, and replays never hit the network
+        entry = self.cache.get(cache_key) if not self.traffic else None
+        if not entry:
+            return None, {}
+        self.cache.move_to_end(cache_key)
+
+        headers = {}
+        if entry['etag']:
+            headers['If-None-Match'] = entry['etag']
+        if entry['last_modified']:
+            headers['If-Modified-Since'] = entry['last_modified']
+        return entry, headers
+
+    def _not_modified(self, entry: Dict, response):
+        self.stats['not_modified'] += 1
+        entry['expires'] = time.monotonic() + (_freshness(response.headers) or 0)
+        return entry['body']
+
+    def _remember(self, cache_key: Tuple, response, body, ttl: float = 0):
+        """Keep a response that can be revalidated or reused later
+        
+        A ttl keeps it for at least that long, whatever its cache headers say.
+        """
+        freshness = _freshness(response.headers)
+        if self.traffic:
+            return
+        etag = response.headers.get('ETag')
+        last_modified = response.headers.get('Last-Modified')
+        if ttl:
+            freshness = max(freshness or 0.0, ttl)
+        if freshness is None or not (etag or last_modified or freshness):
+            self.cache.pop(cache_key, None)
+            return
+
+        self.cache[cache_key] = {
+            'etag': etag,
+            'last_modified': last_modified,
+            'expires': time.monotonic() + freshness,
+            'body': body,
+        }
+        self.cache.move_to_end(cache_key)
+        while len(self.cache) > self.cache_size:
+            self.cache.popitem(last=False)
+
+    def _url(self, address: str, port: int, path: str) -> str:
+        scheme = self.endpoints.get(address, {}).get('scheme') or 'http'
+        return f"{scheme}://{url_host(address)}:{port}{path}"
+
+    def _options(self, address: str, headers: Dict) -> Dict:
+        """Request options for a node, with the credentials of its server"""
+        endpoint = self.endpoints.get(address)
+        if not endpoint:
+            return {'headers': headers}
+        options = {'headers': {**endpoint.get('headers', {}), **headers}}
+        if endpoint.get('timeout'):
+            options['timeout'] = aiohttp.ClientTimeout(total=endpoint['timeout'])
+        if endpoint.get('verify_tls') is False:
+            options['ssl'] = False
+        return options
+
+    async def get(self, address: str, port: int, path: str, ttl: float = 0) -> Optional[Dict]:
+        """GET a dashboard API path and return the decoded JSON body, reused for ttl seconds"""
+        url = self._url(address, port, path)
+        if self.traffic and self.traffic.replay:
+            recorded = self.traffic.load(url)
+            if not recorded or recorded['status'] != 200:
+                return None
+            return json.loads(recorded['body'])
+
+        cache_key = (url,)
+        entry, headers = self._cached(cache_key)
+        if entry and entry['expires'] > time.monotonic():
+            self.stats['fresh'] += 1
+            return entry['body']
+
+        try:
+            self.stats['requests'] += 1
+            async with self.session.get(url, **self._options(address, headers)) as response:
+                if response.status == 304 and entry:
+                    return self._not_modified(entry, response)
+                if self.traffic:
+                    raw = await response.read()
+                    self.traffic.record(url, response.status, raw)
+                if response.status == 200:
+                    body = json.loads(raw) if self.traffic else await response.json()
+                    self._remember(cache_key, response, body, ttl)
+                    return body
+                self.logger.debug("Node API returned %d for %s", response.status, url)
+        except Exception as e:
+            self.logger.debug("Failed to fetch from %s: %s", url, e)
+
+        return None
+
+    async def get_array(self, address: str, port: int, path: str, key: Optional[str] = None,
+                        fields: Optional[Iterable[str]] = None, ttl: float = 0) -> Optional[List]:
+        """GET a JSON array (or the array under a top-level key), decoding it incrementally
+        
+        Only the given fields of each item are kept, and the result is reused
+        for ttl seconds.
+        """
+        arrays = await self.get_arrays(address, port, path, {key: fields}, ttl)
+        return arrays[key] if arrays is not None else None
+
+    async def get_arrays(self, address: str, port: int, path: str,
+                         arrays: Dict[Optional[str], Optional[Iterable[str]]],
+                         ttl: float = 0) -> Optional[Dict[Optional[str], List]]:
+        """Like get_array for several top-level keys of one response, by key, each with its fields"""
+        url = self._url(address, port, path)
+        streams = {key: JsonArrayStream(key, fields) for key, fields in arrays.items()}
+        items = {key: [] for key in arrays}
+        
+        def feed(text: str):
+            # Every stream reads the whole response, each picking out its own array
+            for key, stream in streams.items():
+                items[key].extend(stream.feed(text))
+        
+        if self.traffic and self.traffic.replay:
+            recorded = self.traffic.load(url)
+            if not recorded or recorded['status'] != 200:
+                return None
+            try:
+                feed(recorded['body'])
+                for stream in streams.values():
+                    stream.close()
+            except ValueError as e:
+                self.logger.debug("Recorded response of %s is invalid: %s", url, e)
+                return None
+            return items
+
+        cache_key = (url,) + tuple((key, tuple(fields or ())) for key, fields in arrays.items())
+        entry, headers = self._cached(cache_key)
+        if entry and entry['expires'] > time.monotonic():
+            self.stats['fresh'] += 1
+            return entry['body']
+
+        decoder = codecs.getincrementaldecoder('utf-8')()
+        recorded = []
+
+        try:
+            self.stats['requests'] += 1
+            async with self.session.get(url, **self._options(address, headers)) as response:
+                if response.status == 304 and entry:
+                    return self._not_modified(entry, response)
+                if response.status != 200:
+                    self.logger.debug("Node API returned %d for %s", response.status, url)
+                    if self.traffic:
+                        self.traffic.record(url, response.status, await response.read())
+                    return None
+                async for chunk in response.content.iter_chunked(STREAM_CHUNK_SIZE):
+                    if self.traffic:
+                        recorded.append(chunk)
+                        continue
+                    feed(decoder.decode(chunk))
+                    if all(stream.done for stream in streams.values()):
+                        break
+                if self.traffic:
+                    # Recordings keep the whole response, not just the arrays
+                    self.traffic.record(url, response.status, b''.join(recorded))
+                    feed(b''.join(recorded).decode('utf-8'))
+                feed(decoder.decode(b'', final=True))
+                for stream in streams.values():
+                    stream.close()
+                self._remember(cache_key, response, items, ttl)
+        except Exception as e:
+            self.logger.debug("Failed to fetch from %s: %s", url, e)
+            return None
+
+        return items
+
+    async def get_sno(self, address: str, port: int) -> Optional[Dict]:
+        """Fetch the node overview, adapted to the client's schema
+        
+        The result carries the detected schema as apiSchema, what did not fit
+        it as apiProblems and values of the wrong type as parseWarnings. In
+        strict mode a response with any of these is rejected: None is returned
+        and the reasons are kept in rejections.
+        """
+        data = await self.get(address, port, '/api/sno')
+        self.rejections.pop((address, port), None)
+        if not isinstance(data, dict):
+            return data
+        try:
+            sno = parse_sno(self.satellites.sno(data), self.strict)
+        except StrictParseError as e:
+            self.rejections[(address, port)] = e.problems
+            self.logger.error("Rejected node API response of %s:%s (strict parsing): %s",
+                              url_host(address), port, e)
+            return None
+        problems = sno['apiProblems'] + sno['parseWarnings']
+        warned = (address, port, data.get('version'))
+        if problems and warned not in self.schema_warned:
+            # Once per node and version, the fields stay unknown until an upgrade
+            self.schema_warned.add(warned)
+            self.logger.warning("Node API of %s:%s (%s schema) is not fully supported: %s; "
+                                "affected values are reported as unknown", url_host(address), port,
+                                sno['apiSchema'], '; '.join(problems))
+        return sno
+
+    async def get_satellites(self, address: str, port: int) -> Optional[Dict]:
+        """Fetch usage aggregated over all satellites and per-satellite reputation"""
+        data = await self.get(address, port, '/api/sno/satellites')
+        if self.satellites and isinstance(data, dict) and 'audits' in data:
+            data = {**data, 'audits': self.satellites.entries(data['audits'], 'satelliteID', 'satelliteName')}
+        return data
+
+    async def get_estimated_payout(self, address: str, port: int) -> Optional[Dict]:
+        """Fetch the node's own payout estimate (amounts in USD cents)"""
+        return await self.get(address, port, '/api/sno/estimated-payout')
+
+    async def get_exit_progress(self, address: str, port: int) -> Optional[list]:
+        """Fetch per-satellite graceful exit progress (empty unless the node is exiting)"""
+        progress = await self.get(address, port, '/api/sno/satellites/exit-progress', ttl=self.static_ttl)
+        return self.satellites.entries(progress, 'satelliteID', 'domainName')
+
+    async def get_satellite_arrays(self, address: str, port: int) -> Tuple[Optional[list], Optional[list]]:
+        """Fetch this month's per-day bandwidth usage and per-satellite audit, suspension and online scores
+        
+        Both come from one request for /api/sno/satellites.
+        """
+        arrays = await self.get_arrays(address, port, '/api/sno/satellites',
+                                       {'bandwidthDaily': DAILY_BANDWIDTH_FIELDS, 'audits': AUDIT_FIELDS})
+        if arrays is None:
+            return None, None
+        return arrays['bandwidthDaily'], self.satellites.entries(arrays['audits'], 'satelliteID', 'satelliteName')
+
+    async def get_held_history(self, address: str, port: int) -> Optional[list]:
+        """Fetch per-satellite held amount history, including the join date"""
+        history = await self.get_array(address, port, '/api/heldamount/held-history',
+                                       fields=HELD_HISTORY_FIELDS, ttl=self.static_ttl)
+        return self.satellites.entries(history, 'satelliteID', 'satelliteName')
+
+    async def get_paystubs(self, address: str, port: int, period: str) -> Optional[list]:
+        """Fetch per-satellite paystubs for a YYYY-MM period (amounts in micro-USD)"""
+        paystubs = await self.get_array(address, port, f'/api/heldamount/paystubs/{period}',
+                                        fields=PAYSTUB_FIELDS)
+        return self.satellites.entries(paystubs, 'satelliteId')
+
+
+def node_endpoint(node: Dict):
+    """Address and dashboard port of a node as registered with the dashboard"""
+    return node.get('address', '127.0.0.1'), node.get('dashboardPort') or 14002
@@ -0,0 +1,168 @@
+"""
+Node lookup and metrics
+
+Resolves user-supplied node references and collects a flat set of
+configuration and performance metrics for registered nodes.
+"""
+
+from typing import Dict, List, Optional
+
+from .alerts import find_critical_satellites
+from .errors import NodeUnreachableError
+from .health import audit_success_rate
+from .nodeapi import NodeApiClient, node_endpoint
+from .wallet import wallet_features
+
+TB = 1e12
+
+
+def node_label(node: Dict) -> str:
+    """Short human-readable identifier for a registered node"""
+    return node.get('name') or node.get('nodeId', 'unknown')[:12]
+
+
+def find_node(nodes: List[Dict], ref: str) -> Optional[Dict]:
+    """Find a node by exact name or nickname, dashboard id or node ID prefix"""
+    for node in nodes:
+        if ref in (node.get('name'), node.get('dashboardName'), node.get('id'), node.get('nodeId')):
+            return node
+
+    matches = [node for node in nodes if node.get('nodeId', '').startswith(ref)]
+    if len(matches) == 1:
+        return matches[0]
+    if len(matches) > 1:
+        raise ValueError(f"Node reference '{ref}' is ambiguous ({len(matches)} matches)")
+    return None
+
+
+def determine_status(node_data: Dict) -> str:
+    """Determine node status from API data"""
+    if not node_data.get('lastContactSuccess'):
+        return 'OFFLINE'
+
+    # Check if node is disqualified, globally or by any satellite
+    critical_states = {sat['state'] for sat in find_critical_satellites(node_data)}
+    if node_data.get('disqualified') or 'disqualified' in critical_states:
+        return 'DISQUALIFIED'
+    if 'suspended' in critical_states:
+        return 'SUSPENDED'
+
+    # Check reputation scores
+    if 'reputation' in node_data:
+        reputation = node_data['reputation']
+        audit_score = reputation.get('auditScore', 1.0)
+        suspension_score = reputation.get('suspensionScore', 0.0)
+        
+        if suspension_score > 0:
+            return 'SUSPENDED'
+        elif audit_score < 0.95:
+            return 'WARNING'
+
+    return 'ONLINE'
+
+
+def parse_exit_progress(data) -> List[Dict]:
+    """Normalize per-satellite graceful exit progress from the node API"""
+    if isinstance(data, dict):
+        data = data.get('progress', [])
+    progress = []
+    for entry in data or []:
+        receipt = entry.get('completionReceipt')
+        percent = float(entry.get('percentComplete') or 0)
+        progress.append({
+            'satellite_id': entry.get('satelliteID') or entry.get('id'),
+            'satellite': entry.get('domainName') or entry.get('url'),
+            'percent_complete': percent,
+            'completed': receipt is not None or percent >= 100,
+            'successful': bool(entry.get('successful')),
+            'completion_receipt': receipt,
+        })
+    return progress
+
+
+def exit_in_progress(progress: List[Dict]) -> bool:
+    return any(not entry['completed'] for entry in progress)
+
+
+def exit_status(status: str, progress: List[Dict]) -> str:
+    """Report otherwise healthy nodes in graceful exit as EXITING"""
+    if status in ('ONLINE', 'WARNING') and exit_in_progress(progress):
+        return 'EXITING'
+    return status
+
+
+def format_exit_progress(progress: List[Dict]) -> str:
+    """Short summary such as '45% (2 sat)', 'done' or 'failed'"""
+    if not progress:
+        return '-'
+    running = [entry for entry in progress if not entry['completed']]
+    if running:
+        percent = sum(entry['percent_complete'] for entry in running) / len(running)
+        return f"{percent:.0f}% ({len(running)} sat)"
+    if all(entry['successful'] for entry in progress):
+        return 'done'
+    return 'failed'
+
+
+def _min_score(audits: List[Dict], key: str, fallback: Optional[float] = None) -> Optional[float]:
+    scores = [audit[key] for audit in audits if audit.get(key) is not None]
+    return min(scores) if scores else fallback
+
+
+async def collect_node_metrics(node_api: NodeApiClient, node: Dict) -> Dict:
+    """Fetch live data for a node and reduce it to comparable metrics"""
+    address, port = node_endpoint(node)
+    sno = await node_api.get_sno(address, port)
+    satellites = await node_api.get_satellites(address, port) or {}
+    graceful_exit = parse_exit_progress(await node_api.get_exit_progress(address, port))
+
+    metrics = {
+        'node_id': node.get('nodeId', ''),
+        'name': node_label(node),
+        'address': f"{address}:{port}",
+        'reachable': sno is not None,
+        'status': determine_status(sno) if sno is not None else 'UNREACHABLE',
+    }
+    if (address, port) in node_api.rejections:
+        metrics.update(status='REJECTED', parse_problems=node_api.rejections[(address, port)])
+    elif sno is None:
+        metrics['error'] = NodeUnreachableError.kind
+    if node.get('notes') or node.get('metadata'):
+        metrics.update(notes=node.get('notes'), metadata=node.get('metadata'))
+    if node.get('maintenance'):
+        metrics['maintenance'] = node['maintenance']
+    if sno is None:
+        return metrics
+
+    disk = sno.get('diskSpace', {})
+    used = disk.get('used', 0)
+    allocated = disk.get('allocated') or used + disk.get('available', 0)
+
+    # Exact success rates are not exposed by the node API, so the per-satellite
+    # reputation scores (worst satellite) stand in for them
+    audits = satellites.get('audits', []) or []
+    reputation = sno.get('reputation', {})
+    egress = satellites.get('egressSummary', 0) or 0
+    ingress = satellites.get('ingressSummary', 0) or 0
+
+    metrics.update({
+        'version': sno.get('version', ''),
+        'up_to_date': sno.get('upToDate'),
+        'allocated': allocated,
+        'used': used,
+        'used_ratio': used / allocated if allocated else None,
+        'trash': disk.get('trash', 0),
+        'audit_score': _min_score(audits, 'auditScore', reputation.get('auditScore')),
+        'suspension_score': _min_score(audits, 'suspensionScore', reputation.get('suspensionScore')),
+        'online_score': _min_score(audits, 'onlineScore', reputation.get('onlineScore')),
+        'audit_success_rate': audit_success_rate(sno),
+        'satellites': len(sno.get('satellites', []) or []),
+        'wallet': sno.get('wallet'),
+        'wallet_features': wallet_features(sno),
+        'egress_month': egress,
+        'ingress_month': ingress,
+        'egress_per_tb': egress / (used / TB) if used else None,
+        'graceful_exit': graceful_exit,
+        'status': exit_status(metrics['status'], graceful_exit),
+    })
+    return metrics
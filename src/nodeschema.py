@@ -0,0 +1,175 @@
+"""
+Node API schema detection
+
+The fields of the storagenode dashboard API (`/api/sno`) change across
+releases. Each supported response shape has an adapter that turns it into
+the fields the rest of the client reads, so a renamed field is translated
+instead of silently reading as zero. Responses from releases outside the
+supported range, or missing fields the client relies on, are reported as
+problems to warn about rather than guessed at.
+
+Field values are checked against the types the client expects. By default
+(lenient) a value of the wrong type is dropped and recorded as a parse
+warning; in strict mode, meant for debugging, any problem, wrong type or field
+the client does not know rejects the whole response.
+"""
+
+import re
+import time
+from datetime import datetime
+from typing import Callable, Dict, List, Optional, Tuple
+
+# Storagenode major versions whose API the adapters were written against
+SUPPORTED_MAJOR_VERSIONS = (1,)
+
+# Fields read from the adapted overview, as dotted paths
+REQUIRED_FIELDS = ('version', 'diskSpace.used', 'diskSpace.available', 'bandwidth.used', 'uptime')
+
+UNKNOWN_SCHEMA = 'unknown'
+
+NUMBER = (int, float)
+
+# Expected types of the fields the client reads, as dotted paths
+FIELD_TYPES = {
+    'nodeID': str,
+    'version': str,
+    'upToDate': bool,
+    'uptime': NUMBER,
+    'startedAt': str,
+    'lastPinged': str,
+    'lastContactSuccess': str,
+    'diskSpace': dict,
+    'diskSpace.used': NUMBER,
+    'diskSpace.available': NUMBER,
+    'diskSpace.allocated': NUMBER,
+    'diskSpace.trash': NUMBER,
+    'bandwidth': dict,
+    'bandwidth.used': NUMBER,
+    'reputation': dict,
+    'reputation.auditScore': NUMBER,
+    'reputation.suspensionScore': NUMBER,
+    'reputation.onlineScore': NUMBER,
+    'satellites': list,
+}
+
+# Top-level fields of the supported releases, including ones the client ignores
+KNOWN_FIELDS = {path.split('.')[0] for path in FIELD_TYPES} | {
+    'wallet', 'walletFeatures', 'allowedVersion', 'configuredPort', 'quicStatus', 'lastQuicPingedAt',
+}
+
+
+class StrictParseError(ValueError):
+    """A node API response rejected in strict mode"""
+
+    def __init__(self, problems: List[str]):
+        super().__init__('; '.join(problems))
+        self.problems = problems
+
+
+def parse_version(version: Optional[str]) -> Optional[Tuple[int, ...]]:
+    """(major, minor, patch) of a version such as v1.95.1, or None"""
+    match = re.match(r'v?(\d+)\.(\d+)(?:\.(\d+))?', version or '')
+    if not match:
+        return None
+    return tuple(int(part or 0) for part in match.groups())
+
+
+def _field(data: Dict, path: str):
+    for key in path.split('.'):
+        if not isinstance(data, dict) or key not in data:
+            return None
+        data = data[key]
+    return data
+
+
+def parse_time(value: str) -> Optional[float]:
+    try:
+        return datetime.fromisoformat(value.replace('Z', '+00:00')).timestamp()
+    except (AttributeError, ValueError):
+        return None
+
+
+def _drop_field(data: Dict, path: str) -> Dict:
+    """A copy of data without the field, copying only the dicts on its path"""
+    head, _, rest = path.partition('.')
+    if not rest:
+        return {key: value for key, value in data.items() if key != head}
+    return {**data, head: _drop_field(data[head], rest)}
+
+
+def _type_name(expected) -> str:
+    return 'number' if expected is NUMBER else expected.__name__
+
+
+def check_fields(data: Dict) -> Tuple[Dict, List[str]]:
+    """The data without values of unexpected types, and a parse warning for each"""
+    warnings = []
+    for path, expected in FIELD_TYPES.items():
+        value = _field(data, path)
+        # bool is an int, but never a valid number here
+        if value is None or (isinstance(value, expected) and not (
+                expected is NUMBER and isinstance(value, bool))):
+            continue
+        warnings.append(f"{path}: expected {_type_name(expected)}, got {type(value).__name__} {value!r:.40}")
+        data = _drop_field(data, path)
+    return data, warnings
+
+
+def unexpected_fields(data: Dict) -> List[str]:
+    return sorted(set(data) - KNOWN_FIELDS)
+
+
+def _adapt_uptime(data: Dict) -> Dict:
+    # Already in the client's shape, uptime in seconds
+    return data
+
+
+def _adapt_started_at(data: Dict) -> Dict:
+    # Releases reporting the process start time instead of an uptime
+    started = parse_time(data['startedAt'])
+    return {**data, 'uptime': max(0, round(time.time() - started)) if started else None}
+
+
+# (name, marker field, adapter), tried in order
+ADAPTERS: List[Tuple[str, str, Callable[[Dict], Dict]]] = [
+    ('uptime', 'uptime', _adapt_uptime),
+    ('started-at', 'startedAt', _adapt_started_at),
+]
+
+
+def adapt_sno(data: Dict) -> Tuple[Dict, str, List[str]]:
+    """The node overview in the client's shape, its schema name and any problems"""
+    data, _ = check_fields(data)
+    problems = []
+    version = parse_version(data.get('version'))
+    if version is None:
+        problems.append(f"unrecognized version {data.get('version')!r}")
+    elif version[0] not in SUPPORTED_MAJOR_VERSIONS:
+        relation = 'newer' if version[0] > max(SUPPORTED_MAJOR_VERSIONS) else 'older'
+        problems.append(f"storagenode {data['version']} is {relation} than this client supports")
+
+    schema, adapted = UNKNOWN_SCHEMA, data
+    for name, marker, adapter in ADAPTERS:
+        if marker in data:
+            schema, adapted = name, adapter(data)
+            break
+
+    missing = [path for path in REQUIRED_FIELDS if _field(adapted, path) is None]
+    if missing:
+        problems.append("missing fields " + ', '.join(missing))
+    return adapted, schema, problems
+
+
+def parse_sno(data: Dict, strict: bool = False) -> Dict:
+    """The adapted node overview with apiSchema, apiProblems and parseWarnings
+
+    Raises StrictParseError in strict mode if anything did not parse cleanly.
+    """
+    checked, warnings = check_fields(data)
+    adapted, schema, problems = adapt_sno(checked)
+    if strict:
+        unexpected = unexpected_fields(data)
+        rejected = problems + warnings + ([f"unexpected fields {', '.join(unexpected)}"] if unexpected else [])
+        if rejected:
+            raise StrictParseError(rejected)
+    return {**adapted, 'apiSchema': schema, 'apiProblems': problems, 'parseWarnings': warnings}
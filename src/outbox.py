@@ -0,0 +1,104 @@
+"""
+Upload outbox
+
+Buffers node uploads in a local SQLite database until the dashboard has
+acknowledged them, so data collected while the dashboard is unreachable is
+delivered once it is back. Every upload carries a unique idempotency key that
+the dashboard uses to discard duplicates when an acknowledgement is lost.
+"""
+
+import json
+import logging
+import sqlite3
+import time
+import uuid
+from pathlib import Path
+from typing import Dict, List, Optional
+
+SCHEMA = """
+CREATE TABLE IF NOT EXISTS outbox (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT NOT NULL UNIQUE,
+    node_id TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created REAL NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+CREATE INDEX IF NOT EXISTS outbox_node ON outbox (node_id, seq);
+"""
+
+# Header carrying the idempotency key of an upload
+IDEMPOTENCY_HEADER = 'Idempotency-Key'
+
+
+class Outbox:
+    """Uploads awaiting acknowledgement, delivered oldest first per node"""
+
+    def __init__(self, path: Optional[Path] = None, limit: int = 10000, logger=None):
+        self.path = Path(path) if path else None
+        self.limit = limit
+        self.logger = logger or logging.getLogger(__name__)
+
+        # Without a path the outbox only survives until the process exits
+        if self.path:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+        self.db = sqlite3.connect(str(self.path) if self.path else ':memory:')
+        self.db.row_factory = sqlite3.Row
+        self.db.executescript(SCHEMA)
+
+    def close(self):
+        self.db.close()
+
+    def add(self, node_id: str, payload: Dict, replace: bool = False) -> str:
+        """Queue an upload, returning its idempotency key
+
+        With replace, the node's undelivered uploads are dropped in favour of this one.
+        """
+        key = str(uuid.uuid4())
+        if replace:
+            self.db.execute("DELETE FROM outbox WHERE node_id = ?", (node_id,))
+        self.db.execute("INSERT INTO outbox (key, node_id, payload, created) VALUES (?, ?, ?, ?)",
+                        (key, node_id, json.dumps(payload, default=str), time.time()))
+        dropped = self.db.execute(
+            "DELETE FROM outbox WHERE seq NOT IN (SELECT seq FROM outbox ORDER BY seq DESC LIMIT ?)",
+            (self.limit,)).rowcount
+        self.db.commit()
+        if dropped:
+            self.logger.warning("Outbox full, dropped %d oldest undelivered uploads", dropped)
+        return key
+
+    def pending(self, node_id: Optional[str] = None) -> List[Dict]:
+        """Undelivered uploads in the order they were queued"""
+        if node_id is None:
+            rows = self.db.execute("SELECT * FROM outbox ORDER BY seq")
+        else:
+            rows = self.db.execute("SELECT * FROM outbox WHERE node_id = ? ORDER BY seq", (node_id,))
+        return [{**dict(row), 'payload': json.loads(row['payload'])} for row in rows]
+
+    def node_ids(self) -> List[str]:
+        """Nodes with undelivered uploads"""
+        return [row[0] for row in self.db.execute("SELECT DISTINCT node_id FROM outbox ORDER BY node_id")]
+
+    def coalesce(self) -> int:
+        """Keep only the latest undelivered upload of each node, returning the number dropped"""
+        dropped = self.db.execute(
+            "DELETE FROM outbox WHERE seq NOT IN (SELECT MAX(seq) FROM outbox GROUP BY node_id)").rowcount
+        self.db.commit()
+        return dropped
+
+    def ack(self, key: str):
+        """Remove an upload the dashboard has acknowledged"""
+        self.db.execute("DELETE FROM outbox WHERE key = ?", (key,))
+        self.db.commit()
+
+    def failed(self, key: str, error: str):
+        self.db.execute("UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE key = ?", (error, key))
+        self.db.commit()
+
+    def stats(self) -> Dict:
+        row = self.db.execute("SELECT COUNT(*), MIN(created) FROM outbox").fetchone()
+        return {'pending': row[0], 'oldest': row[1]}
+
+    def __len__(self) -> int:
+        return self.db.execute("SELECT COUNT(*) FROM outbox").fetchone()[0]
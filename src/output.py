@@ -0,0 +1,195 @@
+"""
+Terminal output helpers
+
+Formatting of tabular command output, severity colors and interactive
+prompts.
+"""
+
+import getpass
+import os
+import sys
+import time
+from typing import Dict, List, Optional, Sequence, Set, Tuple
+
+HIGHLIGHT = '\033[7m'
+RESET = '\033[0m'
+CLEAR_SCREEN = '\033[H\033[2J'
+
+RED = '\033[31m'
+YELLOW = '\033[33m'
+GREEN = '\033[32m'
+
+STATUS_COLORS = {
+    'ONLINE': GREEN,
+    'WARNING': YELLOW,
+    'EXITING': YELLOW,
+    'SUSPENDED': YELLOW,
+    'DISQUALIFIED': RED,
+    'OFFLINE': RED,
+    'UNREACHABLE': RED,
+    'REJECTED': RED,
+    'TIMEOUT': YELLOW,
+}
+
+# Reputation scores below this are shown as degraded
+DEGRADED_SCORE = 0.95
+
+_color_enabled: Optional[bool] = None
+
+
+def set_color(enabled: bool):
+    """Force colors on or off for all command output"""
+    global _color_enabled
+    _color_enabled = enabled
+
+
+def color_enabled() -> bool:
+    """Colors are used on terminals unless disabled by --no-color or NO_COLOR"""
+    if _color_enabled is not None:
+        return _color_enabled
+    return sys.stdout.isatty() and 'NO_COLOR' not in os.environ
+
+
+def status_color(status: str) -> Optional[str]:
+    return STATUS_COLORS.get(status)
+
+
+def score_color(score: Optional[float]) -> Optional[str]:
+    if score is None:
+        return None
+    return YELLOW if score < DEGRADED_SCORE else GREEN
+
+
+def format_bytes(value: Optional[float]) -> str:
+    """Human-readable decimal byte size"""
+    if value is None:
+        return '-'
+    for unit in ('B', 'KB', 'MB', 'GB', 'TB'):
+        if abs(value) < 1000 or unit == 'TB':
+            return f"{value:.0f} {unit}" if unit == 'B' else f"{value:.2f} {unit}"
+        value /= 1000
+
+
+def format_ratio(value: Optional[float], digits: int = 1) -> str:
+    """Render a 0..1 ratio as a percentage"""
+    return '-' if value is None else f"{value * 100:.{digits}f}%"
+
+
+def format_table(headers: Sequence[str], rows: List[Sequence],
+                 highlight: Optional[Set[Tuple[int, int]]] = None,
+                 colors: Optional[Dict[Tuple[int, int], str]] = None) -> str:
+    """Render rows as a plain left-aligned text table
+
+    Cells listed in highlight as (row, column) are shown in reverse video, and
+    cells in colors in the given color. Without color support, highlighted
+    cells are marked with a trailing '*' instead.
+    """
+    use_color = color_enabled()
+    highlight = highlight or set()
+    colors = colors or {}
+
+    cells = [[str(h) for h in headers]]
+    for row_index, row in enumerate(rows):
+        cells.append([
+            f"{cell}*" if not use_color and (row_index, col) in highlight else str(cell)
+            for col, cell in enumerate(row)
+        ])
+    widths = [max(len(row[i]) for row in cells) for i in range(len(headers))]
+
+    def render(row_index: int, col: int, cell: str) -> str:
+        padded = cell.ljust(widths[col])
+        if not use_color or row_index == 0:
+            return padded
+        style = colors.get((row_index - 1, col), '')
+        if (row_index - 1, col) in highlight:
+            style += HIGHLIGHT
+        return f"{style}{padded}{RESET}" if style else padded
+
+    lines = []
+    for index, row in enumerate(cells):
+        lines.append('  '.join(render(index, i, cell) for i, cell in enumerate(row)).rstrip())
+        if index == 0:
+            lines.append('  '.join('-' * w for w in widths))
+    return '\n'.join(lines)
+
+
+def format_age(seconds: float) -> str:
+    """Elapsed time such as 5 minutes, 3 hours or 2 days"""
+    for unit, size in (('day', 86400), ('hour', 3600), ('minute', 60)):
+        if seconds >= size:
+            count = int(seconds // size)
+            return f"{count} {unit}{'s' if count != 1 else ''}"
+    return "less than a minute"
+
+
+def confirm(message: str) -> bool:
+    """Ask a yes/no question on the terminal, defaulting to no"""
+    try:
+        answer = input(f"{message} [y/N] ")
+    except EOFError:
+        return False
+    return answer.strip().lower() in ('y', 'yes')
+
+
+def prompt_secret(message: str) -> str:
+    """Ask for a secret value on the terminal without echoing it"""
+    return getpass.getpass(message).strip()
+
+
+def format_eta(seconds: float) -> str:
+    """Order-of-magnitude remaining time such as ~40s, ~3m or ~2h"""
+    if seconds < 60:
+        return f"~{max(1, round(seconds))}s"
+    if seconds < 3600:
+        return f"~{round(seconds / 60)}m"
+    return f"~{round(seconds / 3600)}h"
+
+
+class ScanProgress:
+    """Live counter for discovery scans, redrawn in place on stderr"""
+
+    # Minimum seconds between redraws
+    REFRESH = 0.2
+
+    def __init__(self, total_hosts: int, total_probes: int, stream=None):
+        self.total_hosts = total_hosts
+        self.total_probes = total_probes
+        self.stream = stream or sys.stderr
+        self.hosts = 0
+        self.probes = 0
+        self.found = 0
+        self.started = time.monotonic()
+        self._drawn = 0.0
+
+    def probe_done(self, found: bool = False):
+        self.probes += 1
+        if found:
+            self.found += 1
+        self._draw()
+
+    def host_done(self):
+        self.hosts += 1
+        self._draw(force=True)
+
+    def line(self) -> str:
+        elapsed = time.monotonic() - self.started
+        text = (f"Scanning: {self.hosts}/{self.total_hosts} hosts, "
+                f"{self.probes}/{self.total_probes} ports, {self.found} nodes found")
+        if 0 < self.probes < self.total_probes:
+            remaining = elapsed / self.probes * (self.total_probes - self.probes)
+            text += f", {format_eta(remaining)} left"
+        return text
+
+    def _draw(self, force: bool = False):
+        now = time.monotonic()
+        if not force and now - self._drawn < self.REFRESH:
+            return
+        self._drawn = now
+        self.stream.write('\r\033[K' + self.line())
+        self.stream.flush()
+
+    def finish(self):
+        """Draw the final counts and end the line"""
+        self._draw(force=True)
+        self.stream.write('\n')
+        self.stream.flush()
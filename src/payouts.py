@@ -0,0 +1,172 @@
+"""
+Payout estimates
+
+Collects each node's own payout estimate and summarizes it per node and
+fleet-wide, optionally converted to STORJ and a local fiat currency, along
+with the held-back amount schedule per satellite. Each estimate is
+cross-checked against one computed from the node's raw usage.
+"""
+
+import asyncio
+import logging
+from datetime import datetime, timezone
+from typing import Dict, List, Optional
+
+from .currency import ExchangeRates
+from .nodeapi import NodeApiClient, node_endpoint
+from .pricing import DEFAULT_TOLERANCE, PricingModel, discrepancy
+
+
+# Held-back phases by node age on a satellite: (last month, percent held, label)
+HELD_PHASES = [
+    (3, 75, 'months 1-3'),
+    (6, 50, 'months 4-6'),
+    (9, 25, 'months 7-9'),
+    (15, 0, 'months 10-15'),
+]
+
+# Half of the held amount is returned in the month after the last phase
+RELEASE_MONTH = 16
+
+
+def _parse_time(value: str) -> Optional[datetime]:
+    try:
+        parsed = datetime.fromisoformat(value.replace('Z', '+00:00'))
+    except (AttributeError, ValueError):
+        return None
+    return parsed if parsed.tzinfo else parsed.replace(tzinfo=timezone.utc)
+
+
+def _add_months(year: int, month: int, months: int):
+    index = year * 12 + month - 1 + months
+    return index // 12, index % 12 + 1
+
+
+def held_phase(joined_at: str, now: Optional[datetime] = None) -> Optional[Dict]:
+    """Held-back phase of a node on one satellite from its join date"""
+    joined = _parse_time(joined_at)
+    if joined is None:
+        return None
+    now = now or datetime.now(timezone.utc)
+
+    # The month the node joined counts as month 1
+    month = (now.year - joined.year) * 12 + now.month - joined.month + 1
+    release_year, release_month = _add_months(joined.year, joined.month, RELEASE_MONTH - 1)
+
+    for last_month, percent, label in HELD_PHASES:
+        if month <= last_month:
+            break
+    else:
+        percent, label = 0, f'months {RELEASE_MONTH}+'
+
+    return {
+        'month': month,
+        'phase': label,
+        'held_percent': percent,
+        'release_month': f"{release_year:04d}-{release_month:02d}",
+        'released': month >= RELEASE_MONTH,
+    }
+
+
+def held_schedule(history: Optional[list], now: Optional[datetime] = None) -> List[Dict]:
+    """Per-satellite held-back phase, amount held so far and projected release"""
+    schedule = []
+    for entry in history or []:
+        phase = held_phase(entry.get('joinedAt'), now)
+        if phase is None:
+            continue
+        schedule.append({
+            'satellite_id': entry.get('satelliteID'),
+            'satellite': entry.get('satelliteName'),
+            'joined_at': entry.get('joinedAt'),
+            # Held history amounts are in micro-USD like paystubs
+            'total_held': (entry.get('totalHeld') or 0) / 1e6,
+            'total_disposed': (entry.get('totalDisposed') or 0) / 1e6,
+            **phase,
+        })
+    return schedule
+
+
+def _usd(cents) -> float:
+    """Node payout amounts are reported in USD cents"""
+    return (cents or 0) / 100
+
+
+def current_month_payout(estimate: Optional[Dict]) -> Optional[float]:
+    """This month's payout so far in USD, excluding the held amount, from the node's estimate"""
+    current = (estimate or {}).get('currentMonth')
+    if not isinstance(current, dict) or current.get('payout') is None:
+        return None
+    return _usd(current['payout'])
+
+
+async def collect_payouts(nodes: List[Dict], node_api: NodeApiClient, logger=None,
+                          pricing: Optional[PricingModel] = None,
+                          tolerance: float = DEFAULT_TOLERANCE) -> List[Dict]:
+    """Fetch payout estimates for registered nodes"""
+    logger = logger or logging.getLogger(__name__)
+    pricing = pricing or PricingModel()
+
+    async def fetch(node: Dict) -> Optional[Dict]:
+        estimate = await node_api.get_estimated_payout(*node_endpoint(node))
+        history = await node_api.get_held_history(*node_endpoint(node))
+        if estimate is None:
+            logger.warning("No payout estimate for node %s", node.get('nodeId', 'unknown')[:8])
+            return None
+
+        current = estimate.get('currentMonth', {})
+        previous = estimate.get('previousMonth', {})
+
+        # The node's payout excludes the held amount; the computed one is gross
+        computed = pricing.estimate(current)
+        reported = _usd(current.get('payout')) + _usd(current.get('held'))
+        difference = discrepancy(computed['total'], reported, tolerance)
+        if difference is not None:
+            logger.warning("Payout estimate of node %s disagrees with the pricing model: "
+                           "node says $%.2f, its usage gives $%.2f",
+                           node.get('nodeId', 'unknown')[:8], reported, computed['total'])
+        return {
+            'node_id': node.get('nodeId', ''),
+            'name': node.get('name'),
+            'current_month': _usd(current.get('payout')),
+            'current_month_held': _usd(current.get('held')),
+            'expected_month_end': _usd(estimate.get('currentMonthExpectations')),
+            'previous_month': _usd(previous.get('payout')),
+            'computed_month': computed['total'],
+            'computed_breakdown': computed,
+            'estimator_discrepancy': difference,
+            'held_schedule': held_schedule(history),
+        }
+
+    results = await asyncio.gather(*(fetch(node) for node in nodes))
+    return [r for r in results if r]
+
+
+def summarize_payouts(rows: List[Dict], rates: Optional[ExchangeRates] = None) -> Dict:
+    """Attach currency conversions and fleet-wide totals"""
+    amount_keys = ('current_month', 'current_month_held', 'expected_month_end', 'previous_month', 'computed_month')
+
+    totals = {key: sum(row[key] for row in rows) for key in amount_keys}
+    if rates:
+        for row in rows + [totals]:
+            row['converted'] = {key: rates.convert(row[key]) for key in amount_keys}
+
+    return {
+        'nodes': rows,
+        'totals': totals,
+        'rates': {
+            'storj_usd': rates.storj_usd,
+            'usd_fiat': rates.usd_fiat,
+            'fiat': rates.fiat,
+        } if rates else None,
+    }
+
+
+def format_amount(amounts: Dict, fiat: Optional[str]) -> str:
+    """Render converted amounts as "$1.23 / 4.56 STORJ / 1.10 EUR" """
+    parts = [f"${amounts['usd']:.2f}"]
+    if amounts.get('storj') is not None:
+        parts.append(f"{amounts['storj']:.2f} STORJ")
+    if fiat and amounts.get(fiat) is not None:
+        parts.append(f"{amounts[fiat]:.2f} {fiat.upper()}")
+    return ' / '.join(parts)
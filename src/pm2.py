@@ -79,7 +79,9 @@ class PM2Manager:
                 'instances': config.get('instances', 1),
                 'exec_mode': config.get('exec_mode', 'fork'),
                 'min_uptime': config.get('min_uptime', '10s'),
-                'max_restarts': config.get('max_restarts', 15)
+                'max_restarts': config.get('max_restarts', 15),
+                'kill_signal': config.get('kill_signal', 'SIGINT'),
+                'kill_timeout': config.get('kill_timeout', 1600)
             }]
         }
         
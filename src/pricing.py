@@ -0,0 +1,54 @@
+"""
+Satellite pricing model
+
+Computes payout estimates independently of the node's own estimator, from
+the raw storage and bandwidth usage it reports and the satellites' pricing
+model, and flags nodes whose estimator disagrees.
+"""
+
+from dataclasses import dataclass
+from typing import Dict, Optional
+
+# Usage is priced per decimal terabyte; storage per TB-month of 720 hours
+TB = 1e12
+HOURS_PER_MONTH = 720
+
+# Relative difference from the node's estimate reported as a discrepancy
+DEFAULT_TOLERANCE = 0.05
+
+# Differences below this many USD are never reported (rounding in small amounts)
+MIN_DISCREPANCY_USD = 0.05
+
+
+@dataclass
+class PricingModel:
+    """USD paid to node operators per unit of usage"""
+    storage_tb_month: float = 1.50
+    egress_tb: float = 2.00
+    repair_audit_tb: float = 2.00
+
+    def estimate(self, month: Dict) -> Dict:
+        """USD earned for a month's usage, before held back amounts
+
+        The month is an entry of the node's estimated-payout API, with disk
+        usage in byte-hours and bandwidth in bytes.
+        """
+        storage = (month.get('diskSpace') or 0) / TB / HOURS_PER_MONTH * self.storage_tb_month
+        egress = (month.get('egressBandwidth') or 0) / TB * self.egress_tb
+        repair_audit = (month.get('egressRepairAudit') or 0) / TB * self.repair_audit_tb
+        return {
+            'storage': storage,
+            'egress': egress,
+            'repair_audit': repair_audit,
+            'total': storage + egress + repair_audit,
+        }
+
+
+def discrepancy(computed: float, reported: float, tolerance: float = DEFAULT_TOLERANCE) -> Optional[float]:
+    """Relative difference between the computed and the node's estimate, if beyond the tolerance"""
+    difference = computed - reported
+    if abs(difference) < MIN_DISCREPANCY_USD:
+        return None
+    # Anything against a zero estimate counts as entirely off
+    share = difference / reported if reported else 1.0
+    return share if abs(share) > tolerance else None
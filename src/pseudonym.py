@@ -0,0 +1,71 @@
+"""
+Node ID pseudonymization
+
+Replaces node IDs sent to the dashboard with stable aliases derived from a
+per-client secret salt, so trends can be monitored without disclosing real
+node identities to a third-party service. The aliases of known nodes are kept
+locally to translate dashboard responses back.
+"""
+
+import hashlib
+import hmac
+import json
+import logging
+import os
+import secrets
+from pathlib import Path
+from typing import Dict
+
+ALIAS_PREFIX = 'anon-'
+
+
+class Pseudonymizer:
+    """Maps real node IDs to aliases and back"""
+
+    def __init__(self, path: Path, logger=None):
+        self.path = Path(path)
+        self.logger = logger or logging.getLogger(__name__)
+        self.salt = ''
+        self.aliases: Dict[str, str] = {}
+        self._load()
+
+    def _load(self):
+        try:
+            data = json.loads(self.path.read_text())
+            self.salt, self.aliases = data['salt'], data.get('aliases', {})
+        except FileNotFoundError:
+            self.salt = secrets.token_hex(32)
+            self._save()
+        except (OSError, ValueError, KeyError) as e:
+            # A new salt would change every alias, so refuse to guess
+            raise ValueError(f"unreadable pseudonym file {self.path}: {e}")
+
+    def _save(self):
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(json.dumps({'salt': self.salt, 'aliases': self.aliases}))
+            os.chmod(tmp, 0o600)
+            os.replace(tmp, self.path)
+        except OSError as e:
+            self.logger.error("Failed to save node ID aliases: %s", e)
+
+    def alias(self, node_id: str) -> str:
+        """Stable alias of a node ID"""
+        if node_id.startswith(ALIAS_PREFIX):
+            return node_id
+        alias = ALIAS_PREFIX + hmac.new(self.salt.encode(), node_id.encode(), hashlib.sha256).hexdigest()[:32]
+        if self.aliases.get(alias) != node_id:
+            self.aliases[alias] = node_id
+            self._save()
+        return alias
+
+    def real(self, node_id: str) -> str:
+        """Real node ID of an alias; unknown aliases and real IDs are returned unchanged"""
+        return self.aliases.get(node_id, node_id)
+
+    def reveal(self, node: Dict) -> Dict:
+        """A dashboard node with its real node ID"""
+        if node.get('nodeId') in self.aliases:
+            return {**node, 'nodeId': self.real(node['nodeId'])}
+        return node
@@ -0,0 +1,114 @@
+"""
+Implausible sample quarantine
+
+Node data that cannot be right, such as negative disk usage, more space used
+than allocated without the node reporting it as overused, scores outside 0-1
+or timestamps in the future, points to a broken node or dashboard API rather
+than a real change. Such samples are kept in a local quarantine file for
+investigation instead of being uploaded, alerted on or added to history.
+"""
+
+import json
+import logging
+import time
+from pathlib import Path
+from typing import Dict, List, Optional
+
+from .nodeschema import parse_time
+
+# Quarantined samples kept; the oldest are dropped first
+MAX_QUARANTINED = 1000
+
+# Seconds a node's timestamps may be ahead of the local clock
+CLOCK_SKEW = 300
+
+NON_NEGATIVE_FIELDS = (('diskSpace', 'used'), ('diskSpace', 'available'), ('diskSpace', 'trash'),
+                       ('bandwidth', 'used'))
+SCORE_FIELDS = ('auditScore', 'suspensionScore', 'onlineScore')
+TIMESTAMP_FIELDS = ('startedAt', 'lastPinged', 'lastContactSuccess')
+
+
+def plausibility_problems(node_data: Dict, now: Optional[float] = None) -> List[str]:
+    """Reasons a node overview cannot be right; empty if it is plausible"""
+    now = now or time.time()
+    problems = []
+    for section, key in NON_NEGATIVE_FIELDS:
+        value = (node_data.get(section) or {}).get(key)
+        if value is not None and value < 0:
+            problems.append(f"negative {section}.{key} ({value})")
+    uptime = node_data.get('uptime')
+    if uptime is not None and uptime < 0:
+        problems.append(f"negative uptime ({uptime})")
+
+    disk = node_data.get('diskSpace') or {}
+    used, allocated = disk.get('used'), disk.get('allocated')
+    if used is not None and allocated and used > allocated and not disk.get('overused'):
+        problems.append(f"{used} bytes used of {allocated} allocated, not reported as overused")
+
+    reputation = node_data.get('reputation') or {}
+    for key in SCORE_FIELDS:
+        score = reputation.get(key)
+        if score is not None and not 0 <= score <= 1:
+            problems.append(f"{key} {score} outside 0-1")
+
+    for key in TIMESTAMP_FIELDS:
+        ts = parse_time(node_data[key]) if node_data.get(key) else None
+        if ts and ts > now + CLOCK_SKEW:
+            problems.append(f"{key} {node_data[key]} is in the future")
+    return problems
+
+
+class Quarantine:
+    """Quarantined samples, one JSON record per line"""
+
+    def __init__(self, path: Path, limit: int = MAX_QUARANTINED, logger=None):
+        self.path = Path(path)
+        self.limit = limit
+        self.logger = logger or logging.getLogger(__name__)
+
+    def add(self, node: Dict, node_data: Dict, problems: List[str]):
+        record = {
+            'time': time.time(),
+            'node_id': node.get('nodeId'),
+            'name': node.get('name'),
+            'problems': problems,
+            'data': node_data,
+        }
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            with open(self.path, 'a') as f:
+                f.write(json.dumps(record, default=str) + '\n')
+            entries = self.entries()
+            if len(entries) > self.limit:
+                self._write(entries[-self.limit:])
+        except (OSError, ValueError) as e:
+            self.logger.error("Failed to quarantine sample of node %s: %s", node.get('nodeId', 'unknown')[:8], e)
+
+    def entries(self, node_id: Optional[str] = None) -> List[Dict]:
+        """Quarantined samples, oldest first, of one node if given"""
+        try:
+            lines = self.path.read_text().splitlines()
+        except FileNotFoundError:
+            return []
+        entries = []
+        for line in lines:
+            try:
+                entries.append(json.loads(line))
+            except ValueError:
+                continue
+        return [entry for entry in entries if node_id is None or entry['node_id'] == node_id]
+
+    def clear(self, node_id: Optional[str] = None) -> int:
+        """Remove the samples of one node, or all; returns the number removed"""
+        entries = self.entries()
+        kept = [entry for entry in entries if node_id is not None and entry['node_id'] != node_id]
+        self._write(kept)
+        return len(entries) - len(kept)
+
+    def _write(self, entries: List[Dict]):
+        try:
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(''.join(json.dumps(entry, default=str) + '\n' for entry in entries))
+            tmp.replace(self.path)
+        except OSError as e:
+            raise ValueError(f"cannot write {self.path}: {e}")
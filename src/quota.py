@@ -0,0 +1,80 @@
+"""
+Account quota and rate limits
+
+Reads the dashboard account's limits (maximum nodes, API request rate, data
+retention) and the rate-limit headers of API responses, so the client can
+warn before a limit is hit instead of failing with HTTP 429.
+"""
+
+import logging
+import time
+from typing import Dict, List, Mapping, Optional
+
+# Share of a limit at which a warning is given
+QUOTA_WARN_SHARE = 0.9
+
+# Limits with a matching usage figure, and how they are described
+QUOTA_LIMITS = {
+    'maxNodes': ('nodes', 'registered nodes'),
+    'requestsPerMinute': ('requestsPerMinute', 'API requests per minute'),
+    'retentionDays': (None, 'days of data retention'),
+}
+
+
+def quota_rows(quota: Dict) -> List[Dict]:
+    """Each limit with its usage and the share used"""
+    limits, usage = quota.get('limits') or {}, quota.get('usage') or {}
+    rows = []
+    for name, limit in limits.items():
+        used_key, label = QUOTA_LIMITS.get(name, (None, name))
+        used = usage.get(used_key) if used_key else None
+        share = used / limit if used is not None and limit else None
+        rows.append({'limit': name, 'label': label, 'max': limit, 'used': used, 'share': share})
+    return rows
+
+
+def quota_warnings(quota: Dict, share: float = QUOTA_WARN_SHARE) -> List[str]:
+    """Limits the account is close to or over"""
+    return [
+        f"{row['used']} of {row['max']} {row['label']} used ({row['share']:.0%})"
+        for row in quota_rows(quota) if row['share'] is not None and row['share'] >= share
+    ]
+
+
+class RateLimit:
+    """Dashboard rate-limit state from response headers"""
+
+    def __init__(self, logger=None):
+        self.logger = logger or logging.getLogger(__name__)
+        self.limit: Optional[int] = None
+        self.remaining: Optional[int] = None
+        self.blocked_until = 0.0
+        self.warned = False
+
+    def update(self, status: int, headers: Mapping[str, str]):
+        """Record the rate-limit headers of a response"""
+        try:
+            self.limit = int(headers['X-RateLimit-Limit'])
+            self.remaining = int(headers['X-RateLimit-Remaining'])
+        except (KeyError, ValueError):
+            pass
+
+        if status == 429:
+            try:
+                delay = float(headers.get('Retry-After', 60))
+            except ValueError:
+                delay = 60
+            self.blocked_until = time.time() + delay
+            self.logger.warning("Dashboard rate limit reached, pausing uploads for %ds", delay)
+            return
+
+        if self.limit and self.remaining is not None:
+            low = self.remaining < self.limit * (1 - QUOTA_WARN_SHARE)
+            if low and not self.warned:
+                self.logger.warning("Close to the dashboard rate limit: %d of %d requests left",
+                                    self.remaining, self.limit)
+            self.warned = low
+
+    @property
+    def blocked(self) -> bool:
+        return time.time() < self.blocked_until
@@ -0,0 +1,53 @@
+"""
+Node API traffic recording
+
+Captures node dashboard API responses to a directory and replays them
+offline, to reproduce problems reported against nodes that cannot be reached
+and to exercise collectors deterministically.
+"""
+
+import json
+import logging
+import re
+from pathlib import Path
+from typing import Dict, Optional
+
+
+def recording_name(url: str) -> str:
+    """File name of a recorded URL, e.g. 127.0.0.1_14002_api_sno.json"""
+    name = re.sub(r'^https?://', '', url)
+    return re.sub(r'[^A-Za-z0-9.-]+', '_', name).strip('_') + '.json'
+
+
+class TrafficLog:
+    """A directory of recorded responses, written in record mode and read in replay mode"""
+
+    def __init__(self, directory: Path, replay: bool = False, logger=None):
+        self.directory = Path(directory)
+        self.replay = replay
+        self.logger = logger or logging.getLogger(__name__)
+        if replay and not self.directory.is_dir():
+            raise ValueError(f"recording directory {self.directory} does not exist")
+
+    def record(self, url: str, status: int, body: bytes):
+        try:
+            self.directory.mkdir(parents=True, exist_ok=True)
+            (self.directory / recording_name(url)).write_text(json.dumps({
+                'url': url,
+                'status': status,
+                'body': body.decode('utf-8', errors='replace'),
+            }))
+        except OSError as e:
+            self.logger.warning("Failed to record response of %s: %s", url, e)
+
+    def load(self, url: str) -> Optional[Dict]:
+        """Recorded status and body of a URL, or None if it was not recorded"""
+        try:
+            recorded = json.loads((self.directory / recording_name(url)).read_text())
+        except FileNotFoundError:
+            self.logger.debug("No recorded response for %s", url)
+            return None
+        except (OSError, ValueError) as e:
+            self.logger.warning("Unreadable recording for %s: %s", url, e)
+            return None
+        return recorded
@@ -0,0 +1,194 @@
+"""
+Registration journal
+
+Records the outcome of each node in a bulk registration, so a run that is
+interrupted or partly fails can be resumed with only the nodes that were not
+registered. Registration itself is idempotent: nodes the dashboard already
+knows are updated instead. During discovery, nodes are registered as they are
+found rather than after the whole scan.
+"""
+
+import asyncio
+import json
+import logging
+import os
+import time
+from pathlib import Path
+from typing import Callable, Dict, List, Optional
+
+from .errors import AuthError
+
+REGISTERED = 'registered'
+UPDATED = 'updated'
+FAILED = 'failed'
+PENDING = 'pending'
+
+DONE = {REGISTERED, UPDATED}
+
+# Nodes registered concurrently, and per chunk of the journal
+REGISTRATION_CHUNK_SIZE = 10
+
+
+def registration_result(node: Dict, status: str, error: Optional[str] = None, kind: Optional[str] = None) -> Dict:
+    """A node's outcome; kind is the error class's kind of a failure (see errors.py)"""
+    return {'node_id': node['node_id'], 'name': node.get('name'), 'status': status, 'error': error,
+            'error_kind': kind or ('error' if error else None)}
+
+
+class RegistrationJournal:
+    """Per-node progress of the last bulk registration, kept until it completes"""
+
+    def __init__(self, path: Path, logger=None):
+        self.path = Path(path)
+        self.logger = logger or logging.getLogger(__name__)
+        self.started_at: Optional[float] = None
+        # node_id -> {'account', 'node', 'status', 'error'}
+        self.entries: Dict[str, Dict] = {}
+
+    def load(self) -> bool:
+        """Read an unfinished journal; False if there is none"""
+        try:
+            data = json.loads(self.path.read_text())
+            self.started_at, self.entries = data['started_at'], data['entries']
+        except FileNotFoundError:
+            return False
+        except (OSError, ValueError, KeyError) as e:
+            self.logger.warning("Ignoring unreadable registration journal %s: %s", self.path, e)
+            return False
+        return True
+
+    def begin(self, groups: Optional[Dict[str, List[Dict]]] = None):
+        """Start a registration of nodes grouped by account"""
+        self.started_at = time.time()
+        self.entries = {}
+        self.add(groups or {})
+
+    def add(self, groups: Dict[str, List[Dict]]):
+        """Add nodes found after the registration started"""
+        for account, nodes in groups.items():
+            for node in nodes:
+                self.entries[node['node_id']] = {'account': account, 'node': node, 'status': PENDING, 'error': None}
+        self._save()
+
+    def pending(self) -> Dict[str, List[Dict]]:
+        """Nodes not registered yet, grouped by account"""
+        groups: Dict[str, List[Dict]] = {}
+        for entry in self.entries.values():
+            if entry['status'] not in DONE:
+                groups.setdefault(entry['account'], []).append(entry['node'])
+        return groups
+
+    def record(self, results: List[Dict]):
+        """Store the outcome of a chunk of nodes"""
+        for result in results:
+            entry = self.entries.get(result['node_id'])
+            if entry:
+                entry['status'], entry['error'] = result['status'], result['error']
+        self._save()
+
+    def finish(self) -> bool:
+        """Remove the journal if every node is registered; False if some are left"""
+        if self.pending():
+            return False
+        try:
+            self.path.unlink()
+        except FileNotFoundError:
+            pass
+        except OSError as e:
+            self.logger.debug("Failed to remove registration journal: %s", e)
+        return True
+
+    def _save(self):
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp = self.path.with_suffix('.tmp')
+            tmp.write_text(json.dumps({'started_at': self.started_at, 'entries': self.entries}, default=str))
+            os.chmod(tmp, 0o600)
+            os.replace(tmp, self.path)
+        except OSError as e:
+            self.logger.warning("Failed to write registration journal: %s", e)
+
+
+class RegistrationPipeline:
+    """Registers discovered nodes while discovery goes on
+
+    Nodes are submitted as each source or host finishes, grouped by account
+    and registered by one worker per account, up to a chunk at a time. A node
+    submitted twice is registered once. Once an account's token is rejected
+    or its dashboard is unreachable, its further nodes are only journaled, for
+    `discover --resume`.
+    """
+
+    def __init__(self, journal: RegistrationJournal, assign: Callable[[List[Dict]], Dict[Optional[str], List[Dict]]],
+                 registrar: Callable[[str], object], chunk_size: int = REGISTRATION_CHUNK_SIZE, logger=None):
+        self.journal = journal
+        self.assign = assign
+        # Account name -> client with register_nodes(nodes, on_chunk)
+        self.registrar = registrar
+        self.chunk_size = chunk_size
+        self.logger = logger or logging.getLogger(__name__)
+        self.seen = set()
+        self.unassigned: List[Dict] = []
+        self.queues: Dict[str, asyncio.Queue] = {}
+        self.workers: List[asyncio.Task] = []
+        self.results: List[Dict] = []
+        # Account name -> error that stopped its worker, e.g. AuthError or NetworkError
+        self.errors: Dict[str, Exception] = {}
+
+    @property
+    def submitted(self) -> int:
+        return len(self.seen) - len(self.unassigned)
+
+    def submit(self, nodes: List[Dict]):
+        """Queue newly found nodes for registration"""
+        fresh = [node for node in nodes if node['node_id'] not in self.seen]
+        self.seen.update(node['node_id'] for node in fresh)
+        groups = self.assign(fresh)
+        self.unassigned.extend(groups.pop(None, []))
+        if not groups:
+            return
+        if self.journal.started_at is None:
+            self.journal.begin(groups)
+        else:
+            self.journal.add(groups)
+        for account, account_nodes in groups.items():
+            if account in self.errors:
+                continue
+            if account not in self.queues:
+                self.queues[account] = asyncio.Queue()
+                self.workers.append(asyncio.create_task(self._worker(account, self.queues[account])))
+            for node in account_nodes:
+                self.queues[account].put_nowait(node)
+
+    async def _worker(self, account: str, queue: asyncio.Queue):
+        client = None
+        while True:
+            chunk = [await queue.get()]
+            while len(chunk) < self.chunk_size and not queue.empty():
+                chunk.append(queue.get_nowait())
+            try:
+                # Nodes queued before an error are left pending in the journal
+                if account not in self.errors:
+                    if client is None:
+                        # Inside the try, so a client that cannot be created stops only its account
+                        client = self.registrar(account)
+                    self.results.extend(await client.register_nodes(chunk, on_chunk=self.journal.record,
+                                                                    chunk_size=self.chunk_size))
+            except Exception as e:
+                self.logger.error("Stopped registering nodes with account %s: %s", account, e)
+                self.errors[account] = e
+            finally:
+                for _ in chunk:
+                    queue.task_done()
+
+    async def finish(self) -> List[Dict]:
+        """Wait for the submitted nodes; raises the error that stopped an account, if any"""
+        for queue in self.queues.values():
+            await queue.join()
+        for worker in self.workers:
+            worker.cancel()
+        await asyncio.gather(*self.workers, return_exceptions=True)
+        errors = sorted(self.errors.values(), key=lambda error: not isinstance(error, AuthError))
+        if errors:
+            raise errors[0]
+        return self.results
@@ -0,0 +1,201 @@
+"""
+Monthly earnings reports
+
+Compiles per-node and fleet-wide earnings, storage, bandwidth, uptime and
+audit history for one calendar month into a JSON, CSV or HTML report.
+"""
+
+import csv
+import html
+import io
+import json
+from datetime import datetime, timezone
+from typing import Dict, List, Optional, Tuple
+
+from .currency import ExchangeRates
+from .store import HistoryStore
+
+# Paystub amounts are reported in micro-USD
+PAYSTUB_UNIT = 1_000_000
+
+
+def month_bounds(month: str) -> Tuple[float, float]:
+    """Start and end timestamps (UTC) of a YYYY-MM month"""
+    start = datetime.strptime(month, '%Y-%m').replace(tzinfo=timezone.utc)
+    if start.month == 12:
+        end = start.replace(year=start.year + 1, month=1)
+    else:
+        end = start.replace(month=start.month + 1)
+    return start.timestamp(), end.timestamp()
+
+
+def paystub_earnings(paystubs: Optional[List[Dict]]) -> Optional[Dict]:
+    """Sum paid and held amounts across a node's per-satellite paystubs"""
+    if not paystubs:
+        return None
+    return {
+        'paid': sum(stub.get('paid', 0) for stub in paystubs) / PAYSTUB_UNIT,
+        'held': sum(stub.get('held', 0) for stub in paystubs) / PAYSTUB_UNIT,
+    }
+
+
+def _node_section(node_id: str, samples: List[Dict], paystubs: Optional[List[Dict]]) -> Dict:
+    """Summarize one node's samples for the month"""
+    last = samples[-1] if samples else {}
+    audit_scores = [s['audit_score'] for s in samples if s['audit_score'] is not None]
+    online = sum(1 for s in samples if s['status'] != 'OFFLINE')
+
+    earnings = paystub_earnings(paystubs)
+    if earnings is None:
+        # Month not paid out yet; fall back to the node's last recorded estimate
+        payouts = [s['payout_cents'] for s in samples if s['payout_cents'] is not None]
+        earnings = {'paid': (payouts[-1] / 100) if payouts else 0.0, 'held': 0.0, 'estimated': True}
+
+    return {
+        'node_id': node_id,
+        'name': last.get('name'),
+        'earnings': earnings,
+        'storage': {
+            'average_used': sum(s['disk_used'] or 0 for s in samples) / len(samples) if samples else 0,
+            'max_used': max((s['disk_used'] or 0 for s in samples), default=0),
+            'end_used': last.get('disk_used', 0),
+            'end_available': last.get('disk_available', 0),
+        },
+        'bandwidth': {
+            # The node reports bandwidth used so far this month
+            'used': max((s['bandwidth_used'] or 0 for s in samples), default=0),
+        },
+        'uptime': {
+            'samples': len(samples),
+            'online_ratio': online / len(samples) if samples else None,
+        },
+        'audit': {
+            'min': min(audit_scores) if audit_scores else None,
+            'average': sum(audit_scores) / len(audit_scores) if audit_scores else None,
+            'last': audit_scores[-1] if audit_scores else None,
+        },
+        'versions': sorted({s['version'] for s in samples if s['version']}),
+    }
+
+
+def build_monthly_report(store: HistoryStore, month: str,
+                         paystubs: Optional[Dict[str, List[Dict]]] = None,
+                         rates: Optional[ExchangeRates] = None) -> Dict:
+    """Build the report structure for a month"""
+    start, end = month_bounds(month)
+    paystubs = paystubs or {}
+
+    by_node: Dict[str, List[Dict]] = {}
+    for sample in store.samples(start, end):
+        by_node.setdefault(sample['node_id'], []).append(sample)
+    for node_id in paystubs:
+        by_node.setdefault(node_id, [])
+
+    nodes = [_node_section(node_id, samples, paystubs.get(node_id))
+             for node_id, samples in sorted(by_node.items())]
+
+    ratios = [n['uptime']['online_ratio'] for n in nodes if n['uptime']['online_ratio'] is not None]
+    fleet = {
+        'nodes': len(nodes),
+        'earnings': {
+            'paid': sum(n['earnings']['paid'] for n in nodes),
+            'held': sum(n['earnings']['held'] for n in nodes),
+        },
+        'storage_end_used': sum(n['storage']['end_used'] or 0 for n in nodes),
+        'bandwidth_used': sum(n['bandwidth']['used'] for n in nodes),
+        'average_online_ratio': sum(ratios) / len(ratios) if ratios else None,
+    }
+
+    if rates:
+        for section in nodes + [fleet]:
+            section['earnings']['converted'] = rates.convert(section['earnings']['paid'])
+
+    return {
+        'month': month,
+        'generated_at': datetime.utcnow().isoformat(),
+        'fiat': rates.fiat if rates else None,
+        'nodes': nodes,
+        'fleet': fleet,
+    }
+
+
+def _flat_rows(report: Dict) -> List[Dict]:
+    """One flat row per node plus a fleet total row"""
+    fiat = report['fiat']
+    rows = []
+    for node in report['nodes']:
+        converted = node['earnings'].get('converted', {})
+        row = {
+            'node_id': node['node_id'],
+            'name': node['name'] or '',
+            'paid_usd': round(node['earnings']['paid'], 2),
+            'held_usd': round(node['earnings']['held'], 2),
+            'estimated': node['earnings'].get('estimated', False),
+            'paid_storj': _round(converted.get('storj')),
+            'storage_end_gb': round((node['storage']['end_used'] or 0) / 1e9, 2),
+            'storage_max_gb': round(node['storage']['max_used'] / 1e9, 2),
+            'bandwidth_gb': round(node['bandwidth']['used'] / 1e9, 2),
+            'online_ratio': _round(node['uptime']['online_ratio'], 4),
+            'audit_min': _round(node['audit']['min'], 4),
+            'audit_last': _round(node['audit']['last'], 4),
+        }
+        if fiat:
+            row[f'paid_{fiat}'] = _round(converted.get(fiat))
+        rows.append(row)
+
+    fleet = report['fleet']
+    converted = fleet['earnings'].get('converted', {})
+    total = {key: '' for key in (rows[0] if rows else {})}
+    total.update({
+        'node_id': 'FLEET',
+        'paid_usd': round(fleet['earnings']['paid'], 2),
+        'held_usd': round(fleet['earnings']['held'], 2),
+        'paid_storj': _round(converted.get('storj')),
+        'storage_end_gb': round(fleet['storage_end_used'] / 1e9, 2),
+        'bandwidth_gb': round(fleet['bandwidth_used'] / 1e9, 2),
+        'online_ratio': _round(fleet['average_online_ratio'], 4),
+    })
+    if fiat:
+        total[f'paid_{fiat}'] = _round(converted.get(fiat))
+    rows.append(total)
+    return rows
+
+
+def _round(value, digits: int = 2):
+    return round(value, digits) if value is not None else ''
+
+
+def render_report(report: Dict, fmt: str) -> str:
+    """Render a report as json, csv or html"""
+    if fmt == 'json':
+        return json.dumps(report, indent=2, default=str)
+
+    rows = _flat_rows(report)
+    headers = list(rows[0].keys())
+
+    if fmt == 'csv':
+        buffer = io.StringIO()
+        writer = csv.DictWriter(buffer, fieldnames=headers)
+        writer.writeheader()
+        writer.writerows(rows)
+        return buffer.getvalue()
+
+    if fmt == 'html':
+        head = ''.join(f'<th>{html.escape(h)}</th>' for h in headers)
+        body = ''.join(
+            '<tr>' + ''.join(f'<td>{html.escape(str(row[h]))}</td>' for h in headers) + '</tr>'
+            for row in rows
+        )
+        title = f"Storj earnings report {html.escape(report['month'])}"
+        return (
+            f"<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>{title}</title>"
+            "<style>body{font-family:sans-serif}table{border-collapse:collapse}"
+            "th,td{border:1px solid #ccc;padding:4px 8px;text-align:right}"
+            "tr:last-child{font-weight:bold}</style></head><body>"
+            f"<h1>{title}</h1><p>Generated {html.escape(report['generated_at'])} UTC, "
+            f"{report['fleet']['nodes']} nodes.</p>"
+            f"<table><thead><tr>{head}</tr></thead><tbody>{body}</tbody></table>"
+            "</body></html>\n"
+        )
+
+    raise ValueError(f"Unsupported report format: {fmt}")
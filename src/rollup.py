@@ -0,0 +1,77 @@
+"""
+Fleet rollups
+
+Totals over the payloads of one sync cycle, uploaded to the dashboard once
+the cycle ends so its overview does not have to aggregate every node row:
+stored and free space, today's egress, this month's estimated payout, nodes
+by state and by payout method. Totals are taken from the payloads as uploaded, so fields
+kept off the dashboard with sync.fields stay out of the totals too.
+"""
+
+import time
+from collections import Counter
+from typing import Dict, Optional
+
+from .wallet import format_wallet_features
+
+# Statuses of nodes that are up but need attention
+DEGRADED_STATUSES = ('WARNING', 'SUSPENDED', 'DISQUALIFIED')
+
+# Payload fields summed into the rollup
+TOTALS = ('usedSpace', 'availableSpace', 'egressToday', 'estimatedPayout')
+
+
+class FleetRollup:
+    """Accumulates the nodes of a sync cycle into fleet totals"""
+
+    def __init__(self):
+        self.begin()
+
+    def begin(self):
+        self.statuses: Counter = Counter()
+        self.critical = 0
+        self.unreachable = 0
+        self.maintenance = 0
+        self.payout: Counter = Counter()
+        self.totals: Dict[str, Optional[float]] = dict.fromkeys(TOTALS)
+
+    def add(self, payload: Dict):
+        """Count a node's upload"""
+        self.statuses[payload.get('status') or 'UNKNOWN'] += 1
+        self.critical += bool(payload.get('critical'))
+        if isinstance(payload.get('walletFeatures'), list):
+            self.payout[format_wallet_features(payload['walletFeatures'])] += 1
+        for key in TOTALS:
+            value = payload.get(key)
+            if isinstance(value, (int, float)) and not isinstance(value, bool):
+                self.totals[key] = (self.totals[key] or 0) + value
+
+    def add_unreachable(self):
+        """Count a node whose dashboard did not answer"""
+        self.unreachable += 1
+
+    def add_maintenance(self):
+        """Count an unreachable node in planned downtime, neither online nor offline"""
+        self.maintenance += 1
+
+    def summary(self, skipped: int = 0) -> Dict:
+        """The cycle's totals; totals no node reported are None"""
+        offline = self.statuses['OFFLINE'] + self.unreachable
+        reported = sum(self.statuses.values())
+        return {
+            'nodes': reported + self.unreachable + self.maintenance,
+            'online': reported - self.statuses['OFFLINE'],
+            'offline': offline,
+            'degraded': sum(self.statuses[status] for status in DEGRADED_STATUSES),
+            'critical': self.critical,
+            'maintenance': self.maintenance,
+            'byStatus': {**self.statuses, **({'UNREACHABLE': self.unreachable} if self.unreachable else {}),
+                         **({'MAINTENANCE': self.maintenance} if self.maintenance else {})},
+            **self.totals,
+            # Nodes by wallet features, e.g. {'zksync-era': 9, 'L1': 1}
+            'payoutMethods': dict(self.payout),
+            'payoutConsistent': len(self.payout) < 2,
+            # Nodes synced just before a restart are not in this cycle's totals
+            'skipped': skipped,
+            'generatedAt': time.time(),
+        }
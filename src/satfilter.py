@@ -0,0 +1,67 @@
+"""
+Satellite filtering
+
+Drops satellites from node data before anything looks at it, following
+satellites.include and satellites.exclude, so a decommissioned satellite that
+nodes still list does not raise alerts, pull down the worst reputation score
+or add to payout sums. Satellites are named by ID or by address (with or
+without its port). Totals the node API only reports across all satellites,
+such as this month's bandwidth, are not affected.
+"""
+
+from typing import Any, Dict, Iterable, Optional
+
+
+def _host(url: Optional[str]) -> Optional[str]:
+    return url.rsplit(':', 1)[0] if url and ':' in url else url
+
+
+class SatelliteFilter:
+    """Which satellites count, from include and exclude lists of IDs or addresses"""
+
+    def __init__(self, include: Iterable[str] = (), exclude: Iterable[str] = ()):
+        self.include = set(include or ())
+        self.exclude = set(exclude or ())
+
+    def __bool__(self) -> bool:
+        return bool(self.include or self.exclude)
+
+    def _names(self, satellite_id: Optional[str], url: Optional[str]) -> set:
+        return {name for name in (satellite_id, url, _host(url)) if name}
+
+    def allows(self, satellite_id: Optional[str], url: Optional[str] = None) -> bool:
+        names = self._names(satellite_id, url)
+        if names & self.exclude:
+            return False
+        return not self.include or bool(names & self.include)
+
+    def entries(self, entries: Any, id_key: str, url_key: Optional[str] = None) -> Any:
+        """The per-satellite entries of a node API list that are allowed; other values unchanged"""
+        if not self or not isinstance(entries, list):
+            return entries
+        return [entry for entry in entries if not isinstance(entry, dict) or
+                self.allows(entry.get(id_key), entry.get(url_key) if url_key else None)]
+
+    def sno(self, data: Any) -> Any:
+        """A /api/sno response with only the allowed satellites"""
+        if not self or not isinstance(data, dict) or 'satellites' not in data:
+            return data
+        return {**data, 'satellites': self.entries(data['satellites'], 'id', 'url')}
+
+    def trusted(self, trusted: Dict[str, str]) -> Dict[str, str]:
+        """The allowed satellites of a trust list (ID -> address)"""
+        return {sat_id: url for sat_id, url in trusted.items() if self.allows(sat_id, url)} if self else trusted
+
+
+# Filter of node API clients and discovery, set from the satellites config
+_current = SatelliteFilter()
+
+
+def set_satellite_filter(satellites: SatelliteFilter):
+    """Filter the satellites of every node API response"""
+    global _current
+    _current = satellites
+
+
+def satellite_filter() -> SatelliteFilter:
+    return _current
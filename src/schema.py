@@ -0,0 +1,282 @@
+"""
+Configuration schema
+
+Declares every recognized configuration key with its type and allowed range,
+and turns schema violations into precise, human-readable messages.
+"""
+
+import difflib
+from typing import Dict, List
+
+from jsonschema import Draft7Validator
+
+from .health import HEALTH_WEIGHTS
+from .logger import LOG_COMPONENTS
+from .lowpower import COLLECTORS
+
+# Configuration keys holding durations: seconds as a number, or strings
+# such as "30s", "5m", "1h". Values are the minimum allowed, in seconds.
+DURATION_FIELDS = {
+    'api.timeout': 1,
+    'discovery.timeout': 1,
+    'sync.interval': 30,
+    'alerts.timeout': 1,
+    'alerts.status_interval': 30,
+    'errors.timeout': 1,
+    'currency.cache_ttl': 60,
+    'satellites.cache_ttl': 3600,
+    'telemetry.interval': 3600,
+    'update.timeout': 1,
+    'aggregator.dedupe_window': 0,
+    'sync.startup_jitter': 0,
+    'sync.static_ttl': 0,
+    'sync.dormant_after': 0,
+    'sync.drain_timeout': 0,
+    'low_power.interval': 60,
+}
+
+DURATION = {'type': ['number', 'string']}
+LOG_LEVEL = {'enum': ['debug', 'info', 'warn', 'warning', 'error']}
+PORT = {'type': 'integer', 'minimum': 1, 'maximum': 65535}
+
+
+def _section(properties: Dict) -> Dict:
+    return {'type': 'object', 'additionalProperties': False, 'properties': properties}
+
+
+def _optional(schema: Dict) -> Dict:
+    types = schema['type'] if isinstance(schema['type'], list) else [schema['type']]
+    return {**schema, 'type': types + ['null']}
+
+
+CONFIG_SCHEMA = _section({
+    'api': _section({
+        'token': {'type': 'string'},
+        'endpoint': {'type': 'string', 'pattern': r'^https?://'},
+        'timeout': DURATION,
+        'signing_secret': _optional({'type': 'string', 'minLength': 16}),
+        'client_cert': _optional({'type': 'string'}),
+        'client_key': _optional({'type': 'string'}),
+        'ca_file': _optional({'type': 'string'}),
+        'read_only': {'type': 'boolean'},
+        'accounts': {'type': 'array', 'items': {
+            **_section({
+                'name': {'type': 'string', 'pattern': r'^[A-Za-z0-9_.-]+$'},
+                'token': {'type': 'string'},
+                'endpoint': {'type': 'string', 'pattern': r'^https?://'},
+                'servers': {'type': 'array', 'items': {'type': 'string'}},
+                'tags': {'type': 'array', 'items': {'type': 'string'}},
+                'signing_secret': _optional({'type': 'string', 'minLength': 16}),
+            }),
+            'required': ['name', 'token'],
+        }},
+    }),
+    'discovery': _section({
+        'from_docker': {'type': 'boolean'},
+        'docker_host': {'type': 'string'},
+        'common_ports': {'type': 'array', 'items': PORT},
+        'port_range': {'type': 'array', 'items': PORT, 'minItems': 2, 'maxItems': 2},
+        'timeout': DURATION,
+        'retry_attempts': {'type': 'integer', 'minimum': 0, 'maximum': 10},
+    }),
+    'sync': _section({
+        'interval': DURATION,
+        'batch_size': {'type': 'integer', 'minimum': 1, 'maximum': 500},
+        'max_inflight_uploads': {'type': 'integer', 'minimum': 1, 'maximum': 500},
+        'retry_failed': {'type': 'boolean'},
+        'outbox_limit': {'type': 'integer', 'minimum': 1},
+        'backpressure_threshold': {'type': 'integer', 'minimum': 0},
+        'backpressure': {'enum': ['skip', 'coalesce']},
+        'startup_jitter': DURATION,
+        'phase_offset': {'type': 'boolean'},
+        'jitter_seed': _optional({'type': 'string', 'minLength': 1}),
+        'storage_probe': {'type': 'boolean'},
+        'static_ttl': DURATION,
+        'dormant_after': DURATION,
+        'drain_timeout': DURATION,
+        'fields': _section({
+            'allow': {'type': 'array', 'items': {'type': 'string'}},
+            'deny': {'type': 'array', 'items': {'type': 'string'}},
+        }),
+        'pseudonymize_node_ids': {'type': 'boolean'},
+        'sinks': {'type': 'array', 'minItems': 1, 'items': {
+            **_section({
+                'type': {'enum': ['dashboard', 'influxdb', 'prometheus', 'file', 'stdout']},
+                'path': {'type': 'string'},
+                'url': {'type': 'string', 'pattern': r'^https?://'},
+                'bucket': {'type': 'string'},
+                'org': {'type': 'string'},
+                'database': {'type': 'string'},
+                'token': {'type': 'string'},
+                'measurement': {'type': 'string'},
+                'listen': {'type': 'string'},
+                'timeout': {'type': 'number', 'exclusiveMinimum': 0},
+                'max_size_mb': {'type': 'number', 'minimum': 0},
+                'rotate_every': DURATION,
+                'keep': {'type': 'integer', 'minimum': 0},
+                'compress': {'type': 'boolean'},
+            }),
+            'required': ['type'],
+        }},
+    }),
+    'aggregator': _section({
+        'listen': {'type': 'string'},
+        'cert': _optional({'type': 'string'}),
+        'key': _optional({'type': 'string'}),
+        'client_ca': _optional({'type': 'string'}),
+        'dedupe_window': DURATION,
+    }),
+    'hub': _section({
+        'servers': {'type': 'array', 'items': _section({
+            'name': {'type': 'string'},
+            'address': {'type': 'string'},
+            'addresses': {'type': 'array', 'items': {'type': 'string'}},
+            'concurrency': {'type': 'integer', 'minimum': 1, 'maximum': 100},
+            'scheme': {'enum': ['http', 'https']},
+            'username': {'type': 'string'},
+            'password': {'type': 'string'},
+            'token': {'type': 'string'},
+            'timeout': {'type': 'number', 'exclusiveMinimum': 0},
+            'verify_tls': {'type': 'boolean'},
+            'ports': {'type': ['string', 'array'], 'items': {'type': ['integer', 'string']}},
+        })},
+        'failure_threshold': {'type': 'integer', 'minimum': 0},
+    }),
+    'network': _section({
+        'interface': _optional({'type': 'string', 'pattern': r'^[^\s/]{1,15}$'}),
+        'prefer_overlay': {'type': 'boolean'},
+    }),
+    'logging': _section({
+        'level': LOG_LEVEL,
+        'file': _optional({'type': 'string'}),
+        'levels': _section({component: LOG_LEVEL for component in LOG_COMPONENTS}),
+    }),
+    'alerts': _section({
+        'enabled': {'type': 'boolean'},
+        'webhook_url': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'timeout': DURATION,
+        'disk_full_days': {'type': 'integer', 'minimum': 0},
+        'unknown_audit_days': {'type': 'integer', 'minimum': 0},
+        'status_feed': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'status_interval': DURATION,
+        'storage_latency_factor': {'type': 'number', 'minimum': 0},
+    }),
+    'errors': _section({
+        'sentry_dsn': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'webhook_url': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'environment': _optional({'type': 'string'}),
+        'timeout': DURATION,
+    }),
+    'tracing': _section({
+        'enabled': {'type': 'boolean'},
+        'endpoint': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'service_name': {'type': 'string'},
+    }),
+    'currency': _section({
+        'fiat': _optional({'type': 'string', 'pattern': r'^[A-Za-z]{3}$'}),
+        'source': {'type': 'string', 'pattern': r'^https?://'},
+        'cache_ttl': DURATION,
+    }),
+    'pricing': _section({
+        'storage_tb_month': {'type': 'number', 'minimum': 0},
+        'egress_tb': {'type': 'number', 'minimum': 0},
+        'repair_audit_tb': {'type': 'number', 'minimum': 0},
+        'tolerance': {'type': 'number', 'minimum': 0, 'maximum': 1},
+    }),
+    'health': _section({
+        'weights': _section({component: {'type': 'number', 'minimum': 0} for component in HEALTH_WEIGHTS}),
+        'alert_below': {'type': 'number', 'minimum': 0, 'maximum': 100},
+    }),
+    'satellites': _section({
+        'trust_source': {'type': 'string', 'pattern': r'^https?://'},
+        'extra_trusted': {'type': 'array', 'items': {'type': 'string'}},
+        'cache_ttl': DURATION,
+        'include': {'type': 'array', 'items': {'type': 'string'}},
+        'exclude': {'type': 'array', 'items': {'type': 'string'}},
+    }),
+    'history': _section({
+        'enabled': {'type': 'boolean'},
+        'path': _optional({'type': 'string'}),
+        'retention_days': {'type': 'integer', 'minimum': 1},
+    }),
+    'telemetry': _section({
+        'enabled': {'type': 'boolean'},
+        'endpoint': _optional({'type': 'string', 'pattern': r'^https?://'}),
+        'interval': DURATION,
+    }),
+    'update': _section({
+        'endpoint': {'type': 'string', 'pattern': r'^https?://'},
+        'public_key': _optional({'type': 'string', 'pattern': r'^[A-Za-z0-9+/]{43}=$'}),
+        'timeout': DURATION,
+    }),
+    'low_power': _section({
+        'enabled': {'type': 'boolean'},
+        'interval': DURATION,
+        'skip': {'type': 'array', 'items': {'enum': list(COLLECTORS)}, 'uniqueItems': True},
+        'memory_target': {'type': 'integer', 'minimum': 16},
+    }),
+})
+
+TYPE_NAMES = {
+    'string': 'a string',
+    'integer': 'an integer',
+    'number': 'a number',
+    'boolean': 'true or false',
+    'array': 'a list',
+    'object': 'a mapping',
+    'null': 'empty',
+}
+
+
+def _path(parts) -> str:
+    return '.'.join(str(p) for p in parts) or 'config'
+
+
+def _describe(error) -> List[str]:
+    """Translate one jsonschema error into messages"""
+    path = _path(error.absolute_path)
+    check = error.validator
+
+    if check == 'additionalProperties':
+        known = list(error.schema.get('properties', {}))
+        messages = []
+        for key in sorted(set(error.instance) - set(known)):
+            name = f"{path}.{key}" if error.absolute_path else key
+            message = f"unknown key '{name}'"
+            close = difflib.get_close_matches(str(key), known, n=1)
+            if close:
+                suggestion = f"{path}.{close[0]}" if error.absolute_path else close[0]
+                message += f" (did you mean '{suggestion}'?)"
+            messages.append(message)
+        return messages
+
+    if check == 'type':
+        expected = error.validator_value
+        expected = expected if isinstance(expected, list) else [expected]
+        return [f"{path} must be {' or '.join(TYPE_NAMES.get(t, t) for t in expected)}"]
+    if check == 'minimum':
+        return [f"{path} must be ≥ {error.validator_value}"]
+    if check == 'maximum':
+        return [f"{path} must be ≤ {error.validator_value}"]
+    if check == 'enum':
+        return [f"{path} must be one of: {', '.join(map(str, error.validator_value))}"]
+    if check == 'pattern':
+        return [f"{path} has an invalid value {error.instance!r}"]
+    if check == 'required':
+        missing = [key for key in error.validator_value if key not in error.instance]
+        return [f"{path} is missing {', '.join(repr(key) for key in missing)}"]
+    if check in ('minItems', 'maxItems'):
+        return [f"{path} has the wrong number of entries"]
+
+    return [f"{path}: {error.message}"]
+
+
+def validate_config_data(data: Dict) -> List[str]:
+    """Validate raw configuration data, returning error messages"""
+    validator = Draft7Validator(CONFIG_SCHEMA)
+    errors = sorted(validator.iter_errors(data), key=lambda e: list(map(str, e.absolute_path)))
+
+    messages = []
+    for error in errors:
+        messages.extend(_describe(error))
+    return messages
@@ -0,0 +1,204 @@
+"""
+Self-update
+
+Looks up the latest client release (a GitHub release by default), downloads
+the archive for this platform, or the platform-independent one, and replaces
+the installation directory with its contents. Releases carry a SHA256SUMS
+file and its Ed25519 signature SHA256SUMS.sig; the archive must match its
+checksum and the checksums must be signed by update.public_key. The new
+version is unpacked next to the installation and swapped in with two
+renames, keeping the previous version as <directory>.previous.
+"""
+
+import asyncio
+import base64
+import hashlib
+import io
+import logging
+import os
+import platform
+import re
+import shutil
+import sys
+import tarfile
+from pathlib import Path
+from typing import Dict, Optional, Tuple
+
+import aiohttp
+
+DEFAULT_RELEASE_ENDPOINT = 'https://api.github.com/repos/ElektryonUK/storjcloud-client/releases/latest'
+
+ARCHIVE_PREFIX = 'storjcloud-client-'
+CHECKSUMS = 'SHA256SUMS'
+SIGNATURE = 'SHA256SUMS.sig'
+
+# Largest release file downloaded
+MAX_DOWNLOAD = 100 * 1024 * 1024
+
+# The entry point an unpacked release must contain
+ENTRY_POINT = 'storjcloud-client.py'
+
+MACHINES = {'x86_64': 'amd64', 'amd64': 'amd64', 'aarch64': 'arm64', 'arm64': 'arm64', 'armv7l': 'armv7'}
+
+
+def parse_version(text: str) -> Tuple[int, ...]:
+    """Comparable form of a version such as v1.2.3; ValueError if it is none"""
+    match = re.fullmatch(r'v?(\d+(?:\.\d+)*)', text.strip())
+    if not match:
+        raise ValueError(f"not a release version: {text!r}")
+    return tuple(int(part) for part in match.group(1).split('.'))
+
+
+def platform_tag() -> str:
+    """This platform as release archives name it, e.g. linux-amd64"""
+    system = 'windows' if sys.platform.startswith('win') else sys.platform.rstrip('0123456789')
+    machine = platform.machine().lower()
+    return f"{system}-{MACHINES.get(machine, machine)}"
+
+
+def parse_release(data: Dict) -> Dict:
+    """Version, page and download URLs by file name of a GitHub release response"""
+    if not isinstance(data, dict) or not data.get('tag_name'):
+        raise ValueError("the release endpoint did not return a release")
+    return {
+        'version': data['tag_name'].lstrip('v'),
+        'url': data.get('html_url'),
+        'published': data.get('published_at'),
+        'assets': {asset['name']: asset['browser_download_url'] for asset in data.get('assets') or []
+                   if asset.get('name') and asset.get('browser_download_url')},
+    }
+
+
+def select_archive(release: Dict) -> Optional[str]:
+    """The release archive for this platform, else the platform-independent one"""
+    base = f"{ARCHIVE_PREFIX}{release['version']}"
+    for name in (f"{base}-{platform_tag()}.tar.gz", f"{base}.tar.gz"):
+        if name in release['assets']:
+            return name
+    return None
+
+
+def verify_checksum(name: str, data: bytes, checksums: bytes):
+    """Raise ValueError unless SHA256SUMS lists data's digest for name"""
+    digest = hashlib.sha256(data).hexdigest()
+    for line in checksums.decode('utf-8', 'replace').splitlines():
+        parts = line.split()
+        if len(parts) == 2 and parts[1].lstrip('*') == name:
+            if parts[0].lower() != digest:
+                raise ValueError(f"{name} does not match its checksum")
+            return
+    raise ValueError(f"{CHECKSUMS} has no checksum for {name}")
+
+
+def verify_signature(checksums: bytes, signature: bytes, public_key: str):
+    """Raise ValueError unless signature is public_key's Ed25519 signature of the checksums"""
+    try:
+        from cryptography.exceptions import InvalidSignature
+        from cryptography.hazmat.primitives.asymmetric.ed25519 import Ed25519PublicKey
+    except ImportError:
+        raise ValueError("verifying releases needs the cryptography package (pip install cryptography)")
+    try:
+        key = Ed25519PublicKey.from_public_bytes(base64.b64decode(public_key, validate=True))
+        key.verify(base64.b64decode(signature.strip(), validate=True), checksums)
+    except InvalidSignature:
+        raise ValueError(f"{CHECKSUMS} is not signed by update.public_key")
+    except ValueError as e:
+        raise ValueError(f"invalid public key or signature: {e}")
+
+
+def _unpack(data: bytes, target: Path):
+    """Extract a release archive's single top-level directory into target"""
+    with tarfile.open(fileobj=io.BytesIO(data), mode='r:gz') as archive:
+        members = archive.getmembers()
+        roots = {Path(member.name).parts[0] for member in members if Path(member.name).parts}
+        for member in members:
+            path = Path(member.name)
+            if path.is_absolute() or '..' in path.parts or not (member.isfile() or member.isdir()):
+                raise ValueError(f"unsafe path in release archive: {member.name}")
+        if len(roots) != 1:
+            raise ValueError("release archive must contain a single directory")
+        staging = target.with_name(target.name + '.unpack')
+        shutil.rmtree(staging, ignore_errors=True)
+        archive.extractall(staging)
+    root = staging / roots.pop()
+    if not (root / ENTRY_POINT).is_file():
+        shutil.rmtree(staging, ignore_errors=True)
+        raise ValueError(f"release archive has no {ENTRY_POINT}")
+    os.rename(root, target)
+    shutil.rmtree(staging, ignore_errors=True)
+
+
+def install(data: bytes, install_dir: Path) -> Path:
+    """Replace install_dir with the unpacked release, returning where the previous version is kept
+
+    Raises ValueError or OSError, leaving the installation unchanged.
+    """
+    install_dir = install_dir.resolve()
+    staged = install_dir.with_name(install_dir.name + '.new')
+    previous = install_dir.with_name(install_dir.name + '.previous')
+    shutil.rmtree(staged, ignore_errors=True)
+    _unpack(data, staged)
+    try:
+        os.chmod(staged / ENTRY_POINT, (install_dir / ENTRY_POINT).stat().st_mode)
+        # Local files that are not part of a release, such as a config or virtualenv in the directory
+        for entry in install_dir.iterdir():
+            if (staged / entry.name).exists():
+                continue
+            if entry.is_dir() and not entry.is_symlink():
+                shutil.copytree(entry, staged / entry.name, symlinks=True)
+            else:
+                shutil.copy2(entry, staged / entry.name, follow_symlinks=False)
+    except OSError:
+        shutil.rmtree(staged, ignore_errors=True)
+        raise
+
+    shutil.rmtree(previous, ignore_errors=True)
+    os.rename(install_dir, previous)
+    try:
+        os.rename(staged, install_dir)
+    except OSError:
+        os.rename(previous, install_dir)
+        raise
+    return previous
+
+
+class Updater:
+    """Checks for and downloads client releases"""
+
+    def __init__(self, endpoint: str = DEFAULT_RELEASE_ENDPOINT, timeout: float = 60, logger=None):
+        self.endpoint = endpoint
+        self.timeout = timeout
+        self.logger = logger or logging.getLogger(__name__)
+
+    async def latest(self) -> Dict:
+        """The latest release; raises ValueError or aiohttp.ClientError"""
+        # A separate session, so the dashboard token is never sent to the release host
+        async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=self.timeout)) as session:
+            async with session.get(self.endpoint, headers={'Accept': 'application/vnd.github+json'}) as response:
+                if response.status != 200:
+                    raise ValueError(f"the release endpoint returned HTTP {response.status}")
+                return parse_release(await response.json(content_type=None))
+
+    async def download(self, url: str) -> bytes:
+        async with aiohttp.ClientSession(timeout=aiohttp.ClientTimeout(total=self.timeout)) as session:
+            async with session.get(url) as response:
+                if response.status != 200:
+                    raise ValueError(f"download of {url} returned HTTP {response.status}")
+                chunks, size = [], 0
+                async for chunk in response.content.iter_chunked(64 * 1024):
+                    size += len(chunk)
+                    if size > MAX_DOWNLOAD:
+                        raise ValueError(f"{url} is larger than {MAX_DOWNLOAD // 2**20} MiB")
+                    chunks.append(chunk)
+                return b''.join(chunks)
+
+    async def fetch(self, release: Dict, name: str, signed: bool) -> Tuple[bytes, bytes, Optional[bytes]]:
+        """The archive, checksums and, if signed, signature of a release"""
+        for required in (CHECKSUMS,) + ((SIGNATURE,) if signed else ()):
+            if required not in release['assets']:
+                raise ValueError(f"release {release['version']} has no {required}")
+        downloads = [self.download(release['assets'][name]), self.download(release['assets'][CHECKSUMS])]
+        if signed:
+            downloads.append(self.download(release['assets'][SIGNATURE]))
+        results = await asyncio.gather(*downloads)
+        return results[0], results[1], results[2] if signed else None
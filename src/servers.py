@@ -0,0 +1,136 @@
+"""
+Remote node servers
+
+Lets one hub machine poll the nodes of many servers. Each server listed under
+hub.servers gets its own connection settings (scheme, credentials, timeout)
+for its nodes' dashboard APIs, its own concurrency limit and its own worker
+queue, so a slow or dead server only delays its own nodes. Once several nodes
+of a server in a row are unreachable, its remaining nodes are skipped for the
+rest of the cycle instead of each waiting for a timeout.
+"""
+
+import base64
+import logging
+from typing import Dict, List, Optional
+
+from .discovery import parse_ports
+
+# Nodes polled at once on a server by default
+DEFAULT_SERVER_CONCURRENCY = 2
+
+# Consecutive unreachable nodes after which a server is skipped for the cycle
+DEFAULT_FAILURE_THRESHOLD = 2
+
+
+class RemoteServer:
+    """A server hosting nodes, as configured under hub.servers"""
+
+    def __init__(self, name: str, addresses: List[str], concurrency: int = DEFAULT_SERVER_CONCURRENCY,
+                 scheme: str = 'http', username: Optional[str] = None, password: Optional[str] = None,
+                 token: Optional[str] = None, timeout: Optional[float] = None, verify_tls: bool = True,
+                 failure_threshold: int = DEFAULT_FAILURE_THRESHOLD, ports: Optional[List[int]] = None):
+        self.name = name
+        self.addresses = addresses
+        self.concurrency = concurrency
+        self.scheme = scheme
+        self.username = username
+        self.password = password
+        self.token = token
+        self.timeout = timeout
+        self.verify_tls = verify_tls
+        self.failure_threshold = failure_threshold
+        # Dashboard ports scanned by discover on this server's addresses
+        self.ports = ports
+        # Consecutive unreachable nodes this cycle
+        self.failures = 0
+        self.skipped = 0
+        self.stats = {'reachable': 0, 'unreachable': 0, 'skipped': 0}
+
+    @property
+    def isolated(self) -> bool:
+        """Whether the server's remaining nodes are skipped this cycle"""
+        return bool(self.failure_threshold) and self.failures >= self.failure_threshold
+
+    def begin_cycle(self):
+        self.failures = 0
+        self.skipped = 0
+
+    def record(self, reachable: bool):
+        key = 'reachable' if reachable else 'unreachable'
+        self.stats[key] += 1
+        self.failures = 0 if reachable else self.failures + 1
+
+    def skip(self):
+        self.skipped += 1
+        self.stats['skipped'] += 1
+
+    def endpoint(self) -> Dict:
+        """Connection settings for the node API client"""
+        headers = {}
+        if self.token:
+            headers['Authorization'] = f'Bearer {self.token}'
+        elif self.username:
+            credentials = f"{self.username}:{self.password or ''}".encode()
+            headers['Authorization'] = 'Basic ' + base64.b64encode(credentials).decode()
+        return {'scheme': self.scheme, 'headers': headers, 'timeout': self.timeout, 'verify_tls': self.verify_tls}
+
+
+class ServerPool:
+    """The configured servers, matched to nodes by their registered address"""
+
+    def __init__(self, servers: List[RemoteServer], logger=None):
+        self.servers = servers
+        self.logger = logger or logging.getLogger(__name__)
+        self.by_address = {address: server for server in servers for address in server.addresses}
+
+    def __bool__(self) -> bool:
+        return bool(self.servers)
+
+    def match(self, node: Dict) -> Optional[RemoteServer]:
+        return self.by_address.get(node.get('address'))
+
+    def scan_ports(self) -> Dict[str, List[int]]:
+        """Discovery ports by address, for servers that configure them"""
+        return {address: server.ports for address, server in self.by_address.items() if server.ports}
+
+    def endpoints(self) -> Dict[str, Dict]:
+        """Node API connection settings by address"""
+        return {address: server.endpoint() for address, server in self.by_address.items()}
+
+    def begin_cycle(self):
+        for server in self.servers:
+            server.begin_cycle()
+
+    def end_cycle(self):
+        for server in self.servers:
+            if server.skipped:
+                self.logger.warning("Server %s was unreachable; skipped %d of its nodes this cycle",
+                                    server.name, server.skipped)
+
+    def snapshot(self) -> Dict:
+        return {server.name: {**server.stats, 'isolated': server.isolated} for server in self.servers}
+
+
+def load_servers(entries: List[Dict], failure_threshold: int = DEFAULT_FAILURE_THRESHOLD,
+                 logger=None) -> ServerPool:
+    """Servers from hub.servers; raises ValueError for an address listed twice or bad ports"""
+    servers, seen = [], set()
+    for i, entry in enumerate(entries):
+        addresses = list(entry.get('addresses') or []) + ([entry['address']] if entry.get('address') else [])
+        if not addresses:
+            raise ValueError(f"hub.servers[{i}]: needs an address or addresses")
+        for address in addresses:
+            if address in seen:
+                raise ValueError(f"hub.servers[{i}]: address {address} belongs to another server")
+            seen.add(address)
+        try:
+            ports = parse_ports(entry['ports']) if entry.get('ports') else None
+        except ValueError as e:
+            raise ValueError(f"hub.servers[{i}].ports: {e}")
+        servers.append(RemoteServer(
+            entry.get('name') or addresses[0], addresses,
+            entry.get('concurrency') or DEFAULT_SERVER_CONCURRENCY, entry.get('scheme') or 'http',
+            entry.get('username'), entry.get('password'), entry.get('token'), entry.get('timeout'),
+            entry.get('verify_tls', True), failure_threshold, ports,
+        ))
+    return ServerPool(servers, logger)
@@ -0,0 +1,556 @@
+"""
+Output sinks
+
+Destinations of the payloads sync collects. The storj.cloud dashboard is one
+of them; InfluxDB, Prometheus, files and stdout can replace or accompany it,
+selected under sync.sinks, without the sync scheduler knowing any of them.
+"""
+
+import asyncio
+import gzip
+import json
+import logging
+import os
+import re
+import shutil
+import sys
+import time
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Callable, Dict, List, Optional
+
+import aiohttp
+from aiohttp import web
+
+from .config import parse_duration
+from .dashboard import dashboard_session, read_only
+from .debugserver import parse_listen
+from .errors import AuthError, ClientError, NetworkError, RateLimitedError, VersionSkewError, http_error
+from .outbox import IDEMPOTENCY_HEADER, Outbox
+from .quota import RateLimit
+from .signing import PayloadSigner, encode_body
+from .tracing import span
+
+# Uploads sent to the dashboard at once, over as many pooled connections
+DEFAULT_MAX_INFLIGHT_UPLOADS = 16
+
+# Responses meaning an upload will never be accepted, so retrying is pointless
+REJECTED_UPLOAD_STATUSES = {400, 404, 410, 413, 422}
+
+# Line protocol points kept while InfluxDB is unreachable
+MAX_INFLUX_BUFFER = 10000
+
+# File sink rotation defaults: size of the current file, rotated files kept
+DEFAULT_MAX_FILE_BYTES = 100 * 1024 * 1024
+DEFAULT_KEEP_FILES = 10
+
+# Payload fields exported as metrics: (Prometheus name, description)
+NODE_METRICS = {
+    'usedSpace': ('storj_node_used_space_bytes', 'Disk space used by the node'),
+    'availableSpace': ('storj_node_available_space_bytes', 'Disk space still available to the node'),
+    'bandwidthUsed': ('storj_node_bandwidth_used_bytes', 'Bandwidth used this month'),
+    'auditScore': ('storj_node_audit_score', 'Lowest audit score across satellites'),
+    'suspensionScore': ('storj_node_suspension_score', 'Lowest suspension score across satellites'),
+    'critical': ('storj_node_critical', 'Whether the node is disqualified or suspended on a satellite'),
+    'exiting': ('storj_node_exiting', 'Whether a graceful exit is in progress'),
+}
+
+
+def payload_record(node: Dict, payload: Dict) -> Dict:
+    """A payload as written by local sinks"""
+    return {
+        'time': datetime.now(timezone.utc).isoformat(),
+        'node': node.get('nodeId'),
+        'name': node.get('name'),
+        'payload': payload,
+    }
+
+
+class Sink:
+    """A destination for node payloads
+
+    Sinks never raise from write; a False result counts the node as failed
+    for the cycle. Sinks other than the dashboard are shared by the sync
+    services of all accounts, so opening and closing them twice is harmless.
+    """
+
+    kind = 'sink'
+
+    def __init__(self, logger=None):
+        self.logger = logger or logging.getLogger(__name__)
+        # Failure counter for telemetry, provided by the sync service
+        self.count_error: Callable[[str], None] = lambda category: None
+
+    async def open(self):
+        pass
+
+    async def begin_cycle(self):
+        """Called before the first write of a sync cycle"""
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        raise NotImplementedError
+
+    async def write_summary(self, summary: Dict):
+        """Called with the fleet rollup of a sync cycle, before end_cycle"""
+
+    async def end_cycle(self):
+        """Called after the last write of a sync cycle"""
+
+    async def close(self):
+        pass
+
+    def stats(self) -> Optional[Dict]:
+        """Sink state for state dumps"""
+        return None
+
+    def error(self, node_id: str) -> Optional[ClientError]:
+        """Why the last write of a node failed, if the sink can tell (see errors.py)"""
+        return None
+
+
+class DashboardSink(Sink):
+    """Uploads to the storj.cloud dashboard through the outbox"""
+
+    kind = 'dashboard'
+
+    def __init__(self, api_token: str, dashboard_url: str, outbox: Optional[Outbox] = None,
+                 signer: Optional[PayloadSigner] = None, rate_limit: Optional[RateLimit] = None,
+                 max_inflight: int = DEFAULT_MAX_INFLIGHT_UPLOADS, logger=None):
+        super().__init__(logger)
+        self.api_token = api_token
+        self.dashboard_url = dashboard_url.rstrip('/')
+        # An empty outbox is falsy, so test for None
+        self.outbox = outbox if outbox is not None else Outbox(logger=self.logger)
+        self.signer = signer
+        self.rate_limit = rate_limit or RateLimit(self.logger)
+        self.max_inflight = max_inflight
+        self.inflight = asyncio.Semaphore(max_inflight)
+        self.session = None
+        # Set by the sync service while the outbox is over its backpressure threshold
+        self.coalescing = False
+        # Dashboard node ID -> the error of its last failed upload
+        self.failures: Dict[str, ClientError] = {}
+
+    async def open(self):
+        self.session = dashboard_session(self.max_inflight,
+                                         headers={'Authorization': f'Bearer {self.api_token}'})
+
+    async def begin_cycle(self):
+        await self.flush()
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        if read_only():
+            # Counted as accepted, so nothing is retried or buffered
+            self.logger.debug("Read-only mode, not uploading node %s", node['id'][:8])
+            return True
+        # Queued first, so the upload survives until the dashboard acknowledges it
+        self.outbox.add(node['id'], payload, replace=self.coalescing)
+        return await self._deliver_pending(node['id'])
+
+    async def close(self):
+        if self.session:
+            await self.session.close()
+            self.session = None
+        self.outbox.close()
+
+    def stats(self) -> Dict:
+        return self.outbox.stats()
+
+    def error(self, node_id: str) -> Optional[ClientError]:
+        return self.failures.pop(node_id, None)
+
+    async def write_summary(self, summary: Dict):
+        """Upload the fleet rollup; not buffered, as the next cycle's replaces it"""
+        if read_only() or self.rate_limit.blocked:
+            return
+        url = f"{self.dashboard_url}/storj/fleet"
+        body = encode_body(summary)
+        headers = {'Content-Type': 'application/json'}
+        if self.signer:
+            headers.update(self.signer.sign('PUT', url, body))
+        try:
+            async with self.session.put(url, data=body, headers=headers) as response:
+                self.rate_limit.update(response.status, response.headers)
+                if response.status not in [200, 204]:
+                    self.logger.warning("Failed to upload the fleet rollup: HTTP %d", response.status)
+                    self.count_error(http_error(response.status, "Fleet rollup upload failed").kind)
+        except VersionSkewError as e:
+            # Refused under --strict-compat, not a connection problem
+            self.logger.error("Not uploading the fleet rollup: %s", e)
+            self.count_error(e.kind)
+        except Exception as e:
+            self.logger.warning("Failed to upload the fleet rollup: %s", e)
+            self.count_error('dashboard_unreachable')
+
+    async def flush(self):
+        """Deliver uploads buffered in earlier cycles, stopping while the dashboard fails
+
+        Nodes are delivered in parallel, up to max_inflight uploads at once,
+        each node's uploads still in the order they were queued.
+        """
+        if not len(self.outbox) or read_only():
+            return
+        self.logger.info("Delivering %d buffered uploads", len(self.outbox))
+        failing = asyncio.Event()
+        node_ids = iter(self.outbox.node_ids())
+
+        async def deliver():
+            # Takes the next node only while no delivery has failed
+            for node_id in node_ids:
+                if not await self._deliver_pending(node_id) and self.outbox.pending(node_id):
+                    failing.set()
+                if failing.is_set():
+                    return
+
+        await asyncio.gather(*(deliver() for _ in range(self.max_inflight)))
+        if failing.is_set():
+            self.logger.warning("Dashboard still failing, %d uploads stay buffered", len(self.outbox))
+
+    async def _deliver_pending(self, node_id: str) -> bool:
+        """Deliver a node's queued uploads in order; True if all were acknowledged"""
+        for entry in self.outbox.pending(node_id):
+            if not await self._deliver(entry):
+                return False
+        return True
+
+    async def _deliver(self, entry: Dict) -> bool:
+        """Send one queued upload once fewer than max_inflight are in flight"""
+        async with self.inflight:
+            return await self._send(entry)
+
+    async def _send(self, entry: Dict) -> bool:
+        """Send one queued upload, dequeuing it once acknowledged
+
+        Uploads the dashboard rejects as invalid are discarded; anything else
+        stays queued and is sent again with the same idempotency key.
+        """
+        node_id = entry['node_id']
+        url = f"{self.dashboard_url}/storj/nodes/{node_id}"
+        body = encode_body(entry['payload'])
+        headers = {IDEMPOTENCY_HEADER: entry['key'], 'Content-Type': 'application/json'}
+        if self.signer:
+            # Signed per attempt, so retries carry a fresh timestamp
+            headers.update(self.signer.sign('PATCH', url, body))
+        try:
+            if self.rate_limit.blocked:
+                # Stays queued; sending now would only extend the block
+                self.failures[node_id] = RateLimitedError(
+                    "Dashboard rate limit reached", retry_after=self.rate_limit.blocked_until - time.time())
+                return False
+            with span('dashboard.upload', node_id=node_id, attempts=entry['attempts']) as current:
+                async with self.session.patch(url, data=body, headers=headers) as response:
+                    self.rate_limit.update(response.status, response.headers)
+                    if current:
+                        current.set_attribute('http.status_code', response.status)
+                    if response.status in [200, 204]:
+                        self.outbox.ack(entry['key'])
+                        self.failures.pop(node_id, None)
+                        return True
+                    error = http_error(response.status, f"Failed to update node {node_id}", response.headers)
+                    self.failures[node_id] = error
+                    self.count_error(error.kind)
+                    if response.status in REJECTED_UPLOAD_STATUSES:
+                        self.logger.error("Dashboard rejected update of node %s: HTTP %d, discarding it",
+                                          node_id, response.status)
+                        self.outbox.ack(entry['key'])
+                        return False
+
+                    self.logger.error("Failed to update node %s: HTTP %d", node_id, response.status)
+                    if isinstance(error, AuthError):
+                        self.logger.error("%s", error)
+                    self.outbox.failed(entry['key'], f"HTTP {response.status}")
+                    return False
+        except VersionSkewError as e:
+            # Refused under --strict-compat: kept for the upgraded client, without counting an attempt
+            self.logger.error("Not uploading node %s: %s", node_id, e)
+            self.failures[node_id] = e
+            self.count_error(e.kind)
+            return False
+        except Exception as e:
+            self.logger.error("Failed to update node %s: %s", node_id, e)
+            self.failures[node_id] = NetworkError(f"Failed to update node {node_id}: {e}")
+            self.count_error('dashboard_unreachable')
+            self.outbox.failed(entry['key'], str(e))
+            return False
+
+
+class StdoutSink(Sink):
+    """Prints payloads as JSON, one record per line unless indented"""
+
+    kind = 'stdout'
+
+    def __init__(self, indent: Optional[int] = None, stream=None, logger=None):
+        super().__init__(logger)
+        self.indent = indent
+        self.stream = stream or sys.stdout
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        self.stream.write(json.dumps(payload_record(node, payload), indent=self.indent, default=str) + '\n')
+        self.stream.flush()
+        return True
+
+
+class FileSink(Sink):
+    """Appends payloads to a file as newline-delimited JSON, rotated by size or age
+
+    Rotated files are renamed with the time of rotation, payloads-20240131T120000Z.ndjson
+    for payloads.ndjson, optionally gzipped, and only the newest `keep` are kept
+    (0 keeps all). Files are never rotated in the middle of a record, so a
+    process shipping them can pick up every rotated file as complete.
+    """
+
+    kind = 'file'
+
+    def __init__(self, path: Path, max_bytes: Optional[int] = DEFAULT_MAX_FILE_BYTES,
+                 rotate_every: Optional[float] = None, keep: int = DEFAULT_KEEP_FILES,
+                 compress: bool = True, logger=None):
+        super().__init__(logger)
+        self.path = Path(path).expanduser()
+        self.max_bytes = max_bytes
+        self.rotate_every = rotate_every
+        self.keep = keep
+        self.compress = compress
+        self.file = None
+        # Time of the first record in the current file
+        self.started_at: Optional[float] = None
+
+    async def open(self):
+        if not self.file:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            self.file = open(self.path, 'a')
+            self.started_at = self._first_record_time()
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        if not self.file:
+            return False
+        try:
+            if self.rotate_every and self.started_at and time.time() - self.started_at >= self.rotate_every:
+                await self.rotate()
+            self.file.write(json.dumps(payload_record(node, payload), default=str) + '\n')
+            self.file.flush()
+            self.started_at = self.started_at or time.time()
+            if self.max_bytes and self.file.tell() >= self.max_bytes:
+                await self.rotate()
+            return True
+        except OSError as e:
+            self.logger.error("Failed to write payload to %s: %s", self.path, e)
+            self.count_error('sink')
+            return False
+
+    async def rotate(self):
+        """Move the current file aside and start a new one"""
+        self.file.close()
+        self.file = None
+        stamp = datetime.now(timezone.utc).strftime('%Y%m%dT%H%M%SZ')
+        rotated = self.path.with_name(f"{self.path.stem}-{stamp}{self.path.suffix}")
+        for i in range(1, 100):
+            if not rotated.exists() and not Path(f"{rotated}.gz").exists():
+                break
+            rotated = self.path.with_name(f"{self.path.stem}-{stamp}-{i}{self.path.suffix}")
+        try:
+            os.replace(self.path, rotated)
+        except OSError as e:
+            self.logger.warning("Failed to rotate %s: %s", self.path, e)
+            return
+        finally:
+            await self.open()
+        self.logger.info("Rotated %s to %s", self.path, rotated.name)
+        if self.compress:
+            try:
+                await asyncio.to_thread(_gzip_file, rotated)
+            except OSError as e:
+                self.logger.warning("Failed to compress %s: %s", rotated, e)
+        self._prune()
+
+    def rotated_files(self) -> List[Path]:
+        """Rotated files, oldest first"""
+        pattern = f"{self.path.stem}-*{self.path.suffix}"
+        files = list(self.path.parent.glob(pattern)) + list(self.path.parent.glob(pattern + '.gz'))
+        return sorted(files, key=lambda path: (path.stat().st_mtime, path.name))
+
+    def _prune(self):
+        if not self.keep:
+            return
+        for path in self.rotated_files()[:-self.keep]:
+            try:
+                path.unlink()
+            except OSError as e:
+                self.logger.warning("Failed to remove rotated file %s: %s", path, e)
+
+    def _first_record_time(self) -> Optional[float]:
+        try:
+            with open(self.path) as f:
+                return datetime.fromisoformat(json.loads(f.readline())['time']).timestamp()
+        except (OSError, ValueError, KeyError, TypeError):
+            return None
+
+    async def close(self):
+        if self.file:
+            self.file.close()
+            self.file = None
+
+
+def _gzip_file(path: Path):
+    with open(path, 'rb') as source, gzip.open(f"{path}.gz", 'wb') as target:
+        shutil.copyfileobj(source, target)
+    path.unlink()
+
+
+def _escape_tag(value: str) -> str:
+    return re.sub(r'([,= ])', r'\\\1', value)
+
+
+def line_protocol(measurement: str, node: Dict, payload: Dict, timestamp: int) -> Optional[str]:
+    """InfluxDB line protocol point of a payload's numeric fields"""
+    fields = []
+    for key, value in payload.items():
+        if isinstance(value, bool):
+            fields.append(f"{key}={'true' if value else 'false'}")
+        elif isinstance(value, int):
+            fields.append(f"{key}={value}i")
+        elif isinstance(value, float):
+            fields.append(f"{key}={value!r}")
+    if not fields:
+        return None
+    tags = f",node_id={_escape_tag(node.get('nodeId') or 'unknown')}"
+    for tag in ('name', 'status', 'version'):
+        value = node.get(tag) if tag == 'name' else payload.get(tag)
+        if value:
+            tags += f",{tag}={_escape_tag(str(value))}"
+    return f"{measurement}{tags} {','.join(fields)} {timestamp}"
+
+
+class InfluxSink(Sink):
+    """Writes payloads to InfluxDB, one batch per cycle
+
+    With a bucket the InfluxDB 2 API is used, with a database the 1.x API.
+    Points that fail to write are kept for the next cycle.
+    """
+
+    kind = 'influxdb'
+
+    def __init__(self, url: str, bucket: Optional[str] = None, org: Optional[str] = None,
+                 database: Optional[str] = None, token: Optional[str] = None,
+                 measurement: str = 'storj_node', timeout: float = 10, logger=None):
+        super().__init__(logger)
+        self.url = url.rstrip('/')
+        self.bucket, self.org, self.database = bucket, org, database
+        self.token = token
+        self.measurement = measurement
+        self.timeout = timeout
+        self.lines: List[str] = []
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        line = line_protocol(self.measurement, node, payload, int(time.time()))
+        if line:
+            self.lines.append(line)
+            del self.lines[:-MAX_INFLUX_BUFFER]
+        return True
+
+    async def end_cycle(self):
+        if not self.lines:
+            return
+        if self.bucket:
+            url, params = f"{self.url}/api/v2/write", {'bucket': self.bucket, 'precision': 's'}
+            if self.org:
+                params['org'] = self.org
+        else:
+            url, params = f"{self.url}/write", {'db': self.database, 'precision': 's'}
+        headers = {'Authorization': f'Token {self.token}'} if self.token else {}
+        try:
+            timeout = aiohttp.ClientTimeout(total=self.timeout)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.post(url, params=params, data='\n'.join(self.lines).encode(),
+                                        headers=headers) as response:
+                    if response.status >= 300:
+                        raise ValueError(f"HTTP {response.status}: {(await response.text())[:200]}")
+            self.lines = []
+        except Exception as e:
+            self.logger.error("Failed to write %d points to InfluxDB: %s", len(self.lines), e)
+            self.count_error('sink')
+
+    async def close(self):
+        await self.end_cycle()
+
+    def stats(self) -> Dict:
+        return {'buffered': len(self.lines)}
+
+
+class PrometheusSink(Sink):
+    """Serves the latest payload of every node as Prometheus metrics"""
+
+    kind = 'prometheus'
+
+    def __init__(self, listen: str = '127.0.0.1:9651', logger=None):
+        super().__init__(logger)
+        self.host, self.port = parse_listen(listen)
+        self.latest: Dict[str, Dict] = {}
+        self.runner = None
+
+    async def open(self):
+        if self.runner:
+            return
+        app = web.Application()
+        app.router.add_get('/metrics', self.metrics)
+        self.runner = web.AppRunner(app)
+        await self.runner.setup()
+        await web.TCPSite(self.runner, self.host, self.port).start()
+        self.logger.info("Serving node metrics on http://%s:%d/metrics", self.host, self.port)
+
+    async def write(self, node: Dict, payload: Dict) -> bool:
+        self.latest[node.get('nodeId') or 'unknown'] = {
+            'name': node.get('name') or '', 'payload': payload, 'time': time.time(),
+        }
+        return True
+
+    async def close(self):
+        if self.runner:
+            await self.runner.cleanup()
+            self.runner = None
+
+    def render(self) -> str:
+        """Metrics in the Prometheus text exposition format"""
+        def labels(node_id: str, entry: Dict) -> str:
+            name = entry['name'].replace('\\', '\\\\').replace('"', '\\"')
+            return f'node_id="{node_id}",name="{name}"'
+
+        lines = []
+        for key, (metric, description) in NODE_METRICS.items():
+            lines += [f"# HELP {metric} {description}", f"# TYPE {metric} gauge"]
+            for node_id, entry in self.latest.items():
+                value = entry['payload'].get(key)
+                if isinstance(value, (int, float)):
+                    lines.append(f"{metric}{{{labels(node_id, entry)}}} {float(value)}")
+        metric = 'storj_node_last_sync_timestamp_seconds'
+        lines += [f"# HELP {metric} When the node was last synced", f"# TYPE {metric} gauge"]
+        lines += [f"{metric}{{{labels(node_id, entry)}}} {entry['time']:.0f}" for node_id, entry in self.latest.items()]
+        return '\n'.join(lines) + '\n'
+
+    async def metrics(self, request):
+        return web.Response(text=self.render(), content_type='text/plain')
+
+
+def create_sink(settings: Dict, logger=None, **dashboard) -> Sink:
+    """A sink from its sync.sinks entry; dashboard sinks take the account's token and outbox"""
+    kind = settings.get('type')
+    if kind == 'dashboard':
+        return DashboardSink(logger=logger, **dashboard)
+    if kind == 'stdout':
+        return StdoutSink(logger=logger)
+    if kind == 'file':
+        try:
+            rotate_every = parse_duration(settings['rotate_every']) if settings.get('rotate_every') else None
+        except (ValueError, AttributeError):
+            raise ValueError("rotate_every as a duration such as 1h or 1d")
+        max_size_mb = settings.get('max_size_mb', DEFAULT_MAX_FILE_BYTES / 1024 / 1024)
+        return FileSink(settings['path'], int(max_size_mb * 1024 * 1024) or None, rotate_every,
+                        settings.get('keep', DEFAULT_KEEP_FILES), settings.get('compress', True), logger=logger)
+    if kind == 'influxdb':
+        if not settings.get('bucket') and not settings.get('database'):
+            raise ValueError("a bucket or database")
+        return InfluxSink(settings['url'], settings.get('bucket'), settings.get('org'), settings.get('database'),
+                          settings.get('token'), settings.get('measurement') or 'storj_node',
+                          settings.get('timeout') or 10, logger=logger)
+    if kind == 'prometheus':
+        return PrometheusSink(settings.get('listen') or '127.0.0.1:9651', logger=logger)
+    raise ValueError(f"unknown sink type {kind!r}")
@@ -0,0 +1,104 @@
+"""
+Persistent daemon state
+
+Keeps the sync daemon's scheduler state (last successful sync per node,
+pending retries and alert deduplication keys) on disk so a restart neither
+re-uploads recently synced nodes nor forgets which nodes were mid-retry.
+"""
+
+import json
+import logging
+import os
+import time
+from pathlib import Path
+from typing import Dict, Optional
+
+# First retry delay after a failed node sync, doubled per attempt
+RETRY_BASE_DELAY = 30
+
+# Registered node fields kept so a retry does not need the dashboard's node list;
+# local annotations are applied again when the retry runs
+RETRY_NODE_FIELDS = ('id', 'nodeId', 'name', 'address', 'dashboardPort', 'externalAddress', 'config')
+
+
+class DaemonState:
+    """Scheduler state of the sync daemon, saved as JSON"""
+
+    def __init__(self, path: Optional[Path] = None, logger=None):
+        self.path = Path(path) if path else None
+        self.logger = logger or logging.getLogger(__name__)
+        self.last_success: Dict[str, float] = {}
+        self.pending_retries: Dict[str, Dict] = {}
+        self.alert_keys = set()
+
+    def load(self) -> 'DaemonState':
+        if not self.path:
+            return self
+        try:
+            data = json.loads(self.path.read_text())
+        except FileNotFoundError:
+            return self
+        except (OSError, ValueError) as e:
+            self.logger.warning("Ignoring unreadable daemon state %s: %s", self.path, e)
+            return self
+
+        self.last_success = data.get('last_success', {})
+        self.pending_retries = data.get('pending_retries', {})
+        self.alert_keys = set(data.get('alert_keys', []))
+        if self.pending_retries:
+            self.logger.info("Resuming %d pending node retries", len(self.pending_retries))
+        return self
+
+    def save(self):
+        """Write the state atomically so a crash never leaves a partial file"""
+        if not self.path:
+            return
+        data = {
+            'saved_at': time.time(),
+            'last_success': self.last_success,
+            'pending_retries': self.pending_retries,
+            'alert_keys': sorted(self.alert_keys),
+        }
+        tmp = self.path.with_suffix('.tmp')
+        try:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            tmp.write_text(json.dumps(data))
+            os.replace(tmp, self.path)
+        except OSError as e:
+            self.logger.error("Failed to save daemon state: %s", e)
+
+    def synced(self, node_id: str, ts: Optional[float] = None):
+        self.last_success[node_id] = ts or time.time()
+        self.pending_retries.pop(node_id, None)
+
+    def failed(self, node: Dict, max_delay: float, ts: Optional[float] = None, min_delay: float = 0):
+        """Schedule a retry with exponential backoff, no sooner than min_delay (e.g. a Retry-After)"""
+        ts = ts or time.time()
+        node_id = node.get('nodeId', 'unknown')
+        attempts = self.pending_retries.get(node_id, {}).get('attempts', 0) + 1
+        delay = min(max(RETRY_BASE_DELAY * 2 ** (attempts - 1), min_delay), max_delay)
+        saved = {key: node.get(key) for key in RETRY_NODE_FIELDS}
+        if node.get('dashboardName'):
+            # The dashboard's name, not a local nickname applied over it
+            saved['name'] = node['dashboardName']
+        self.pending_retries[node_id] = {
+            'node': saved,
+            'attempts': attempts,
+            'next_at': ts + delay,
+        }
+
+    def recently_synced(self, node_id: str, within: float) -> bool:
+        return time.time() - self.last_success.get(node_id, 0) < within
+
+    def due_retries(self, ts: Optional[float] = None):
+        ts = ts or time.time()
+        return [entry for entry in self.pending_retries.values() if entry['next_at'] <= ts]
+
+    def next_retry_at(self) -> Optional[float]:
+        return min((entry['next_at'] for entry in self.pending_retries.values()), default=None)
+
+    def forget(self, registered):
+        """Drop state of nodes no longer registered"""
+        for table in (self.last_success, self.pending_retries):
+            for node_id in set(table) - set(registered):
+                del table[node_id]
@@ -0,0 +1,82 @@
+"""
+Storage directory probe
+
+Writes, fsyncs, reads back and removes a small file in the storage directory
+of each node on this host, timing each step. A storage directory that cannot
+be written stops the node from accepting uploads, and a sudden rise in
+latency, such as a failing disk or a saturated array, makes it lose upload
+races before anything else shows it. Latency is compared with the node's own
+recent probes, since what is normal differs between an SSD and a busy NAS.
+"""
+
+import os
+import statistics
+import time
+from collections import deque
+from pathlib import Path
+from typing import Deque, Dict, Optional
+
+# Bytes written by a probe, about the size of a small piece
+PROBE_SIZE = 4096
+
+# Recent probe latencies kept per node as its baseline
+BASELINE_SIZE = 20
+
+# Probes needed before latency is compared with the baseline
+MIN_BASELINE = 5
+
+# Latency below which no probe counts as a spike, whatever the baseline
+MIN_SPIKE_LATENCY = 0.05
+
+
+def probe_storage(directory: Path) -> Dict:
+    """Time a write, fsync and read of a small file in a directory (blocking)
+
+    Returns whether the directory is writable, the seconds each step and
+    the whole probe took, and the error if it failed.
+    """
+    path = Path(directory) / f'.storjcloud-probe-{os.getpid()}'
+    data = os.urandom(PROBE_SIZE)
+    result = {'writable': False, 'write': None, 'fsync': None, 'read': None, 'total': None, 'error': None}
+    started = time.perf_counter()
+    try:
+        fd = os.open(path, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600)
+        try:
+            os.write(fd, data)
+            written = time.perf_counter()
+            os.fsync(fd)
+            synced = time.perf_counter()
+        finally:
+            os.close(fd)
+        with open(path, 'rb') as f:
+            if f.read() != data:
+                raise OSError("read back different data than written")
+        done = time.perf_counter()
+        result.update(writable=True, write=written - started, fsync=synced - written, read=done - synced,
+                      total=done - started)
+    except OSError as e:
+        result['error'] = str(e)
+    finally:
+        try:
+            path.unlink()
+        except OSError:
+            pass
+    return result
+
+
+class LatencyBaseline:
+    """Recent probe latencies per node, to tell spikes from the node's normal latency"""
+
+    def __init__(self, factor: float = 5):
+        self.factor = factor
+        self.latencies: Dict[str, Deque[float]] = {}
+
+    def record(self, node_id: str, latency: float) -> Optional[float]:
+        """Add a probe; returns the baseline if the latency is a spike above it"""
+        history = self.latencies.setdefault(node_id, deque(maxlen=BASELINE_SIZE))
+        baseline = statistics.median(history) if len(history) >= MIN_BASELINE else None
+        history.append(latency)
+        if (baseline is None or not self.factor or latency < MIN_SPIKE_LATENCY
+                or latency < baseline * self.factor):
+            return None
+        return baseline
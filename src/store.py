@@ -0,0 +1,267 @@
+"""
+Local history store
+
+Keeps a time series of per-node samples collected by the sync daemon in a
+local SQLite database so trends and reports can be computed offline, along
+with where and when each node was last found by discovery and a timeline of
+significant node events and per-satellite reputation scores.
+"""
+
+import json
+import logging
+import sqlite3
+import time
+from pathlib import Path
+from datetime import datetime, timezone
+from typing import Dict, Iterable, List, Optional, Tuple
+
+SCHEMA = """
+CREATE TABLE IF NOT EXISTS samples (
+    ts REAL NOT NULL,
+    node_id TEXT NOT NULL,
+    name TEXT,
+    status TEXT,
+    version TEXT,
+    disk_used INTEGER,
+    disk_available INTEGER,
+    bandwidth_used INTEGER,
+    audit_score REAL,
+    suspension_score REAL,
+    online_score REAL,
+    payout_cents REAL,
+    data TEXT
+);
+CREATE INDEX IF NOT EXISTS samples_node_ts ON samples (node_id, ts);
+CREATE TABLE IF NOT EXISTS sightings (
+    node_id TEXT PRIMARY KEY,
+    name TEXT,
+    address TEXT,
+    dashboard_port INTEGER,
+    first_seen REAL NOT NULL,
+    last_seen REAL NOT NULL,
+    missing_since REAL
+);
+CREATE TABLE IF NOT EXISTS traffic_daily (
+    node_id TEXT NOT NULL,
+    day TEXT NOT NULL,
+    ingress INTEGER,
+    egress INTEGER,
+    PRIMARY KEY (node_id, day)
+);
+CREATE TABLE IF NOT EXISTS events (
+    ts REAL NOT NULL,
+    node_id TEXT NOT NULL,
+    name TEXT,
+    kind TEXT NOT NULL,
+    message TEXT,
+    data TEXT
+);
+CREATE INDEX IF NOT EXISTS events_node_ts ON events (node_id, ts);
+CREATE TABLE IF NOT EXISTS satellite_scores (
+    ts REAL NOT NULL,
+    node_id TEXT NOT NULL,
+    satellite_id TEXT NOT NULL,
+    satellite TEXT,
+    audit_score REAL,
+    suspension_score REAL,
+    online_score REAL
+);
+CREATE INDEX IF NOT EXISTS satellite_scores_node_ts ON satellite_scores (node_id, ts);
+"""
+
+
+class HistoryStore:
+    """SQLite-backed per-node sample history"""
+
+    def __init__(self, path: Path, retention_days: int = 400, logger=None):
+        self.path = Path(path)
+        self.retention_days = retention_days
+        self.logger = logger or logging.getLogger(__name__)
+
+        self.path.parent.mkdir(parents=True, exist_ok=True)
+        self.db = sqlite3.connect(str(self.path))
+        self.db.row_factory = sqlite3.Row
+        self.db.executescript(SCHEMA)
+
+    def close(self):
+        self.db.close()
+
+    def record_sample(self, node_id: str, name: Optional[str], status: str,
+                      node_data: Dict, extra: Optional[Dict] = None, ts: Optional[float] = None):
+        """Store one observation of a node"""
+        disk = node_data.get('diskSpace', {})
+        reputation = node_data.get('reputation', {})
+        extra = extra or {}
+
+        self.db.execute(
+            "INSERT INTO samples VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+            (
+                ts or time.time(), node_id, name, status, node_data.get('version'),
+                disk.get('used', 0), disk.get('available', 0),
+                node_data.get('bandwidth', {}).get('used', 0),
+                reputation.get('auditScore'), reputation.get('suspensionScore'),
+                reputation.get('onlineScore'), extra.get('payout_cents'),
+                json.dumps(extra, default=str),
+            )
+        )
+        self.db.commit()
+
+    def samples(self, start: float, end: float, node_id: Optional[str] = None) -> List[Dict]:
+        """Samples within [start, end), oldest first"""
+        query = "SELECT * FROM samples WHERE ts >= ? AND ts < ?"
+        params = [start, end]
+        if node_id:
+            query += " AND node_id = ?"
+            params.append(node_id)
+        query += " ORDER BY ts"
+
+        rows = []
+        for row in self.db.execute(query, params):
+            sample = dict(row)
+            sample['data'] = json.loads(sample['data'] or '{}')
+            rows.append(sample)
+        return rows
+
+    def latest_samples(self, at: float, window: float) -> Dict[str, Dict]:
+        """The last sample of each node taken within window seconds before at, by node ID"""
+        rows = self.db.execute(
+            """SELECT samples.* FROM samples JOIN (
+                   SELECT node_id, MAX(ts) AS ts FROM samples WHERE ts <= ? AND ts > ? GROUP BY node_id
+               ) latest USING (node_id, ts)""",
+            (at, at - window)
+        )
+        return {row['node_id']: dict(row) for row in rows}
+
+    def last_sample(self, node_id: str) -> Optional[Dict]:
+        row = self.db.execute("SELECT * FROM samples WHERE node_id = ? ORDER BY ts DESC LIMIT 1",
+                              (node_id,)).fetchone()
+        return dict(row) if row else None
+
+    def record_event(self, node_id: str, name: Optional[str], kind: str, message: str,
+                     data: Optional[Dict] = None, ts: Optional[float] = None):
+        self.db.execute(
+            "INSERT INTO events VALUES (?, ?, ?, ?, ?, ?)",
+            (ts or time.time(), node_id, name, kind, message, json.dumps(data or {}, default=str))
+        )
+        self.db.commit()
+
+    def events(self, since: float = 0, node_id: Optional[str] = None,
+               kinds: Optional[Iterable[str]] = None) -> List[Dict]:
+        """Events from since on, oldest first"""
+        query = "SELECT * FROM events WHERE ts >= ?"
+        params: List = [since]
+        if node_id:
+            query += " AND node_id = ?"
+            params.append(node_id)
+        kinds = list(kinds or [])
+        if kinds:
+            query += f" AND kind IN ({', '.join('?' for _ in kinds)})"
+            params.extend(kinds)
+        query += " ORDER BY ts"
+
+        rows = []
+        for row in self.db.execute(query, params):
+            event = dict(row)
+            event['data'] = json.loads(event['data'] or '{}')
+            rows.append(event)
+        return rows
+
+    def last_event(self, node_id: str, kinds: Iterable[str]) -> Optional[Dict]:
+        """The node's most recent event of one of the kinds"""
+        kinds = list(kinds)
+        row = self.db.execute(
+            f"SELECT * FROM events WHERE node_id = ? AND kind IN ({', '.join('?' for _ in kinds)}) "
+            "ORDER BY ts DESC LIMIT 1",
+            [node_id, *kinds]
+        ).fetchone()
+        return dict(row) if row else None
+
+    def prune(self):
+        """Drop samples and events older than the retention period"""
+        cutoff = time.time() - self.retention_days * 86400
+        self.db.execute("DELETE FROM samples WHERE ts < ?", (cutoff,))
+        self.db.execute("DELETE FROM events WHERE ts < ?", (cutoff,))
+        self.db.execute("DELETE FROM satellite_scores WHERE ts < ?", (cutoff,))
+        cutoff_day = datetime.fromtimestamp(cutoff, timezone.utc).strftime('%Y-%m-%d')
+        self.db.execute("DELETE FROM traffic_daily WHERE day < ?", (cutoff_day,))
+        self.db.commit()
+
+    def record_satellite_scores(self, node_id: str, audits: List[Dict], ts: Optional[float] = None):
+        """Store the per-satellite scores of one poll, as in the node API's audits list"""
+        ts = ts or time.time()
+        self.db.executemany(
+            "INSERT INTO satellite_scores VALUES (?, ?, ?, ?, ?, ?, ?)",
+            [(ts, node_id, audit.get('satelliteID') or audit.get('satelliteName'), audit.get('satelliteName'),
+              audit.get('auditScore'), audit.get('suspensionScore'), audit.get('onlineScore'))
+             for audit in audits if audit.get('satelliteID') or audit.get('satelliteName')]
+        )
+        self.db.commit()
+
+    def satellite_scores(self, node_id: str, start: float, end: float) -> List[Dict]:
+        """A node's per-satellite scores within [start, end), oldest first"""
+        rows = self.db.execute(
+            "SELECT * FROM satellite_scores WHERE node_id = ? AND ts >= ? AND ts < ? ORDER BY ts",
+            (node_id, start, end)
+        )
+        return [dict(row) for row in rows]
+
+    def record_daily_traffic(self, node_id: str, days: Dict[str, Tuple[int, int]]):
+        """Store per-day (ingress, egress) totals, replacing earlier values for the same day"""
+        self.db.executemany(
+            "INSERT OR REPLACE INTO traffic_daily VALUES (?, ?, ?, ?)",
+            [(node_id, day, ingress, egress) for day, (ingress, egress) in days.items()]
+        )
+        self.db.commit()
+
+    def daily_traffic(self, node_id: str, since_day: str) -> Dict[str, Tuple[int, int]]:
+        """Per-day (ingress, egress) totals from since_day (YYYY-MM-DD) on"""
+        rows = self.db.execute(
+            "SELECT day, ingress, egress FROM traffic_daily WHERE node_id = ? AND day >= ? ORDER BY day",
+            (node_id, since_day)
+        )
+        return {row['day']: (row['ingress'], row['egress']) for row in rows}
+
+    def record_sightings(self, nodes: List[Dict], scanned_hosts: Iterable[str],
+                         ts: Optional[float] = None) -> List[Dict]:
+        """Record discovered nodes and return known nodes missing from the scanned hosts
+
+        Missing nodes whose missing_since equals ts disappeared in this scan.
+        """
+        ts = ts or time.time()
+        scanned = set(scanned_hosts)
+        found = {node['node_id'] for node in nodes}
+
+        for node in nodes:
+            self.db.execute(
+                """INSERT INTO sightings VALUES (?, ?, ?, ?, ?, ?, NULL)
+                   ON CONFLICT (node_id) DO UPDATE SET name = excluded.name,
+                       address = excluded.address, dashboard_port = excluded.dashboard_port,
+                       last_seen = excluded.last_seen, missing_since = NULL""",
+                (node['node_id'], node.get('name'), node['address'], node['dashboard_port'], ts, ts)
+            )
+
+        missing = []
+        for row in self.db.execute("SELECT * FROM sightings"):
+            if row['address'] in scanned and row['node_id'] not in found:
+                missing.append(dict(row))
+        for node in missing:
+            if node['missing_since'] is None:
+                node['missing_since'] = ts
+                self.db.execute("UPDATE sightings SET missing_since = ? WHERE node_id = ?",
+                                (ts, node['node_id']))
+        self.db.commit()
+        return missing
+
+    def stale_nodes(self, older_than: float = 0) -> List[Dict]:
+        """Nodes no longer found by discovery, last seen more than older_than seconds ago"""
+        cutoff = time.time() - older_than
+        rows = self.db.execute(
+            "SELECT * FROM sightings WHERE missing_since IS NOT NULL AND last_seen <= ? ORDER BY last_seen",
+            (cutoff,)
+        )
+        return [dict(row) for row in rows]
+
+    def forget_node(self, node_id: str):
+        """Stop tracking a node's sightings"""
+        self.db.execute("DELETE FROM sightings WHERE node_id = ?", (node_id,))
+        self.db.commit()
@@ -2,116 +2,808 @@
 Node synchronization service
 
 Continuously monitors registered Storj nodes and syncs their data
-with the Storj Cloud monitoring dashboard.
+with the Storj Cloud monitoring dashboard, or the other configured sinks.
 """
 
 import asyncio
+import json
 import logging
-from datetime import datetime
-from typing import Dict, List, Optional
+import signal
+import socket
+import time
+from collections import deque
+from datetime import datetime, timedelta, timezone
+from pathlib import Path
+from typing import AsyncIterator, Dict, List, Optional, Sequence, Set, Tuple
 
-import aiohttp
+from . import __version__, lowpower
+from .alerts import Alert, AlertManager, find_critical_satellites
+from .annotations import NodeAnnotations
+from .audits import node_audit_trends
+from .capacity import check_allocation, filesystem_usage, storage_dir
+from .compat import check as check_compat
+from .crash import write_crash_report
+from .dashboard import dashboard_session
+from .dormancy import BACKOFF_AFTER, ErrorBudget
+from .errorreport import ErrorReporter
+from .errors import ClientError, NetworkError, NodeUnreachableError, RateLimitedError, VersionSkewError, http_error
+from .fields import FieldFilter
+from .anomaly import BASELINE_DAYS, daily_traffic, detect_traffic_anomalies
+from .extaddr import PublicIpLookup, check_external_address
+from .events import AVAILABILITY_EVENTS, availability_event, sample_events
+from .forecast import node_forecast
+from .health import audit_success_rate, health_problems, health_score
+from .identity import identity_dir, inspect_identity
+from .jsonl import emit
+from .jitter import machine_id, next_phase, phase_offset, startup_delay
+from .logger import get_logger
+from .nodeapi import RESPONSE_CACHE_SIZE, STATIC_TTL, NodeApiClient, node_endpoint
+from .nodes import determine_status, exit_in_progress, exit_status, parse_exit_progress
+from .outbox import Outbox
+from .output import format_age
+from .payouts import current_month_payout, held_schedule
+from .pseudonym import Pseudonymizer
+from .quarantine import Quarantine, plausibility_problems
+from .quota import RateLimit, quota_warnings
+from .rollup import FleetRollup
+from .servers import ServerPool
+from .signing import PayloadSigner
+from .sinks import DashboardSink, Sink, StdoutSink
+from .state import DaemonState
+from .storageprobe import LatencyBaseline, probe_storage
+from .store import HistoryStore
+from .telemetry import Telemetry
+from .tracing import span
+from .trust import TrustList, compare_satellites
+from .wallet import wallet_features
+
+# Number of score samples kept per node for alert context
+SCORE_HISTORY_SIZE = 12
+
+# Registered nodes requested from the dashboard per page
+NODE_PAGE_SIZE = 200
+
+# Seconds between checks of the account quota
+QUOTA_CHECK_INTERVAL = 3600
 
 
 class NodeSync:
     """Synchronizes node data with dashboard"""
     
     def __init__(self, api_token: str, dashboard_url: str, interval: int = 300,
-                 batch_size: int = 10, retry_failed: bool = True, logger=None):
+                 batch_size: int = 10, retry_failed: bool = True, logger=None,
+                 alerts: Optional[AlertManager] = None,
+                 store: Optional[HistoryStore] = None,
+                 telemetry: Optional[Telemetry] = None,
+                 disk_full_days: int = 0,
+                 state: Optional[DaemonState] = None,
+                 crash_dir: Optional[Path] = None,
+                 dump_dir: Optional[Path] = None,
+                 trust: Optional[TrustList] = None,
+                 account: Optional[str] = None,
+                 handle_signals: bool = True,
+                 errors: Optional[ErrorReporter] = None,
+                 outbox: Optional[Outbox] = None,
+                 signer: Optional[PayloadSigner] = None,
+                 fields: Optional[FieldFilter] = None,
+                 dry_run: bool = False,
+                 pseudonyms: Optional[Pseudonymizer] = None,
+                 server_address: Optional[str] = None,
+                 sinks: Optional[List[Sink]] = None,
+                 annotations: Optional[NodeAnnotations] = None,
+                 health_weights: Optional[Dict[str, float]] = None,
+                 health_alert_below: float = 0,
+                 servers: Optional[ServerPool] = None,
+                 backpressure_threshold: int = 0,
+                 backpressure: str = 'coalesce',
+                 startup_jitter: float = 0,
+                 align_phase: bool = False,
+                 jitter_seed: Optional[str] = None,
+                 quarantine: Optional[Quarantine] = None,
+                 storage_probe: bool = False,
+                 storage_latency_factor: float = 5,
+                 static_ttl: float = STATIC_TTL,
+                 budget: Optional[ErrorBudget] = None,
+                 unknown_audit_days: int = 0,
+                 drain_timeout: float = 30,
+                 low_power: bool = False,
+                 skip_collectors: Sequence[str] = (),
+                 memory_target: int = 0,
+                 once: bool = False):
         self.api_token = api_token
         self.dashboard_url = dashboard_url.rstrip('/')
         self.interval = interval
         self.batch_size = batch_size
         self.retry_failed = retry_failed
         self.logger = logger or logging.getLogger(__name__)
+        self.alerts = alerts or AlertManager(logger=self.logger)
+        self.store = store
+        self.telemetry = telemetry
+        self.disk_full_days = disk_full_days
+        self.unknown_audit_days = unknown_audit_days
+        self.health_weights = health_weights
+        self.health_alert_below = health_alert_below
+        self.servers = servers
+        self.backpressure_threshold = backpressure_threshold
+        self.backpressure = backpressure
+        self.backpressure_stats = {'skipped_cycles': 0, 'coalesced': 0}
+        # Accounts on one machine are spread like separate machines
+        seed = f"{jitter_seed or machine_id()}:{account or ''}"
+        self.startup_delay = startup_delay(seed, startup_jitter)
+        self.phase_offset = phase_offset(seed, interval) if align_phase else None
+        self.state = state or DaemonState(logger=self.logger)
+        self.crash_dir = crash_dir
+        self.dump_dir = dump_dir
+        self.trust = trust
+        self.account = account
+        self.handle_signals = handle_signals
+        self.errors = errors
+        self.fields = fields
+        self.dry_run = dry_run
+        self.once = once
+        self.pseudonyms = pseudonyms
+        self.annotations = annotations
+        self.quarantine = quarantine
+        self.budget = budget
+        self.storage_probe = storage_probe
+        self.storage_latency = LatencyBaseline(storage_latency_factor)
+        self.static_ttl = static_ttl
+        self.drain_timeout = drain_timeout
+        # The low-power profile caps the in-memory buffers and skips collectors
+        self.low_power = low_power
+        self.skip = set(skip_collectors)
+        self.memory = lowpower.MemoryGuard(memory_target, self.logger) if low_power and memory_target else None
+        self.score_history_size = lowpower.SCORE_HISTORY_SIZE if low_power else SCORE_HISTORY_SIZE
+        self.page_size = lowpower.NODE_PAGE_SIZE if low_power else NODE_PAGE_SIZE
+        self.rollup = FleetRollup()
+        self.last_rollup: Optional[Dict] = None
+        # Payout methods of the last inconsistency warned about
+        self.payout_warned: Optional[List[str]] = None
+        self.server_address = server_address
+        self.rate_limit = RateLimit(self.logger)
+        self.quota_checked = 0.0
+        
+        # A dry run prints the payloads instead of sending them anywhere
+        if dry_run:
+            sinks = [StdoutSink(indent=2, logger=self.logger)]
+        elif sinks is None:
+            sinks = [DashboardSink(api_token, dashboard_url, outbox, signer, self.rate_limit, self.logger)]
+        self.sinks = sinks
+        self.dashboard = next((sink for sink in sinks if isinstance(sink, DashboardSink)), None)
+        if self.dashboard:
+            # Uploads and node listings count against the same account limits
+            self.rate_limit = self.dashboard.rate_limit
+        for sink in sinks:
+            sink.count_error = self._count_error
         
         self.session = None
+        self.node_api = None
         self.running = False
+        self.score_history: Dict[str, deque] = {}
+        self.public_ip = PublicIpLookup(logger=self.logger)
+        
+        # Why nodes failed in the current cycle, and why the node list could not be fetched
+        self.failures: Dict[str, ClientError] = {}
+        self.cycle_error: Optional[ClientError] = None
+        self.cycle_counts: Dict[str, int] = {}
+        
+        # Diagnostics for state dumps
+        self.last_results: Dict[str, Dict] = {}
+        self.in_flight: Set[str] = set()
+        self.queue: Optional[asyncio.Queue] = None
+        self.cycle_started: Optional[float] = None
+        self.cycles = 0
+        self.last_cycle_duration: Optional[float] = None
+        self.started_at: Optional[float] = None
+        
+        # Registered nodes seen in the last cycle, for on-demand collection
+        self.known_nodes: Dict[str, Dict] = {}
+        self.wake = asyncio.Event()
+        # Set by sync_now(): the next cycle also uploads nodes synced moments ago
+        self.forced = False
+        
+        # Graceful shutdown: the cycle or retries running, which a shutdown lets finish
+        self.work: Optional[asyncio.Task] = None
+        self.stopping = False
+        self.drain_expired = False
+        self.drain_timer: Optional[asyncio.TimerHandle] = None
     
     async def start(self):
         """Start the sync daemon"""
         self.running = True
-        self.session = aiohttp.ClientSession(
+        self.started_at = time.time()
+        self.session = dashboard_session(
             headers={'Authorization': f'Bearer {self.api_token}'}
         )
+        self.node_api = NodeApiClient(timeout=10, logger=get_logger('api'),
+                                      endpoints=self.servers.endpoints() if self.servers else None,
+                                      static_ttl=self.static_ttl,
+                                      cache_size=lowpower.RESPONSE_CACHE_SIZE if self.low_power else RESPONSE_CACHE_SIZE).open()
+        for sink in self.sinks:
+            await sink.open()
+        
+        # Alerts active before a restart are not repeated
+        self.alerts.active |= self.state.alert_keys
+        
+        if self.handle_signals and hasattr(signal, 'SIGUSR1'):
+            asyncio.get_running_loop().add_signal_handler(signal.SIGUSR1, self.dump_state)
+            asyncio.get_running_loop().add_signal_handler(signal.SIGUSR2, self.sync_now)
+            asyncio.get_running_loop().add_signal_handler(signal.SIGTERM, self.shutdown)
         
         self.logger.info("Sync daemon started")
         
         try:
+            if self.startup_delay and not self.dry_run:
+                self.logger.info("Delaying the first cycle by %.0fs (startup jitter)", self.startup_delay)
+                await self._sleep(time.time() + self.startup_delay)
             while self.running:
-                await self._sync_cycle()
-                await asyncio.sleep(self.interval)
+                # Stops the daemon under --strict-compat once the dashboard requires a newer client
+                check_compat()
+                with span('sync.cycle', cycle=self.cycles + 1, account=self.account):
+                    await self._drainable(self._sync_cycle())
+                # Also after the cycle, whose requests may have been the first to learn of it
+                check_compat()
+                if self.dry_run:
+                    break
+                self._save_state()
+                if self.once:
+                    break
+                await self._wait_for_next_cycle(next_phase(time.time(), self.interval, self.phase_offset))
         except KeyboardInterrupt:
             self.logger.info("Sync daemon interrupted")
         finally:
             await self.stop()
     
+    def shutdown(self):
+        """Stop once the nodes in flight are synced, waiting at most drain_timeout seconds
+        
+        Nodes not started yet are left for the next run. A second shutdown
+        request stops without waiting.
+        """
+        if self.stopping:
+            self.logger.warning("Shutdown requested again, stopping without waiting for %d nodes",
+                                len(self.in_flight))
+            self._abort_drain()
+            return
+        self.stopping = True
+        self.running = False
+        self.wake.set()
+        if not self.work:
+            self.logger.info("Shutting down")
+            return
+        self.logger.info("Shutting down after the %d nodes in flight are synced (at most %gs)",
+                         len(self.in_flight), self.drain_timeout)
+        self.drain_timer = asyncio.get_running_loop().call_later(self.drain_timeout, self._abort_drain)
+    
+    def _abort_drain(self):
+        if self.work and not self.work.done():
+            self.drain_expired = True
+            self.work.cancel()
+    
+    async def _drainable(self, work):
+        """Run a cycle or retries, which a shutdown lets finish within drain_timeout"""
+        self.work = asyncio.ensure_future(work)
+        try:
+            await self.work
+        except asyncio.CancelledError:
+            if not self.drain_expired:
+                raise
+            self.logger.warning("Drain timeout reached, abandoning the nodes still in flight")
+        finally:
+            self.work = None
+            if self.drain_timer:
+                self.drain_timer.cancel()
+    
     async def stop(self):
         """Stop the sync daemon"""
         self.running = False
         if self.session:
             await self.session.close()
+        if self.node_api:
+            await self.node_api.close()
+        if self.store:
+            self.store.close()
+        for sink in self.sinks:
+            try:
+                await sink.close()
+            except Exception as e:
+                self.logger.error("Failed to close %s sink: %s", sink.kind, e)
+        self._save_state()
         self.logger.info("Sync daemon stopped")
     
+    def _save_state(self):
+        # A dry run must not make the next real run skip nodes
+        if self.dry_run:
+            return
+        self.state.alert_keys = set(self.alerts.active)
+        self.state.save()
+    
+    async def _wait_for_next_cycle(self, next_cycle: float):
+        """Sleep until the next cycle, retrying failed nodes as their retries fall due
+        
+        sync_now() ends the wait early.
+        """
+        while self.running and self.retry_failed:
+            next_retry = self.state.next_retry_at()
+            if next_retry is None or next_retry >= next_cycle:
+                break
+            if await self._sleep(next_retry):
+                return
+            await self._drainable(self._retry_pending())
+            self._save_state()
+        await self._sleep(next_cycle)
+    
+    async def _sleep(self, until: float) -> bool:
+        """Sleep until a time, returning True if woken early by sync_now()"""
+        try:
+            await asyncio.wait_for(self.wake.wait(), max(0.0, until - time.time()))
+        except asyncio.TimeoutError:
+            return False
+        self.wake.clear()
+        return True
+    
+    def sync_now(self):
+        """Start the next cycle immediately, or right after the running one"""
+        self.logger.info("Immediate sync cycle requested")
+        self.forced = True
+        self.wake.set()
+    
+    async def collect_now(self, node_id: str) -> Optional[bool]:
+        """Sync one node immediately; None when the node is not registered"""
+        if self.pseudonyms:
+            node_id = self.pseudonyms.real(node_id)
+        node = self.known_nodes.get(node_id)
+        if not node or not self.session:
+            return None
+        success = await self._sync_node(node) is True
+        self._record_result(node, success)
+        return success
+    
+    async def _retry_pending(self):
+        """Re-sync nodes whose retry is due"""
+        due = self.state.due_retries()
+        self.logger.info("Retrying %d failed nodes", len(due))
+        if self.annotations:
+            # The state file keeps no annotations, so a retry cannot clear them on the dashboard
+            self.annotations.refresh()
+        nodes = [self.annotations.apply(entry['node']) if self.annotations else entry['node'] for entry in due]
+        results = await asyncio.gather(*(self._sync_node(node) for node in nodes))
+        for node, success in zip(nodes, results):
+            self._record_result(node, success)
+    
+    def _record_result(self, node: Dict, success: bool):
+        node_id = node.get('nodeId', 'unknown')
+        error = self.failures.pop(node_id, None)
+        self.last_results[node_id] = {
+            'time': datetime.utcnow().isoformat(),
+            'success': success,
+            'error': error.kind if error and not success else None,
+        }
+        if success:
+            self.state.synced(node_id)
+        elif self.budget and self.budget.backing_off(node_id):
+            # Polled again when its backoff allows, not retried in between
+            self.state.pending_retries.pop(node_id, None)
+        elif error and not error.retryable:
+            # Such as a rejected token or upload: retrying before the next cycle gets the same answer
+            self.state.pending_retries.pop(node_id, None)
+        elif self.retry_failed:
+            wait = error.retry_after if isinstance(error, RateLimitedError) else None
+            self.state.failed(node, max_delay=self.interval, min_delay=wait or 0)
+    
+    def snapshot(self) -> Dict:
+        """The daemon's internal state, for diagnosing stuck syncs"""
+        # Nodes waiting in the worker queue (peeks at the queue's internal deque)
+        queued = [node.get('nodeId') for node in getattr(self.queue, '_queue', [])]
+        now = time.time()
+        return {
+            'time': datetime.utcnow().isoformat(),
+            'account': self.account,
+            'running': self.running,
+            'interval': self.interval,
+            'phase_offset': self.phase_offset,
+            'cycles': self.cycles,
+            'cycle_running_for': now - self.cycle_started if self.cycle_started else None,
+            'last_cycle_duration': self.last_cycle_duration,
+            'tasks': len(asyncio.all_tasks()),
+            'in_flight': sorted(self.in_flight),
+            'queued': queued,
+            'pending_retries': {
+                node_id: {'attempts': entry['attempts'], 'retry_in': entry['next_at'] - now}
+                for node_id, entry in self.state.pending_retries.items()
+            },
+            'last_results': self.last_results,
+            'active_alerts': sorted(self.alerts.active),
+            'node_api': dict(self.node_api.stats) if self.node_api else None,
+            'outbox': self.dashboard.stats() if self.dashboard else None,
+            'sinks': {sink.kind: sink.stats() for sink in self.sinks},
+            'servers': self.servers.snapshot() if self.servers else None,
+            'backpressure': self.health(),
+            'fleet': self.last_rollup,
+            'failing_nodes': {
+                entry['nodeId']: {key: entry[key] for key in ('failures', 'since', 'dormant')}
+                for entry in self.budget.failing() if entry.get('account') == self.account
+            } if self.budget else None,
+        }
+    
+    def upload_queue_depth(self) -> int:
+        """Uploads waiting for the dashboard to acknowledge them"""
+        return len(self.dashboard.outbox) if self.dashboard else 0
+    
+    def health(self) -> Dict:
+        """Upload queue depth and backpressure, for the debug server's /healthz"""
+        depth = self.upload_queue_depth()
+        return {
+            'upload_queue': depth,
+            'threshold': self.backpressure_threshold or None,
+            'backpressured': bool(self.backpressure_threshold) and depth > self.backpressure_threshold,
+            **self.backpressure_stats,
+        }
+    
+    def _apply_backpressure(self) -> bool:
+        """Hold back collection while the dashboard falls behind; True to skip this cycle
+        
+        Uploads buffered in earlier cycles have just been flushed. If the outbox
+        is still over the threshold, the cycle is either skipped or each node
+        keeps only its latest upload, so the queue cannot outgrow the fleet.
+        """
+        depth = self.upload_queue_depth()
+        over = bool(self.backpressure_threshold) and depth > self.backpressure_threshold
+        if not over:
+            if self.dashboard and self.dashboard.coalescing:
+                self.logger.info("Upload queue back to %d uploads, backpressure released", depth)
+                self.dashboard.coalescing = False
+            return False
+        if self.backpressure == 'skip':
+            self.backpressure_stats['skipped_cycles'] += 1
+            self.logger.warning("Upload queue at %d uploads (threshold %d), skipping collection this cycle",
+                                depth, self.backpressure_threshold)
+            return True
+        dropped = self.dashboard.outbox.coalesce()
+        self.dashboard.coalescing = True
+        self.backpressure_stats['coalesced'] += dropped
+        self.logger.warning("Upload queue at %d uploads (threshold %d), keeping only the latest upload "
+                            "per node (%d superseded)", depth, self.backpressure_threshold, dropped)
+        return False
+    
+    def dump_state(self):
+        """Write a state snapshot to a file, or to the log without a dump directory"""
+        dump = json.dumps(self.snapshot(), indent=2, default=str)
+        if self.dump_dir:
+            prefix = f"state-{self.account}" if self.account else "state"
+            path = Path(self.dump_dir) / f"{prefix}-{time.strftime('%Y%m%d-%H%M%S')}.json"
+            try:
+                path.parent.mkdir(parents=True, exist_ok=True)
+                path.write_text(dump)
+                self.logger.info("Daemon state dumped to %s", path)
+                return
+            except OSError as e:
+                self.logger.error("Failed to write state dump: %s", e)
+        self.logger.info("Daemon state:\n%s", dump)
+    
     async def _sync_cycle(self):
-        """Perform one sync cycle"""
+        """Perform one sync cycle
+        
+        Registered nodes are fetched page by page and fed through a bounded
+        queue to a fixed pool of workers, so peak memory depends on the
+        worker count rather than the fleet size. Nodes of servers listed
+        under hub.servers go to a queue and workers of their server instead.
+        """
+        queue: asyncio.Queue = asyncio.Queue(maxsize=self.batch_size)
+        counts = {'synced': 0, 'failed': 0, 'skipped': 0, 'backoff': 0, 'dormant': 0}
+        self.cycle_counts, self.cycle_error = counts, None
+        forced, self.forced = self.forced, False
+        self.queue = queue
+        self.cycle_started = time.time()
+        self.cycles += 1
+        emit('cycle_started', cycle=self.cycles, account=self.account)
+        
+        async def worker(queue: asyncio.Queue):
+            while True:
+                node = await queue.get()
+                if self.stopping:
+                    # Not started before the shutdown, so left for the next run
+                    queue.task_done()
+                    continue
+                node_id = node.get('nodeId', 'unknown')
+                self.in_flight.add(node_id)
+                started = time.monotonic()
+                server = self.servers.match(node) if self.servers else None
+                try:
+                    if server and server.isolated:
+                        # Retried later rather than waiting for another timeout now
+                        server.skip()
+                        success = False
+                    else:
+                        with span('sync.node', node_id=node_id, node_name=node.get('name')) as current:
+                            success = await self._sync_node(node) is True
+                            if current:
+                                current.set_attribute('success', success)
+                    self._record_result(node, success)
+                except Exception as e:
+                    # Keep the worker alive whatever happens to one node
+                    self.logger.error("Unexpected error for node %s: %s", node.get('nodeId', 'unknown'), e)
+                    self._crash_report(e, node)
+                    success = False
+                finally:
+                    self.in_flight.discard(node_id)
+                    queue.task_done()
+                counts['synced' if success else 'failed'] += 1
+                emit('node_synced' if success else 'node_failed', node_id=node_id, name=node.get('name'),
+                     account=self.account, seconds=round(time.monotonic() - started, 3),
+                     error=self.last_results.get(node_id, {}).get('error') if not success else None)
+        
+        workers = [asyncio.create_task(worker(queue)) for _ in range(self.batch_size)]
+        # Server name -> its queue, unbounded so a stalled server never blocks the others
+        server_queues: Dict[str, asyncio.Queue] = {}
+        registered = set()
         try:
-            # Get registered nodes from dashboard
-            nodes = await self._get_registered_nodes()
-            if not nodes:
+            await self._check_quota()
+            for sink in self.sinks:
+                await sink.begin_cycle()
+            if self.servers:
+                self.servers.begin_cycle()
+            if self._apply_backpressure():
+                for sink in self.sinks:
+                    await sink.end_cycle()
+                return
+            self.rollup.begin()
+            if self.budget:
+                # Picks up nodes reactivated while running
+                self.budget.refresh()
+            
+            async for node in self._iter_registered_nodes():
+                if self.stopping:
+                    break
+                node_id = node.get('nodeId', 'unknown')
+                registered.add(node_id)
+                self.known_nodes[node_id] = node
+                
+                # Nodes uploaded shortly before a restart are not uploaded again
+                if not self.dry_run and not forced and self.state.recently_synced(node_id, self.interval / 2):
+                    counts['skipped'] += 1
+                    continue
+                # Nodes failing repeatedly are polled less often, dormant nodes not at all
+                if self.budget and not self.budget.due(node_id, self.interval):
+                    counts['dormant' if self.budget.dormant(node_id) else 'backoff'] += 1
+                    continue
+                server = self.servers.match(node) if self.servers else None
+                if server:
+                    if server.name not in server_queues:
+                        server_queues[server.name] = asyncio.Queue()
+                        workers.extend(asyncio.create_task(worker(server_queues[server.name]))
+                                       for _ in range(server.concurrency))
+                    server_queues[server.name].put_nowait(node)
+                    continue
+                await queue.put(node)
+            await queue.join()
+            for server_queue in server_queues.values():
+                await server_queue.join()
+            if self.servers:
+                self.servers.end_cycle()
+            # A cycle cut short by a shutdown or a failed node list has no complete rollup
+            if registered and not self.stopping and not self.cycle_error:
+                await self._upload_rollup(counts['skipped'] + counts['backoff'] + counts['dormant'])
+            for sink in self.sinks:
+                await sink.end_cycle()
+            
+            if self.stopping:
+                # Nodes not reached must keep their state and budget for the next run
+                self.logger.info("Sync cycle stopped early by shutdown: %d synced, %d failed",
+                                 counts['synced'], counts['failed'])
+                return
+            if self.cycle_error:
+                # The node list is incomplete, so nodes missing from it may still be registered
+                self.logger.warning("Sync cycle ended early: %d synced, %d failed", counts['synced'], counts['failed'])
+                emit('cycle_failed', cycle=self.cycles, account=self.account, **counts,
+                     error=self.cycle_error.to_dict())
+                return
+            if not registered:
                 self.logger.debug("No registered nodes found")
                 return
             
-            self.logger.info("Syncing %d nodes", len(nodes))
+            self._forget_unregistered(registered)
+            for node_id in set(self.known_nodes) - registered:
+                del self.known_nodes[node_id]
+            self.state.forget(registered)
+            if self.budget:
+                self.budget.forget(registered, self.account)
+            if counts['skipped']:
+                self.logger.info("Skipped %d nodes synced less than %ds ago",
+                                 counts['skipped'], self.interval / 2)
+            if counts['backoff'] or counts['dormant']:
+                self.logger.info("Not polled this cycle: %d nodes backing off after repeated failures, %d dormant",
+                                 counts['backoff'], counts['dormant'])
             
-            # Process nodes in batches
-            for i in range(0, len(nodes), self.batch_size):
-                batch = nodes[i:i + self.batch_size]
-                await self._sync_batch(batch)
+            if self.store:
+                self.store.prune()
+            if self.memory:
+                self.memory.check(self.node_api)
             
-            self.logger.info("Sync cycle completed")
+            if self.telemetry:
+                self.telemetry.record_cycle(len(registered))
+            
+            if counts['failed']:
+                self.logger.warning("Sync cycle completed: %d synced, %d failed",
+                                    counts['synced'], counts['failed'])
+            else:
+                self.logger.info("Sync cycle completed: %d nodes synced", counts['synced'])
+            emit('cycle_finished', cycle=self.cycles, account=self.account, **counts,
+                 seconds=round(time.time() - self.cycle_started, 3))
+            if self.node_api:
+                stats = self.node_api.stats
+                self.logger.debug("Node API since start: %d requests, %d not modified, %d served from cache",
+                                  stats['requests'], stats['not_modified'], stats['fresh'])
             
         except Exception as e:
             self.logger.error("Sync cycle failed: %s", e)
+            self._count_error('cycle')
+            if self.errors:
+                self.errors.report(e, self._error_context())
+        finally:
+            for task in workers:
+                task.cancel()
+            await asyncio.gather(*workers, return_exceptions=True)
+            self.queue = None
+            self.last_cycle_duration = time.time() - self.cycle_started
+            self.cycle_started = None
+        
+        if self.telemetry:
+            await self.telemetry.maybe_send()
+    
+    async def _upload_rollup(self, skipped: int):
+        """Send the fleet totals of the cycle to every sink"""
+        summary = {
+            **self.rollup.summary(skipped),
+            'account': self.account,
+            'host': socket.gethostname(),
+        }
+        self.last_rollup = summary
+        methods = sorted(summary['payoutMethods'])
+        if not summary['payoutConsistent'] and methods != self.payout_warned:
+            self.logger.warning("Nodes differ in payout method: %s (see status for which)",
+                                ', '.join(f"{summary['payoutMethods'][method]} {method}" for method in methods))
+        self.payout_warned = None if summary['payoutConsistent'] else methods
+        self.logger.debug("Fleet rollup: %d nodes, %d online, %d offline, %d degraded",
+                          summary['nodes'], summary['online'], summary['offline'], summary['degraded'])
+        for sink in self.sinks:
+            try:
+                await sink.write_summary(summary)
+            except Exception as e:
+                self.logger.error("%s sink failed for the fleet rollup: %s", sink.kind, e)
+                self._count_error('sink')
+    
+    def _count_error(self, category: str):
+        """Count an error category for telemetry"""
+        if self.telemetry:
+            self.telemetry.count_error(category)
+    
+    def _forget_unregistered(self, registered: Set[str]):
+        """Drop per-node state of nodes no longer registered"""
+        for node_id in set(self.score_history) - registered:
+            del self.score_history[node_id]
     
-    async def _get_registered_nodes(self) -> List[Dict]:
-        """Get list of registered nodes from dashboard"""
+    async def _iter_registered_nodes(self) -> AsyncIterator[Dict]:
+        """Yield registered nodes, one dashboard page at a time"""
+        if self.annotations:
+            # Picks up nicknames and maintenance windows set while running
+            self.annotations.refresh()
+        offset = 0
+        while True:
+            page = await self._get_registered_nodes(offset, self.page_size)
+            if page is None:
+                return
+            nodes, total = page
+            for node in nodes:
+                # Aliased node IDs are translated back for local use
+                if self.pseudonyms:
+                    node = self.pseudonyms.reveal(node)
+                yield self.annotations.apply(node) if self.annotations else node
+            offset += len(nodes)
+            
+            # Dashboards without paging return every node in one response
+            if total is None or not nodes or offset >= total:
+                return
+    
+    async def _get_registered_nodes(self, offset: int = 0,
+                                    limit: int = NODE_PAGE_SIZE) -> Optional[Tuple[List[Dict], Optional[int]]]:
+        """Get one page of registered nodes and the total count, if reported"""
         url = f"{self.dashboard_url}/storj/nodes"
         
         try:
-            async with self.session.get(url) as response:
+            async with self.session.get(url, params={'offset': offset, 'limit': limit}) as response:
+                self.rate_limit.update(response.status, response.headers)
                 if response.status == 200:
                     data = await response.json()
-                    return data.get('nodes', [])
+                    return data.get('nodes', []), data.get('total')
                 else:
-                    self.logger.error("Failed to get nodes: HTTP %d", response.status)
-                    return []
+                    self.cycle_error = http_error(response.status, "Failed to get registered nodes",
+                                                  response.headers)
+                    self.logger.error("%s", self.cycle_error)
+                    self._count_error(self.cycle_error.kind)
+                    return None
+        except VersionSkewError as e:
+            self.logger.error("Failed to get registered nodes: %s", e)
+            self.cycle_error = e
+            self._count_error(e.kind)
+            return None
         except Exception as e:
             self.logger.error("Failed to get registered nodes: %s", e)
-            return []
-    
-    async def _sync_batch(self, nodes: List[Dict]):
-        """Sync a batch of nodes"""
-        tasks = [self._sync_node(node) for node in nodes]
-        results = await asyncio.gather(*tasks, return_exceptions=True)
-        
-        success_count = sum(1 for r in results if r is True)
-        error_count = len(results) - success_count
-        
-        if error_count > 0:
-            self.logger.warning("Batch sync: %d success, %d errors", success_count, error_count)
+            self.cycle_error = NetworkError(f"Failed to reach dashboard: {e}")
+            self._count_error('dashboard_unreachable')
+            return None
     
     async def _sync_node(self, node: Dict) -> bool:
-        """Sync a single node"""
+        """Sync a single node
+        
+        Any error is contained to the node, so one malformed response
+        cannot stop the daemon.
+        """
+        node_data = None
         try:
+            maintenance = self._maintenance(node)
+            
             # Fetch current node data
+            started = time.monotonic()
             node_data = await self._fetch_node_data(node)
+            latency = time.monotonic() - started
+            if self.servers and (server := self.servers.match(node)):
+                server.record(bool(node_data))
+            rejected = not node_data and self.node_api.rejections.get(node_endpoint(node))
+            if rejected:
+                # Answered, so not an outage; the response was logged as rejected
+                self._count_error('node_parse')
+                return False
+            if not node_data and maintenance:
+                # Planned downtime is neither a failure nor worth retrying
+                self.rollup.add_maintenance()
+                self.logger.info("Node %s is under maintenance and unreachable",
+                                 node.get('nodeId', 'unknown')[:8])
+                return await self._update_maintenance(node, maintenance)
             if not node_data:
+                # Planned downtime stays out of the availability timeline
+                self._record_availability(node, False, "node dashboard unreachable")
+                self.rollup.add_unreachable()
                 self.logger.warning("Failed to fetch data for node %s", node.get('nodeId', 'unknown'))
+                self.failures[node.get('nodeId', 'unknown')] = NodeUnreachableError(
+                    f"Node {node.get('nodeId', 'unknown')[:8]} dashboard unreachable")
+                self._count_error('node_unreachable')
+                self._spend_budget(node)
+                return False
+            self._reset_budget(node)
+            if self.pseudonyms and node_data.get('nodeID'):
+                # Relearns aliases lost with the local alias file
+                self.pseudonyms.alias(node_data['nodeID'])
+            if await self._check_plausible(node, node_data):
                 return False
             
+            self._record_scores(node, node_data)
+            await self._check_critical(node, node_data)
+            # Fetched once for both the local history and the upload
+            estimate = await self.node_api.get_estimated_payout(*node_endpoint(node))
+            await self._store_sample(node, node_data, estimate)
+            await self._check_disk_full(node)
+            bandwidth, audits = await self.node_api.get_satellite_arrays(*node_endpoint(node))
+            audit_trend = await self._check_unknown_audits(node, audits)
+            await self._check_allocation(node, node_data)
+            egress_today = await self._check_traffic(node, node_data, bandwidth)
+            await self._check_external_address(node)
+            identity = await self._check_identity(node)
+            storage = await self._check_storage(node)
+            health = self._health(node_data)
+            await self._check_health(node, health)
+            graceful_exit = parse_exit_progress(
+                await self.node_api.get_exit_progress(*node_endpoint(node)))
+            await self._check_satellites(node, node_data, graceful_exit)
+            held = held_schedule(await self.node_api.get_held_history(*node_endpoint(node)))
+            payout = current_month_payout(estimate)
+            
             # Update node in dashboard
-            success = await self._update_node(node['id'], node_data)
+            success = await self._update_node(
+                node, node_data, graceful_exit=graceful_exit, held=held, identity=identity,
+                client=self._client_metadata(node, latency), health=health, maintenance=maintenance,
+                storage=storage, usage={'egressToday': egress_today, 'estimatedPayout': payout},
+                audit_trend=audit_trend)
             if success:
                 self.logger.debug("Synced node %s", node.get('nodeId', 'unknown')[:8])
             
@@ -119,76 +811,602 @@ class NodeSync:
             
         except Exception as e:
             self.logger.error("Failed to sync node %s: %s", node.get('nodeId', 'unknown'), e)
+            self._count_error('node_sync')
+            self._crash_report(e, node, node_data)
             return False
     
+    async def _check_plausible(self, node: Dict, node_data: Dict) -> bool:
+        """Quarantine an implausible sample instead of syncing it; True if quarantined"""
+        node_id = node.get('nodeId', 'unknown')
+        key = f"implausible:{node_id}"
+        problems = plausibility_problems(node_data)
+        if not problems:
+            self.alerts.clear(key)
+            return False
+        
+        self.logger.warning("Quarantined implausible data of node %s: %s", node_id[:8], '; '.join(problems))
+        self._count_error('node_implausible')
+        if self.quarantine:
+            self.quarantine.add(node, node_data, problems)
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='implausible',
+            severity='warning',
+            title=f"Node {node_id[:8]} reports implausible data",
+            message='; '.join(problems) + "; the sample was quarantined, see `quarantine list`",
+            details={'problems': problems},
+        ))
+        return True
+    
+    def _maintenance(self, node: Dict) -> Optional[Dict]:
+        """The node's maintenance window, silencing its alerts while it lasts"""
+        node_id = node.get('nodeId', 'unknown')
+        maintenance = self.annotations.maintenance(node_id) if self.annotations else None
+        if maintenance:
+            self.alerts.silence(node_id, maintenance['until'])
+        else:
+            self.alerts.unsilence(node_id)
+        return maintenance
+    
+    def _crash_report(self, error: Exception, node: Dict, payload=None):
+        context = {
+            'node_id': node.get('nodeId'),
+            'name': node.get('name'),
+            'endpoint': '%s:%s' % node_endpoint(node),
+        }
+        path = self.crash_dir and write_crash_report(self.crash_dir, error, context, payload, self.logger)
+        if path:
+            self.logger.error("Crash report written to %s", path)
+        if self.errors:
+            self.errors.report(error, {**self._error_context(), 'node_id': node.get('nodeId')})
+    
+    def _client_metadata(self, node: Dict, latency: float) -> Dict:
+        """Health of the client itself, shown per server on the dashboard"""
+        retry = self.state.pending_retries.get(node.get('nodeId', 'unknown'), {})
+        return {
+            'version': __version__,
+            'host': socket.gethostname(),
+            'address': self.server_address,
+            'account': self.account,
+            'uptime': round(time.time() - self.started_at) if self.started_at else None,
+            'cycle': self.cycles,
+            'lastCycleDuration': round(self.last_cycle_duration, 3) if self.last_cycle_duration else None,
+            'collectionLatency': round(latency, 3),
+            'retries': retry.get('attempts', 0),
+            'queueDepth': self.queue.qsize() if self.queue else 0,
+            'inFlight': len(self.in_flight),
+        }
+    
+    def _error_context(self) -> Dict:
+        """Daemon context attached to error reports"""
+        return {
+            'command': 'sync',
+            'account': self.account,
+            'cycle': self.cycles,
+            'nodes': len(self.known_nodes),
+            'interval': self.interval,
+        }
+    
     async def _fetch_node_data(self, node: Dict) -> Optional[Dict]:
         """Fetch current data from node dashboard API"""
-        dashboard_port = node.get('dashboardPort') or 14002
-        address = node.get('address', '127.0.0.1')
-        url = f"http://{address}:{dashboard_port}/api/sno"
+        with span('node.poll', node_id=node.get('nodeId'), endpoint='%s:%s' % node_endpoint(node)):
+            return await self.node_api.get_sno(*node_endpoint(node))
+    
+    async def _store_sample(self, node: Dict, node_data: Dict, estimate: Optional[Dict] = None):
+        """Record the node's state, and its estimated payout response, in local history"""
+        if not self.store:
+            return
+        
+        extra = {}
+        if estimate:
+            extra['payout_cents'] = estimate.get('currentMonth', {}).get('payout')
         
+        node_id = node.get('nodeId', 'unknown')
+        status = self._determine_status(node_data)
         try:
-            async with aiohttp.ClientSession() as session:
-                async with session.get(url, timeout=10) as response:
-                    if response.status == 200:
-                        return await response.json()
-                    else:
-                        self.logger.debug("Node API returned %d for %s", response.status, url)
+            previous = self.store.last_sample(node_id)
+            self.store.record_sample(node_id, node.get('name'), status, node_data, extra)
+            events = sample_events(previous, self.store.last_sample(node_id))
+            for kind, message, data in events:
+                self.store.record_event(node_id, node.get('name'), kind, message, data)
+        except Exception as e:
+            self.logger.error("Failed to record history for node %s: %s", node_id[:8], e)
+        self._record_availability(node, status != 'OFFLINE', "no contact with satellites")
+    
+    def _spend_budget(self, node: Dict):
+        """Count an unreachable poll against the node's error budget"""
+        if not self.budget:
+            return
+        entry = self.budget.failed(node, self.account)
+        label = node.get('name') or node.get('nodeId', 'unknown')[:12]
+        if entry['dormant'] == entry['last']:
+            self.logger.warning("Node %s has been unreachable for %s and is now dormant; it is no longer polled "
+                                "until reactivated (nodes reactivate %s)", label,
+                                format_age(entry['last'] - entry['since']), node.get('nodeId', 'unknown')[:12])
+        elif entry['failures'] == BACKOFF_AFTER:
+            self.logger.warning("Node %s failed %d polls in a row; polling it less often until it answers",
+                                label, entry['failures'])
+    
+    def _reset_budget(self, node: Dict):
+        if not self.budget:
+            return
+        entry = self.budget.succeeded(node.get('nodeId', 'unknown'))
+        if entry and (entry['dormant'] or entry['failures'] >= BACKOFF_AFTER):
+            self.logger.info("Node %s answers again after %d failed polls",
+                             node.get('name') or node.get('nodeId', 'unknown')[:12], entry['failures'])
+    
+    def _record_availability(self, node: Dict, up: bool, reason: str):
+        """Record the node going offline or coming back in the event timeline"""
+        if not self.store:
+            return
+        node_id = node.get('nodeId', 'unknown')
+        try:
+            now = time.time()
+            event = availability_event(self.store.last_event(node_id, AVAILABILITY_EVENTS), up, reason, now)
+            if event:
+                self.store.record_event(node_id, node.get('name'), *event, ts=now)
+        except Exception as e:
+            self.logger.error("Failed to record events for node %s: %s", node_id[:8], e)
+    
+    def _record_scores(self, node: Dict, node_data: Dict):
+        """Keep a short rolling history of reputation scores per node"""
+        node_id = node.get('nodeId', 'unknown')
+        history = self.score_history.setdefault(node_id, deque(maxlen=self.score_history_size))
+        reputation = node_data.get('reputation', {})
+        history.append({
+            'timestamp': datetime.utcnow().isoformat(),
+            'auditScore': reputation.get('auditScore'),
+            'suspensionScore': reputation.get('suspensionScore'),
+            'onlineScore': reputation.get('onlineScore'),
+        })
+    
+    async def _check_critical(self, node: Dict, node_data: Dict):
+        """Alert immediately when a satellite suspends or disqualifies the node"""
+        node_id = node.get('nodeId', 'unknown')
+        critical = find_critical_satellites(node_data)
+        keys = [f"{node_id}:{sat['id']}:{sat['state']}" for sat in critical]
+        self.alerts.clear(f"{node_id}:", keep=keys)
+        
+        for key, satellite in zip(keys, critical):
+            alert = Alert(
+                node_id=node_id,
+                node_name=node.get('name'),
+                kind=satellite['state'],
+                title=f"Node {node_id[:8]} {satellite['state']} on {satellite['url'] or satellite['id']}",
+                message=f"Satellite {satellite['url'] or satellite['id']} reports the node "
+                        f"{satellite['state']} since {satellite['since']}",
+                details={
+                    'satellite': satellite,
+                    'scoreHistory': list(self.score_history.get(node_id, [])),
+                }
+            )
+            await self.alerts.raise_alert(key, alert)
+    
+    async def _check_disk_full(self, node: Dict):
+        """Alert when the usage trend fills the node's allocation soon"""
+        if not self.store or not self.disk_full_days:
+            return
+        
+        node_id = node.get('nodeId', 'unknown')
+        key = f"disk_full:{node_id}"
+        forecast = node_forecast(self.store, node_id)
+        if not forecast or forecast['days_left'] > self.disk_full_days:
+            self.alerts.clear(key)
+            return
+        
+        days = forecast['days_left']
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='disk_full',
+            severity='warning',
+            title=f"Node {node_id[:8]} fills up in ~{days:.0f} days",
+            message=f"Used space grows by {forecast['growth_per_day'] / 1e9:.1f} GB/day; "
+                    f"the allocation is projected to be full in ~{days:.0f} days",
+            details={'forecast': forecast},
+        ))
+    
+    async def _check_unknown_audits(self, node: Dict, audits: Optional[List[Dict]]) -> Optional[List[Dict]]:
+        """Record the node's per-satellite scores and alert on suspension scores heading for suspension
+        
+        Returns the node's score trend per satellite, None without local history.
+        """
+        if not self.store or 'audit_trends' in self.skip:
+            return None
+        
+        node_id = node.get('nodeId', 'unknown')
+        try:
+            if audits:
+                self.store.record_satellite_scores(node_id, audits)
+            trends = node_audit_trends(self.store, node_id)
+        except Exception as e:
+            self.logger.error("Failed to record satellite scores for node %s: %s", node_id[:8], e)
+            return None
+        
+        warned = [trend for trend in trends if self.unknown_audit_days and trend['days_to_suspension'] is not None
+                  and trend['days_to_suspension'] <= self.unknown_audit_days]
+        keys = [f"unknown_audits:{node_id}:{trend['satellite_id']}" for trend in warned]
+        self.alerts.clear(f"unknown_audits:{node_id}:", keep=keys)
+        
+        for key, trend in zip(keys, warned):
+            satellite = trend['satellite'] or trend['satellite_id'][:12]
+            await self.alerts.raise_alert(key, Alert(
+                node_id=node_id,
+                node_name=node.get('name'),
+                kind='unknown_audits',
+                severity='warning',
+                title=f"Node {node_id[:8]} heading for suspension on {satellite}",
+                message=f"The suspension score on {satellite} is {trend['suspension_score']:.1%} and falls by "
+                        f"{-trend['suspension_per_day']:.2%} a day from unknown audits; the satellite suspends "
+                        f"the node below 60% in ~{trend['days_to_suspension']:.0f} days (check the node's log "
+                        f"for failed GET_AUDIT requests and the disk for read errors)",
+                details={'trend': trend, 'scoreHistory': list(self.score_history.get(node_id, []))},
+            ))
+        return trends
+    
+    async def _check_allocation(self, node: Dict, node_data: Dict):
+        """Alert when the allocation exceeds what the node's disk can hold"""
+        node_id = node.get('nodeId', 'unknown')
+        key = f"allocation:{node_id}"
+        result = check_allocation(node_data.get('diskSpace', {}), filesystem_usage(storage_dir(node)))
+        if not result or not result['problems']:
+            self.alerts.clear(key)
+            return
+        
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='allocation',
+            severity='warning',
+            title=f"Node {node_id[:8]} allocation exceeds its disk",
+            message='; '.join(result['problems']) +
+                    "; the node will crash when the disk fills up, lower STORAGE",
+            details=result,
+        ))
+    
+    def _health(self, node_data: Dict) -> Dict:
+        reputation = node_data.get('reputation', {})
+        return health_score({
+            'reachable': True,
+            'status': self._determine_status(node_data),
+            'audit_score': reputation.get('auditScore'),
+            'suspension_score': reputation.get('suspensionScore'),
+            'online_score': reputation.get('onlineScore'),
+            'audit_success_rate': audit_success_rate(node_data),
+            'up_to_date': node_data.get('upToDate'),
+        }, self.health_weights)
+    
+    async def _check_health(self, node: Dict, health: Dict):
+        """Alert when the node's health score drops below health.alert_below"""
+        node_id = node.get('nodeId', 'unknown')
+        key = f"health:{node_id}"
+        if not self.health_alert_below or health['score'] >= self.health_alert_below:
+            self.alerts.clear(key)
+            return
+        
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='health',
+            severity='warning',
+            title=f"Node {node_id[:8]} health score {health['score']:.0f}",
+            message=f"Health score {health['score']:.0f} is below {self.health_alert_below:.0f}: "
+                    + ', '.join(health_problems(health['components'])),
+            details=health,
+        ))
+    
+    async def _check_traffic(self, node: Dict, node_data: Dict, bandwidth: Optional[List[Dict]]) -> Optional[int]:
+        """Alert when the node's daily traffic (bandwidth) deviates sharply from its baseline
+        
+        Returns the bytes the node sent today, if it reports them.
+        """
+        node_id = node.get('nodeId', 'unknown')
+        now = datetime.now(timezone.utc)
+        traffic = daily_traffic(bandwidth)
+        today = traffic.get(now.strftime('%Y-%m-%d'))
+        egress_today = today[1] if today else None
+        if not self.store or 'traffic_anomalies' in self.skip:
+            return egress_today
+        
+        since = (now - timedelta(days=BASELINE_DAYS + 1)).strftime('%Y-%m-%d')
+        try:
+            self.store.record_daily_traffic(node_id, traffic)
+            history = self.store.daily_traffic(node_id, since)
         except Exception as e:
-            self.logger.debug("Failed to fetch from %s: %s", url, e)
+            self.logger.error("Failed to record traffic for node %s: %s", node_id[:8], e)
+            return egress_today
+        
+        # Traffic of an offline node is expected to stop
+        anomalies = []
+        if self._determine_status(node_data) != 'OFFLINE':
+            anomalies = detect_traffic_anomalies(history, now)
+        keys = [f"traffic:{node_id}:{a['direction']}" for a in anomalies]
+        self.alerts.clear(f"traffic:{node_id}:", keep=keys)
+        
+        for key, anomaly in zip(keys, anomalies):
+            await self.alerts.raise_alert(key, Alert(
+                node_id=node_id,
+                node_name=node.get('name'),
+                kind=f"traffic_{anomaly['kind']}",
+                severity='warning',
+                title=f"Node {node_id[:8]} {anomaly['direction']} {anomaly['kind']}",
+                message=f"{anomaly['direction'].capitalize()} on {anomaly['day']} is "
+                        f"{anomaly['ratio']:.0%} of the usual {anomaly['baseline'] / 1e9:.1f} GB/day; "
+                        f"this often indicates a networking or satellite trust problem",
+                details={'anomaly': anomaly},
+            ))
+        return egress_today
+    
+    async def _check_external_address(self, node: Dict):
+        """Alert when the node's external address no longer points at this host"""
+        external_address = node.get('externalAddress')
+        if not external_address or 'external_address' in self.skip:
+            return
+        public_ip = await self.public_ip.get()
+        if not public_ip:
+            return
+        
+        node_id = node.get('nodeId', 'unknown')
+        key = f"external_address:{node_id}"
+        result = await check_external_address(external_address, public_ip)
+        if result['matches']:
+            self.alerts.clear(key)
+            return
+        
+        resolved = ', '.join(result['resolved']) or 'nothing'
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='external_address',
+            title=f"Node {node_id[:8]} external address is stale",
+            message=f"{result['host']} resolves to {resolved} but this host's public IP is {public_ip}; "
+                    "satellites cannot reach the node (check the dynamic DNS updater)",
+            details=result,
+        ))
+    
+    async def _check_satellites(self, node: Dict, node_data: Dict, graceful_exit: List[Dict]):
+        """Alert on satellites outside the trust list, or trusted ones the node lacks"""
+        if not self.trust:
+            return
+        
+        node_id = node.get('nodeId', 'unknown')
+        key = f"satellites:{node_id}"
+        exited = [entry['satellite_id'] for entry in graceful_exit if entry['completed']]
+        trusted = self.node_api.satellites.trusted(await self.trust.load())
+        result = compare_satellites(node_data, trusted, exited, self.trust.extra)
+        if not result['untrusted'] and not result['missing']:
+            self.alerts.clear(key)
+            return
+        
+        problems = []
+        if result['untrusted']:
+            problems.append("untrusted " + ', '.join(sat['url'] or sat['id'][:12] for sat in result['untrusted']))
+        if result['missing']:
+            problems.append("missing " + ', '.join(sat['url'] or sat['id'][:12] for sat in result['missing']))
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='satellites',
+            severity='warning',
+            title=f"Node {node_id[:8]} satellite list differs from the trust list",
+            message=f"Satellites {'; '.join(problems)}; check the node's trust sources",
+            details=result,
+        ))
+    
+    async def _check_identity(self, node: Dict) -> Optional[Dict]:
+        """Inspect the node's identity directory when it is on this host"""
+        directory = identity_dir(node)
+        if not directory or 'identity' in self.skip:
+            return None
+        
+        node_id = node.get('nodeId', 'unknown')
+        key = f"identity:{node_id}"
+        identity = inspect_identity(directory, node.get('nodeId'), self.logger)
+        if identity['healthy'] is not False:
+            self.alerts.clear(key)
+            return identity
         
-        return None
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='identity',
+            title=f"Node {node_id[:8]} identity is broken",
+            message='; '.join(identity['problems']),
+            details={'identity': identity},
+        ))
+        return identity
     
-    async def _update_node(self, node_id: str, node_data: Dict) -> bool:
-        """Update node data in dashboard"""
-        url = f"{self.dashboard_url}/storj/nodes/{node_id}"
+    async def _check_storage(self, node: Dict) -> Optional[Dict]:
+        """Probe the node's storage directory when it is on this host
+        
+        Alerts when the directory cannot be written, or when a probe takes
+        several times longer than the node's recent probes.
+        """
+        directory = storage_dir(node)
+        if not self.storage_probe or self.dry_run or not directory or not directory.is_dir():
+            return None
+        
+        node_id = node.get('nodeId', 'unknown')
+        result = await asyncio.to_thread(probe_storage, directory)
+        if not result['writable']:
+            self.alerts.clear(f"storage_latency:{node_id}")
+            await self.alerts.raise_alert(f"storage:{node_id}", Alert(
+                node_id=node_id,
+                node_name=node.get('name'),
+                kind='storage',
+                title=f"Node {node_id[:8]} cannot write to its storage directory",
+                message=f"Probe of {directory} failed: {result['error']}; "
+                        f"the node cannot store new pieces",
+                details={'directory': str(directory), 'probe': result},
+            ))
+            return result
+        self.alerts.clear(f"storage:{node_id}")
+        
+        key = f"storage_latency:{node_id}"
+        baseline = self.storage_latency.record(node_id, result['total'])
+        if baseline is None:
+            self.alerts.clear(key)
+            return result
+        await self.alerts.raise_alert(key, Alert(
+            node_id=node_id,
+            node_name=node.get('name'),
+            kind='storage_latency',
+            severity='warning',
+            title=f"Node {node_id[:8]} storage latency spiked",
+            message=f"Writing and syncing a small file in {directory} took {result['total'] * 1000:.0f} ms, "
+                    f"usually {baseline * 1000:.0f} ms; the node may start losing upload races",
+            details={'directory': str(directory), 'probe': result, 'baseline': baseline},
+        ))
+        return result
+    
+    async def _update_node(self, node: Dict, node_data: Dict, *,
+                           graceful_exit: Optional[List[Dict]] = None,
+                           held: Optional[List[Dict]] = None,
+                           identity: Optional[Dict] = None,
+                           client: Optional[Dict] = None,
+                           health: Optional[Dict] = None,
+                           maintenance: Optional[Dict] = None,
+                           storage: Optional[Dict] = None,
+                           usage: Optional[Dict] = None,
+                           audit_trend: Optional[List[Dict]] = None) -> bool:
+        """Send node data, with what the checks collected for it, to every sink; True if all accepted it
+        
+        The collected values are keyword-only, as every check adds one.
+        """
+        critical = find_critical_satellites(node_data)
+        graceful_exit = graceful_exit or []
         
         # Transform node data for dashboard API
         update_data = {
-            'status': self._determine_status(node_data),
+            'status': exit_status(self._determine_status(node_data), graceful_exit),
             'version': node_data.get('version'),
-            'usedSpace': node_data.get('diskSpace', {}).get('used', 0),
-            'availableSpace': node_data.get('diskSpace', {}).get('available', 0),
-            'bandwidthUsed': node_data.get('bandwidth', {}).get('used', 0),
-            'uptime': node_data.get('uptime', 0),
+            # None rather than 0 where the node's API schema lacks the field
+            'usedSpace': node_data.get('diskSpace', {}).get('used'),
+            'availableSpace': node_data.get('diskSpace', {}).get('available'),
+            'bandwidthUsed': node_data.get('bandwidth', {}).get('used'),
+            # Bytes sent today (UTC) and this month's payout so far in USD
+            'egressToday': (usage or {}).get('egressToday'),
+            'estimatedPayout': (usage or {}).get('estimatedPayout'),
+            'uptime': node_data.get('uptime'),
+            'apiSchema': node_data.get('apiSchema'),
+            'apiProblems': node_data.get('apiProblems', []),
+            # Values of the wrong type, reported instead of uploaded
+            'parseWarnings': node_data.get('parseWarnings', []),
             'lastSeen': datetime.utcnow().isoformat(),
             'reputation': node_data.get('reputation', {}),
             'satellites': node_data.get('satellites', []),
+            # Opted-in payout methods such as zksync-era, empty for Layer 1
+            'walletFeatures': wallet_features(node_data),
             'auditScore': node_data.get('reputation', {}).get('auditScore'),
             'suspensionScore': node_data.get('reputation', {}).get('suspensionScore'),
+            # Per-satellite score trends, None without local history
+            'auditTrend': [{
+                'satelliteId': trend['satellite_id'],
+                'satellite': trend['satellite'],
+                'auditScore': trend['audit_score'],
+                'suspensionScore': trend['suspension_score'],
+                'suspensionPerDay': trend['suspension_per_day'],
+                'auditPerDay': trend['audit_per_day'],
+                'falling': trend['falling'],
+                'daysToSuspension': trend['days_to_suspension'],
+            } for trend in audit_trend] if audit_trend is not None else None,
+            'critical': bool(critical),
+            'criticalSatellites': critical,
+            # Lets the dashboard show a shrinking, exiting node as such
+            'exiting': exit_in_progress(graceful_exit),
+            'gracefulExit': [{
+                'satelliteId': entry['satellite_id'],
+                'satellite': entry['satellite'],
+                'percentComplete': entry['percent_complete'],
+                'completed': entry['completed'],
+                'successful': entry['successful'],
+                'completionReceipt': entry['completion_receipt'],
+            } for entry in graceful_exit],
+            'heldSchedule': [{
+                'satelliteId': entry['satellite_id'],
+                'satellite': entry['satellite'],
+                'month': entry['month'],
+                'phase': entry['phase'],
+                'heldPercent': entry['held_percent'],
+                'totalHeld': entry['total_held'],
+                'releaseMonth': entry['release_month'],
+                'released': entry['released'],
+            } for entry in held or []],
+            # None when the identity is not on this host
+            'identityHealthy': identity['healthy'] if identity else None,
+            'identityProblems': identity['problems'] if identity else [],
+            # None unless the storage directory was probed on this host
+            'storageWritable': storage['writable'] if storage else None,
+            'storageLatencyMs': round(storage['total'] * 1000, 2) if storage and storage['total'] else None,
+            'client': client,
+            'healthScore': health['score'] if health else None,
+            'healthComponents': health['components'] if health else {},
+            **self._maintenance_fields(maintenance),
+            # Local annotations, see `nodes rename` and `nodes annotate`
+            'nickname': node.get('nickname'),
+            'notes': node.get('notes'),
+            'metadata': node.get('metadata') or {},
         }
         
+        if self.fields:
+            update_data = self.fields.apply(update_data)
+        self.rollup.add(update_data)
+        return await self._write_sinks(node, update_data)
+    
+    async def _update_maintenance(self, node: Dict, maintenance: Dict) -> bool:
+        """Tell the sinks an unreachable node is in planned downtime, as no node data is there to send"""
+        last_success = self.state.last_success.get(node.get('nodeId', 'unknown'))
+        update_data = {
+            'status': 'OFFLINE',
+            'lastSeen': datetime.utcfromtimestamp(last_success).isoformat() if last_success else None,
+            **self._maintenance_fields(maintenance),
+        }
+        if self.fields:
+            update_data = self.fields.apply(update_data)
+        return await self._write_sinks(node, update_data)
+    
+    @staticmethod
+    def _maintenance_fields(maintenance: Optional[Dict]) -> Dict:
+        """Lets the dashboard leave planned downtime out of availability"""
+        return {
+            'maintenance': bool(maintenance),
+            'maintenanceUntil': datetime.utcfromtimestamp(maintenance['until']).isoformat() if maintenance else None,
+            'maintenanceReason': maintenance['reason'] if maintenance else None,
+        }
+    
+    async def _write_sinks(self, node: Dict, update_data: Dict) -> bool:
+        """Send a node's update to every sink; True if all accepted it"""
+        results = []
+        for sink in self.sinks:
+            try:
+                results.append(await sink.write(node, update_data))
+                error = not results[-1] and sink.error(node.get('id'))
+                if error:
+                    self.failures[node.get('nodeId', 'unknown')] = error
+            except Exception as e:
+                self.logger.error("%s sink failed for node %s: %s", sink.kind, node.get('nodeId', 'unknown')[:8], e)
+                self._count_error('sink')
+                results.append(False)
+        return all(results)
+    
+    async def _check_quota(self):
+        """Warn when the account approaches its limits, at most hourly"""
+        if time.time() - self.quota_checked < QUOTA_CHECK_INTERVAL:
+            return
+        self.quota_checked = time.time()
         try:
-            async with self.session.patch(url, json=update_data) as response:
-                if response.status in [200, 204]:
-                    return True
-                else:
-                    self.logger.error("Failed to update node %s: HTTP %d", node_id, response.status)
-                    if response.status == 401:
-                        self.logger.error("Authentication failed - check API token")
-                    return False
+            async with self.session.get(f"{self.dashboard_url}/account/quota") as response:
+                self.rate_limit.update(response.status, response.headers)
+                if response.status != 200:
+                    return
+                quota = await response.json()
         except Exception as e:
-            self.logger.error("Failed to update node %s: %s", node_id, e)
-            return False
+            self.logger.debug("Failed to get account quota: %s", e)
+            return
+        for warning in quota_warnings(quota):
+            self.logger.warning("Dashboard account close to its limit: %s", warning)
     
     def _determine_status(self, node_data: Dict) -> str:
         """Determine node status from API data"""
-        if not node_data.get('lastContactSuccess'):
-            return 'OFFLINE'
-        
-        # Check if node is disqualified
-        if node_data.get('disqualified'):
-            return 'DISQUALIFIED'
-        
-        # Check reputation scores
-        if 'reputation' in node_data:
-            reputation = node_data['reputation']
-            audit_score = reputation.get('auditScore', 1.0)
-            suspension_score = reputation.get('suspensionScore', 0.0)
-            
-            if suspension_score > 0:
-                return 'SUSPENDED'
-            elif audit_score < 0.95:
-                return 'WARNING'
-        
-        return 'ONLINE'
+        return determine_status(node_data)
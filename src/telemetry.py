@@ -0,0 +1,102 @@
+"""
+Anonymous usage telemetry
+
+Strictly opt-in reporting of client version, node count and error categories.
+Pending data is kept on disk so `telemetry show` can print exactly what the
+next report would contain.
+"""
+
+import json
+import logging
+import os
+import time
+from pathlib import Path
+from typing import Dict
+
+import aiohttp
+
+from . import __version__
+
+
+def telemetry_forced_off() -> bool:
+    """Hard off switch that overrides any configuration"""
+    return os.getenv('STORJCLOUD_TELEMETRY', '').lower() in ('off', '0', 'false', 'no')
+
+
+class Telemetry:
+    """Collects and periodically sends anonymous usage data"""
+
+    def __init__(self, enabled: bool, endpoint: str, state_path: Path,
+                 interval: float = 86400, logger=None):
+        self.forced_off = telemetry_forced_off()
+        self.enabled = enabled and not self.forced_off
+        self.endpoint = endpoint
+        self.state_path = Path(state_path)
+        self.interval = interval
+        self.logger = logger or logging.getLogger(__name__)
+        self.state = self._load()
+
+    def _load(self) -> Dict:
+        try:
+            return json.loads(self.state_path.read_text())
+        except (OSError, ValueError):
+            return {'node_count': 0, 'errors': {}, 'last_sent': time.time()}
+
+    def _save(self):
+        try:
+            self.state_path.parent.mkdir(parents=True, exist_ok=True)
+            self.state_path.write_text(json.dumps(self.state))
+        except OSError as e:
+            self.logger.debug("Failed to save telemetry state: %s", e)
+
+    def record_cycle(self, node_count: int):
+        if self.forced_off:
+            return
+        self.state['node_count'] = node_count
+        self._save()
+
+    def count_error(self, category: str):
+        if self.forced_off:
+            return
+        errors = self.state.setdefault('errors', {})
+        errors[category] = errors.get(category, 0) + 1
+
+    def payload(self) -> Dict:
+        """Exactly what the next report sends"""
+        return {
+            'client_version': __version__,
+            'node_count': self.state.get('node_count', 0),
+            'error_categories': dict(sorted(self.state.get('errors', {}).items())),
+        }
+
+    async def maybe_send(self):
+        """Send the pending report if enabled and the interval has elapsed"""
+        if self.forced_off:
+            return
+        self._save()
+        if not self.enabled or time.time() - self.state.get('last_sent', 0) < self.interval:
+            return
+
+        try:
+            timeout = aiohttp.ClientTimeout(total=10)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.post(self.endpoint, json=self.payload()) as response:
+                    if response.status >= 300:
+                        self.logger.debug("Telemetry endpoint returned HTTP %d", response.status)
+                        return
+        except Exception as e:
+            self.logger.debug("Failed to send telemetry: %s", e)
+            return
+
+        self.state['errors'] = {}
+        self.state['last_sent'] = time.time()
+        self._save()
+
+
+def telemetry_status(enabled_in_config: bool) -> str:
+    """Explain whether telemetry is active"""
+    if telemetry_forced_off():
+        return "disabled (STORJCLOUD_TELEMETRY=off)"
+    if not enabled_in_config:
+        return "disabled (opt in with telemetry.enabled: true)"
+    return "enabled"
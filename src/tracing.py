@@ -0,0 +1,68 @@
+"""
+Tracing
+
+Optional OpenTelemetry instrumentation of sync cycles, node polls and
+dashboard uploads, exported over OTLP/HTTP to Jaeger, Tempo or a collector.
+Without the OpenTelemetry SDK installed, or with tracing disabled, spans are
+no-ops and cost nothing.
+"""
+
+import logging
+import socket
+from contextlib import contextmanager
+from typing import Optional
+
+from . import __version__
+
+_provider = None
+_tracer = None
+
+
+def setup_tracing(endpoint: Optional[str] = None, service_name: str = 'storjcloud-client',
+                  logger=None) -> bool:
+    """Export spans over OTLP; the endpoint defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318"""
+    global _provider, _tracer
+    logger = logger or logging.getLogger(__name__)
+    try:
+        from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+        from opentelemetry.sdk.resources import Resource
+        from opentelemetry.sdk.trace import TracerProvider
+        from opentelemetry.sdk.trace.export import BatchSpanProcessor
+    except ImportError:
+        logger.warning("tracing.enabled is set but OpenTelemetry is not installed "
+                       "(pip install opentelemetry-sdk opentelemetry-exporter-otlp-proto-http)")
+        return False
+
+    resource = Resource.create({
+        'service.name': service_name,
+        'service.version': __version__,
+        'host.name': socket.gethostname(),
+    })
+    _provider = TracerProvider(resource=resource)
+    _provider.add_span_processor(BatchSpanProcessor(OTLPSpanExporter(endpoint=endpoint)))
+    _tracer = _provider.get_tracer('storjcloud-client', __version__)
+    logger.info("Exporting traces to %s", endpoint or 'the OTLP endpoint from the environment')
+    return True
+
+
+def shutdown_tracing():
+    """Flush pending spans"""
+    global _provider, _tracer
+    if _provider:
+        _provider.shutdown()
+    _provider = _tracer = None
+
+
+@contextmanager
+def span(name: str, **attributes):
+    """Run a block in a span; yields the span, or None when tracing is off
+
+    Spans started inside the block, including in tasks it creates, become
+    its children. Exceptions are recorded on the span.
+    """
+    if not _tracer:
+        yield None
+        return
+    attributes = {key: value for key, value in attributes.items() if value is not None}
+    with _tracer.start_as_current_span(name, attributes=attributes) as current:
+        yield current
@@ -0,0 +1,124 @@
+"""
+Satellite trust list
+
+Fetches the official list of trusted satellites and compares it with the
+satellites each node reports, detecting unknown satellites and trusted
+satellites a node is missing, both signs of a misconfigured or forked trust
+list.
+"""
+
+import json
+import logging
+import time
+from pathlib import Path
+from typing import Dict, Iterable, List, Optional
+
+import aiohttp
+
+DEFAULT_TRUST_SOURCE = "https://www.storj.io/dcs-satellites"
+
+# Used when the trust source cannot be reached and nothing is cached
+DEFAULT_TRUSTED_SATELLITES = {
+    '12EayRS2V1kEsWESU9QMRseFhdxYxKicsiFmxrsLZHeLUtdps3S': 'us1.storj.io:7777',
+    '12L9ZFwhzVpuEKMUNUqkaTLGzwY9G24tbiigLiXpmZWKwmcNDDs': 'eu1.storj.io:7777',
+    '121RTSDpyNZVcEU84Ticf2L1ntiuUimbWgfATz21tuvgk3vzoA6': 'ap1.storj.io:7777',
+    '1wFTAgs9DP5RSnCqKV1eLf6N9wtk4EAtmN5DpSxcs8EjT69tGE': 'saltlake.tardigrade.io:7777',
+}
+
+
+def parse_trust_list(text: str) -> Dict[str, str]:
+    """Satellite IDs and addresses from ID@HOST:PORT lines"""
+    satellites = {}
+    for line in text.splitlines():
+        line = line.split('#', 1)[0].strip()
+        if '@' in line:
+            satellite_id, _, address = line.partition('@')
+            satellites[satellite_id.strip()] = address.strip()
+    return satellites
+
+
+class TrustList:
+    """Trusted satellites with an on-disk cache"""
+
+    def __init__(self, source: str = DEFAULT_TRUST_SOURCE, extra: Iterable[str] = (),
+                 cache_path: Optional[Path] = None, cache_ttl: int = 86400, logger=None):
+        self.source = source
+        self.extra = list(extra)
+        self.cache_path = cache_path
+        self.cache_ttl = cache_ttl
+        self.logger = logger or logging.getLogger(__name__)
+        self.satellites: Dict[str, str] = {}
+        self.loaded_at = 0.0
+
+    async def load(self) -> Dict[str, str]:
+        """Load the list from cache, refreshing from the source when stale"""
+        if self.satellites and time.time() - self.loaded_at < self.cache_ttl:
+            return self.satellites
+
+        cached = self._read_cache()
+        if cached and time.time() - cached.get('fetched_at', 0) < self.cache_ttl:
+            satellites = cached['satellites']
+        else:
+            satellites = await self._fetch()
+            if satellites:
+                self._write_cache(satellites)
+            elif cached:
+                self.logger.warning("Using stale satellite trust list from %s", cached.get('fetched_at'))
+                satellites = cached['satellites']
+            else:
+                satellites = dict(DEFAULT_TRUSTED_SATELLITES)
+
+        self.satellites, self.loaded_at = satellites, time.time()
+        return satellites
+
+    async def _fetch(self) -> Optional[Dict[str, str]]:
+        try:
+            timeout = aiohttp.ClientTimeout(total=10)
+            async with aiohttp.ClientSession(timeout=timeout) as session:
+                async with session.get(self.source) as response:
+                    if response.status != 200:
+                        self.logger.warning("Satellite trust source returned HTTP %d", response.status)
+                        return None
+                    text = await response.text()
+        except Exception as e:
+            self.logger.warning("Failed to fetch satellite trust list: %s", e)
+            return None
+        return parse_trust_list(text) or None
+
+    def _read_cache(self) -> Optional[Dict]:
+        if not self.cache_path or not self.cache_path.exists():
+            return None
+        try:
+            cached = json.loads(self.cache_path.read_text())
+        except (OSError, ValueError):
+            return None
+        # A list cached from another source is of no use
+        if cached.get('source') != self.source:
+            return None
+        return cached
+
+    def _write_cache(self, satellites: Dict[str, str]):
+        if not self.cache_path:
+            return
+        try:
+            self.cache_path.parent.mkdir(parents=True, exist_ok=True)
+            self.cache_path.write_text(json.dumps({
+                'source': self.source, 'satellites': satellites, 'fetched_at': time.time()}))
+        except OSError as e:
+            self.logger.debug("Failed to write satellite trust list cache: %s", e)
+
+
+def compare_satellites(node_data: Dict, trusted: Dict[str, str], exited: Iterable[str] = (),
+                       extra: Iterable[str] = ()) -> Dict[str, List[Dict]]:
+    """Unknown satellites a node reports and trusted ones it is missing
+
+    Satellites the node has gracefully exited are not reported as missing.
+    Extra satellites are accepted but not expected on every node.
+    """
+    reported = {sat.get('id'): sat.get('url') for sat in node_data.get('satellites', []) or []}
+    accepted = set(trusted) | set(extra)
+    return {
+        'untrusted': [{'id': sat_id, 'url': url} for sat_id, url in reported.items() if sat_id not in accepted],
+        'missing': [{'id': sat_id, 'url': url} for sat_id, url in trusted.items()
+                    if sat_id not in reported and sat_id not in set(exited)],
+    }
@@ -0,0 +1,70 @@
+"""
+Payout wallet features
+
+Storage nodes opt in to payouts on a Layer 2 network such as zkSync with
+operator.wallet-features, which the node API reports as walletFeatures; a node
+without any is paid on Ethereum (Layer 1). Fleets usually share one wallet and
+one payout method, so a node that differs from the rest is most often a
+setting forgotten on a new or rebuilt node.
+"""
+
+from collections import Counter
+from typing import Dict, List, Optional, Tuple
+
+# Wallet features storagenode releases understand
+KNOWN_FEATURES = ('zksync', 'zksync-era')
+
+# Nodes listed by name in an inconsistency before the rest are counted
+MAX_LISTED = 5
+
+
+def wallet_features(node_data: Optional[Dict]) -> List[str]:
+    """A node's wallet features, lowercased and sorted; empty for Layer 1 payouts"""
+    features = (node_data or {}).get('walletFeatures') or []
+    if isinstance(features, str):
+        features = features.split(',')
+    return sorted({str(feature).strip().lower() for feature in features if str(feature).strip()})
+
+
+def format_wallet_features(features: Optional[List[str]]) -> str:
+    if features is None:
+        return '-'
+    return ', '.join(features) if features else 'L1'
+
+
+def _listed(names: List[str]) -> str:
+    listed = ', '.join(names[:MAX_LISTED])
+    return listed + (f" and {len(names) - MAX_LISTED} more" if len(names) > MAX_LISTED else '')
+
+
+def _odd_ones(nodes: List[Dict], key) -> Optional[Tuple[object, List[Dict]]]:
+    """The most common value of key and the nodes that differ from it, None if all agree"""
+    values = Counter(key(node) for node in nodes)
+    if len(values) < 2:
+        return None
+    usual = values.most_common(1)[0][0]
+    return usual, [node for node in nodes if key(node) != usual]
+
+
+def payout_inconsistencies(nodes: List[Dict]) -> List[str]:
+    """Payout settings in which some nodes differ from the rest of the fleet
+
+    nodes carry 'name', 'wallet' and 'wallet_features' as in status metrics;
+    nodes that did not report them are left out.
+    """
+    reporting = [node for node in nodes if node.get('wallet_features') is not None]
+    problems = []
+    odd = _odd_ones(reporting, lambda node: tuple(node['wallet_features']))
+    if odd:
+        usual, others = odd
+        problems.append(f"paid differently from the rest ({format_wallet_features(list(usual))}) "
+                        f"on {len(others)} of {len(reporting)} nodes: "
+                        + _listed([f"{node['name']} ({format_wallet_features(node['wallet_features'])})"
+                                   for node in others]))
+    with_wallet = [node for node in reporting if node.get('wallet')]
+    odd = _odd_ones(with_wallet, lambda node: node['wallet'].lower())
+    if odd:
+        _, others = odd
+        problems.append(f"paid to a different wallet than the rest on {len(others)} of {len(with_wallet)} nodes: "
+                        + _listed([node['name'] for node in others]))
+    return problems
@@ -10,60 +10,266 @@ import asyncio
 import json
 import logging
 import os
+import signal
+import socket
 import sys
+import tarfile
 import time
 import yaml
+from datetime import datetime
 from pathlib import Path
-from typing import Dict, List, Optional, Any
+from typing import Dict, List, Optional, Tuple, Any
+
+import aiohttp
 
 # Import our modules
-from src.discovery import DockerDiscovery, PortScanner
+from src import __version__
+from src.annotations import NodeAnnotations, parse_metadata
+from src.accounts import DEFAULT_ACCOUNT, Account, assign_nodes, load_accounts
+from src.discovery import (DEFAULT_SCAN_CONCURRENCY, DiscoveryCache, DockerDiscovery, expand_hosts,
+                           incremental_scan, parse_ports, scan_hosts)
 from src.sync import NodeSync
 from src.auth import AuthManager
-from src.config import Config
+from src.bench import estimate_cycle, run_bench
+from src.agent import AgentConnection
+from src.aggregator import Aggregator
+from src.alerts import Alert, AlertManager
+from src.errors import (ClientError, UsageError, AuthError, NetworkError, NodeUnreachableError, PartialSuccess,
+                        ReadOnlyError, NoNodesFound, DeadlineExceeded, EXIT_CONFIG, EXIT_ERROR, EXIT_INTERRUPTED)
+from src.control import SYNC_NOW_SIGNAL, PidFile, signal_daemon
+from src.config import (Config, ConfigError, ENV_VARS, EXTRA_ENV_VARS, SECRET_KEYS,
+                        data_dir, env_flag, parse_duration, write_config_value)
+from src.confcrypt import (MACHINE, PASSPHRASE, PASSPHRASE_ENV, SECRET_ENTRY_KEYS, decrypt_tree,
+                           is_encrypted)
+from src.completion import SHELLS, completion_script
+from src.crash import write_crash_report
+from src.currency import ExchangeRates
+from src.errorreport import ErrorReporter
+from src.debugserver import DebugServer, parse_listen
+from src.capacity import storage_dir
+from src.compat import set_strict_compat
+from src.cancel import deadline_error, run, set_deadline, time_left, within_deadline
+from src.doctor import FAIL, SEVERITY_COLORS, WARN, run_checks
+from src.dormancy import ErrorBudget, backoff_cycles
+from src.lint import ERROR, container_settings, lint_settings, lint_summary, load_config_file
+from src.mockserver import MockDashboard
+from src.netstatus import NetworkStatus
+from src.dashboard import read_only, set_read_only
+from src.mtls import client_context, server_context, set_client_tls
+from src.network import server_address
+from src.fields import FieldFilter
+from src.inventory import load_inventory
+from src.jsonl import OUTPUT_FORMATS, emit, set_output
+from src.diff import DEFAULT_WINDOW, fleet_diff, format_point, parse_point
+from src.events import EVENT_KINDS
+from src.forecast import format_days_left, node_forecast
+from src.health import health_band, health_score
+from src.nodeapi import NodeApiClient, node_endpoint, set_strict_parsing, set_traffic
+from src.outbox import Outbox
+from src.nodes import collect_node_metrics, find_node, format_exit_progress, node_label
+from src.output import (format_table, format_bytes, format_ratio, format_age, confirm, prompt_secret,
+                        set_color, status_color, score_color, CLEAR_SCREEN, GREEN, RED, YELLOW, ScanProgress)
+from src.pricing import PricingModel
+from src.wallet import format_wallet_features, payout_inconsistencies
+from src.pseudonym import Pseudonymizer
+from src.quarantine import Quarantine
+from src.satfilter import SatelliteFilter, set_satellite_filter
+from src.selfupdate import (Updater, install, parse_version, platform_tag, select_archive, verify_checksum,
+                            verify_signature)
+from src.quota import quota_rows, quota_warnings
+from src.recording import TrafficLog
+from src.registration import (DONE as REGISTRATION_DONE, FAILED, REGISTERED, UPDATED, RegistrationJournal,
+                              RegistrationPipeline)
+from src.payouts import collect_payouts, summarize_payouts, format_amount
+from src.report import build_monthly_report, render_report
+from src.schema import DURATION_FIELDS
+from src.servers import ServerPool, load_servers
+from src.sinks import DashboardSink, Sink, create_sink
+from src.state import DaemonState
+from src.store import HistoryStore
+from src.telemetry import Telemetry, telemetry_status
+from src.tracing import setup_tracing, shutdown_tracing
+from src.trust import TrustList
 from src.pm2 import PM2Manager
-from src.logger import setup_logger
+from src.logger import get_logger, setup_logger
+from src.lowpower import apply_profile
+
+
+# Short names of frequently used commands
+COMMAND_ALIASES = {'d': 'discover', 's': 'sync', 'st': 'status'}
 
 
 def main():
     """Main entry point"""
     parser = create_parser()
     args = parser.parse_args()
+    args.command = COMMAND_ALIASES.get(args.command, args.command)
+    if args.deadline:
+        try:
+            deadline = parse_duration(args.deadline)
+        except ValueError as e:
+            parser.error(f"--deadline: {e}")
+        if deadline <= 0:
+            parser.error("--deadline must be positive")
+        set_deadline(deadline, args.deadline)
+    
+    # Completion scripts need neither the config nor logging
+    if args.command == 'completion':
+        print(completion_script(parser, args.shell), end='')
+        return
+    
+    # Non-interactive mode never prompts and keeps output plain and stable
+    non_interactive = args.non_interactive or env_flag('STORJCLOUD_NON_INTERACTIVE')
+    args.interactive = not non_interactive and sys.stdin.isatty()
+    
+    # Colors only on terminals, and never with --no-color, NO_COLOR or in non-interactive mode
+    no_color = args.no_color or non_interactive or 'NO_COLOR' in os.environ
+    if no_color:
+        set_color(False)
     
     # Setup logging
-    logger = setup_logger(args.log_level or 'info')
+    logger = setup_logger(args.log_level or 'info', color=not no_color)
     
     # Load configuration
-    config = Config.load(args.config)
+    try:
+        config = Config.load(args.config)
+    except ConfigError as e:
+        logger.error("Invalid configuration%s:", f" in {e.source}" if e.source else "")
+        for error in e.errors:
+            logger.error("  %s", error)
+        sys.exit(e.exit_code)
+    
+    # Apply the configured levels and log file; --log-level still wins
+    logger = setup_logger(args.log_level or config.logging.level, config.logging.file,
+                          color=not no_color, levels=config.logging.levels)
+    
+    if config.config_file and not non_interactive:
+        logger.info("Using config file %s", config.config_file)
     
     # Override config with CLI args
     if args.token:
-        config.api.token = args.token
+        config.set_flag('api.token', args.token)
     if args.url:
-        config.api.endpoint = args.url
+        config.set_flag('api.endpoint', args.url)
+    if args.interface:
+        config.set_flag('network.interface', args.interface)
+    if args.read_only:
+        config.set_flag('api.read_only', True)
+    if args.low_power:
+        config.set_flag('low_power.enabled', True)
     
-    # Validate configuration
-    if not config.api.token and args.command not in ['install-service', 'help']:
-        logger.error("API token required. Get one from %s/settings/api-tokens", config.api.endpoint)
-        sys.exit(1)
+    # Validate configuration; linting a local config file needs no dashboard access
+    lints_file = args.command == 'check' and getattr(args, 'target', None) and Path(args.target).expanduser().exists()
+    # With api.accounts configured, discover and sync use the accounts' tokens
+    uses_accounts = config.api.accounts and args.command in ['discover', 'sync']
+    local_commands = ['install-service', 'help', 'config', 'telemetry', 'mock-server', 'events', 'quarantine', 'ctl', 'diff',
+                      'self-update']
+    # The error budget is a local file
+    if args.command == 'nodes' and getattr(args, 'nodes_command', None) in ('dormant', 'reactivate'):
+        local_commands.append('nodes')
+    # Agents authenticate to their aggregator with a client certificate instead
+    agent_mode = bool(config.api.client_cert) and args.command != 'aggregator'
+    if not config.api.token and args.command not in local_commands and not lints_file and not uses_accounts \
+            and not agent_mode:
+        if args.interactive:
+            token = prompt_secret(f"API token (from {config.api.endpoint}/settings/api-tokens): ")
+            if token:
+                config.set_flag('api.token', token)
+        if not config.api.token:
+            logger.error("API token required. Get one from %s/settings/api-tokens", config.api.endpoint)
+            sys.exit(EXIT_CONFIG)
     
     # Route to command handlers
     try:
+        if args.record or args.replay:
+            try:
+                set_traffic(TrafficLog(args.record or args.replay, replay=bool(args.replay), logger=logger))
+            except ValueError as e:
+                raise UsageError(f"--replay: {e}")
+            logger.info("%s node API traffic %s %s", "Replaying" if args.replay else "Recording",
+                        "from" if args.replay else "to", args.record or args.replay)
+        if args.strict_parsing:
+            set_strict_parsing(True)
+        if args.strict_compat:
+            set_strict_compat(True)
+        set_output(getattr(args, 'output_format', 'text'))
+        set_satellite_filter(SatelliteFilter(config.satellites.include, config.satellites.exclude))
+        set_read_only(config.api.read_only)
+        if agent_mode:
+            try:
+                set_client_tls(client_context(config.api.client_cert, config.api.client_key, config.api.ca_file))
+            except ValueError as e:
+                raise ConfigError([f"api.client_cert: {e}"])
+        
         if args.command == 'discover':
-            asyncio.run(handle_discover(args, config, logger))
+            run(handle_discover(args, config, logger))
         elif args.command == 'sync':
-            asyncio.run(handle_sync(args, config, logger))
+            run(handle_sync(args, config, logger))
         elif args.command == 'install-service':
             handle_install_service(args, config, logger)
+        elif args.command == 'self-update':
+            run(handle_self_update(args, config, logger))
         elif args.command == 'auth':
-            asyncio.run(handle_auth(args, config, logger))
+            run(handle_auth(args, config, logger))
+        elif args.command == 'token':
+            run(handle_token(args, config, logger))
+        elif args.command == 'whoami':
+            run(handle_whoami(args, config, logger))
+        elif args.command == 'logout':
+            run(handle_logout(args, config, logger))
+        elif args.command == 'quota':
+            run(handle_quota(args, config, logger))
+        elif args.command == 'payouts':
+            run(handle_payouts(args, config, logger))
+        elif args.command == 'report':
+            run(handle_report(args, config, logger))
+        elif args.command == 'nodes':
+            run(handle_nodes(args, config, logger))
+        elif args.command == 'status':
+            run(handle_status(args, config, logger))
+        elif args.command == 'events':
+            handle_events(args, config, logger)
+        elif args.command == 'diff':
+            handle_diff(args, config, logger)
+        elif args.command == 'quarantine':
+            handle_quarantine(args, config, logger)
+        elif args.command == 'ctl':
+            handle_ctl(args, config, logger)
+        elif args.command == 'config':
+            handle_config(args, config, logger)
+        elif args.command == 'telemetry':
+            handle_telemetry(args, config, logger)
+        elif args.command == 'bench':
+            run(handle_bench(args, config, logger))
+        elif args.command == 'doctor':
+            run(handle_doctor(args, config, logger))
+        elif args.command == 'check':
+            run(handle_check(args, config, logger))
+        elif args.command == 'mock-server':
+            run(handle_mock_server(args, config, logger))
+        elif args.command == 'aggregator':
+            run(handle_aggregator(args, config, logger))
         else:
             parser.print_help()
     except KeyboardInterrupt:
         logger.info("Interrupted by user")
+        sys.exit(EXIT_INTERRUPTED)
+    except ClientError as e:
+        if getattr(args, 'json', False):
+            # stdout may already hold the command's JSON, so the error goes to stderr as one line
+            print(json.dumps({'error': e.to_dict()}, default=str), file=sys.stderr)
+        else:
+            logger.error("%s", e, extra={'error': e.to_dict()})
+        sys.exit(e.exit_code)
     except Exception as e:
         logger.error("Command failed: %s", e)
-        sys.exit(1)
+        report = write_crash_report(data_dir() / 'crash', e, {'command': args.command})
+        if report:
+            logger.error("Crash report written to %s", report)
+        errors = create_error_reporter(config, logger)
+        if errors.enabled:
+            run(errors.send(e, {'command': args.command}), deadline=False)
+        sys.exit(EXIT_ERROR)
 
 
 def create_parser() -> argparse.ArgumentParser:
@@ -77,111 +283,813 @@ def create_parser() -> argparse.ArgumentParser:
     parser.add_argument('--config', '-c', help='Config file path')
     parser.add_argument('--token', '-t', help='API token from Storj Cloud dashboard')
     parser.add_argument('--url', help='Dashboard URL (default: https://storj.cloud)')
+    parser.add_argument('--interface', metavar='NAME',
+                        help='Network interface whose address identifies this server (e.g., eth1)')
     parser.add_argument('--log-level', choices=['debug', 'info', 'warn', 'error'], help='Log level')
+    parser.add_argument('--no-color', action='store_true', help='Disable colored output')
+    parser.add_argument('--non-interactive', action='store_true',
+                        help='Never prompt, fail instead; plain stable output (for CI/Ansible)')
+    traffic_group = parser.add_mutually_exclusive_group()
+    traffic_group.add_argument('--record', metavar='DIR', help='Record node API responses to a directory')
+    traffic_group.add_argument('--replay', metavar='DIR',
+                               help='Answer node API requests from a recording instead of the nodes')
+    parser.add_argument('--strict-parsing', action='store_true',
+                        help='Reject node API responses with unexpected, missing or malformed fields')
+    parser.add_argument('--read-only', action='store_true',
+                        help='Collect and display only: never register, update or remove anything on the dashboard')
+    parser.add_argument('--strict-compat', action='store_true',
+                        help='Fail instead of warning when the dashboard requires a newer client version')
+    parser.add_argument('--deadline', metavar='DURATION',
+                        help='Stop the command after this long (e.g., 2m), reporting partial results')
+    parser.add_argument('--low-power', action='store_true',
+                        help='Minimal resource profile for small devices such as a Raspberry Pi Zero')
     
     # Subcommands
     subparsers = parser.add_subparsers(dest='command', help='Available commands')
     
     # Discover command
-    discover_parser = subparsers.add_parser('discover', help='Discover Storj nodes')
+    discover_parser = subparsers.add_parser('discover', aliases=['d'], help='Discover Storj nodes')
     discover_parser.add_argument('--from-docker', action='store_true', help='Discover from Docker containers')
     discover_parser.add_argument('--docker-host', help='Docker host (default: unix:///var/run/docker.sock)')
-    discover_parser.add_argument('--server', '-s', help='Server IP address')
-    discover_parser.add_argument('--ports', '-p', help='Custom ports (comma-separated)')
-    discover_parser.add_argument('--port-range', help='Port range (e.g., 14000-14005)')
+    discover_parser.add_argument('--server', '-s',
+                                 help='Server IP addresses, hostnames, CIDR ranges or "overlay" (comma-separated)')
+    discover_parser.add_argument('--inventory', metavar='FILE',
+                                 help='Scan the hosts of an Ansible inventory (INI or YAML) or a hosts file, '
+                                      'one per line')
+    discover_parser.add_argument('--limit', metavar='GROUP', help='Only scan the hosts of an inventory group')
+    discover_parser.add_argument('--ports', '-p', help='Ports and ranges (e.g., 14000-14100,15002,28967)')
+    discover_parser.add_argument('--port-range', help='Port range (e.g., 14000-14005), same as --ports')
     discover_parser.add_argument('--auto', action='store_true', help='Auto-detect common ports')
     discover_parser.add_argument('--timeout', type=int, default=5, help='Connection timeout')
+    discover_parser.add_argument('--incremental', action='store_true',
+                                 help='Re-check cached nodes and only rescan hosts where nodes went missing')
+    discover_parser.add_argument('--concurrency', type=int, default=DEFAULT_SCAN_CONCURRENCY,
+                                 help='Maximum ports probed at once')
     discover_parser.add_argument('--json', action='store_true', help='Output JSON')
+    discover_parser.add_argument('--output', dest='output_format', choices=OUTPUT_FORMATS, default='text',
+                                 help='jsonl: stream one JSON event per line as nodes are found and registered')
+    discover_parser.add_argument('--resume', action='store_true',
+                                 help='Register the nodes an interrupted or partly failed run left out, without scanning')
     
     # Sync command
-    sync_parser = subparsers.add_parser('sync', help='Start sync daemon')
-    sync_parser.add_argument('--interval', '-i', type=int, default=300, help='Sync interval (seconds)')
-    sync_parser.add_argument('--batch-size', type=int, default=10, help='Batch size for parallel sync')
+    sync_parser = subparsers.add_parser('sync', aliases=['s'], help='Start sync daemon')
+    sync_parser.add_argument('--interval', '-i', help='Sync interval (e.g., 300, 5m; default from config)')
+    sync_parser.add_argument('--batch-size', type=int, help='Nodes synced concurrently (default from config)')
+    sync_parser.add_argument('--max-inflight-uploads', type=int, metavar='N',
+                             help='Uploads sent to the dashboard at once (default from config)')
     sync_parser.add_argument('--retry-failed', action='store_true', help='Retry failed syncs')
+    sync_parser.add_argument('--agent', action='store_true',
+                             help='Keep a connection to the dashboard to serve on-demand refreshes')
+    sync_parser.add_argument('--once', action='store_true', help='Run one cycle and exit (e.g., from cron)')
+    sync_parser.add_argument('--dry-run', action='store_true',
+                             help='Run one cycle and print the (filtered) uploads instead of sending them')
+    sync_parser.add_argument('--debug-listen', metavar='HOST:PORT',
+                             help='Serve profiling and debug endpoints (e.g., 127.0.0.1:6060)')
+    sync_parser.add_argument('--output', dest='output_format', choices=OUTPUT_FORMATS, default='text',
+                             help='jsonl: stream one JSON event per line as cycles run and nodes are synced')
     
     # Service management
     service_parser = subparsers.add_parser('install-service', help='Install as PM2 service')
     service_parser.add_argument('--name', default='storjcloud-sync', help='Service name')
     
+    # Updates
+    update_parser = subparsers.add_parser('self-update', help='Update the client to the latest release')
+    update_parser.add_argument('--check', action='store_true', help='Only report whether an update is available')
+    update_parser.add_argument('--allow-unsigned', action='store_true',
+                               help='Install with only the checksum verified when update.public_key is not set')
+    update_parser.add_argument('--yes', '-y', action='store_true', help='Do not ask for confirmation')
+    update_parser.add_argument('--json', action='store_true', help='Output JSON (with --check)')
+    
+    # Shell completion
+    completion_parser = subparsers.add_parser('completion', help='Print a shell completion script')
+    completion_parser.add_argument('shell', choices=SHELLS, help='Shell to complete for')
+    
     # Auth testing
     auth_parser = subparsers.add_parser('auth', help='Test authentication')
     
+    # Credentials
+    whoami_parser = subparsers.add_parser('whoami', help='Show the account the API token belongs to')
+    whoami_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    subparsers.add_parser('logout', help='Revoke the API token and remove it from the config file')
+    
+    quota_parser = subparsers.add_parser('quota', help='Show the dashboard account limits and usage')
+    quota_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Token management
+    token_parser = subparsers.add_parser('token', help='Manage the API token')
+    token_subparsers = token_parser.add_subparsers(dest='token_command', help='Token commands')
+    
+    rotate_parser = token_subparsers.add_parser('rotate', help='Replace the API token with a new one')
+    rotate_parser.add_argument('--name', help='Name of the new token (default: storjcloud-client@HOSTNAME)')
+    rotate_parser.add_argument('--keep-old', action='store_true',
+                               help='Do not revoke the old token (e.g., other servers still use it)')
+    
+    # Payout estimates
+    payouts_parser = subparsers.add_parser('payouts', help='Show payout estimates')
+    payouts_parser.add_argument('--currency', help='Fiat currency for conversion (e.g., EUR)')
+    payouts_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Monthly report
+    report_parser = subparsers.add_parser('report', help='Generate monthly earnings report')
+    report_parser.add_argument('--month', required=True, help='Report month (YYYY-MM)')
+    report_parser.add_argument('--format', choices=['html', 'csv', 'json'], default='html',
+                               help='Report format')
+    report_parser.add_argument('--output', '-o', help='Output file (default: storj-report-<month>.<format>)')
+    report_parser.add_argument('--currency', help='Fiat currency for conversion (e.g., EUR)')
+    
+    # Node status
+    status_parser = subparsers.add_parser('status', aliases=['st'], help='Show status of registered nodes')
+    status_parser.add_argument('--watch', '-w', action='store_true', help='Refresh the table in place')
+    status_parser.add_argument('--interval', default='10s', help='Watch refresh interval (e.g., 10s)')
+    status_parser.add_argument('--json', action='store_true', help='Output JSON')
+    status_parser.add_argument('--output', dest='output_format', choices=OUTPUT_FORMATS, default='text',
+                               help='jsonl: stream one JSON event per line for each node whose status changed')
+    
+    # Configuration inspection
+    config_parser = subparsers.add_parser('config', help='Inspect configuration')
+    config_subparsers = config_parser.add_subparsers(dest='config_command', help='Config commands')
+    
+    env_parser = config_subparsers.add_parser('env', help='List recognized environment variables')
+    env_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    passphrase_help = f'Encrypt with a passphrase ({PASSPHRASE_ENV}, or asked for) instead of the machine key'
+    encrypt_parser = config_subparsers.add_parser('encrypt', help="Encrypt the config file's secret values")
+    encrypt_parser.add_argument('--passphrase', action='store_true', help=passphrase_help)
+    config_subparsers.add_parser('decrypt', help="Write the config file's encrypted values back in plaintext")
+    encrypt_value_parser = config_subparsers.add_parser('encrypt-value',
+                                                        help='Print an encrypted value to paste into the config file')
+    encrypt_value_parser.add_argument('--passphrase', action='store_true', help=passphrase_help)
+    
+    # Telemetry
+    telemetry_parser = subparsers.add_parser('telemetry', help='Inspect opt-in anonymous telemetry')
+    telemetry_subparsers = telemetry_parser.add_subparsers(dest='telemetry_command', help='Telemetry commands')
+    telemetry_subparsers.add_parser('show', help='Print exactly what would be sent')
+    
+    # Benchmarking
+    bench_parser = subparsers.add_parser('bench', help='Measure latency to the dashboard and nodes')
+    bench_parser.add_argument('--iterations', '-n', type=int, default=20, help='Requests per target')
+    bench_parser.add_argument('--concurrency', type=int, default=1, help='Concurrent requests per target')
+    bench_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Setup diagnostics
+    doctor_parser = subparsers.add_parser('doctor', help='Diagnose node setup problems')
+    doctor_parser.add_argument('--timeout', type=int, default=3, help='Gateway discovery timeout')
+    doctor_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Storagenode configuration checks
+    check_parser = subparsers.add_parser('check', help='Check storagenode configuration')
+    check_subparsers = check_parser.add_subparsers(dest='check_command', help='Check commands')
+    
+    check_config_parser = check_subparsers.add_parser('config', help='Lint storagenode settings')
+    check_config_parser.add_argument('target', nargs='?',
+                                     help='config.yaml path or node (name or node ID prefix); default all nodes')
+    check_config_parser.add_argument('--docker-host', help='Docker host (default: unix:///var/run/docker.sock)')
+    check_config_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Local dashboard for testing
+    mock_parser = subparsers.add_parser('mock-server', help='Run an in-memory mock of the dashboard API')
+    mock_parser.add_argument('--listen', default='127.0.0.1:8080', help='Address to listen on (default: 127.0.0.1:8080)')
+    mock_parser.add_argument('--accept-token', action='append', default=[], metavar='TOKEN',
+                             help='Only accept this API token (repeatable; default: any token)')
+    mock_parser.add_argument('--signing-secret', help='Require uploads signed with this secret')
+    
+    # Aggregator in front of the dashboard for agents
+    aggregator_parser = subparsers.add_parser('aggregator',
+                                              help='Receive uploads from agents over mTLS and forward them')
+    aggregator_parser.add_argument('--listen', help='Address to listen on (default: aggregator.listen)')
+    
+    # Event timeline
+    events_parser = subparsers.add_parser('events', help='Show the timeline of node events')
+    events_subparsers = events_parser.add_subparsers(dest='events_command', help='Event commands')
+    events_list_parser = events_subparsers.add_parser('list', help='List recorded node events')
+    events_list_parser.add_argument('--node', help='Only this node (name, nickname or node ID prefix)')
+    events_list_parser.add_argument('--since', default='7d', help='How far back to list (e.g., 24h, 30d)')
+    events_list_parser.add_argument('--kind', action='append', choices=EVENT_KINDS,
+                                    help='Only events of this kind (repeatable)')
+    events_list_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Fleet changes between two points in local history
+    diff_parser = subparsers.add_parser('diff', help='Show what changed across the fleet between two points in time')
+    diff_parser.add_argument('--from', dest='start', default='yesterday',
+                             help='Earlier point: now, today, yesterday, a duration ago (12h) or a date '
+                                  '(2024-01-31T08:00), default yesterday')
+    diff_parser.add_argument('--to', dest='end', default='now', help='Later point, default now')
+    diff_parser.add_argument('--window', default=f'{DEFAULT_WINDOW // 60}m',
+                             help='How long before each point a node must have been sampled to count as present')
+    diff_parser.add_argument('--all', action='store_true', help='Also list nodes whose only change is used space')
+    diff_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    # Implausible samples held back by the sync daemon
+    quarantine_parser = subparsers.add_parser('quarantine', help='Inspect samples quarantined as implausible')
+    quarantine_subparsers = quarantine_parser.add_subparsers(dest='quarantine_command', help='Quarantine commands')
+    quarantine_list_parser = quarantine_subparsers.add_parser('list', help='List quarantined samples')
+    quarantine_list_parser.add_argument('--node', help='Only this node (name or node ID prefix)')
+    quarantine_list_parser.add_argument('--json', action='store_true', help='Output JSON, with the quarantined data')
+    quarantine_clear_parser = quarantine_subparsers.add_parser('clear', help='Remove quarantined samples')
+    quarantine_clear_parser.add_argument('--node', help='Only this node (name or node ID prefix)')
+    
+    # Control of the running sync daemon
+    ctl_parser = subparsers.add_parser('ctl', help='Control the running sync daemon')
+    ctl_subparsers = ctl_parser.add_subparsers(dest='ctl_command', help='Control commands')
+    ctl_subparsers.add_parser('sync-now', help='Start a sync cycle now instead of at the next interval')
+    
+    # Node management
+    nodes_parser = subparsers.add_parser('nodes', help='Inspect registered nodes')
+    nodes_subparsers = nodes_parser.add_subparsers(dest='nodes_command', help='Node commands')
+    
+    remove_parser = nodes_subparsers.add_parser('remove', help='Remove nodes from the dashboard')
+    remove_parser.add_argument('--stale', action='store_true',
+                               help='Remove nodes no longer found by discovery')
+    remove_parser.add_argument('--older-than', default='0s',
+                               help='Only nodes last seen longer ago than this (e.g., 7d)')
+    remove_parser.add_argument('--yes', '-y', action='store_true', help='Do not ask for confirmation')
+    
+    compare_parser = nodes_subparsers.add_parser('compare', help='Compare two nodes side by side')
+    compare_parser.add_argument('node_a', help='First node (name or node ID prefix)')
+    compare_parser.add_argument('node_b', help='Second node (name or node ID prefix)')
+    compare_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    rename_parser = nodes_subparsers.add_parser('rename', help='Give a node a local nickname')
+    rename_parser.add_argument('node', help='Node (name, nickname or node ID prefix)')
+    rename_parser.add_argument('nickname', nargs='?', help='New nickname (omit to remove it)')
+    
+    annotate_parser = nodes_subparsers.add_parser('annotate', help='Attach notes and metadata to a node')
+    annotate_parser.add_argument('node', help='Node (name, nickname or node ID prefix)')
+    annotate_parser.add_argument('--note', help='Replace the notes ("" removes them)')
+    annotate_parser.add_argument('--set', action='append', default=[], metavar='KEY=VALUE',
+                                 help='Set a metadata key (repeatable)')
+    annotate_parser.add_argument('--unset', action='append', default=[], metavar='KEY',
+                                 help='Remove a metadata key (repeatable)')
+    annotate_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    maintenance_parser = nodes_subparsers.add_parser('maintenance',
+                                                     help='Put a node under maintenance, silencing its alerts')
+    maintenance_parser.add_argument('node', help='Node (name, nickname or node ID prefix)')
+    maintenance_group = maintenance_parser.add_mutually_exclusive_group()
+    maintenance_group.add_argument('--for', dest='duration', help='Length of the maintenance (e.g., 4h)')
+    maintenance_group.add_argument('--end', action='store_true', help='End the maintenance now')
+    maintenance_parser.add_argument('--reason', help='Why the node is under maintenance')
+    
+    dormant_parser = nodes_subparsers.add_parser('dormant', help='List nodes polled less often or not at all '
+                                                                 'after repeated failures')
+    dormant_parser.add_argument('--json', action='store_true', help='Output JSON')
+    
+    reactivate_parser = nodes_subparsers.add_parser('reactivate',
+                                                    help='Poll a dormant or backing-off node every cycle again')
+    reactivate_target = reactivate_parser.add_mutually_exclusive_group(required=True)
+    reactivate_target.add_argument('node', nargs='?', help='Node (name or node ID prefix)')
+    reactivate_target.add_argument('--all', action='store_true', help='Every dormant or backing-off node')
+    
     return parser
 
 
 async def handle_discover(args, config: Config, logger):
     """Handle discover command"""
+    if args.json and args.output_format == 'jsonl':
+        raise UsageError("--json cannot be combined with --output jsonl")
+    journal = RegistrationJournal(data_dir() / 'registration.json', logger)
+    if args.resume:
+        if read_only():
+            raise ReadOnlyError("discover --resume registers nodes, which read-only mode forbids")
+        if not journal.load():
+            raise UsageError("No interrupted registration to resume")
+        pending = journal.pending()
+        logger.info("Resuming registration of %d nodes", sum(len(nodes) for nodes in pending.values()))
+        await register_groups(config, logger, pending, journal)
+        return
+    
     logger.info("Starting node discovery...")
     
     discovered_nodes = []
+    scanned_hosts = set()
+    timed_out = None
+    
+    # Each node is registered with the account its server or tags map to, as soon as it is found
+    accounts = load_accounts(config)
+    by_name = {account.name: account for account in accounts}
+    pipeline = RegistrationPipeline(journal, lambda nodes: assign_nodes(nodes, accounts),
+                                    lambda name: create_auth_manager(config, get_logger('api'), by_name[name]),
+                                    logger=logger)
+    # Read-only mode discovers and lists nodes without registering them
+    submit = pipeline.submit if not read_only() else lambda nodes: None
     
     if args.from_docker:
         # Docker-based discovery
         docker_host = args.docker_host or config.discovery.docker_host
-        discovery = DockerDiscovery(docker_host, logger)
+        discovery = DockerDiscovery(docker_host, get_logger('discovery'))
         docker_nodes = await discovery.discover_nodes()
+        for node in docker_nodes:
+            emit_node_found(node, 'docker')
+        submit(docker_nodes)
         discovered_nodes.extend(docker_nodes)
+        scanned_hosts.add('127.0.0.1')
         logger.info("Found %d nodes from Docker", len(docker_nodes))
     
-    if args.ports or args.port_range or args.auto:
+    if args.ports or args.port_range or args.auto or args.incremental or args.inventory:
         # Port-based discovery
-        server_ip = args.server or '127.0.0.1'
-        scanner = PortScanner(server_ip, args.timeout, logger)
+        try:
+            hosts = expand_hosts(args.server) if args.server else []
+        except ValueError as e:
+            raise UsageError(f"--server: {e}")
+        host_tags = {}
+        if args.inventory:
+            try:
+                inventory = load_inventory(args.inventory)
+                names = inventory.hosts(args.limit)
+            except ValueError as e:
+                raise UsageError(f"--inventory: {e}")
+            for name in names:
+                address = inventory.addresses[name]
+                host_tags.setdefault(address, []).extend(inventory.tags(name))
+            hosts = list(dict.fromkeys(hosts + list(host_tags)))
+            logger.info("Scanning %d hosts from %s", len(names), args.inventory)
+        elif args.limit:
+            raise UsageError("--limit needs --inventory")
+        hosts = hosts or ['127.0.0.1']
+        if args.concurrency < 1:
+            raise UsageError("--concurrency must be ≥ 1")
+        
+        # Explicit ports apply to every host, otherwise hub.servers may set a server's own
+        host_ports = {}
+        try:
+            if args.ports or args.port_range:
+                ports = parse_ports(args.ports or args.port_range)
+            else:  # auto
+                ports = config.discovery.common_ports
+                scan_ports = create_server_pool(config, logger).scan_ports()
+                host_ports = {host: scan_ports[host] for host in hosts if host in scan_ports}
+        except ValueError as e:
+            raise UsageError(f"--{'ports' if args.ports else 'port-range'}: {e}")
+        
+        cache = DiscoveryCache(data_dir() / 'cache' / 'discovery.json', get_logger('discovery'))
+        cached = [node for node in cache.load() if node.get('address') in hosts]
+        incremental = args.incremental and bool(cached)
+        if args.incremental and not cached:
+            logger.info("No cached discovery results for these hosts, running a full scan")
+        
+        if incremental:
+            # Cached endpoints are re-checked, hosts without any are scanned in full
+            known_hosts = {node['address'] for node in cached}
+            total_hosts = len(hosts)
+            total_probes = len(cached) + sum(len(host_ports.get(host, ports)) for host in hosts
+                                             if host not in known_hosts)
+        else:
+            total_hosts, total_probes = len(hosts), sum(len(host_ports.get(host, ports)) for host in hosts)
+        emit('scan_started', hosts=total_hosts, probes=total_probes, incremental=incremental)
+        
+        # Live progress only for interactive, human-readable runs
+        progress = None
+        if args.interactive and not args.json and sys.stderr.isatty():
+            progress = ScanProgress(total_hosts, total_probes)
         
-        if args.ports:
-            ports = [int(p.strip()) for p in args.ports.split(',')]
-        elif args.port_range:
-            start, end = map(int, args.port_range.split('-'))
-            ports = list(range(start, end + 1))
-        else:  # auto
-            ports = config.discovery.common_ports
+        # Nodes found so far, the result of a scan cut short by --deadline
+        scanned = []
         
-        port_nodes = await scanner.scan_ports(ports)
+        def found(nodes: List[Dict]):
+            # Tagged before registration, so inventory groups can pick the account
+            for node in nodes:
+                tags = host_tags.get(node['address']) or host_tags.get(node.get('resolved_address'))
+                if tags:
+                    node['tags'] = list(dict.fromkeys(node.get('tags', []) + tags))
+                emit_node_found(node, 'scan')
+            scanned.extend(nodes)
+            submit(nodes)
+        
+        try:
+            if incremental:
+                port_nodes = await within_deadline(incremental_scan(
+                    hosts, ports, cached, args.timeout, get_logger('discovery'), progress=progress,
+                    concurrency=args.concurrency, host_ports=host_ports, on_nodes=found))
+            else:
+                port_nodes = await within_deadline(scan_hosts(
+                    hosts, ports, args.timeout, get_logger('discovery'), progress=progress,
+                    concurrency=args.concurrency, host_ports=host_ports, on_nodes=found))
+        except DeadlineExceeded:
+            port_nodes = scanned
+            timed_out = deadline_error(f"the scan was stopped after finding {len(scanned)} nodes")
+        finally:
+            if progress:
+                progress.finish()
+        # A partial scan must neither replace the cache nor make unreached nodes look missing
+        if not timed_out:
+            cache.save(port_nodes, hosts)
+            scanned_hosts.update(hosts)
         discovered_nodes.extend(port_nodes)
         logger.info("Found %d nodes from port scanning", len(port_nodes))
     
+    await report_missing_nodes(config, logger, discovered_nodes, scanned_hosts)
+    
     if not discovered_nodes:
-        logger.warning("No nodes discovered")
-        return
+        raise timed_out or NoNodesFound("No nodes discovered")
     
-    # Remove duplicates based on node ID
+    # Remove duplicates based on node ID, keeping the node as submitted for registration
     unique_nodes = {}
     for node in discovered_nodes:
-        unique_nodes[node['node_id']] = node
+        unique_nodes.setdefault(node['node_id'], node)
     
     discovered_nodes = list(unique_nodes.values())
     logger.info("Total unique nodes found: %d", len(discovered_nodes))
+    emit('discover_finished', nodes=len(discovered_nodes))
     
     # Output results
     if args.json:
         print(json.dumps(discovered_nodes, indent=2, default=str))
     else:
         for node in discovered_nodes:
-            logger.info("Node %s on %s:%d (Status: %s, Used: %.2f GB)",
+            resolved = node.get('resolved_address')
+            logger.info("Node %s on %s:%d%s (Status: %s, Used: %.2f GB)",
                        node['node_id'][:8], node['address'], node['dashboard_port'],
+                       f" ({resolved})" if resolved and resolved != node['address'] else '',
                        node['status'], node['disk_space']['used'] / 1e9)
+            for satellite in node.get('critical_satellites', []):
+                logger.critical("Node %s is %s on satellite %s since %s",
+                                node['node_id'][:8], satellite['state'],
+                                satellite['url'] or satellite['id'], satellite['since'])
     
-    # Register with dashboard
-    auth = AuthManager(config.api.token, config.api.endpoint)
-    registered = await auth.register_nodes(discovered_nodes)
-    logger.info("Successfully registered %d nodes with dashboard", registered)
+    unassigned = pipeline.unassigned
+    if unassigned:
+        logger.warning("%d nodes match no account and are not registered: %s",
+                       len(unassigned), ', '.join(node.get('name') or node['node_id'][:8] for node in unassigned))
+    
+    if read_only():
+        logger.info("Read-only mode: not registering the %d discovered nodes", len(discovered_nodes))
+        if timed_out:
+            raise timed_out
+        return
+    if not pipeline.submitted:
+        raise ClientError(f"None of the {len(discovered_nodes)} discovered nodes can be registered")
+    try:
+        results = await pipeline.finish()
+    except NetworkError as e:
+        left = sum(len(nodes) for nodes in journal.pending().values())
+        # Re-raised as is, so the exit code still tells a rate limit from an outage
+        e.args = (f"{e}; run 'discover --resume' to register the remaining {left} nodes",)
+        raise
+    report_registration(logger, results, journal, len(accounts) > 1)
+    if timed_out:
+        raise timed_out
+
+
+def emit_node_found(node: Dict, source: str):
+    emit('node_found', node_id=node['node_id'], name=node.get('name'), address=node['address'],
+         port=node['dashboard_port'], status=node.get('status'), source=source, tags=node.get('tags'))
+
+
+async def register_groups(config: Config, logger, groups: Dict[str, List[Dict]], journal: RegistrationJournal):
+    """Register nodes with their accounts, recording progress in the journal"""
+    accounts = load_accounts(config)
+    by_name = {account.name: account for account in accounts}
+    results = []
+    for name, nodes in groups.items():
+        account = by_name.get(name)
+        if not account:
+            logger.warning("Account %s is no longer configured, skipping its %d nodes", name, len(nodes))
+            continue
+        auth = create_auth_manager(config, get_logger('api'), account)
+        try:
+            results.extend(await auth.register_nodes(nodes, on_chunk=journal.record))
+        except NetworkError as e:
+            left = sum(len(nodes) for nodes in journal.pending().values())
+            e.args = (f"{e}; run 'discover --resume' to register the remaining {left} nodes",)
+            raise
+    report_registration(logger, results, journal, len(accounts) > 1)
+
+
+def report_registration(logger, results: List[Dict], journal: RegistrationJournal, per_account: bool):
+    """Summarize a registration, raising unless every journaled node is registered"""
+    if per_account:
+        for name in sorted({entry['account'] for entry in journal.entries.values()}):
+            entries = [entry for entry in journal.entries.values() if entry['account'] == name]
+            done = sum(1 for entry in entries if entry['status'] in REGISTRATION_DONE)
+            logger.info("Registered %d of %d nodes with account %s", done, len(entries), name)
+    
+    counts = {status: sum(1 for result in results if result['status'] == status)
+              for status in (REGISTERED, UPDATED, FAILED)}
+    logger.info("Registered %d new and updated %d existing nodes with dashboard",
+                counts[REGISTERED], counts[UPDATED])
+    for result in results:
+        emit('node_registered' if result['status'] != FAILED else 'registration_failed',
+             node_id=result['node_id'], name=result['name'], status=result['status'], reason=result.get('error'),
+             error=result.get('error_kind'))
+        if result['status'] == FAILED:
+            logger.error("Not registered: %s (%s): %s", result['name'] or '-', result['node_id'][:8], result['error'])
+    
+    total = len(journal.entries)
+    registered = sum(1 for entry in journal.entries.values() if entry['status'] in REGISTRATION_DONE)
+    if journal.finish():
+        return
+    if registered == 0:
+        raise ClientError(f"Failed to register any of {total} nodes; retry with 'discover --resume'")
+    raise PartialSuccess(f"Registered only {registered} of {total} nodes; retry the rest with 'discover --resume'")
+
+
+async def report_missing_nodes(config: Config, logger, nodes: List[Dict], scanned_hosts):
+    """Record discovered nodes and alert on known nodes no longer found"""
+    if not config.history.enabled:
+        return
+    
+    now = time.time()
+    store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    try:
+        missing = store.record_sightings(nodes, scanned_hosts, ts=now)
+    finally:
+        store.close()
+    
+    alerts = AlertManager(
+        webhook_url=config.alerts.webhook_url,
+        enabled=config.alerts.enabled,
+        timeout=config.alerts.timeout,
+        logger=logger
+    )
+    for node in missing:
+        message = (f"node {node['name'] or node['node_id'][:12]} last seen "
+                   f"{format_age(now - node['last_seen'])} ago on host {node['address']} "
+                   f"port {node['dashboard_port']}")
+        if node['missing_since'] != now:
+            logger.warning("Still missing: %s", message)
+            continue
+        await alerts.notify(Alert(
+            node_id=node['node_id'],
+            node_name=node['name'],
+            kind='node_missing',
+            severity='warning',
+            title=f"Node {node['name'] or node['node_id'][:12]} not found",
+            message=message,
+            details={'address': node['address'], 'dashboardPort': node['dashboard_port'],
+                     'lastSeen': node['last_seen']},
+        ))
+    if missing:
+        logger.info("Run 'nodes remove --stale' to remove nodes that are gone for good")
 
 
 async def handle_sync(args, config: Config, logger):
     """Handle sync command"""
-    logger.info("Starting sync daemon...")
-    logger.info("Sync interval: %d seconds", args.interval)
-    
-    sync_service = NodeSync(
-        config.api.token,
-        config.api.endpoint,
-        args.interval,
-        args.batch_size,
-        args.retry_failed,
-        logger
+    low_power = config.low_power.enabled
+    if low_power:
+        apply_profile(config)
+        logger.info("Low-power profile: one node at a time, skipping %s",
+                    ', '.join(config.low_power.skip) or 'no collectors')
+    interval = config.sync.interval
+    if args.interval:
+        try:
+            interval = parse_duration(args.interval)
+        except ValueError as e:
+            raise UsageError(str(e))
+        if interval < DURATION_FIELDS['sync.interval']:
+            raise UsageError(f"--interval must be ≥ {DURATION_FIELDS['sync.interval']}s")
+    batch_size = args.batch_size or config.sync.batch_size
+    if args.max_inflight_uploads is not None:
+        if args.max_inflight_uploads < 1:
+            raise UsageError("--max-inflight-uploads must be ≥ 1")
+        config.set_flag('sync.max_inflight_uploads', args.max_inflight_uploads)
+    if args.dry_run and args.agent:
+        raise UsageError("--dry-run cannot be combined with --agent")
+    if args.once and args.agent:
+        raise UsageError("--once cannot be combined with --agent")
+    if args.dry_run and args.output_format == 'jsonl':
+        raise UsageError("--dry-run prints its uploads as JSON and cannot be combined with --output jsonl")
+    
+    if args.dry_run:
+        logger.info("Dry run: printing one cycle of uploads instead of sending them")
+    elif args.once:
+        logger.info("Running one sync cycle")
+    else:
+        logger.info("Starting sync daemon...")
+        logger.info("Sync interval: %d seconds", interval)
+    if read_only() and not args.dry_run:
+        logger.warning("Read-only mode: collecting without uploading anything to the dashboard")
+    
+    # A dry run sends nothing: no alerts, telemetry or history samples
+    alerts = AlertManager(
+        webhook_url=config.alerts.webhook_url,
+        enabled=config.alerts.enabled and not args.dry_run,
+        timeout=config.alerts.timeout,
+        logger=get_logger('alerts'),
+        network_status=create_network_status(config) if not args.dry_run else None,
     )
     
-    await sync_service.start()
+    telemetry = create_telemetry(config, logger) if not args.dry_run else None
+    
+    store = None
+    if config.history.enabled and not args.dry_run:
+        store = HistoryStore(config.history_path, config.history.retention_days, get_logger('history'))
+    
+    fields = create_field_filter(config)
+    pseudonyms = create_pseudonymizer(config, logger)
+    annotations = create_annotations(logger)
+    servers = create_server_pool(config, logger)
+    # A dry run must not count failures towards making nodes dormant
+    budget = create_error_budget(config, logger) if not args.dry_run else None
+    
+    # One sync service per dashboard account, sharing alerts, history and the trust list
+    accounts = load_accounts(config)
+    multi = len(accounts) > 1
+    trust = create_trust_list(config, logger)
+    errors = create_error_reporter(config, logger)
+    address = get_server_address(config)
+    # Sinks other than the dashboard are shared by all accounts
+    shared_sinks = create_local_sinks(config, logger)
+    if config.tracing.enabled:
+        setup_tracing(config.tracing.endpoint, config.tracing.service_name, logger)
+    services = []
+    for account in accounts:
+        suffix = '' if account.name == DEFAULT_ACCOUNT else f'-{account.name}'
+        account_logger = get_logger('sync').getChild(account.name) if multi else get_logger('sync')
+        services.append(NodeSync(
+            account.token,
+            account.endpoint,
+            interval,
+            batch_size,
+            args.retry_failed or config.sync.retry_failed,
+            account_logger,
+            alerts=alerts,
+            store=store,
+            # Usage is reported once for the whole client
+            telemetry=telemetry if not services else None,
+            disk_full_days=config.alerts.disk_full_days,
+            unknown_audit_days=config.alerts.unknown_audit_days,
+            health_weights=config.health.weights,
+            health_alert_below=config.health.alert_below,
+            servers=servers,
+            backpressure_threshold=config.sync.backpressure_threshold,
+            backpressure=config.sync.backpressure,
+            startup_jitter=config.sync.startup_jitter,
+            align_phase=config.sync.phase_offset,
+            jitter_seed=config.sync.jitter_seed,
+            quarantine=create_quarantine(account_logger) if not args.dry_run else None,
+            storage_probe=config.sync.storage_probe,
+            storage_latency_factor=config.alerts.storage_latency_factor,
+            static_ttl=config.sync.static_ttl,
+            budget=budget,
+            drain_timeout=config.sync.drain_timeout,
+            low_power=low_power,
+            skip_collectors=config.low_power.skip if low_power else (),
+            memory_target=config.low_power.memory_target,
+            state=DaemonState(data_dir() / f'sync-state{suffix}.json', account_logger).load(),
+            sinks=None if args.dry_run else account_sinks(config, account, shared_sinks, account_logger),
+            crash_dir=data_dir() / 'crash',
+            dump_dir=data_dir() / 'dumps',
+            trust=trust,
+            account=account.name if multi else None,
+            handle_signals=not multi,
+            errors=errors,
+            fields=fields,
+            dry_run=args.dry_run,
+            pseudonyms=pseudonyms,
+            server_address=address,
+            annotations=annotations,
+            once=args.once
+        ))
+    if multi:
+        logger.info("Syncing %d accounts: %s", len(accounts), ', '.join(account.name for account in accounts))
+        if hasattr(signal, 'SIGUSR1'):
+            asyncio.get_running_loop().add_signal_handler(
+                signal.SIGUSR1, lambda: [service.dump_state() for service in services])
+            asyncio.get_running_loop().add_signal_handler(
+                SYNC_NOW_SIGNAL, lambda: [service.sync_now() for service in services])
+            asyncio.get_running_loop().add_signal_handler(
+                signal.SIGTERM, lambda: [service.shutdown() for service in services])
+    
+    def snapshot():
+        if not multi:
+            return services[0].snapshot()
+        return {service.account: service.snapshot() for service in services}
+    
+    def health():
+        reports = [service.health() for service in services]
+        if not multi:
+            return reports[0]
+        return {
+            'upload_queue': sum(report['upload_queue'] for report in reports),
+            'backpressured': any(report['backpressured'] for report in reports),
+            'accounts': {service.account: report for service, report in zip(services, reports)},
+        }
+    
+    debug_server = None
+    if args.debug_listen:
+        try:
+            debug_server = DebugServer(args.debug_listen, snapshot, logger, health)
+        except ValueError as e:
+            raise UsageError(f"--debug-listen: {e}")
+        await debug_server.start()
+    
+    agent_tasks = []
+    if args.agent:
+        agent_tasks = [asyncio.create_task(AgentConnection(service, get_logger('agent')).run()) for service in services]
+    
+    # --deadline stops the daemon like SIGTERM, draining in the time left
+    expired = False
+    
+    def expire():
+        nonlocal expired
+        expired = True
+        logger.warning("Deadline of %s reached, stopping", args.deadline)
+        for service in services:
+            service.drain_timeout = min(service.drain_timeout, time_left(grace=False))
+            service.shutdown()
+    
+    deadline_timer = None
+    if time_left() is not None:
+        deadline_timer = asyncio.get_running_loop().call_later(time_left(), expire)
+    
+    # ctl commands find the daemon through its PID file; a single cycle is not a daemon
+    pid_file = PidFile(data_dir() / 'sync.pid', logger) if not args.dry_run and not args.once else None
+    if pid_file:
+        pid_file.write()
+    try:
+        await asyncio.gather(*(service.start() for service in services))
+        if expired:
+            raise deadline_error("the sync daemon was stopped")
+        if args.once:
+            report_cycle(services)
+    finally:
+        if deadline_timer:
+            deadline_timer.cancel()
+        if pid_file:
+            pid_file.remove()
+        for task in agent_tasks:
+            task.cancel()
+        if debug_server:
+            await debug_server.stop()
+        await errors.flush()
+        await asyncio.to_thread(shutdown_tracing)
+
+
+def report_cycle(services: List[NodeSync]):
+    """Raise the error of a single sync cycle (sync --once) unless every node synced"""
+    failures = sorted((service.cycle_error for service in services if service.cycle_error),
+                      key=lambda error: not isinstance(error, AuthError))
+    if failures:
+        raise failures[0]
+    synced = sum(service.cycle_counts.get('synced', 0) for service in services)
+    failed = sum(service.cycle_counts.get('failed', 0) for service in services)
+    if failed and not synced:
+        raise ClientError(f"None of the {failed} nodes synced; see the log for why")
+    if failed:
+        raise PartialSuccess(f"Synced {synced} nodes, {failed} failed")
+
+
+async def handle_self_update(args, config: Config, logger):
+    """Check for a newer release and install it in place of this installation"""
+    updater = Updater(config.update.endpoint, config.update.timeout, logger)
+    try:
+        release = await updater.latest()
+        newer = parse_version(release['version']) > parse_version(__version__)
+    except (aiohttp.ClientError, asyncio.TimeoutError) as e:
+        raise NetworkError(f"Cannot reach the release endpoint: {e}")
+    except ValueError as e:
+        raise ClientError(f"Cannot check for updates: {e}")
+    archive = select_archive(release)
+    
+    if args.check:
+        if args.json:
+            print(json.dumps({'current': __version__, 'latest': release['version'], 'updateAvailable': newer,
+                              'archive': archive, 'url': release['url']}, indent=2))
+        elif newer:
+            print(f"Version {release['version']} is available (installed: {__version__}): {release['url']}")
+        else:
+            print(f"Version {__version__} is the latest release")
+        return
+    if not newer:
+        logger.info("Version %s is the latest release", __version__)
+        return
+    
+    install_dir = Path(__file__).resolve().parent
+    if (install_dir / '.git').exists():
+        raise UsageError(f"{install_dir} is a git checkout; update it with git pull")
+    if not archive:
+        raise ClientError(f"Release {release['version']} has no archive for {platform_tag()}")
+    if not config.update.public_key and not args.allow_unsigned:
+        raise UsageError("Set update.public_key to the release signing key to verify releases, "
+                         "or pass --allow-unsigned to rely on the checksum alone")
+    if args.interactive and not args.yes and not confirm(
+            f"Update {install_dir} from {__version__} to {release['version']}?"):
+        logger.info("Update cancelled")
+        return
+    
+    try:
+        data, checksums, signature = await updater.fetch(release, archive, bool(config.update.public_key))
+        if config.update.public_key:
+            verify_signature(checksums, signature, config.update.public_key)
+        else:
+            logger.warning("update.public_key is not set: %s is verified by its checksum only", archive)
+        verify_checksum(archive, data, checksums)
+    except (aiohttp.ClientError, asyncio.TimeoutError) as e:
+        raise NetworkError(f"Cannot download release {release['version']}: {e}")
+    except ValueError as e:
+        raise ClientError(f"Release {release['version']} failed verification, nothing was changed: {e}")
+    
+    requirements = install_dir / 'requirements.txt'
+    old_requirements = requirements.read_bytes() if requirements.exists() else b''
+    try:
+        previous = install(data, install_dir)
+    except (OSError, ValueError, tarfile.TarError) as e:
+        raise ClientError(f"Cannot install release {release['version']}, nothing was changed: {e}")
+    logger.info("Updated to %s; the previous version is kept in %s", release['version'], previous)
+    if requirements.exists() and requirements.read_bytes() != old_requirements:
+        logger.warning("Dependencies changed: run pip3 install -r %s", requirements)
+    logger.info("Restart running services to use the new version (e.g. pm2 restart storjcloud-sync)")
 
 
 def handle_install_service(args, config: Config, logger):
@@ -190,23 +1098,38 @@ def handle_install_service(args, config: Config, logger):
     
     pm2 = PM2Manager(logger)
     
+    # An encrypted token stays in the config file, which the service decrypts when it starts;
+    # the ecosystem file would otherwise hold it in plaintext
+    encrypted = config.source_of('api.token') == 'file' and config.encrypted.get('api.token')
+    if encrypted:
+        service_args = f'--config {os.path.abspath(config.config_file)} sync'
+        env = {'STORJCLOUD_DASHBOARD_URL': config.api.endpoint}
+        if encrypted == PASSPHRASE:
+            logger.warning("The service needs %s in its environment to decrypt the config", PASSPHRASE_ENV)
+    else:
+        service_args = f'sync --token {config.api.token}'
+        env = {
+            'STORJCLOUD_API_TOKEN': config.api.token,
+            'STORJCLOUD_DASHBOARD_URL': config.api.endpoint,
+        }
+    
     # Create service configuration
     service_config = {
         'name': args.name,
         'script': os.path.abspath(__file__),
-        'args': f'sync --token {config.api.token}',
+        'args': service_args,
         'cwd': os.getcwd(),
-        'env': {
-            'STORJCLOUD_API_TOKEN': config.api.token,
-            'STORJCLOUD_DASHBOARD_URL': config.api.endpoint,
-        },
+        'env': env,
         'error_file': f'/var/log/{args.name}-error.log',
         'out_file': f'/var/log/{args.name}-out.log',
         'log_file': f'/var/log/{args.name}.log',
         'time': True,
         'autorestart': True,
         'watch': False,
-        'max_memory_restart': '200M'
+        'max_memory_restart': '200M',
+        # PM2 stops with SIGINT and kills after 1.6s by default, cutting a cycle short
+        'kill_signal': 'SIGTERM',
+        'kill_timeout': int((config.sync.drain_timeout + 10) * 1000)
     }
     
     pm2.install_service(service_config)
@@ -214,6 +1137,1106 @@ def handle_install_service(args, config: Config, logger):
     logger.info("Start with: pm2 start %s", args.name)
 
 
+def create_pricing_model(config: Config) -> PricingModel:
+    return PricingModel(config.pricing.storage_tb_month, config.pricing.egress_tb,
+                        config.pricing.repair_audit_tb)
+
+
+async def load_exchange_rates(config: Config, logger, fiat: Optional[str] = None) -> Optional[ExchangeRates]:
+    """Load exchange rates for payout conversion, if available"""
+    rates = ExchangeRates(
+        fiat=fiat or config.currency.fiat,
+        source=config.currency.source,
+        cache_path=data_dir() / 'cache' / 'rates.json',
+        cache_ttl=config.currency.cache_ttl,
+        logger=logger
+    )
+    if not await rates.load():
+        logger.warning("Exchange rates unavailable, showing USD amounts only")
+        return None
+    return rates
+
+
+async def handle_payouts(args, config: Config, logger):
+    """Handle payouts command"""
+    auth = create_auth_manager(config, logger)
+    nodes = await auth.list_nodes()
+    if not nodes:
+        raise NoNodesFound("No registered nodes found")
+    
+    async with create_node_api(config, logger) as node_api:
+        rows = await collect_payouts(nodes, node_api, logger, create_pricing_model(config),
+                                     config.pricing.tolerance)
+    
+    rates = await load_exchange_rates(config, logger, args.currency)
+    summary = summarize_payouts(rows, rates)
+    
+    if args.json:
+        print(json.dumps(summary, indent=2, default=str))
+        if len(rows) < len(nodes):
+            raise PartialSuccess(f"No payout estimate for {len(nodes) - len(rows)} of {len(nodes)} nodes")
+        return
+    
+    fiat = rates.fiat if rates else None
+    
+    def amount(row, key):
+        if 'converted' in row:
+            return format_amount(row['converted'][key], fiat)
+        return f"${row[key]:.2f}"
+    
+    table_rows = [
+        [row['name'] or row['node_id'][:12], amount(row, 'current_month'),
+         amount(row, 'expected_month_end'), amount(row, 'current_month_held'),
+         amount(row, 'previous_month'), amount(row, 'computed_month')]
+        for row in summary['nodes']
+    ]
+    totals = summary['totals']
+    table_rows.append(['TOTAL', amount(totals, 'current_month'), amount(totals, 'expected_month_end'),
+                       amount(totals, 'current_month_held'), amount(totals, 'previous_month'),
+                       amount(totals, 'computed_month')])
+    # Highlight nodes whose estimator disagrees with the pricing model
+    colors = {(i, 5): YELLOW for i, row in enumerate(summary['nodes']) if row['estimator_discrepancy'] is not None}
+    
+    print(format_table(['Node', 'This month', 'Expected', 'Held', 'Last month', 'From usage'], table_rows,
+                       colors=colors))
+    
+    held_rows = [
+        [row['name'] or row['node_id'][:12], entry['satellite'] or (entry['satellite_id'] or '')[:12],
+         str(entry['month']), entry['phase'], f"{entry['held_percent']}%", f"${entry['total_held']:.2f}",
+         'released' if entry['released'] else entry['release_month']]
+        for row in summary['nodes'] for entry in row['held_schedule']
+    ]
+    if held_rows:
+        print()
+        print(format_table(['Node', 'Satellite', 'Month', 'Phase', 'Held', 'Held so far', 'Release'],
+                           held_rows))
+    
+    if len(rows) < len(nodes):
+        raise PartialSuccess(f"No payout estimate for {len(nodes) - len(rows)} of {len(nodes)} nodes")
+
+
+async def handle_report(args, config: Config, logger):
+    """Handle monthly report generation"""
+    try:
+        datetime.strptime(args.month, '%Y-%m')
+    except ValueError:
+        raise UsageError(f"Invalid month {args.month!r}, expected YYYY-MM")
+    
+    # Paystubs are the authoritative earnings for completed months
+    paystubs = {}
+    auth = create_auth_manager(config, logger)
+    nodes = await auth.list_nodes()
+    async with create_node_api(config, logger) as node_api:
+        for node in nodes:
+            stubs = await node_api.get_paystubs(*node_endpoint(node), args.month)
+            if stubs:
+                paystubs[node.get('nodeId', '')] = stubs
+    
+    rates = await load_exchange_rates(config, logger, args.currency)
+    
+    store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    try:
+        report = build_monthly_report(store, args.month, paystubs, rates)
+    finally:
+        store.close()
+    
+    if not report['nodes']:
+        raise NoNodesFound(f"No history or paystubs found for {args.month}")
+    
+    output = args.output or f"storj-report-{args.month}.{args.format}"
+    Path(output).write_text(render_report(report, args.format))
+    logger.info("Wrote %s report for %d nodes to %s", args.month, len(report['nodes']), output)
+
+
+def status_row(metrics: Dict) -> List[str]:
+    """Table cells for one node in status output"""
+    def score(value):
+        return '-' if value is None else f"{value:.3f}"
+    
+    health = metrics.get('health')
+    return [
+        metrics['name'],
+        f"{metrics['status']} (maint.)" if metrics.get('maintenance') else metrics['status'],
+        f"{health['score']:.0f}" if health else '-',
+        metrics.get('version', '-'),
+        format_bytes(metrics.get('used')),
+        format_bytes(metrics.get('allocated')),
+        format_ratio(metrics.get('used_ratio')),
+        score(metrics.get('audit_score')),
+        score(metrics.get('suspension_score')),
+        score(metrics.get('online_score')),
+        format_exit_progress(metrics.get('graceful_exit', [])),
+        format_days_left(metrics.get('disk_forecast')),
+        format_wallet_features(metrics.get('wallet_features')),
+    ]
+
+
+HEALTH_COLORS = {'good': GREEN, 'fair': YELLOW, 'poor': RED}
+
+STATUS_HEADERS = ['Node', 'Status', 'Health', 'Version', 'Used', 'Allocated', 'Used %', 'Audit', 'Suspension', 'Online',
+                  'Graceful exit', 'Full in', 'Payout']
+
+
+def status_colors(row_index: int, metrics: Dict) -> Dict:
+    """Severity colors for one status row"""
+    colors = {}
+    if metrics.get('maintenance'):
+        colors[(row_index, 1)] = YELLOW
+    elif color := status_color(metrics['status']):
+        colors[(row_index, 1)] = color
+    if color := HEALTH_COLORS.get(health_band((metrics.get('health') or {}).get('score'))):
+        colors[(row_index, 2)] = color
+    for col, key in ((7, 'audit_score'), (8, 'suspension_score'), (9, 'online_score')):
+        if color := score_color(metrics.get(key)):
+            colors[(row_index, col)] = color
+    if metrics.get('disk_full_soon'):
+        colors[(row_index, 11)] = YELLOW
+    return colors
+
+
+async def collect_fleet_metrics(node_api: NodeApiClient, nodes: List[Dict]) -> Tuple[List[Dict], int]:
+    """Metrics of every node, and how many did not answer before the --deadline
+    
+    Nodes still being collected when the command has to stop are reported
+    with status TIMEOUT.
+    """
+    tasks = [asyncio.ensure_future(collect_node_metrics(node_api, node)) for node in nodes]
+    left = time_left()
+    if left is None:
+        return list(await asyncio.gather(*tasks)), 0
+    _, pending = await asyncio.wait(tasks, timeout=left)
+    for task in pending:
+        task.cancel()
+    await asyncio.gather(*pending, return_exceptions=True)
+    results = [task.result() if task not in pending else
+               {'node_id': node.get('nodeId', ''), 'name': node_label(node),
+                'address': "%s:%d" % node_endpoint(node), 'reachable': False, 'status': 'TIMEOUT',
+                'error': DeadlineExceeded.kind}
+               for node, task in zip(nodes, tasks)]
+    return results, len(pending)
+
+
+async def watch_pause(interval: float):
+    """Wait for the next refresh of a watch, raising DeadlineExceeded when the --deadline comes first"""
+    left = time_left()
+    if left is not None and left < interval:
+        await asyncio.sleep(left)
+        raise deadline_error("stopped watching")
+    await asyncio.sleep(interval)
+
+
+def check_reachable(unreachable: int, total: int, timed_out: int = 0):
+    """Raise the matching failure class when nodes could not be reached"""
+    if timed_out:
+        raise deadline_error(f"{timed_out} of {total} nodes did not answer before it")
+    if unreachable == total:
+        raise NodeUnreachableError(f"None of the {total} nodes could be reached")
+    if unreachable:
+        raise PartialSuccess(f"{unreachable} of {total} nodes could not be reached")
+
+
+async def handle_status(args, config: Config, logger):
+    """Handle status command"""
+    try:
+        interval = parse_duration(args.interval)
+    except ValueError as e:
+        raise UsageError(str(e))
+    jsonl = args.output_format == 'jsonl'
+    if args.json and jsonl:
+        raise UsageError("--json cannot be combined with --output jsonl")
+    # Streamed events need no terminal to refresh
+    if args.watch and not args.interactive and not jsonl:
+        raise UsageError("--watch needs an interactive terminal")
+    
+    auth = create_auth_manager(config, logger)
+    nodes = await auth.list_nodes()
+    if not nodes:
+        raise NoNodesFound("No registered nodes found")
+    
+    previous: Dict[str, List[str]] = {}
+    store = None
+    if config.history.enabled and config.history_path.exists():
+        store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    
+    try:
+        async with create_node_api(config, logger) as node_api:
+            while True:
+                results, timed_out = await collect_fleet_metrics(node_api, nodes)
+                # Nodes down for maintenance are expected to be unreachable
+                unreachable = sum(1 for metrics in results if not metrics['reachable'] and
+                                  not metrics.get('maintenance') and metrics['status'] != 'TIMEOUT')
+                for metrics in results:
+                    metrics['health'] = health_score(metrics, config.health.weights)
+                
+                if store:
+                    for metrics in results:
+                        forecast = node_forecast(store, metrics['node_id'])
+                        metrics['disk_forecast'] = forecast
+                        metrics['disk_full_soon'] = bool(
+                            forecast and forecast['days_left'] <= config.alerts.disk_full_days)
+                
+                if args.json:
+                    print(json.dumps(results, indent=2, default=str))
+                    check_reachable(unreachable, len(nodes), timed_out)
+                    return
+                
+                rows = [status_row(metrics) for metrics in results]
+                
+                if jsonl:
+                    for metrics, row in zip(results, rows):
+                        if previous.get(metrics['node_id']) != row:
+                            emit('node_status', **metrics)
+                        previous[metrics['node_id']] = row
+                    if not args.watch:
+                        check_reachable(unreachable, len(nodes), timed_out)
+                        return
+                    await watch_pause(interval)
+                    continue
+                
+                # Highlight values that changed since the last refresh
+                highlight = set()
+                colors = {}
+                for row_index, (metrics, row) in enumerate(zip(results, rows)):
+                    before = previous.get(metrics['node_id'])
+                    if before:
+                        highlight.update((row_index, col) for col, cell in enumerate(row) if cell != before[col])
+                    previous[metrics['node_id']] = row
+                    colors.update(status_colors(row_index, metrics))
+                
+                table = format_table(STATUS_HEADERS, rows, highlight, colors)
+                # Nodes paid differently from the rest of the fleet, usually by mistake
+                payout = ''.join(f"\nPayout settings differ: {problem}"
+                                 for problem in payout_inconsistencies(results))
+                if not args.watch:
+                    print(table + payout)
+                    check_reachable(unreachable, len(nodes), timed_out)
+                    return
+                
+                print(f"{CLEAR_SCREEN}Every {args.interval}: {len(nodes)} nodes, "
+                      f"updated {datetime.now().strftime('%H:%M:%S')}\n")
+                print(table + payout, flush=True)
+                await watch_pause(interval)
+    finally:
+        if store:
+            store.close()
+
+
+async def handle_bench(args, config: Config, logger):
+    """Benchmark the dashboard API and every node dashboard"""
+    if args.iterations < 1 or args.concurrency < 1:
+        raise UsageError("--iterations and --concurrency must be ≥ 1")
+    
+    auth = create_auth_manager(config, logger)
+    nodes = await auth.list_nodes()
+    
+    node_urls = [(node_label(node), "http://%s:%d/api/sno" % node_endpoint(node)) for node in nodes]
+    api, node_results = await run_bench(f"{auth.dashboard_url}/auth/me", config.api.token, node_urls,
+                                        args.iterations, args.concurrency, config.api.timeout)
+    
+    cycle = estimate_cycle(api, node_results, config.sync.batch_size)
+    
+    if args.json:
+        print(json.dumps({'api': api, 'nodes': node_results, 'estimated_cycle_seconds': cycle}, indent=2))
+    else:
+        def ms(value):
+            return '-' if value is None else f"{value * 1000:.0f} ms"
+        
+        rows = [[r['target'], f"{r['ok']}/{r['iterations']}", ms(r['p50']), ms(r['p90']), ms(r['p99']),
+                 ms(r['max']), f"{r['requests_per_second'] or 0:.1f}",
+                 format_bytes(r['bytes_per_second']) + '/s']
+                for r in [api] + node_results]
+        print(format_table(['Target', 'OK', 'p50', 'p90', 'p99', 'Max', 'Req/s', 'Throughput'], rows))
+        
+        if cycle is not None:
+            print(f"\nEstimated sync cycle: ~{cycle:.0f}s for {len(nodes)} nodes with "
+                  f"batch_size {config.sync.batch_size} (interval {config.sync.interval:.0f}s)")
+            if cycle > config.sync.interval / 2:
+                print("Consider a larger sync.batch_size or a longer sync.interval.")
+    
+    failed = [r for r in [api] + node_results if not r['ok']]
+    if api in failed:
+        raise NetworkError("The dashboard API did not answer any request")
+    if failed:
+        raise PartialSuccess(f"{len(failed)} of {len(node_results)} nodes did not answer any request")
+
+
+async def handle_doctor(args, config: Config, logger):
+    """Run setup diagnostics against every registered node"""
+    auth = create_auth_manager(config, logger)
+    nodes = await auth.list_nodes()
+    if not nodes:
+        raise NoNodesFound("No registered nodes found")
+    
+    async with create_node_api(config, logger) as node_api:
+        results = await run_checks(nodes, node_api, create_trust_list(config, logger), args.timeout, logger,
+                                   get_server_address(config) if config.network.interface else None)
+    
+    if args.json:
+        print(json.dumps([result.to_dict() for result in results], indent=2, default=str))
+    else:
+        rows = [[result.check, result.node or '-', result.status.upper(), result.message] for result in results]
+        colors = {(i, 2): SEVERITY_COLORS[result.status]
+                  for i, result in enumerate(results) if result.status in SEVERITY_COLORS}
+        print(format_table(['Check', 'Node', 'Result', 'Details'], rows, colors=colors))
+    
+    failed = sum(1 for result in results if result.status == FAIL)
+    warnings = sum(1 for result in results if result.status == WARN)
+    if failed:
+        raise ClientError(f"Doctor found {failed} problems and {warnings} warnings")
+    if warnings:
+        logger.warning("Doctor found %d warnings", warnings)
+
+
+async def handle_check(args, config: Config, logger):
+    """Handle check subcommands"""
+    if args.check_command != 'config':
+        raise UsageError("Specify a check subcommand (see: check --help)")
+    
+    # (label, settings) per linted node
+    targets = []
+    path = Path(args.target).expanduser() if args.target else None
+    if path and path.exists():
+        path = path / 'config.yaml' if path.is_dir() else path
+        try:
+            targets.append((str(path), load_config_file(path)))
+        except (OSError, ValueError, yaml.YAMLError) as e:
+            raise UsageError(f"Cannot read {path}: {e}")
+    else:
+        auth = create_auth_manager(config, logger)
+        nodes = await auth.list_nodes()
+        if args.target:
+            try:
+                node = find_node(nodes, args.target)
+            except ValueError as e:
+                raise UsageError(str(e))
+            if not node:
+                raise UsageError(f"No config file or registered node '{args.target}'")
+            nodes = [node]
+        if not nodes:
+            raise NoNodesFound("No registered nodes found")
+        
+        docker = DockerDiscovery(args.docker_host or config.discovery.docker_host, logger)
+        for node in nodes:
+            settings = {}
+            directory = storage_dir(node)
+            if directory and (directory / 'config.yaml').exists():
+                try:
+                    settings.update(load_config_file(directory / 'config.yaml'))
+                except (OSError, ValueError, yaml.YAMLError) as e:
+                    logger.warning("Cannot read config of %s: %s", node_label(node), e)
+            container = (node.get('config') or {}).get('containerName')
+            attrs = docker.inspect_container(container) if container else None
+            if attrs:
+                # Command line flags take precedence over config.yaml
+                settings.update(container_settings(attrs))
+            if not settings:
+                logger.warning("No config.yaml or container found for %s on this host", node_label(node))
+                continue
+            targets.append((node_label(node), settings))
+    
+    if not targets:
+        raise NoNodesFound("No node configuration found on this host")
+    
+    results = [(label, lint_settings(settings)) for label, settings in targets]
+    if args.json:
+        print(json.dumps([{'node': label, 'summary': lint_summary(findings),
+                           'findings': [f.to_dict() for f in findings]}
+                          for label, findings in results], indent=2))
+    else:
+        for label, findings in results:
+            print(f"{label}: {lint_summary(findings)}")
+            if findings:
+                print(format_table(['Severity', 'Setting', 'Source', 'Problem'],
+                                   [[f.severity.upper(), f.key, f.source or '-', f.message] for f in findings]))
+                print()
+    
+    errors = sum(1 for _, findings in results for f in findings if f.severity == ERROR)
+    if errors:
+        raise ClientError(f"Found {errors} risky settings")
+
+
+def create_telemetry(config: Config, logger) -> Telemetry:
+    return Telemetry(
+        enabled=config.telemetry.enabled,
+        endpoint=config.telemetry_endpoint,
+        state_path=data_dir() / 'telemetry.json',
+        interval=config.telemetry.interval,
+        logger=logger
+    )
+
+
+def create_error_reporter(config: Config, logger) -> ErrorReporter:
+    return ErrorReporter(
+        sentry_dsn=config.errors.sentry_dsn,
+        webhook_url=config.errors.webhook_url,
+        environment=config.errors.environment,
+        timeout=config.errors.timeout,
+        logger=logger
+    )
+
+
+def create_auth_manager(config: Config, logger, account: Optional[Account] = None) -> AuthManager:
+    """Dashboard client for an account, by default the one of api.token"""
+    account = account or Account(DEFAULT_ACCOUNT, config.api.token, config.api.endpoint,
+                                 signing_secret=config.api.signing_secret)
+    return AuthManager(account.token, account.endpoint, logger, account.signer(),
+                       create_field_filter(config), create_pseudonymizer(config, logger),
+                       get_server_address(config), create_annotations(logger))
+
+
+def get_server_address(config: Config) -> Optional[str]:
+    """This server's address, from network.interface or an overlay if configured"""
+    try:
+        return server_address(config.network.interface, prefer_overlay=config.network.prefer_overlay)
+    except ValueError as e:
+        raise ConfigError([f"network.interface: {e}"])
+
+
+def create_server_pool(config: Config, logger) -> ServerPool:
+    try:
+        return load_servers(config.hub.servers, config.hub.failure_threshold, logger)
+    except ValueError as e:
+        raise ConfigError([str(e)])
+
+
+def create_node_api(config: Config, logger) -> NodeApiClient:
+    """Node API client with the connection settings of hub.servers"""
+    return NodeApiClient(logger=logger, endpoints=create_server_pool(config, logger).endpoints())
+
+
+def create_quarantine(logger) -> Quarantine:
+    return Quarantine(data_dir() / 'quarantine.ndjson', logger=logger)
+
+
+def create_annotations(logger) -> NodeAnnotations:
+    return NodeAnnotations(data_dir() / 'annotations.json', logger)
+
+
+def create_error_budget(config: Config, logger) -> ErrorBudget:
+    return ErrorBudget(data_dir() / 'node-budget.json', config.sync.dormant_after, logger)
+
+
+def create_network_status(config: Config) -> Optional[NetworkStatus]:
+    if not config.alerts.status_feed:
+        return None
+    return NetworkStatus(config.alerts.status_feed, config.alerts.status_interval, config.alerts.timeout,
+                         get_logger('alerts'))
+
+
+def create_pseudonymizer(config: Config, logger) -> Optional[Pseudonymizer]:
+    if not config.sync.pseudonymize_node_ids:
+        return None
+    try:
+        return Pseudonymizer(data_dir() / 'pseudonyms.json', logger)
+    except ValueError as e:
+        raise ClientError(f"Cannot pseudonymize node IDs: {e}")
+
+
+def create_local_sinks(config: Config, logger) -> Dict[int, Sink]:
+    """The configured sinks other than the dashboard, by position in sync.sinks"""
+    sinks = {}
+    for i, settings in enumerate(config.sync.sinks):
+        if settings['type'] == 'dashboard':
+            continue
+        try:
+            sinks[i] = create_sink(settings, get_logger('sync'))
+        except (KeyError, ValueError) as e:
+            raise ConfigError([f"sync.sinks[{i}]: {settings['type']} sink needs {e}"])
+    return sinks
+
+
+def account_sinks(config: Config, account: Account, shared: Dict[int, Sink], logger) -> List[Sink]:
+    """Sinks of one account's sync service: its own dashboard sink and the shared ones"""
+    suffix = '' if account.name == DEFAULT_ACCOUNT else f'-{account.name}'
+    sinks = []
+    for i, settings in enumerate(config.sync.sinks):
+        if settings['type'] != 'dashboard':
+            sinks.append(shared[i])
+            continue
+        outbox = Outbox(data_dir() / f'outbox{suffix}.db', config.sync.outbox_limit, logger)
+        sinks.append(create_sink(settings, logger, api_token=account.token, dashboard_url=account.endpoint,
+                                 outbox=outbox, signer=account.signer(),
+                                 max_inflight=config.sync.max_inflight_uploads))
+    return sinks
+
+
+def create_field_filter(config: Config) -> FieldFilter:
+    fields = config.sync.fields or {}
+    return FieldFilter(fields.get('allow'), fields.get('deny'))
+
+
+def create_trust_list(config: Config, logger) -> TrustList:
+    return TrustList(
+        source=config.satellites.trust_source,
+        extra=config.satellites.extra_trusted,
+        cache_path=data_dir() / 'cache' / 'trust.json',
+        cache_ttl=config.satellites.cache_ttl,
+        logger=logger
+    )
+
+
+async def handle_mock_server(args, config: Config, logger):
+    """Serve the mock dashboard until interrupted"""
+    try:
+        host, port = parse_listen(args.listen)
+    except ValueError as e:
+        raise UsageError(f"--listen: {e}")
+    
+    server = MockDashboard(args.accept_token, logger, args.signing_secret)
+    await server.start(host, port)
+    try:
+        await asyncio.Event().wait()
+    finally:
+        await server.stop()
+
+
+async def handle_aggregator(args, config: Config, logger):
+    """Forward agent uploads to the dashboard until interrupted"""
+    settings = config.aggregator
+    missing = [key for key in ('cert', 'key', 'client_ca') if not getattr(settings, key)]
+    if missing:
+        raise ConfigError([f"aggregator.{key} is required" for key in missing])
+    try:
+        host, port = parse_listen(args.listen or settings.listen)
+    except ValueError as e:
+        raise UsageError(f"--listen: {e}")
+    try:
+        ssl_context = server_context(settings.cert, settings.key, settings.client_ca)
+    except ValueError as e:
+        raise ConfigError([f"aggregator: {e}"])
+    
+    aggregator_logger = get_logger('aggregator')
+    account = Account(DEFAULT_ACCOUNT, config.api.token, config.api.endpoint,
+                      signing_secret=config.api.signing_secret)
+    upstream = DashboardSink(account.token, account.endpoint,
+                             Outbox(data_dir() / 'aggregator-outbox.db', config.sync.outbox_limit, aggregator_logger),
+                             account.signer(), max_inflight=config.sync.max_inflight_uploads,
+                             logger=aggregator_logger)
+    aggregator = Aggregator(upstream, settings.dedupe_window, aggregator_logger)
+    try:
+        await aggregator.start(host, port, ssl_context)
+    except OSError as e:
+        raise ClientError(f"Cannot listen on {host}:{port}: {e}")
+    try:
+        await asyncio.Event().wait()
+    finally:
+        await aggregator.stop()
+
+
+def handle_events(args, config: Config, logger):
+    """List node events recorded by the sync daemon"""
+    if args.events_command != 'list':
+        raise UsageError("Specify an events subcommand (see: events --help)")
+    if not config.history.enabled:
+        raise UsageError("The event timeline requires history.enabled")
+    try:
+        since = time.time() - parse_duration(args.since)
+    except ValueError as e:
+        raise UsageError(str(e))
+    if not config.history_path.exists():
+        raise NoNodesFound("No history recorded yet; events are recorded by the sync daemon")
+    
+    store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    try:
+        events = store.events(since, kinds=args.kind)
+    finally:
+        store.close()
+    if args.node:
+        # Names are those at the time of the event, so match them without the dashboard
+        named = [event for event in events if args.node in (event['name'], event['node_id'])]
+        events = named or [event for event in events if event['node_id'].startswith(args.node)]
+        if len({event['node_id'] for event in events}) > 1:
+            raise UsageError(f"Node reference '{args.node}' is ambiguous")
+    
+    if args.json:
+        print(json.dumps(events, indent=2, default=str))
+        return
+    if not events:
+        logger.info("No events since %s", datetime.fromtimestamp(since).strftime('%Y-%m-%d %H:%M'))
+        return
+    print(format_table(
+        ['Time', 'Node', 'Event', 'Details'],
+        [[datetime.fromtimestamp(event['ts']).strftime('%Y-%m-%d %H:%M'), event['name'] or event['node_id'][:12],
+          event['kind'], event['message']] for event in events]
+    ))
+
+
+def handle_diff(args, config: Config, logger):
+    """Compare the fleet at two points in local history"""
+    if not config.history.enabled:
+        raise UsageError("diff requires history.enabled")
+    try:
+        now = time.time()
+        start, end = parse_point(args.start, now), parse_point(args.end, now)
+        window = parse_duration(args.window)
+    except ValueError as e:
+        raise UsageError(str(e))
+    if start >= end:
+        raise UsageError("--from must be earlier than --to")
+    if not config.history_path.exists():
+        raise NoNodesFound("No history recorded yet; samples are recorded by the sync daemon")
+    
+    store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    try:
+        before = store.latest_samples(start, window)
+        after = store.latest_samples(end, window)
+        events = [event for event in store.events(start) if event['ts'] <= end]
+    finally:
+        store.close()
+    for label, point, samples in (('--from', start, before), ('--to', end, after)):
+        if not samples:
+            logger.warning("No samples within %s before %s (%s); was the sync daemon running?",
+                           args.window, format_point(point), label)
+    if not before and not after:
+        raise NoNodesFound("No samples at either point in time")
+    diff = fleet_diff(before, after, events, args.all)
+    
+    if args.json:
+        print(json.dumps({'from': start, 'to': end, **diff}, indent=2, default=str))
+        return
+    
+    used_delta = diff['disk_used_after'] - diff['disk_used_before']
+    print(f"Fleet from {format_point(start)} to {format_point(end)}")
+    print(f"Nodes: {diff['nodes_before']} → {diff['nodes_after']} "
+          f"({len(diff['added'])} added, {len(diff['removed'])} removed)")
+    print(f"Used space: {format_bytes(diff['disk_used_before'])} → {format_bytes(diff['disk_used_after'])} "
+          f"({'+' if used_delta >= 0 else '-'}{format_bytes(abs(used_delta))})")
+    print(f"Events: {diff['events']}")
+    for title, rows in (('Added', diff['added']), ('Removed', diff['removed'])):
+        if rows:
+            print(f"\n{title}:")
+            print(format_table(['Node', 'Status', 'Version', 'Used'],
+                               [[row['name'] or row['node_id'][:12], row['status'], row['version'] or '-',
+                                 format_bytes(row['disk_used'])] for row in rows]))
+    if diff['changed']:
+        print("\nChanged:")
+        print(format_table(
+            ['Node', 'Status', 'Used', 'Changes', 'Events'],
+            [[row['name'] or row['node_id'][:12], row['status'],
+              ('+' if row['disk_used_delta'] >= 0 else '-') + format_bytes(abs(row['disk_used_delta'])),
+              '; '.join(f"{key} {change['from']} → {change['to']}" if isinstance(change['from'], str)
+                        else f"{key} {change['from']:.3f} → {change['to']:.3f}"
+                        for key, change in row['changes'].items()) or '-',
+              ', '.join(event['kind'] for event in row['events']) or '-'] for row in diff['changed']]
+        ))
+    elif not diff['added'] and not diff['removed']:
+        print("\nNo status, version or score changes and no events")
+
+
+def handle_quarantine(args, config: Config, logger):
+    """List or clear samples quarantined by the sync daemon"""
+    if args.quarantine_command not in ('list', 'clear'):
+        raise UsageError("Specify a quarantine subcommand (see: quarantine --help)")
+    quarantine = create_quarantine(logger)
+    entries = quarantine.entries()
+    node_id = None
+    if args.node:
+        matches = ({entry['node_id'] for entry in entries if args.node == entry['name']} or
+                   {entry['node_id'] for entry in entries if (entry['node_id'] or '').startswith(args.node)})
+        if len(matches) > 1:
+            raise UsageError(f"Node reference '{args.node}' is ambiguous")
+        if not matches:
+            raise NoNodesFound(f"No quarantined samples of node '{args.node}'")
+        node_id = matches.pop()
+        entries = quarantine.entries(node_id)
+    
+    if args.quarantine_command == 'clear':
+        try:
+            removed = quarantine.clear(node_id)
+        except ValueError as e:
+            raise ClientError(str(e))
+        logger.info("Removed %d quarantined samples", removed)
+        return
+    if args.json:
+        print(json.dumps(entries, indent=2, default=str))
+        return
+    if not entries:
+        logger.info("No quarantined samples")
+        return
+    print(format_table(
+        ['Time', 'Node', 'Problems'],
+        [[datetime.fromtimestamp(entry['time']).strftime('%Y-%m-%d %H:%M'),
+          entry['name'] or (entry['node_id'] or '')[:12], '; '.join(entry['problems'])] for entry in entries]
+    ))
+
+
+def handle_ctl(args, config: Config, logger):
+    """Send a command to the running sync daemon"""
+    if args.ctl_command != 'sync-now':
+        raise UsageError("Specify a ctl subcommand (see: ctl --help)")
+    if SYNC_NOW_SIGNAL is None:
+        raise ClientError("ctl sync-now needs signals, which this platform does not support")
+    try:
+        pid = signal_daemon(data_dir() / 'sync.pid', SYNC_NOW_SIGNAL)
+    except ValueError as e:
+        raise ClientError(f"Cannot reach the sync daemon: {e}")
+    except OSError as e:
+        raise ClientError(f"Cannot signal the sync daemon: {e}")
+    logger.info("Asked the sync daemon (PID %d) to sync now", pid)
+
+
+def handle_telemetry(args, config: Config, logger):
+    """Handle telemetry subcommands"""
+    if args.telemetry_command != 'show':
+        raise UsageError("Specify a telemetry subcommand (see: telemetry --help)")
+    
+    telemetry = create_telemetry(config, logger)
+    print(f"Telemetry: {telemetry_status(config.telemetry.enabled)}")
+    print(f"Endpoint:  {config.telemetry_endpoint}")
+    print("Next report payload:")
+    print(json.dumps(telemetry.payload(), indent=2))
+
+
+def handle_config(args, config: Config, logger):
+    """Handle config subcommands"""
+    if args.config_command in ('encrypt', 'decrypt', 'encrypt-value'):
+        handle_config_encryption(args, config, logger)
+        return
+    if args.config_command != 'env':
+        raise UsageError("Specify a config subcommand (see: config --help)")
+    
+    def display(key, value):
+        if value is None:
+            return ''
+        if key in SECRET_KEYS and value:
+            return value[:4] + '…'
+        return str(value)
+    
+    entries = []
+    for env_var, key in ENV_VARS:
+        entries.append({
+            'variable': env_var,
+            'key': key,
+            'value': display(key, config.get(key)),
+            'source': config.source_of(key),
+            'set': env_var in os.environ,
+        })
+    for env_var, resolve in EXTRA_ENV_VARS.items():
+        entries.append({
+            'variable': env_var,
+            'key': None,
+            'value': resolve(),
+            'source': 'env' if os.getenv(env_var) else 'default',
+            'set': env_var in os.environ,
+        })
+    
+    if args.json:
+        print(json.dumps({'config_file': config.config_file, 'variables': entries}, indent=2))
+        return
+    
+    print(f"Config file: {config.config_file or '(none)'}\n")
+    rows = [[e['variable'], e['key'] or '-', e['value'], e['source']] for e in entries]
+    print(format_table(['Variable', 'Config key', 'Resolved value', 'Source'], rows))
+
+
+def handle_config_encryption(args, config: Config, logger):
+    """Encrypt or decrypt the config file's secret values, or encrypt a single value"""
+    mode = PASSPHRASE if getattr(args, 'passphrase', False) else MACHINE
+    if mode == PASSPHRASE and not os.getenv(PASSPHRASE_ENV):
+        if not args.interactive:
+            raise UsageError(f"Set {PASSPHRASE_ENV} to encrypt with a passphrase non-interactively")
+        passphrase = prompt_secret("Passphrase: ")
+        if not passphrase or prompt_secret("Repeat the passphrase: ") != passphrase:
+            raise UsageError("The passphrases are empty or do not match")
+        config.keys.passphrase = passphrase
+    
+    if args.config_command == 'encrypt-value':
+        value = prompt_secret("Value to encrypt: ") if args.interactive else sys.stdin.readline().strip()
+        if not value:
+            raise UsageError("Nothing to encrypt")
+        try:
+            print(config.keys.encrypt(value, mode))
+        except ValueError as e:
+            raise ClientError(f"Cannot encrypt: {e}")
+        return
+    
+    if not config.config_file:
+        raise UsageError("No config file to update (see: config env)")
+    try:
+        data = yaml.safe_load(Path(config.config_file).read_text()) or {}
+    except (OSError, yaml.YAMLError) as e:
+        raise ConfigError([f"cannot read {config.config_file}: {e}"])
+    
+    changed = []
+    for key in SECRET_KEYS:
+        section, name = key.split('.')
+        raw = (data.get(section) or {}).get(name)
+        if not isinstance(raw, str) or not raw:
+            continue
+        if args.config_command == 'encrypt' and not is_encrypted(raw):
+            try:
+                value = config.keys.encrypt(raw, mode)
+            except ValueError as e:
+                raise ClientError(f"Cannot encrypt {key}: {e}")
+        elif args.config_command == 'decrypt' and is_encrypted(raw):
+            # Decrypted when the config was loaded
+            value = decrypt_tree(raw, config.keys)[0]
+        else:
+            continue
+        write_config_value(config.config_file, key, value)
+        changed.append(key)
+    
+    verb = 'Encrypted' if args.config_command == 'encrypt' else 'Decrypted'
+    if changed:
+        logger.info("%s %s in %s", verb, ', '.join(changed), config.config_file)
+    else:
+        logger.info("No %s secret values in %s", 'plaintext' if args.config_command == 'encrypt' else 'encrypted',
+                    config.config_file)
+    if args.config_command == 'encrypt':
+        for key, fields in SECRET_ENTRY_KEYS.items():
+            section, name = key.split('.')
+            for index, entry in enumerate((data.get(section) or {}).get(name) or []):
+                for secret in fields:
+                    value = entry.get(secret) if isinstance(entry, dict) else None
+                    if isinstance(value, str) and value and not is_encrypted(value):
+                        logger.warning("%s[%d].%s is still in plaintext; replace it with the output of "
+                                       "'config encrypt-value'", key, index, secret)
+        if mode == MACHINE and changed:
+            logger.info("The values can only be decrypted with %s; back it up, or use --passphrase",
+                        config.keys.machine_key)
+
+
+async def handle_nodes(args, config: Config, logger):
+    """Handle node subcommands"""
+    if args.nodes_command == 'compare':
+        await handle_nodes_compare(args, config, logger)
+    elif args.nodes_command == 'remove':
+        await handle_nodes_remove(args, config, logger)
+    elif args.nodes_command in ('rename', 'annotate'):
+        await handle_nodes_annotate(args, config, logger)
+    elif args.nodes_command == 'maintenance':
+        await handle_nodes_maintenance(args, config, logger)
+    elif args.nodes_command in ('dormant', 'reactivate'):
+        handle_nodes_dormant(args, config, logger)
+    else:
+        raise UsageError("Specify a nodes subcommand (see: nodes --help)")
+
+
+async def handle_nodes_remove(args, config: Config, logger):
+    """Remove nodes that discovery no longer finds"""
+    if not args.stale:
+        raise UsageError("Specify which nodes to remove (--stale)")
+    if not config.history.enabled:
+        raise UsageError("Stale node tracking requires history.enabled")
+    try:
+        older_than = parse_duration(args.older_than)
+    except ValueError as e:
+        raise UsageError(str(e))
+    
+    store = HistoryStore(config.history_path, config.history.retention_days, logger)
+    try:
+        stale = store.stale_nodes(older_than)
+        if not stale:
+            logger.info("No stale nodes")
+            return
+        
+        now = time.time()
+        print(format_table(
+            ['Node', 'Node ID', 'Address', 'Last seen'],
+            [[node['name'] or '-', node['node_id'][:12], f"{node['address']}:{node['dashboard_port']}",
+              f"{format_age(now - node['last_seen'])} ago"] for node in stale]
+        ))
+        
+        if read_only():
+            raise ReadOnlyError("Read-only mode: not removing stale nodes from the dashboard")
+        if not args.yes:
+            if not args.interactive:
+                raise UsageError("Pass --yes to remove stale nodes without confirmation")
+            if not confirm(f"Remove {len(stale)} stale node(s) from the dashboard?"):
+                return
+        
+        auth = create_auth_manager(config, logger)
+        for node in stale:
+            if not await auth.remove_node(node['node_id']):
+                logger.info("Node %s was not registered with the dashboard", node['node_id'][:8])
+            store.forget_node(node['node_id'])
+        logger.info("Removed %d stale node(s)", len(stale))
+    finally:
+        store.close()
+
+
+async def handle_nodes_compare(args, config: Config, logger):
+    """Show configuration and performance of two nodes side by side"""
+    auth = create_auth_manager(config, logger)
+    selected = [await find_registered_node(auth, ref) for ref in (args.node_a, args.node_b)]
+    
+    async with create_node_api(config, logger) as node_api:
+        a, b = await asyncio.gather(*(collect_node_metrics(node_api, node) for node in selected))
+    
+    unreachable = sum(1 for metrics in (a, b) if not metrics['reachable'])
+    
+    if args.json:
+        print(json.dumps([a, b], indent=2, default=str))
+        check_reachable(unreachable, 2)
+        return
+    
+    for metrics in (a, b):
+        if not metrics['reachable']:
+            logger.warning("Node %s (%s) is not reachable", metrics['name'], metrics['address'])
+    
+    def score(value):
+        return '-' if value is None else f"{value:.4f}"
+    
+    def difference(key):
+        # Relative difference of B against A for numeric metrics
+        va, vb = a.get(key), b.get(key)
+        if not isinstance(va, (int, float)) or not isinstance(vb, (int, float)) or not va:
+            return ''
+        return f"{(vb - va) / va * 100:+.1f}%"
+    
+    rows = [
+        ['Node ID', a['node_id'][:12], b['node_id'][:12], ''],
+        ['Address', a['address'], b['address'], ''],
+        ['Version', a.get('version', '-'), b.get('version', '-'),
+         '' if a.get('version') == b.get('version') else 'differs'],
+        ['Allocated', format_bytes(a.get('allocated')), format_bytes(b.get('allocated')), difference('allocated')],
+        ['Used', format_bytes(a.get('used')), format_bytes(b.get('used')), difference('used')],
+        ['Used %', format_ratio(a.get('used_ratio')), format_ratio(b.get('used_ratio')), ''],
+        ['Trash', format_bytes(a.get('trash')), format_bytes(b.get('trash')), difference('trash')],
+        ['Audit score', score(a.get('audit_score')), score(b.get('audit_score')), difference('audit_score')],
+        ['Suspension score', score(a.get('suspension_score')), score(b.get('suspension_score')),
+         difference('suspension_score')],
+        ['Online score', score(a.get('online_score')), score(b.get('online_score')), difference('online_score')],
+        ['Satellites', a.get('satellites', '-'), b.get('satellites', '-'), ''],
+        ['Ingress (month)', format_bytes(a.get('ingress_month')), format_bytes(b.get('ingress_month')),
+         difference('ingress_month')],
+        ['Egress (month)', format_bytes(a.get('egress_month')), format_bytes(b.get('egress_month')),
+         difference('egress_month')],
+        ['Egress per TB stored', format_bytes(a.get('egress_per_tb')), format_bytes(b.get('egress_per_tb')),
+         difference('egress_per_tb')],
+    ]
+    colors = {}
+    for row_index, key in ((7, 'audit_score'), (8, 'suspension_score'), (9, 'online_score')):
+        for col, metrics in ((1, a), (2, b)):
+            if color := score_color(metrics.get(key)):
+                colors[(row_index, col)] = color
+    
+    print(format_table(['Metric', a['name'], b['name'], 'B vs A'], rows, colors=colors))
+    check_reachable(unreachable, 2)
+
+
+async def find_registered_node(auth: AuthManager, ref: str) -> Dict:
+    """A registered node by reference; UsageError if there is no single match"""
+    nodes = await auth.list_nodes()
+    try:
+        node = find_node(nodes, ref)
+    except ValueError as e:
+        raise UsageError(str(e))
+    if not node:
+        raise UsageError(f"Node '{ref}' not found among {len(nodes)} registered nodes")
+    return node
+
+
+async def handle_nodes_annotate(args, config: Config, logger):
+    """Set a node's nickname, notes or metadata, or show them"""
+    auth = create_auth_manager(config, logger)
+    node = await find_registered_node(auth, args.node)
+    
+    annotations = auth.annotations
+    node_id = node['nodeId']
+    try:
+        if args.nodes_command == 'rename':
+            annotations.rename(node_id, args.nickname)
+            if args.nickname:
+                logger.info("Node %s is now called %s", node_id[:12], args.nickname.strip())
+            else:
+                logger.info("Removed the nickname of node %s", node_id[:12])
+            return
+        if args.note is not None or args.set or args.unset:
+            annotations.annotate(node_id, args.note, parse_metadata(args.set), args.unset)
+    except ValueError as e:
+        raise UsageError(str(e))
+    
+    entry = annotations.get(node_id)
+    if args.json:
+        print(json.dumps({'node_id': node_id, **entry}, indent=2))
+        return
+    rows = [['Node ID', node_id], ['Nickname', entry['nickname'] or '-'], ['Notes', entry['notes'] or '-']]
+    rows.extend([f"metadata.{key}", value] for key, value in sorted(entry['metadata'].items()))
+    print(format_table(['Field', 'Value'], rows))
+
+
+async def handle_nodes_maintenance(args, config: Config, logger):
+    """Start or end a node's maintenance window, or show it"""
+    auth = create_auth_manager(config, logger)
+    node = await find_registered_node(auth, args.node)
+    annotations = auth.annotations
+    node_id = node['nodeId']
+    
+    try:
+        if args.end:
+            if annotations.end_maintenance(node_id):
+                logger.info("Ended maintenance of node %s", node_label(node))
+            else:
+                logger.info("Node %s is not under maintenance", node_label(node))
+            return
+        if args.duration:
+            try:
+                duration = parse_duration(args.duration)
+            except ValueError as e:
+                raise UsageError(str(e))
+            if duration <= 0:
+                raise UsageError("--for must be longer than 0s")
+            window = annotations.start_maintenance(node_id, duration, args.reason)
+            logger.info("Node %s is under maintenance until %s; its alerts are silenced", node_label(node),
+                        datetime.fromtimestamp(window['until']).strftime('%Y-%m-%d %H:%M'))
+            return
+    except ValueError as e:
+        raise ClientError(f"Cannot save maintenance: {e}")
+    
+    if args.reason:
+        raise UsageError("--reason needs --for")
+    window = annotations.maintenance(node_id)
+    if not window:
+        print(f"Node {node_label(node)} is not under maintenance")
+        return
+    print(f"Node {node_label(node)} is under maintenance until "
+          f"{datetime.fromtimestamp(window['until']).strftime('%Y-%m-%d %H:%M')} "
+          f"({format_age(window['until'] - time.time())} left)"
+          + (f": {window['reason']}" if window['reason'] else ''))
+
+
+def handle_nodes_dormant(args, config: Config, logger):
+    """List the nodes the error budget backs off from, or reactivate them"""
+    budget = create_error_budget(config, logger)
+    failing = budget.failing()
+    
+    if args.nodes_command == 'reactivate':
+        if args.all:
+            nodes = [entry for entry in failing if budget.backing_off(entry['nodeId'])]
+        else:
+            try:
+                node = find_node(failing, args.node)
+            except ValueError as e:
+                raise UsageError(str(e))
+            if not node or not budget.backing_off(node['nodeId']):
+                raise UsageError(f"Node '{args.node}' is neither dormant nor backing off")
+            nodes = [node]
+        for node in nodes:
+            budget.reactivate(node['nodeId'])
+            logger.info("Reactivated node %s; it is polled every cycle again", node_label(node))
+        if not nodes:
+            logger.info("No dormant or backing-off nodes")
+        return
+    
+    if args.json:
+        print(json.dumps(failing, indent=2))
+        return
+    if not failing:
+        print("No node has failed its recent polls")
+        return
+    now = time.time()
+    rows = []
+    for entry in failing:
+        polled = 'never (dormant)' if entry['dormant'] else 'every cycle'
+        if not entry['dormant'] and backoff_cycles(entry['failures']) > 1:
+            polled = f"every {backoff_cycles(entry['failures'])} cycles"
+        rows.append([node_label(entry), str(entry['failures']), format_age(now - entry['since']), polled])
+    print(format_table(['Node', 'Failed polls', 'Failing for', 'Polled'], rows))
+    if any(entry['dormant'] for entry in failing):
+        print("\nReactivate a dormant node with: nodes reactivate NODE (or --all)")
+
+
 async def handle_auth(args, config: Config, logger):
     """Handle auth testing"""
     logger.info("Testing authentication...")
@@ -226,8 +2249,110 @@ async def handle_auth(args, config: Config, logger):
         logger.info("User: %s", user_info.get('email', 'Unknown'))
         logger.info("Permissions: %s", ', '.join(user_info.get('permissions', [])))
     else:
-        logger.error("Authentication failed")
-        sys.exit(1)
+        raise AuthError("Authentication failed")
+
+
+async def handle_whoami(args, config: Config, logger):
+    """Show the account, scopes and limits of the API token"""
+    auth = AuthManager(config.api.token, config.api.endpoint)
+    user_info = await auth.test_token()
+    if not user_info:
+        raise AuthError("Authentication failed")
+    
+    token = user_info.get('token') or {}
+    info = {
+        'email': user_info.get('email'),
+        'account': user_info.get('account') or user_info.get('name'),
+        'endpoint': config.api.endpoint,
+        'token': token.get('name') or config.api.token[:4] + '…',
+        'token_source': config.source_of('api.token'),
+        'scopes': token.get('scopes') or user_info.get('scopes') or user_info.get('permissions') or [],
+        'expires': token.get('expiresAt'),
+        'limits': user_info.get('limits') or ((await auth.get_quota()) or {}).get('limits') or {},
+    }
+    if args.json:
+        print(json.dumps(info, indent=2, default=str))
+        return
+    
+    rows = [
+        ['Email', info['email'] or '-'],
+        ['Account', info['account'] or '-'],
+        ['Dashboard', info['endpoint']],
+        ['Token', f"{info['token']} (from {info['token_source']})"],
+        ['Scopes', ', '.join(info['scopes']) or '-'],
+        ['Expires', info['expires'] or 'never'],
+    ]
+    rows += [[f"Limit: {name.replace('_', ' ')}", str(value)] for name, value in sorted(info['limits'].items())]
+    print(format_table(['Field', 'Value'], rows))
+
+
+async def handle_quota(args, config: Config, logger):
+    """Show the account's limits, usage and the limits it is close to"""
+    auth = AuthManager(config.api.token, config.api.endpoint, logger)
+    quota = await auth.get_quota()
+    if quota is None:
+        raise ClientError("The dashboard does not report account limits")
+    
+    if args.json:
+        print(json.dumps(quota, indent=2, default=str))
+    else:
+        rows = [[row['label'], '-' if row['used'] is None else str(row['used']), str(row['max']),
+                 format_ratio(row['share'])] for row in quota_rows(quota)]
+        print(format_table(['Limit', 'Used', 'Max', 'Used %'], rows))
+    for warning in quota_warnings(quota):
+        logger.warning("Close to account limit: %s", warning)
+
+
+async def handle_logout(args, config: Config, logger):
+    """Revoke the API token and remove it from the config file"""
+    auth = AuthManager(config.api.token, config.api.endpoint, logger)
+    if await auth.revoke_token():
+        logger.info("Token revoked")
+    else:
+        logger.warning("The token was already invalid")
+    
+    source = config.source_of('api.token')
+    if source == 'file':
+        write_config_value(config.config_file, 'api.token', None)
+        logger.info("Token removed from %s", config.config_file)
+    else:
+        logger.warning("The token is set by %s; remove it there too", source)
+
+
+async def handle_token(args, config: Config, logger):
+    """Handle token subcommands"""
+    if args.token_command != 'rotate':
+        raise UsageError("Specify a token subcommand (see: token --help)")
+    
+    source = config.source_of('api.token')
+    if source != 'file':
+        raise UsageError(f"api.token is set by {source}; token rotate updates the config file, "
+                         "so keep the token there")
+    
+    old = AuthManager(config.api.token, config.api.endpoint, logger)
+    if not await old.test_token():
+        raise AuthError("The current token is not valid")
+    
+    issued = await old.create_token(args.name or f"storjcloud-client@{socket.gethostname()}")
+    new = AuthManager(issued['token'], config.api.endpoint, logger)
+    if not await new.test_token():
+        raise AuthError("The new token failed verification; the current token is unchanged")
+    
+    try:
+        write_config_value(config.config_file, 'api.token', config.sealed('api.token', issued['token']))
+    except (OSError, ConfigError):
+        # Do not leave an unused token behind
+        await new.revoke_token()
+        raise
+    logger.info("New token written to %s", config.config_file)
+    
+    if args.keep_old:
+        logger.info("The old token stays valid (--keep-old)")
+    elif await old.revoke_token():
+        logger.info("Old token revoked")
+    else:
+        logger.warning("The old token was already invalid")
+    logger.info("Run install-service again if the PM2 service was installed with the old token")
 
 
 if __name__ == '__main__':